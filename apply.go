@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// placement is a set of outputs written into one directory of a project.
+type placement struct {
+	// Dir is relative to the project root.
+	Dir        string
+	Dimensions []imageprocessor.Dimension
+	// Files are written alongside the outputs, e.g. an asset catalog's Contents.json.
+	Files map[string][]byte
+}
+
+// project is a detected project type and where its icons live.
+type project struct {
+	Type       string
+	Placements []placement
+	Warnings   []string
+}
+
+// detectors recognize project types from the layout of a directory. Each
+// returns nil when the directory is not a project of its type.
+var detectors = []func(root string) (*project, error){
+	detectTauri,
+	detectFlutter,
+	detectAndroid,
+	detectXcode,
+	detectElectron,
+	detectWeb,
+}
+
+// runApply detects the project types of a target directory and writes the
+// generated icons into the locations each type expects. Replaced files are
+// backed up under .logo-generator-backup in the target.
+func runApply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	input := fs.String("input", "", "path to the source image")
+	target := fs.String("target", ".", "project directory to write the icons into")
+	types := fs.String("types", "", "comma separated project types to apply instead of detecting them: tauri, flutter, android, xcode, electron, web")
+	dryRun := fs.Bool("dry-run", false, "print the files that would be written without writing them")
+	options := processorFlags(fs)
+	logs := loggingFlags(fs)
+	fs.Parse(args)
+
+	if *input == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator apply -input <path_to_image> [-target <dir>]")
+	}
+
+	projects, err := detectProjects(*target)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	switch {
+	case *types != "":
+		projects = selectProjects(projects, strings.Split(*types, ","))
+	case len(projects) > 1 && projects[len(projects)-1].Type == "web":
+		// A web front end inside an app project ships the app's icons, not favicons
+		projects = projects[:len(projects)-1]
+	}
+	if len(projects) == 0 {
+		log.Fatalf("Error: no supported project found in %s\n", *target)
+	}
+
+	for _, p := range projects {
+		fmt.Printf("Detected %s project\n", p.Type)
+		for _, w := range p.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+	}
+	if *dryRun {
+		for _, p := range projects {
+			for _, pl := range p.Placements {
+				for _, dim := range pl.Dimensions {
+					fmt.Printf("  %s %dx%d\n", filepath.Join(*target, pl.Dir, dim.Name), dim.Width, dim.Height)
+				}
+				for name := range pl.Files {
+					fmt.Printf("  %s\n", filepath.Join(*target, pl.Dir, name))
+				}
+			}
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logger, closeLog := logs.logger(slog.LevelWarn)
+	defer closeLog()
+	ctx = imageprocessor.WithLogger(ctx, logger)
+
+	// Generate into a scratch directory first so a failed run leaves the project untouched
+	workDir, err := os.MkdirTemp("", "logo-generator-apply-")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	var writes []pendingWrite
+	for i, p := range projects {
+		for j, pl := range p.Placements {
+			outDir := filepath.Join(workDir, fmt.Sprintf("%d-%d", i, j))
+			result, err := imageprocessor.ProcessImage(ctx, *input, outDir, pl.Dimensions, options())
+			if err != nil {
+				log.Fatalf("Error: %s: %v\n", p.Type, err)
+			}
+			for _, out := range result.Outputs {
+				writes = append(writes, pendingWrite{from: out.Path, to: filepath.Join(pl.Dir, out.Dimension.Name)})
+			}
+			for name, data := range pl.Files {
+				writes = append(writes, pendingWrite{data: data, to: filepath.Join(pl.Dir, name)})
+			}
+		}
+	}
+
+	backupDir := filepath.Join(*target, ".logo-generator-backup", time.Now().Format("20060102-150405"))
+	counts := map[string]int{}
+	for _, w := range writes {
+		state, err := w.apply(*target, backupDir)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		counts[state]++
+		if !logs.quiet {
+			fmt.Printf("  %-9s %s\n", state, filepath.Join(*target, w.to))
+		}
+	}
+
+	if !logs.quiet {
+		fmt.Printf("Applied %d files: %d created, %d replaced, %d unchanged\n", len(writes), counts["created"], counts["replaced"], counts["unchanged"])
+		if counts["replaced"] > 0 {
+			fmt.Println("Replaced files were backed up to", backupDir)
+		}
+	}
+}
+
+// detectProjects runs every detector against root.
+func detectProjects(root string) ([]*project, error) {
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	var projects []*project
+	for _, detect := range detectors {
+		p, err := detect(root)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			projects = append(projects, p)
+		}
+	}
+	return projects, nil
+}
+
+// selectProjects keeps the projects of the given types, failing when one of
+// them was not detected.
+func selectProjects(projects []*project, types []string) []*project {
+	var selected []*project
+	for _, p := range projects {
+		if slices.Contains(types, p.Type) {
+			selected = append(selected, p)
+		}
+	}
+	for _, t := range types {
+		if !slices.ContainsFunc(selected, func(p *project) bool { return p.Type == t }) {
+			log.Fatalf("Error: no %s project found in the target directory\n", t)
+		}
+	}
+	return selected
+}
+
+// pendingWrite copies a generated file, or writes data, to a path relative
+// to the project root.
+type pendingWrite struct {
+	from string
+	data []byte
+	to   string
+}
+
+// apply writes the file, first copying any different file at the
+// destination into backupDir. It reports whether the file was created,
+// replaced or left unchanged.
+func (w pendingWrite) apply(root, backupDir string) (string, error) {
+	data := w.data
+	if w.from != "" {
+		var err error
+		if data, err = os.ReadFile(w.from); err != nil {
+			return "", err
+		}
+	}
+
+	dst := filepath.Join(root, w.to)
+	state := "created"
+	if old, err := os.ReadFile(dst); err == nil {
+		if bytes.Equal(old, data) {
+			return "unchanged", nil
+		}
+		backup := filepath.Join(backupDir, w.to)
+		if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", dst, err)
+		}
+		if err := os.WriteFile(backup, old, 0644); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", dst, err)
+		}
+		state = "replaced"
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return state, nil
+}
+
+// exists reports whether the path relative to root exists.
+func exists(root string, rel ...string) bool {
+	_, err := os.Stat(filepath.Join(append([]string{root}, rel...)...))
+	return err == nil
+}
+
+// fileContains reports whether the file relative to root contains s.
+func fileContains(root, rel, s string) bool {
+	data, err := os.ReadFile(filepath.Join(root, rel))
+	return err == nil && bytes.Contains(data, []byte(s))
+}
+
+// detectTauri finds the icons directory of a Tauri app.
+func detectTauri(root string) (*project, error) {
+	if !exists(root, "src-tauri", "tauri.conf.json") {
+		return nil, nil
+	}
+	return &project{Type: "tauri", Placements: []placement{
+		{Dir: filepath.Join("src-tauri", "icons"), Dimensions: imageprocessor.DefaultDimensions},
+	}}, nil
+}
+
+// detectFlutter finds the platform folders of a Flutter app.
+func detectFlutter(root string) (*project, error) {
+	if !fileContains(root, "pubspec.yaml", "flutter") {
+		return nil, nil
+	}
+	p := &project{Type: "flutter"}
+	if res := filepath.Join("android", "app", "src", "main", "res"); exists(root, res) {
+		p.Placements = append(p.Placements, androidPlacements(root, res, &p.Warnings)...)
+	}
+	if set := filepath.Join("ios", "Runner", "Assets.xcassets", "AppIcon.appiconset"); exists(root, set) {
+		pl, err := appIconPlacement(root, set)
+		if err != nil {
+			return nil, err
+		}
+		p.Placements = append(p.Placements, pl)
+	}
+	if exists(root, "web") {
+		p.Placements = append(p.Placements,
+			placement{Dir: "web", Dimensions: []imageprocessor.Dimension{{Width: 32, Height: 32, Name: "favicon.png"}}},
+			placement{Dir: filepath.Join("web", "icons"), Dimensions: []imageprocessor.Dimension{
+				{Width: 192, Height: 192, Name: "Icon-192.png"},
+				{Width: 512, Height: 512, Name: "Icon-512.png"},
+			}},
+		)
+	}
+	return p, nil
+}
+
+// detectAndroid finds the resources of the app module of a Gradle project.
+func detectAndroid(root string) (*project, error) {
+	gradle := exists(root, "settings.gradle") || exists(root, "settings.gradle.kts")
+	res := filepath.Join("app", "src", "main", "res")
+	if !gradle || !exists(root, res) {
+		return nil, nil
+	}
+	p := &project{Type: "android"}
+	p.Placements = androidPlacements(root, res, &p.Warnings)
+	return p, nil
+}
+
+// androidDensities maps the launcher icon density buckets to their sizes.
+var androidDensities = []struct {
+	Dir  string
+	Size uint
+}{
+	{"mipmap-mdpi", 48},
+	{"mipmap-hdpi", 72},
+	{"mipmap-xhdpi", 96},
+	{"mipmap-xxhdpi", 144},
+	{"mipmap-xxxhdpi", 192},
+}
+
+// androidPlacements writes the legacy launcher icon into every density
+// bucket of an Android res directory.
+func androidPlacements(root, res string, warnings *[]string) []placement {
+	if exists(root, res, "mipmap-anydpi-v26", "ic_launcher.xml") {
+		*warnings = append(*warnings, "the project defines an adaptive launcher icon in mipmap-anydpi-v26, which Android 8 and later use instead of the generated PNGs")
+	}
+	var placements []placement
+	for _, d := range androidDensities {
+		placements = append(placements, placement{
+			Dir:        filepath.Join(res, d.Dir),
+			Dimensions: []imageprocessor.Dimension{{Width: d.Size, Height: d.Size, Name: "ic_launcher.png"}},
+		})
+	}
+	return placements
+}
+
+// detectXcode finds the app icon set of an Xcode project, skipping hidden
+// directories, including backups made by apply, dependencies and build
+// products.
+func detectXcode(root string) (*project, error) {
+	projects, _ := filepath.Glob(filepath.Join(root, "*.xcodeproj"))
+	if len(projects) == 0 {
+		return nil, nil
+	}
+
+	var set string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root && (strings.HasPrefix(d.Name(), ".") || slices.Contains([]string{"Pods", "node_modules", "build", "DerivedData"}, d.Name())) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && d.Name() == "AppIcon.appiconset" {
+			set, _ = filepath.Rel(root, path)
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if set == "" {
+		return &project{Type: "xcode", Warnings: []string{"no AppIcon.appiconset found in the Xcode project"}}, nil
+	}
+
+	pl, err := appIconPlacement(root, set)
+	if err != nil {
+		return nil, err
+	}
+	return &project{Type: "xcode", Placements: []placement{pl}}, nil
+}
+
+// appIconContents is the Contents.json of an asset catalog icon set.
+type appIconContents struct {
+	Images []appIconImage  `json:"images"`
+	Info   json.RawMessage `json:"info,omitempty"`
+}
+
+type appIconImage struct {
+	Filename string `json:"filename,omitempty"`
+	Idiom    string `json:"idiom"`
+	Platform string `json:"platform,omitempty"`
+	Scale    string `json:"scale,omitempty"`
+	Size     string `json:"size"`
+}
+
+// appIconPlacement fills an asset catalog icon set. macOS sets get every
+// size and scale; other sets get the single 1024 point image supported
+// since Xcode 14. Contents.json is rewritten to reference the new files.
+func appIconPlacement(root, set string) (placement, error) {
+	var existing appIconContents
+	if data, err := os.ReadFile(filepath.Join(root, set, "Contents.json")); err == nil {
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return placement{}, fmt.Errorf("failed to parse %s: %w", filepath.Join(set, "Contents.json"), err)
+		}
+	}
+	mac := slices.ContainsFunc(existing.Images, func(img appIconImage) bool { return img.Idiom == "mac" })
+
+	contents := appIconContents{Info: json.RawMessage(`{"author":"xcode","version":1}`)}
+	var dims []imageprocessor.Dimension
+	if mac {
+		for _, size := range []uint{16, 32, 128, 256, 512} {
+			for _, scale := range []uint{1, 2} {
+				name := fmt.Sprintf("icon_%dx%d.png", size, size)
+				if scale == 2 {
+					name = fmt.Sprintf("icon_%dx%d@2x.png", size, size)
+				}
+				dims = append(dims, imageprocessor.Dimension{Width: size * scale, Height: size * scale, Name: name})
+				contents.Images = append(contents.Images, appIconImage{
+					Filename: name, Idiom: "mac", Scale: fmt.Sprintf("%dx", scale), Size: fmt.Sprintf("%dx%d", size, size),
+				})
+			}
+		}
+	} else {
+		dims = []imageprocessor.Dimension{{Width: 1024, Height: 1024, Name: "AppIcon.png"}}
+		contents.Images = []appIconImage{{Filename: "AppIcon.png", Idiom: "universal", Platform: "ios", Size: "1024x1024"}}
+	}
+
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return placement{}, err
+	}
+	return placement{Dir: set, Dimensions: dims, Files: map[string][]byte{"Contents.json": append(data, '\n')}}, nil
+}
+
+// detectElectron finds the build resources directory of an electron-builder app.
+func detectElectron(root string) (*project, error) {
+	if !fileContains(root, "package.json", `"electron"`) {
+		return nil, nil
+	}
+
+	// electron-builder reads icons from build/ unless directories.buildResources says otherwise
+	var pkg struct {
+		Build struct {
+			Directories struct {
+				BuildResources string `json:"buildResources"`
+			} `json:"directories"`
+		} `json:"build"`
+	}
+	data, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json: %w", err)
+	}
+	dir := "build"
+	if d := pkg.Build.Directories.BuildResources; d != "" {
+		dir = filepath.FromSlash(d)
+	}
+
+	dims, err := imageprocessor.LoadPreset("electron")
+	if err != nil {
+		return nil, err
+	}
+	return &project{Type: "electron", Placements: []placement{{Dir: dir, Dimensions: dims}}}, nil
+}
+
+// detectWeb finds the static directory of a website: public/ when present,
+// otherwise the directory holding index.html.
+func detectWeb(root string) (*project, error) {
+	var dir string
+	switch {
+	case exists(root, "public"):
+		dir = "public"
+	case exists(root, "static"):
+		dir = "static"
+	case exists(root, "index.html"):
+		dir = "."
+	default:
+		return nil, nil
+	}
+
+	dims, err := imageprocessor.LoadPreset("web")
+	if err != nil {
+		return nil, err
+	}
+	return &project{Type: "web", Placements: []placement{{Dir: dir, Dimensions: dims}}}, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runApprove prints the perceptual hash of an approved master logo, or
+// appends it to the approved hashes file used by -approved.
+func runApprove(args []string) {
+	fs := flag.NewFlagSet("approve", flag.ExitOnError)
+	input := fs.String("input", "", "path to the approved master image")
+	out := fs.String("o", "", "append the hash to this approved hashes file instead of printing it")
+	fs.Parse(args)
+
+	if *input == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator approve -input <path_to_image> [-o approved.txt]")
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Error: failed to decode image: %v\n", err)
+	}
+	hash := imageprocessor.HashImage(img)
+	line := fmt.Sprintf("%s  # %s\n", hash, filepath.Base(*input))
+
+	if *out == "" {
+		fmt.Print(line)
+		return
+	}
+	approved, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := approved.WriteString(line); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := approved.Close(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Added %s to %s\n", hash, *out)
+}
@@ -0,0 +1,87 @@
+// Package cdn invalidates cached copies of generated assets on content
+// delivery networks, and maps outputs to the URLs of image CDNs that render
+// them on demand.
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// Purger invalidates cached URLs on a CDN.
+type Purger interface {
+	Purge(ctx context.Context, urls []string) error
+}
+
+// New returns the purger described by spec: "cloudflare:<zone id>",
+// "fastly" or "cloudfront:<distribution id>". Credentials are read from the
+// environment: CLOUDFLARE_API_TOKEN, FASTLY_API_TOKEN, or AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and the optional AWS_SESSION_TOKEN.
+func New(spec string) (Purger, error) {
+	provider, id, _ := strings.Cut(spec, ":")
+	switch provider {
+	case "cloudflare":
+		if id == "" {
+			return nil, fmt.Errorf("cloudflare needs a zone ID, as cloudflare:<zone id>")
+		}
+		token, err := env("CLOUDFLARE_API_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		return &Cloudflare{Zone: id, Token: token}, nil
+	case "fastly":
+		token, err := env("FASTLY_API_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		return &Fastly{Token: token}, nil
+	case "cloudfront":
+		if id == "" {
+			return nil, fmt.Errorf("cloudfront needs a distribution ID, as cloudfront:<distribution id>")
+		}
+		creds, err := storage.AWSCredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &CloudFront{Distribution: id, Credentials: creds}, nil
+	default:
+		return nil, fmt.Errorf("unknown CDN %q, want cloudflare, fastly or cloudfront", provider)
+	}
+}
+
+// URLs maps output names to their public URLs under base.
+func URLs(base string, names []string) []string {
+	base = strings.TrimSuffix(base, "/")
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = base + "/" + url.PathEscape(name)
+	}
+	return urls
+}
+
+// env returns a required environment variable.
+func env(name string) (string, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return "", fmt.Errorf("%s is not set", name)
+	}
+	return v, nil
+}
+
+// checkResponse turns an unsuccessful API response into an error.
+func checkResponse(resp *http.Response, provider string) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	var msg strings.Builder
+	buf := make([]byte, 512)
+	n, _ := resp.Body.Read(buf)
+	msg.Write(buf[:n])
+	return fmt.Errorf("%s purge failed: %s: %s", provider, resp.Status, strings.TrimSpace(msg.String()))
+}
@@ -0,0 +1,49 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// cloudflareBatch is the number of URLs Cloudflare accepts per purge request.
+const cloudflareBatch = 30
+
+// Cloudflare purges URLs from a Cloudflare zone.
+type Cloudflare struct {
+	Zone  string
+	Token string
+	// Endpoint is the API base URL; empty means Cloudflare's.
+	Endpoint string
+}
+
+// Purge purges urls in batches of the size Cloudflare accepts.
+func (c *Cloudflare) Purge(ctx context.Context, urls []string) error {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.cloudflare.com/client/v4"
+	}
+	for start := 0; start < len(urls); start += cloudflareBatch {
+		body, err := json.Marshal(map[string][]string{"files": urls[start:min(start+cloudflareBatch, len(urls))]})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/zones/"+c.Zone+"/purge_cache", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		err = checkResponse(resp, "cloudflare")
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
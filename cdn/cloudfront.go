@@ -0,0 +1,67 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// CloudFront creates invalidations on an Amazon CloudFront distribution.
+type CloudFront struct {
+	Distribution string
+	Credentials  storage.AWSCredentials
+	// Endpoint is the API base URL; empty means CloudFront's.
+	Endpoint string
+}
+
+// invalidationBatch is the request body of CreateInvalidation.
+type invalidationBatch struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Paths           []string `xml:"Paths>Items>Path"`
+	CallerReference string   `xml:"CallerReference"`
+}
+
+// Purge invalidates the paths of urls in a single invalidation.
+func (c *CloudFront) Purge(ctx context.Context, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://cloudfront.amazonaws.com"
+	}
+
+	batch := invalidationBatch{Quantity: len(urls), CallerReference: "logo-generator-" + strconv.FormatInt(time.Now().UnixNano(), 10)}
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return err
+		}
+		batch.Paths = append(batch.Paths, parsed.EscapedPath())
+	}
+	body, err := xml.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/2020-05-31/distribution/"+url.PathEscape(c.Distribution)+"/invalidation", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	// CloudFront is a global service signed for us-east-1
+	storage.SignAWS(req, req.URL.EscapedPath(), body, c.Credentials, "us-east-1", "cloudfront", time.Now().UTC())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "cloudfront")
+}
@@ -0,0 +1,62 @@
+package cdn
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Cloudinary builds Cloudinary delivery URLs. Sources given as http(s) URLs
+// are fetched remotely; anything else is the public ID of an uploaded image.
+type Cloudinary struct {
+	// Endpoint is the delivery base URL, https://res.cloudinary.com/<cloud name>.
+	Endpoint string
+	// Secret is the API secret URLs are signed with; empty leaves them unsigned.
+	Secret string
+}
+
+// URL returns the Cloudinary URL rendering dim from source.
+func (c *Cloudinary) URL(source string, dim imageprocessor.Dimension) (string, error) {
+	t, err := newTransform(dim, "png", "jpeg", "ico")
+	if err != nil {
+		return "", err
+	}
+
+	// Each filter is a chained transformation so they apply in config order
+	mode := map[string]string{"stretch": "c_scale", "crop": "c_fill", "pad": "c_pad,b_transparent"}[t.fit]
+	components := []string{fmt.Sprintf("%s,w_%d,h_%d", mode, t.width, t.height)}
+	for _, f := range t.filters {
+		switch {
+		case f.background != "":
+			components = append(components, "b_rgb:"+f.background)
+		case f.circle:
+			components = append(components, "r_max")
+		default:
+			components = append(components, fmt.Sprintf("r_%d", f.radius))
+		}
+	}
+
+	delivery := "upload"
+	ext := t.format
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		delivery = "fetch"
+		components = append(components, "f_"+ext, source)
+	} else {
+		components = append(components, strings.TrimSuffix(source, path.Ext(source))+"."+ext)
+	}
+	signed := strings.Join(components, "/")
+
+	u := strings.TrimSuffix(c.Endpoint, "/") + "/image/" + delivery + "/"
+	if c.Secret != "" {
+		sum := sha1.Sum([]byte(signed + c.Secret))
+		u += "s--" + base64.RawURLEncoding.EncodeToString(sum[:])[:8] + "--/"
+	}
+	return u + signed, nil
+}
@@ -0,0 +1,42 @@
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Fastly purges URLs from Fastly, one request per URL as its API requires.
+type Fastly struct {
+	Token string
+	// Endpoint is the API base URL; empty means Fastly's.
+	Endpoint string
+}
+
+// Purge purges every URL in urls.
+func (f *Fastly) Purge(ctx context.Context, urls []string) error {
+	endpoint := f.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.fastly.com"
+	}
+	for _, u := range urls {
+		// The purge endpoint takes the URL without its scheme
+		target := u[strings.Index(u, "://")+3:]
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/purge/"+target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", f.Token)
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		err = checkResponse(resp, "fastly")
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package cdn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Imgproxy builds imgproxy URLs.
+type Imgproxy struct {
+	// Endpoint is the base URL imgproxy is served from.
+	Endpoint string
+	key      []byte
+	salt     []byte
+}
+
+// SetKey signs the URLs with the hex encoded key and salt imgproxy is
+// configured with.
+func (p *Imgproxy) SetKey(key, salt string) error {
+	var err error
+	if p.key, err = hex.DecodeString(key); err != nil {
+		return fmt.Errorf("invalid imgproxy key: %w", err)
+	}
+	if p.salt, err = hex.DecodeString(salt); err != nil {
+		return fmt.Errorf("invalid imgproxy salt: %w", err)
+	}
+	return nil
+}
+
+// URL returns the imgproxy URL rendering dim from the source URL.
+func (p *Imgproxy) URL(source string, dim imageprocessor.Dimension) (string, error) {
+	t, err := newTransform(dim, "png", "jpeg", "ico")
+	if err != nil {
+		return "", err
+	}
+
+	var path string
+	switch t.fit {
+	case "crop":
+		path = fmt.Sprintf("/rs:fill:%d:%d", t.width, t.height)
+	case "pad":
+		path = fmt.Sprintf("/rs:fit:%d:%d/ex:1", t.width, t.height)
+	default:
+		path = fmt.Sprintf("/rs:force:%d:%d", t.width, t.height)
+	}
+	for _, f := range t.filters {
+		if f.background == "" {
+			return "", fmt.Errorf("%s: imgproxy cannot mask images", dim.Name)
+		}
+		path += "/bg:" + f.background
+	}
+	ext := t.format
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	path += "/" + base64.RawURLEncoding.EncodeToString([]byte(source)) + "." + ext
+
+	signature := "insecure"
+	if p.key != nil {
+		mac := hmac.New(sha256.New, p.key)
+		mac.Write(p.salt)
+		mac.Write([]byte(path))
+		signature = base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return strings.TrimSuffix(p.Endpoint, "/") + "/" + signature + path, nil
+}
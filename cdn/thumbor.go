@@ -0,0 +1,56 @@
+package cdn
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Thumbor builds Thumbor URLs.
+type Thumbor struct {
+	// Endpoint is the base URL Thumbor is served from.
+	Endpoint string
+	// Key is the security key URLs are signed with; empty makes unsafe URLs.
+	Key string
+}
+
+// URL returns the Thumbor URL rendering dim from source.
+func (th *Thumbor) URL(source string, dim imageprocessor.Dimension) (string, error) {
+	t, err := newTransform(dim, "png", "jpeg")
+	if err != nil {
+		return "", err
+	}
+
+	// Thumbor crops to the size by default; stretch() distorts instead,
+	// and fit-in with a transparent fill pads
+	var filters []string
+	size := fmt.Sprintf("%dx%d", t.width, t.height)
+	switch t.fit {
+	case "stretch":
+		filters = append(filters, "stretch()")
+	case "pad":
+		size = "fit-in/" + size
+		filters = append(filters, "fill(transparent)")
+	}
+	for _, f := range t.filters {
+		if f.background != "" {
+			filters = append(filters, "fill("+f.background+")")
+		} else {
+			filters = append(filters, fmt.Sprintf("round_corner(%d,0,0,0,1)", f.radius))
+		}
+	}
+	filters = append(filters, "format("+t.format+")")
+	path := fmt.Sprintf("%s/filters:%s/%s", size, strings.Join(filters, ":"), source)
+
+	signature := "unsafe"
+	if th.Key != "" {
+		mac := hmac.New(sha1.New, []byte(th.Key))
+		mac.Write([]byte(path))
+		signature = base64.URLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return strings.TrimSuffix(th.Endpoint, "/") + "/" + signature + "/" + path, nil
+}
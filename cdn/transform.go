@@ -0,0 +1,119 @@
+package cdn
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Transformer maps an output to the URL under which an image CDN renders it
+// from a source image, instead of generating the file.
+type Transformer interface {
+	URL(source string, dim imageprocessor.Dimension) (string, error)
+}
+
+// NewTransformer returns the transformer for an image CDN: "imgproxy",
+// "cloudinary" or "thumbor", serving from endpoint. URLs are signed when the
+// provider's secret is set: IMGPROXY_KEY and IMGPROXY_SALT,
+// CLOUDINARY_API_SECRET or THUMBOR_SECURITY_KEY.
+func NewTransformer(provider, endpoint string) (Transformer, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("%s needs the URL it is served from", provider)
+	}
+	switch provider {
+	case "imgproxy":
+		t := &Imgproxy{Endpoint: endpoint}
+		key, salt := os.Getenv("IMGPROXY_KEY"), os.Getenv("IMGPROXY_SALT")
+		if (key == "") != (salt == "") {
+			return nil, fmt.Errorf("IMGPROXY_KEY and IMGPROXY_SALT must be set together")
+		}
+		if key != "" {
+			if err := t.SetKey(key, salt); err != nil {
+				return nil, err
+			}
+		}
+		return t, nil
+	case "cloudinary":
+		return &Cloudinary{Endpoint: endpoint, Secret: os.Getenv("CLOUDINARY_API_SECRET")}, nil
+	case "thumbor":
+		return &Thumbor{Endpoint: endpoint, Key: os.Getenv("THUMBOR_SECURITY_KEY")}, nil
+	default:
+		return nil, fmt.Errorf("unknown image CDN %q, want imgproxy, cloudinary or thumbor", provider)
+	}
+}
+
+// transform is an output reduced to the operations image CDNs perform: a
+// resize that stretches, crops or pads to the size as fit says, filters in
+// config order, and the encoding.
+type transform struct {
+	width, height int
+	fit           string
+	format        string
+	filters       []transformFilter
+}
+
+// transformFilter is a background fill with color, or a mask cutting
+// corners of radius pixels.
+type transformFilter struct {
+	background string
+	radius     int
+	circle     bool
+}
+
+// newTransform checks that dim can be expressed as a CDN transformation.
+// formats lists the encodings the provider can produce.
+func newTransform(dim imageprocessor.Dimension, formats ...string) (transform, error) {
+	t := transform{width: int(dim.Width), height: int(dim.Height), fit: dim.Fit, format: dim.Format}
+	if t.fit == "" {
+		t.fit = "stretch"
+	}
+	if t.format == "" {
+		t.format = "png"
+	}
+	if !slices.Contains(formats, t.format) {
+		return t, fmt.Errorf("%s: the %s format is not supported", dim.Name, t.format)
+	}
+	if dim.Card != nil || dim.Place != nil || dim.AdaptiveLayer != nil {
+		return t, fmt.Errorf("%s: cards, placements and adaptive icon layers are not supported", dim.Name)
+	}
+	if dim.Gray > 0 {
+		return t, fmt.Errorf("%s: dithering to gray levels is not supported", dim.Name)
+	}
+	if len(dim.Sizes) > 1 {
+		return t, fmt.Errorf("%s: ico files with several sizes are not supported", dim.Name)
+	}
+
+	for _, spec := range dim.Filters {
+		switch spec.Type {
+		case "background":
+			c, err := imageprocessor.ParseHexColor(spec.Color)
+			if err != nil {
+				return t, fmt.Errorf("%s: %w", dim.Name, err)
+			}
+			if c.A != 0xff {
+				return t, fmt.Errorf("%s: translucent background %s is not supported", dim.Name, spec.Color)
+			}
+			t.filters = append(t.filters, transformFilter{background: fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)})
+		case "mask":
+			// The radius is relative to the output, as the processor's is
+			// relative to the image it masks
+			side := float64(min(t.width, t.height))
+			switch spec.Shape {
+			case "circle":
+				t.filters = append(t.filters, transformFilter{radius: int(side / 2), circle: true})
+			case "rounded":
+				t.filters = append(t.filters, transformFilter{radius: int(math.Round(side * imageprocessor.RoundedCornerRadius))})
+			default:
+				return t, fmt.Errorf("%s: unknown mask shape %q", dim.Name, spec.Shape)
+			}
+		case "crop", "extend", "rotate", "flip":
+			return t, fmt.Errorf("%s: %s filters are not supported", dim.Name, spec.Type)
+		default:
+			return t, fmt.Errorf("%s: unknown filter %q", dim.Name, spec.Type)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// changelogFlag registers -changelog. The returned function is called before
+// the run, to capture the outputs it is about to replace, and returns the
+// function writing the changelog entry once the run is done.
+func changelogFlag(fs *flag.FlagSet) func(outputDir, manifestName string) func(result *imageprocessor.Result) {
+	path := fs.String("changelog", "", "append a Markdown entry listing added, removed and visually changed outputs to this file, e.g. ASSETS_CHANGELOG.md; - prints it")
+
+	return func(outputDir, manifestName string) func(result *imageprocessor.Result) {
+		if *path == "" {
+			return func(*imageprocessor.Result) {}
+		}
+		if manifestName == "" {
+			log.Fatal("Error: -changelog compares with the manifest of the previous run, but -manifest is empty")
+		}
+		previous := readPreviousManifest(filepath.Join(outputDir, manifestName))
+		before := imageprocessor.SnapshotOutputs(outputDir, previous)
+
+		return func(result *imageprocessor.Result) {
+			changes := imageprocessor.CompareOutputs(previous, before, result)
+			if len(changes) == 0 {
+				return
+			}
+			if *path == "-" {
+				if err := imageprocessor.WriteChangelog(os.Stdout, changes, result.GeneratedAt, result.Source); err != nil {
+					log.Fatalf("Error: %v\n", err)
+				}
+				return
+			}
+			f, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+			if err := imageprocessor.WriteChangelog(f, changes, result.GeneratedAt, result.Source); err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+			if err := f.Close(); err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+		}
+	}
+}
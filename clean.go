@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"slices"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runClean removes previously generated files that the current config no
+// longer lists, using the output directory's manifest to know which files
+// the generator owns.
+func runClean(args []string) {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	outputDir := fs.String("output", "output", "directory the images were generated into")
+	dimensions, listedDimensions := dimensionsFlag(fs)
+	manifestName := fs.String("manifest", "manifest.json", "name of the manifest in the output directory")
+	dryRun := fs.Bool("dry-run", false, "print the files that would be removed without removing them")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 || *manifestName == "" {
+		log.Fatal("Usage: logo-generator clean [-output <dir>] [-config <file> | -preset <names>]")
+	}
+
+	manifestPath := filepath.Join(*outputDir, *manifestName)
+	manifest := previousManifest(fs, manifestPath)
+	// Outputs only left out by when conditions are kept
+	dimensions()
+	stale := imageprocessor.StaleOutputs(manifest, listedDimensions())
+	for _, entry := range stale {
+		fmt.Println("  removing", filepath.Join(*outputDir, entry.Name))
+	}
+	if *dryRun {
+		return
+	}
+
+	if err := imageprocessor.Prune(*outputDir, stale); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Forget the removed files so the manifest keeps matching the directory
+	manifest.Outputs = slices.DeleteFunc(manifest.Outputs, func(e imageprocessor.ManifestEntry) bool {
+		return slices.ContainsFunc(stale, func(s imageprocessor.ManifestEntry) bool { return s.Name == e.Name })
+	})
+	if err := manifest.Write(manifestPath); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Removed %d stale files from %s\n", len(stale), *outputDir)
+}
+
+// previousManifest reads the manifest of the last run for pruning. A
+// missing manifest means no files are known to be generated. Pruning against
+// a -tags subset would delete the unselected outputs, so the combination is
+// rejected.
+func previousManifest(flags *flag.FlagSet, path string) imageprocessor.Manifest {
+	if flags.Lookup("tags").Value.String() != "" {
+		log.Fatal("Error: pruning cannot be combined with -tags")
+	}
+	return readPreviousManifest(path)
+}
+
+// readPreviousManifest reads the manifest of the previous run, which is empty
+// when there was none.
+func readPreviousManifest(path string) imageprocessor.Manifest {
+	manifest, err := imageprocessor.ReadManifest(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error: %v\n", err)
+	}
+	return manifest
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// clipboardInput is the -input value reading the source from the system
+// clipboard. A file of that name is read as ./clipboard.
+const clipboardInput = "clipboard"
+
+// windowsClipboardScript writes the clipboard's image to standard output as
+// PNG. The PNG format design tools and browsers put on the clipboard keeps
+// transparency; the bitmap every image is also available as does not.
+const windowsClipboardScript = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$png = [Windows.Forms.Clipboard]::GetData('PNG')
+if ($png -isnot [IO.MemoryStream]) {
+	$img = [Windows.Forms.Clipboard]::GetImage()
+	if (-not $img) { exit 3 }
+	$png = New-Object IO.MemoryStream
+	$img.Save($png, [Drawing.Imaging.ImageFormat]::Png)
+}
+$out = [Console]::OpenStandardOutput()
+$png.WriteTo($out)
+$out.Flush()`
+
+// appleScriptData matches the PNG data AppleScript prints as «data PNGf…».
+var appleScriptData = regexp.MustCompile(`«data PNGf([0-9A-Fa-f]*)»`)
+
+// readClipboard returns the image on the system clipboard, using the tools
+// each platform ships with: osascript on macOS, PowerShell on Windows, and
+// wl-paste or xclip on Linux.
+func readClipboard() ([]byte, error) {
+	var data []byte
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		var out []byte
+		out, err = exec.Command("osascript", "-e", "the clipboard as «class PNGf»").Output()
+		if err == nil {
+			m := appleScriptData.FindSubmatch(out)
+			if m == nil {
+				return nil, errors.New("the clipboard does not hold an image")
+			}
+			data, err = hex.DecodeString(string(m[1]))
+		}
+	case "windows":
+		data, err = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-STA", "-Command", windowsClipboardScript).Output()
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			data, err = exec.Command("wl-paste", "--no-newline", "--type", "image/png").Output()
+		} else {
+			data, err = exec.Command("xclip", "-selection", "clipboard", "-target", "image/png", "-out").Output()
+		}
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("failed to read the clipboard: %w; on Linux install wl-clipboard or xclip", err)
+	}
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("the clipboard does not hold an image: %v", clipboardError(err))
+	}
+
+	// Tools may hand over whatever the clipboard holds, so check it decodes
+	if _, _, err := imageprocessor.DecodeSafe(bytes.NewReader(data), imageprocessor.DecodeLimits{}); err != nil {
+		return nil, fmt.Errorf("the clipboard does not hold an image: %w", err)
+	}
+	return data, nil
+}
+
+// clipboardError describes why a clipboard tool failed, including what it
+// printed to standard error.
+func clipboardError(err error) string {
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && len(bytes.TrimSpace(exit.Stderr)) > 0 {
+		return string(bytes.TrimSpace(exit.Stderr))
+	}
+	if err == nil {
+		return "it is empty"
+	}
+	return err.Error()
+}
+
+// clipboardFS serves the image read from the clipboard as the source named
+// clipboardInput.
+func clipboardFS() (imageprocessor.FS, error) {
+	data, err := readClipboard()
+	if err != nil {
+		return nil, err
+	}
+	mem := &imageprocessor.MemFS{}
+	if err := mem.WriteFile(clipboardInput, data, 0644); err != nil {
+		return nil, err
+	}
+	return sourceFS{name: clipboardInput, mem: mem}, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// contrastReport is the JSON form of the contrast command's report.
+type contrastReport struct {
+	Source      string                         `json:"source"`
+	Palette     []imageprocessor.PaletteColor  `json:"palette"`
+	Backgrounds []string                       `json:"backgrounds"`
+	Contrast    []imageprocessor.ContrastEntry `json:"contrast"`
+}
+
+// runContrast reports the WCAG contrast of the logo's dominant colors
+// against common and brand backgrounds, flagging the pairs below AA, so
+// brand teams can decide which variants to ship on which backgrounds.
+func runContrast(args []string) {
+	fs := flag.NewFlagSet("contrast", flag.ExitOnError)
+	input := fs.String("input", "", "path to the logo")
+	backgrounds := fs.String("backgrounds", "#ffffff,#000000", "comma separated background colors to check against")
+	brand := fs.String("brand", "", "comma separated brand colors, checked as backgrounds after -backgrounds")
+	out := fs.String("o", "", "write the report to this .txt, .md or .json file instead of printing it")
+	fs.Parse(args)
+	if *input == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator contrast -input <path_to_image> [-brand #hex,...] [-o report.md]")
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	img, _, err := imageprocessor.DecodeSafe(f, imageprocessor.DecodeLimits{})
+	f.Close()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	palette := imageprocessor.ExtractPalette(img, imageprocessor.DefaultPaletteSize)
+	if len(palette) == 0 {
+		log.Fatal("Error: the logo has no opaque pixels to take colors from")
+	}
+
+	report := contrastReport{Source: filepath.Base(*input), Palette: palette}
+	for _, list := range []string{*backgrounds, *brand} {
+		for _, bg := range strings.Split(list, ",") {
+			if bg = strings.TrimSpace(bg); bg != "" {
+				report.Backgrounds = append(report.Backgrounds, bg)
+			}
+		}
+	}
+	colors := make([]string, len(palette))
+	for i, c := range palette {
+		colors[i] = c.Hex
+	}
+	if report.Contrast, err = imageprocessor.ContrastMatrix(colors, report.Backgrounds); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	var data []byte
+	switch filepath.Ext(*out) {
+	case ".json":
+		if data, err = json.MarshalIndent(report, "", "  "); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		data = append(data, '\n')
+	case ".md":
+		data = report.markdown()
+	case "", ".txt":
+		data = report.text()
+	default:
+		log.Fatalf("Error: -o: %s: reports are written as .txt, .md or .json files\n", *out)
+	}
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Println("Wrote", *out)
+}
+
+// cell returns the entry of a palette color against a background.
+func (r contrastReport) cell(row, col int) imageprocessor.ContrastEntry {
+	return r.Contrast[row*len(r.Backgrounds)+col]
+}
+
+// text renders the report as a table for the terminal, marking the pairs
+// below AA with an exclamation mark.
+func (r contrastReport) text() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "WCAG contrast of the colors of %s (! below AA %.1f:1)\n\n", r.Source, imageprocessor.ContrastAA)
+	fmt.Fprintf(&b, "%-16s", "color")
+	for _, bg := range r.Backgrounds {
+		fmt.Fprintf(&b, "  %-16s", " on "+bg)
+	}
+	b.WriteString("\n")
+	for i, c := range r.Palette {
+		fmt.Fprintf(&b, "%-16s", fmt.Sprintf("%s %4.1f%%", c.Hex, c.Coverage))
+		for j := range r.Backgrounds {
+			e := r.cell(i, j)
+			mark := " "
+			if e.BelowAA() {
+				mark = "!"
+			}
+			fmt.Fprintf(&b, "  %s%-15s", mark, fmt.Sprintf("%5.2f %s", e.Ratio, e.Level))
+		}
+		b.WriteString("\n")
+	}
+	return trimLines(b.Bytes())
+}
+
+// markdown renders the report as a Markdown table, for design reviews and
+// pull requests.
+func (r contrastReport) markdown() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "## WCAG contrast of the colors of %s\n\n", r.Source)
+	b.WriteString("| Color | Coverage |")
+	for _, bg := range r.Backgrounds {
+		fmt.Fprintf(&b, " on `%s` |", bg)
+	}
+	b.WriteString("\n| --- | ---: |" + strings.Repeat(" --- |", len(r.Backgrounds)) + "\n")
+	for i, c := range r.Palette {
+		fmt.Fprintf(&b, "| `%s` | %.1f%% |", c.Hex, c.Coverage)
+		for j := range r.Backgrounds {
+			e := r.cell(i, j)
+			if e.BelowAA() {
+				fmt.Fprintf(&b, " ⚠️ %.2f %s |", e.Ratio, e.Level)
+			} else {
+				fmt.Fprintf(&b, " %.2f %s |", e.Ratio, e.Level)
+			}
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n⚠️ marks pairs below AA (%.1f:1). AA large (%.0f:1) is enough for large text and graphical objects.\n", imageprocessor.ContrastAA, imageprocessor.ContrastAALarge)
+	return b.Bytes()
+}
+
+// trimLines removes the padding the table leaves at the end of lines.
+func trimLines(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " ")
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runDaemon keeps the source and the dimensions in memory and regenerates
+// the outputs when the config changes or a local REST request asks for it.
+func runDaemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	input := fs.String("input", "", "path to the source image, read once and kept in memory")
+	outputDir := fs.String("output", "output", "directory the generated images are written to")
+	options := processorFlags(fs)
+	loadDimensions := dimensionsLoader(fs)
+	manifestName := fs.String("manifest", "manifest.json", "name of the manifest written to the output directory; empty disables it")
+	addr := fs.String("addr", "127.0.0.1:7890", "local address the REST trigger listens on")
+	poll := fs.Duration("poll", time.Second, "how often the config and source are checked for changes")
+	logs := loggingFlags(fs)
+	fs.Parse(args)
+	if *input == "" {
+		log.Fatal("Usage: logo-generator daemon [flags] -input <path_to_image>")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger, closeLog := logs.logger(slog.LevelInfo)
+	defer closeLog()
+	ctx = imageprocessor.WithLogger(ctx, logger)
+
+	d := &daemon{
+		input:          *input,
+		outputDir:      *outputDir,
+		manifestName:   *manifestName,
+		configPath:     fs.Lookup("config").Value.String(),
+		options:        options(),
+		loadDimensions: loadDimensions,
+		logger:         logger,
+	}
+	if _, err := d.reloadSource(nil); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := d.reloadConfig(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if run := d.run(ctx, "start", nil); run.Error != "" {
+		logger.Error("initial generation failed", "error", run.Error)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	srv := &http.Server{Handler: d.handler(ctx), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	go d.watch(ctx, *poll)
+
+	logger.Info("daemon listening", "addr", listener.Addr().String(), "config", d.configPath, "input", d.input)
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
+
+// daemon holds the state of the daemon command. mu serializes runs and
+// guards everything below it.
+type daemon struct {
+	input, outputDir, manifestName string
+	configPath                     string
+	options                        imageprocessor.Options
+	loadDimensions                 func() ([]imageprocessor.Dimension, imageprocessor.Profile, error)
+	logger                         *slog.Logger
+
+	mu          sync.Mutex
+	source      *imageprocessor.MemFS
+	sourceSum   string
+	sourceMod   time.Time
+	processor   *imageprocessor.Processor
+	configMod   time.Time
+	configError string
+	lastRun     *daemonRun
+}
+
+// daemonRun is the JSON summary of a generation.
+type daemonRun struct {
+	Started    time.Time        `json:"started"`
+	DurationMs int64            `json:"durationMs"`
+	Trigger    string           `json:"trigger"`
+	Generated  int              `json:"generated"`
+	Unchanged  int              `json:"unchanged"`
+	Failed     int              `json:"failed"`
+	Outputs    []daemonRunEntry `json:"outputs"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// daemonRunEntry is the outcome of one output of a daemonRun.
+type daemonRunEntry struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Bytes  int64  `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+}
+
+// daemonStatus is the JSON answer of GET /status.
+type daemonStatus struct {
+	Input        string     `json:"input"`
+	SourceSHA256 string     `json:"sourceSha256"`
+	Config       string     `json:"config,omitempty"`
+	ConfigError  string     `json:"configError,omitempty"`
+	Outputs      int        `json:"outputs"`
+	LastRun      *daemonRun `json:"lastRun,omitempty"`
+}
+
+// sourceFS serves a source held in memory, such as the daemon's or one read
+// from the clipboard, and everything else, such as watermark images and the
+// outputs, from the host.
+type sourceFS struct {
+	name string
+	mem  *imageprocessor.MemFS
+}
+
+func (s sourceFS) Open(name string) (fs.File, error) {
+	if name == s.name {
+		return s.mem.Open(name)
+	}
+	return imageprocessor.HostFS.Open(name)
+}
+
+func (s sourceFS) Stat(name string) (fs.FileInfo, error) {
+	if name == s.name {
+		return s.mem.Stat(name)
+	}
+	return imageprocessor.HostFS.Stat(name)
+}
+
+func (s sourceFS) MkdirAll(name string, perm fs.FileMode) error {
+	return imageprocessor.HostFS.MkdirAll(name, perm)
+}
+
+func (s sourceFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return imageprocessor.HostFS.WriteFile(name, data, perm)
+}
+
+// reloadSource keeps data as the source, or rereads the input file when data
+// is nil and the file changed since it was read. It reports whether the
+// source changed. Callers other than the first hold d.mu.
+func (d *daemon) reloadSource(data []byte) (bool, error) {
+	if data == nil {
+		info, err := os.Stat(d.input)
+		if err != nil {
+			return false, err
+		}
+		if d.source != nil && info.ModTime().Equal(d.sourceMod) {
+			return false, nil
+		}
+		if data, err = os.ReadFile(d.input); err != nil {
+			return false, err
+		}
+		d.sourceMod = info.ModTime()
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) == d.sourceSum {
+		return false, nil
+	}
+	mem := &imageprocessor.MemFS{}
+	if err := mem.MkdirAll(filepath.Dir(d.input), 0755); err != nil {
+		return false, err
+	}
+	if err := mem.WriteFile(d.input, data, 0644); err != nil {
+		return false, err
+	}
+	d.source, d.sourceSum = mem, hex.EncodeToString(sum[:])
+	return true, nil
+}
+
+// reloadConfig reloads the dimensions when the config file changed since it
+// was loaded, reporting whether it did. A config that fails to load keeps
+// the previous dimensions in use. Callers other than the first hold d.mu.
+func (d *daemon) reloadConfig() (bool, error) {
+	if d.configPath != "" {
+		info, err := os.Stat(d.configPath)
+		if err != nil {
+			return false, err
+		}
+		if d.processor != nil && info.ModTime().Equal(d.configMod) {
+			return false, nil
+		}
+		d.configMod = info.ModTime()
+	} else if d.processor != nil {
+		return false, nil
+	}
+
+	dims, profile, err := d.loadDimensions()
+	if err == nil {
+		opts := d.options
+		opts.Watermark = profile.Watermark
+		var p *imageprocessor.Processor
+		if p, err = imageprocessor.NewProcessor(dims, opts); err == nil {
+			d.processor, d.configError = p, ""
+			return true, nil
+		}
+	}
+	d.configError = err.Error()
+	return false, err
+}
+
+// watch polls the config and source until ctx is done, regenerating the
+// outputs when either changed.
+func (d *daemon) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.mu.Lock()
+			configChanged, err := d.reloadConfig()
+			if err != nil {
+				d.logger.Error("failed to reload config; keeping the previous dimensions", "config", d.configPath, "error", err)
+			} else if configChanged {
+				d.logger.Info("reloaded config", "config", d.configPath, "outputs", len(d.processor.Dimensions()))
+			}
+			sourceChanged, err := d.reloadSource(nil)
+			if err != nil {
+				d.logger.Error("failed to reload source", "input", d.input, "error", err)
+			}
+			d.mu.Unlock()
+			if configChanged || sourceChanged {
+				trigger := "config"
+				if sourceChanged {
+					trigger = "source"
+				}
+				d.run(ctx, trigger, nil)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run regenerates the outputs, first replacing the source with upload when
+// one is given, and records the run as the last one.
+func (d *daemon) run(ctx context.Context, trigger string, upload []byte) *daemonRun {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run := &daemonRun{Started: time.Now().UTC(), Trigger: trigger, Outputs: []daemonRunEntry{}}
+	d.lastRun = run
+	if upload != nil {
+		// Keep the previous source when the upload is not an image
+		if _, _, err := imageprocessor.DecodeSafe(bytes.NewReader(upload), imageprocessor.DecodeLimits{}); err != nil {
+			run.Error = err.Error()
+			return run
+		}
+		if _, err := d.reloadSource(upload); err != nil {
+			run.Error = err.Error()
+			return run
+		}
+	}
+
+	opts := d.processor.Options()
+	opts.FS = sourceFS{name: d.input, mem: d.source}
+	p, err := imageprocessor.NewProcessor(d.processor.Dimensions(), opts)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	result, err := p.Process(ctx, d.input, d.outputDir)
+	if err == nil && d.manifestName != "" {
+		err = result.WriteManifest(filepath.Join(d.outputDir, d.manifestName))
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if result != nil {
+		run.Generated = result.Count(imageprocessor.StatusGenerated)
+		run.Unchanged = result.Count(imageprocessor.StatusUnchanged)
+		run.Failed = result.Count(imageprocessor.StatusFailed)
+		for _, out := range result.Outputs {
+			entry := daemonRunEntry{Name: out.Dimension.Name, Status: string(out.Status), Bytes: out.Bytes}
+			if out.Err != nil {
+				entry.Error = out.Err.Error()
+			}
+			run.Outputs = append(run.Outputs, entry)
+		}
+	}
+	run.DurationMs = time.Since(run.Started).Milliseconds()
+	d.logger.Info("regenerated", "trigger", trigger, "generated", run.Generated, "unchanged", run.Unchanged, "failed", run.Failed, "error", run.Error)
+	return run
+}
+
+// handler serves the daemon's REST API:
+//
+//	POST /regenerate  regenerate now; a request body replaces the source
+//	GET  /status      the source, config and last run
+func (d *daemon) handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /regenerate", func(w http.ResponseWriter, r *http.Request) {
+		upload, err := io.ReadAll(io.LimitReader(r.Body, imageprocessor.DefaultDecodeLimits.MaxBytes+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(upload)) > imageprocessor.DefaultDecodeLimits.MaxBytes {
+			http.Error(w, "source too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		trigger := "request"
+		if len(upload) == 0 {
+			upload = nil
+		} else {
+			trigger = "upload"
+		}
+		run := d.run(ctx, trigger, upload)
+		status := http.StatusOK
+		if run.Error != "" {
+			status = http.StatusUnprocessableEntity
+		}
+		writeDaemonJSON(w, status, run)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		status := daemonStatus{
+			Input:        d.input,
+			SourceSHA256: d.sourceSum,
+			Config:       d.configPath,
+			ConfigError:  d.configError,
+			Outputs:      len(d.processor.Dimensions()),
+			LastRun:      d.lastRun,
+		}
+		d.mu.Unlock()
+		writeDaemonJSON(w, http.StatusOK, status)
+	})
+	return mux
+}
+
+// writeDaemonJSON answers with v as JSON.
+func writeDaemonJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
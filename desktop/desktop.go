@@ -0,0 +1,79 @@
+// Package desktop integrates the generator with desktop file managers, so
+// designers can generate icons by right-clicking an image.
+package desktop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// plistDict is a property list dictionary, keeping its keys in order.
+type plistDict []plistEntry
+
+// plistEntry is a key of a plistDict.
+type plistEntry struct {
+	Key   string
+	Value any
+}
+
+// plist renders v as an XML property list. Values are strings, ints, bools,
+// plistDicts and []any arrays of them.
+func plist(v any) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	buf.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buf.WriteString(`<plist version="1.0">` + "\n")
+	writePlist(&buf, v, 0)
+	buf.WriteString("</plist>\n")
+	return buf.Bytes()
+}
+
+// writePlist writes a property list value indented by depth tabs.
+func writePlist(buf *bytes.Buffer, v any, depth int) {
+	indent := strings.Repeat("\t", depth)
+	switch v := v.(type) {
+	case plistDict:
+		buf.WriteString(indent + "<dict>\n")
+		for _, e := range v {
+			buf.WriteString(indent + "\t<key>" + escapeXML(e.Key) + "</key>\n")
+			writePlist(buf, e.Value, depth+1)
+		}
+		buf.WriteString(indent + "</dict>\n")
+	case []any:
+		buf.WriteString(indent + "<array>\n")
+		for _, item := range v {
+			writePlist(buf, item, depth+1)
+		}
+		buf.WriteString(indent + "</array>\n")
+	case string:
+		buf.WriteString(indent + "<string>" + escapeXML(v) + "</string>\n")
+	case int:
+		buf.WriteString(indent + "<integer>" + strconv.Itoa(v) + "</integer>\n")
+	case bool:
+		buf.WriteString(indent + "<" + strconv.FormatBool(v) + "/>\n")
+	default:
+		panic(fmt.Sprintf("unsupported property list value %T", v))
+	}
+}
+
+// escapeXML escapes the characters XML text cannot contain.
+func escapeXML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// stableUUID derives a UUID from parts, so regenerated files only change
+// when their contents do.
+func stableUUID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
@@ -0,0 +1,144 @@
+package desktop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuickAction is a Finder Quick Action, an Automator workflow in
+// ~/Library/Services, that runs the generator on the images selected in
+// Finder and writes each one's icons next to it.
+type QuickAction struct {
+	// Name is the title of the action in Finder's Quick Actions menu.
+	Name string
+	// Command is the generator's executable followed by the flags of every
+	// run, such as -preset web; -input and -output are added per image.
+	Command []string
+	// OutputSuffix is appended to an image's name without its extension to
+	// name its output directory, such as logo-icons for logo.png.
+	OutputSuffix string
+}
+
+// quickActionFileTypes are the image types the action is offered for.
+var quickActionFileTypes = []any{"public.png", "public.jpeg"}
+
+// BundleName returns the name of the workflow bundle in ~/Library/Services.
+func (q QuickAction) BundleName() (string, error) {
+	if q.Name == "" || strings.ContainsAny(q.Name, "/:") || strings.HasPrefix(q.Name, ".") {
+		return "", fmt.Errorf("invalid Quick Action name %q", q.Name)
+	}
+	return q.Name + ".workflow", nil
+}
+
+// Files returns the files of the workflow bundle by their path inside it.
+func (q QuickAction) Files() (map[string][]byte, error) {
+	if _, err := q.BundleName(); err != nil {
+		return nil, err
+	}
+	if len(q.Command) == 0 {
+		return nil, fmt.Errorf("no command to run")
+	}
+	if q.OutputSuffix == "" {
+		return nil, fmt.Errorf("an output suffix is required, so icons are not written over the image")
+	}
+
+	info := plistDict{
+		{"NSServices", []any{plistDict{
+			{"NSBackgroundColorName", "background"},
+			{"NSIconName", "NSActionTemplate"},
+			{"NSMenuItem", plistDict{{"default", q.Name}}},
+			{"NSMessage", "runWorkflowAsService"},
+			{"NSRequiredContext", plistDict{{"NSApplicationIdentifier", "com.apple.finder"}}},
+			{"NSSendFileTypes", quickActionFileTypes},
+		}}},
+	}
+
+	action := plistDict{
+		{"AMAccepts", plistDict{{"Container", "List"}, {"Optional", true}, {"Types", []any{"com.apple.cocoa.string"}}}},
+		{"AMActionVersion", "2.0.3"},
+		{"AMApplication", []any{"Automator"}},
+		{"AMParameterProperties", plistDict{
+			{"COMMAND_STRING", plistDict{}},
+			{"CheckedForUserDefaultShell", plistDict{}},
+			{"inputMethod", plistDict{}},
+			{"shell", plistDict{}},
+			{"source", plistDict{}},
+		}},
+		{"AMProvides", plistDict{{"Container", "List"}, {"Types", []any{"com.apple.cocoa.string"}}}},
+		{"ActionBundlePath", "/System/Library/Automator/Run Shell Script.action"},
+		{"ActionName", "Run Shell Script"},
+		{"ActionParameters", plistDict{
+			{"COMMAND_STRING", q.script()},
+			{"CheckedForUserDefaultShell", true},
+			// Selected files are passed as arguments rather than on stdin
+			{"inputMethod", 1},
+			{"shell", "/bin/bash"},
+			{"source", ""},
+		}},
+		{"BundleIdentifier", "com.apple.RunShellScript"},
+		{"CFBundleVersion", "2.0.3"},
+		{"CanShowSelectedItemsWhenRun", false},
+		{"CanShowWhenRun", true},
+		{"Category", []any{"AMCategoryUtilities"}},
+		{"Class Name", "RunShellScriptAction"},
+		{"InputUUID", stableUUID(q.Name, "input")},
+		{"Keywords", []any{"Shell", "Script", "Command", "Run", "Unix"}},
+		{"OutputUUID", stableUUID(q.Name, "output")},
+		{"UUID", stableUUID(q.Name, "action")},
+		{"UnlocalizedApplications", []any{"Automator"}},
+		{"location", "449.000000:305.000000"},
+		{"nibPath", "/System/Library/Automator/Run Shell Script.action/Contents/Resources/Base.lproj/main.nib"},
+	}
+	const finder = "/System/Library/CoreServices/Finder.app"
+	document := plistDict{
+		{"AMApplicationBuild", "523"},
+		{"AMApplicationVersion", "2.10"},
+		{"AMDocumentVersion", "2"},
+		{"actions", []any{plistDict{{"action", action}, {"isViewVisible", 1}}}},
+		{"connectors", plistDict{}},
+		{"workflowMetaData", plistDict{
+			{"applicationBundleIDsByPath", plistDict{{finder, "com.apple.finder"}}},
+			{"applicationPaths", []any{finder}},
+			{"inputTypeIdentifier", "com.apple.Automator.fileSystemObject.image"},
+			{"outputTypeIdentifier", "com.apple.Automator.nothing"},
+			{"presentationMode", 15},
+			{"processesInput", 0},
+			{"serviceApplicationBundleID", "com.apple.finder"},
+			{"serviceApplicationPath", finder},
+			{"serviceInputTypeIdentifier", "com.apple.Automator.fileSystemObject.image"},
+			{"serviceOutputTypeIdentifier", "com.apple.Automator.nothing"},
+			{"serviceProcessesInput", 0},
+			{"systemImageName", "NSActionTemplate"},
+			{"useAutomaticInputType", 0},
+			{"workflowTypeIdentifier", "com.apple.Automator.servicesMenu"},
+		}},
+	}
+
+	return map[string][]byte{
+		"Contents/Info.plist":     plist(info),
+		"Contents/document.wflow": plist(document),
+	}, nil
+}
+
+// script returns the shell script the workflow runs with the selected files
+// as arguments. The outcome of each image is shown as a notification; file
+// names reach osascript as arguments so they are never parsed as AppleScript.
+func (q QuickAction) script() string {
+	words := make([]string, len(q.Command))
+	for i, word := range q.Command {
+		words[i] = shellQuote(word)
+	}
+	var b strings.Builder
+	b.WriteString("# Generated by logo-generator install-service; do not edit.\n")
+	b.WriteString(`log="${TMPDIR:-/tmp}/logo-generator-service.log"` + "\n")
+	b.WriteString("for f in \"$@\"; do\n")
+	fmt.Fprintf(&b, "\tout=\"${f%%.*}\"%s\n", shellQuote(q.OutputSuffix))
+	fmt.Fprintf(&b, "\tif %s -input \"$f\" -output \"$out\" -q >\"$log\" 2>&1; then\n", strings.Join(words, " "))
+	b.WriteString("\t\tmsg=\"Generated icons in ${out##*/}\"\n")
+	b.WriteString("\telse\n")
+	b.WriteString("\t\tmsg=\"Failed to generate icons from ${f##*/}; see $log\"\n")
+	b.WriteString("\tfi\n")
+	fmt.Fprintf(&b, "\t/usr/bin/osascript -e 'on run argv' -e 'display notification (item 1 of argv) with title (item 2 of argv)' -e 'end run' \"$msg\" %s\n", shellQuote(q.Name))
+	b.WriteString("done\n")
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package desktop
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// ShellExtension is a Windows Explorer context menu entry that runs the
+// generator on the image right-clicked and writes its icons next to it. The
+// entry runs a batch script, as only a script can derive the output
+// directory from the image's path.
+type ShellExtension struct {
+	// Name is the text of the context menu entry.
+	Name string
+	// Command is the generator's executable followed by the flags of every
+	// run, such as -preset web; -input and -output are added per image.
+	Command []string
+	// OutputSuffix is appended to an image's name without its extension to
+	// name its output directory, such as logo-icons for logo.png.
+	OutputSuffix string
+	// ScriptPath is where the batch script the entry runs is installed.
+	ScriptPath string
+}
+
+// shellExtensionTypes are the file extensions the entry is registered for.
+var shellExtensionTypes = []string{".png", ".jpg", ".jpeg"}
+
+// Key returns the name of the entry's registry key, derived from its name so
+// entries with different names can be installed side by side.
+func (e ShellExtension) Key() string {
+	return "LogoGenerator." + stableUUID("shell", e.Name)[:8]
+}
+
+// Script returns the batch script the entry runs with the image's path as
+// its argument. A failed run keeps its console window open on the error.
+func (e ShellExtension) Script() ([]byte, error) {
+	if len(e.Command) == 0 {
+		return nil, fmt.Errorf("no command to run")
+	}
+	if e.OutputSuffix == "" {
+		return nil, fmt.Errorf("an output suffix is required, so icons are not written over the image")
+	}
+	words := make([]string, len(e.Command))
+	for i, word := range e.Command {
+		quoted, err := batchQuote(word)
+		if err != nil {
+			return nil, err
+		}
+		words[i] = quoted
+	}
+	// The suffix goes inside the quotes of the output path, so quote it and
+	// strip its quotes
+	suffix, err := batchQuote(e.OutputSuffix)
+	if err != nil {
+		return nil, err
+	}
+	suffix = suffix[1 : len(suffix)-1]
+	lines := []string{
+		"@echo off",
+		"rem Generated by logo-generator install-shell-ext; do not edit.",
+		// The script is written as UTF-8, so paths outside the ANSI code page
+		// survive
+		"chcp 65001 >nul",
+		fmt.Sprintf(`%s -input "%%~f1" -output "%%~dpn1%s"`, strings.Join(words, " "), suffix),
+		"if errorlevel 1 pause",
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n"), nil
+}
+
+// RegFile returns a registry file adding the entry for the current user,
+// imported with `reg import`.
+func (e ShellExtension) RegFile() ([]byte, error) {
+	if e.Name == "" || strings.ContainsAny(e.Name, "\r\n") {
+		return nil, fmt.Errorf("invalid context menu entry name %q", e.Name)
+	}
+	if e.ScriptPath == "" || strings.Contains(e.ScriptPath, `"`) {
+		return nil, fmt.Errorf("invalid script path %q", e.ScriptPath)
+	}
+	command := fmt.Sprintf(`cmd.exe /c ""%s" "%%1""`, e.ScriptPath)
+	var b strings.Builder
+	b.WriteString("Windows Registry Editor Version 5.00\r\n")
+	for _, ext := range shellExtensionTypes {
+		key := e.keyFor(ext)
+		fmt.Fprintf(&b, "\r\n[%s]\r\n@=%s\r\n\r\n[%s\\command]\r\n@=%s\r\n", key, regString(e.Name), key, regString(command))
+	}
+	return utf16File(b.String()), nil
+}
+
+// UninstallRegFile returns a registry file removing the entry.
+func (e ShellExtension) UninstallRegFile() []byte {
+	var b strings.Builder
+	b.WriteString("Windows Registry Editor Version 5.00\r\n")
+	for _, ext := range shellExtensionTypes {
+		fmt.Fprintf(&b, "\r\n[-%s]\r\n", e.keyFor(ext))
+	}
+	return utf16File(b.String())
+}
+
+// keyFor returns the entry's registry key for a file extension. Entries
+// under SystemFileAssociations apply whichever program opens the type.
+func (e ShellExtension) keyFor(ext string) string {
+	return `HKEY_CURRENT_USER\Software\Classes\SystemFileAssociations\` + ext + `\shell\` + e.Key()
+}
+
+// batchQuote quotes s as a single argument in a batch script. Batch files
+// have no escape for a double quote inside a quoted argument, so those are
+// refused. Trailing backslashes are doubled so they do not escape the
+// closing quote when the program splits its command line.
+func batchQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "\"\r\n") {
+		return "", fmt.Errorf("%q cannot be passed through a batch script", s)
+	}
+	trimmed := strings.TrimRight(s, `\`)
+	s += strings.Repeat(`\`, len(s)-len(trimmed))
+	return `"` + strings.ReplaceAll(s, "%", "%%") + `"`, nil
+}
+
+// regString quotes s as a registry file string value.
+func regString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// utf16File encodes s as UTF-16LE with a byte order mark, the encoding
+// regedit writes and reads for version 5 registry files.
+func utf16File(s string) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFE})
+	for _, u := range utf16.Encode([]rune(s)) {
+		buf.WriteByte(byte(u))
+		buf.WriteByte(byte(u >> 8))
+	}
+	return buf.Bytes()
+}
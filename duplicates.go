@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// sourceFingerprint identifies a source by its pixels rather than its file,
+// so the same artwork saved twice with different compression or metadata
+// is still recognized.
+type sourceFingerprint struct {
+	pixels [sha256.Size]byte
+	phash  imageprocessor.PerceptualHash
+}
+
+// fingerprintSource decodes the image at path and fingerprints it.
+func fingerprintSource(path string) (sourceFingerprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return sourceFingerprint{}, err
+	}
+	defer f.Close()
+	img, _, err := imageprocessor.DecodeSafe(f, imageprocessor.DecodeLimits{})
+	if err != nil {
+		return sourceFingerprint{}, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	// Hash the pixels in one format, along with the size, whatever the
+	// encoding of the file
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	h := sha256.New()
+	fmt.Fprintf(h, "%dx%d\n", b.Dx(), b.Dy())
+	h.Write(nrgba.Pix)
+	fp := sourceFingerprint{phash: imageprocessor.HashImage(nrgba)}
+	copy(fp.pixels[:], h.Sum(nil))
+	return fp, nil
+}
+
+// duplicate records that a project's source matches the source of an
+// earlier project generated the same way.
+type duplicate struct {
+	// Of is the index of the earlier project.
+	Of int
+	// Distance is the number of bits in which the perceptual hashes of the
+	// sources differ; it is -1 when the pixels are identical.
+	Distance int
+}
+
+// String describes how close the sources are.
+func (d duplicate) String() string {
+	switch d.Distance {
+	case -1:
+		return "identical pixels"
+	case 1:
+		return "near-identical, 1 bit apart"
+	}
+	return fmt.Sprintf("near-identical, %d bits apart", d.Distance)
+}
+
+// findDuplicates returns, for projects whose source is a pixel-identical or
+// near-identical copy of an earlier project's source with the same config,
+// preset, profile, tags and vars, which earlier project it duplicates.
+// Near-identical means perceptual hashes at most maxDistance bits apart; a
+// negative maxDistance only matches identical pixels. Projects are matched
+// against the first project of each group, so a chain of small edits does
+// not add up. Sources that cannot be read are never duplicates; they fail
+// when they are generated.
+func findDuplicates(projects []workspaceProject, maxDistance int) map[int]duplicate {
+	type candidate struct {
+		index int
+		spec  string
+		fp    sourceFingerprint
+	}
+	var firsts []candidate
+	dups := map[int]duplicate{}
+	for i, p := range projects {
+		fp, err := fingerprintSource(p.Source)
+		if err != nil {
+			continue
+		}
+		spec, _ := json.Marshal([]any{p.Config, p.Preset, p.Profile, p.Tags, p.Vars})
+		// Prefer identical pixels, then the closest hash
+		best := duplicate{Of: -1}
+		for _, c := range firsts {
+			if c.spec != string(spec) {
+				continue
+			}
+			d := c.fp.phash.Distance(fp.phash)
+			if c.fp.pixels == fp.pixels {
+				d = -1
+			}
+			if (d == -1 || d <= maxDistance) && (best.Of < 0 || d < best.Distance) {
+				best = duplicate{Of: c.index, Distance: d}
+			}
+		}
+		if best.Of >= 0 {
+			dups[i] = best
+		} else {
+			firsts = append(firsts, candidate{index: i, spec: string(spec), fp: fp})
+		}
+	}
+	return dups
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/drewalth/logo-generator/export"
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// exportFlags registers the flags that write the outputs in other forms
+// next to them, and returns a function applying them after a run.
+func exportFlags(fs *flag.FlagSet) func(result *imageprocessor.Result, outputDir string, quiet bool) {
+	goPackage := fs.String("go-embed", "", "write "+export.GoEmbedFile+" declaring this Go package, which embeds the outputs")
+	dataURIs := fs.String("data-uris", "", "write the data URIs of the smallest outputs to this .json, .css or .go file, for inlining")
+	dataURIMax := fs.String("data-uri-max", "4KiB", "largest output included in -data-uris")
+	sprite := fs.String("sprite", "", "pack the outputs into this sprite sheet PNG, with its frames in .json and .css files of the same name")
+	spriteOutputs := fs.String("sprite-outputs", "", "comma separated outputs to pack into -sprite (default: all)")
+	snippets := fs.String("snippets", "", "write a .swift (SwiftUI), .kt (Jetpack Compose) or .ts file referencing the PNG and JPEG outputs")
+	tokens := fs.String("design-tokens", "", "write Style Dictionary design tokens describing the outputs to this JSON file")
+	snippetPackage := fs.String("snippet-package", "", "Kotlin package of the -snippets file, holding the app's R class")
+	palette := fs.String("palette", "", "write the source's dominant colors to this .json or .scss file")
+	byteArrays := fs.String("byte-arrays", "", "write the outputs as arrays in this .h (C) or .rs (Rust) file, for firmware")
+	byteArrayOutputs := fs.String("byte-array-outputs", "", "comma separated outputs to include in -byte-arrays (default: all)")
+	byteArrayRGB565 := fs.Bool("byte-array-rgb565", false, "declare the decoded RGB565 pixels of the outputs in -byte-arrays instead of their encoded bytes")
+
+	return func(result *imageprocessor.Result, outputDir string, quiet bool) {
+		var generated []string
+		for _, out := range result.Outputs {
+			if out.Status.Succeeded() {
+				generated = append(generated, filepath.ToSlash(out.Dimension.Name))
+			}
+		}
+
+		if *goPackage != "" {
+			src, err := export.GoEmbed(*goPackage, filepath.Base(result.Source), generated)
+			if err != nil {
+				log.Fatalf("Error: -go-embed: %v\n", err)
+			}
+			writeExport(filepath.Join(outputDir, export.GoEmbedFile), src, quiet)
+		}
+		if *dataURIs != "" {
+			data, err := dataURIFile(*dataURIs, *dataURIMax, result)
+			if err != nil {
+				log.Fatalf("Error: -data-uris: %v\n", err)
+			}
+			writeExport(*dataURIs, data, quiet)
+		}
+		if *sprite != "" {
+			var names []string
+			if *spriteOutputs != "" {
+				names = strings.Split(*spriteOutputs, ",")
+			}
+			if err := writeSprite(*sprite, names, result, quiet); err != nil {
+				log.Fatalf("Error: -sprite: %v\n", err)
+			}
+		}
+		if *snippets != "" {
+			data, err := snippetFile(*snippets, *snippetPackage, result, outputDir)
+			if err != nil {
+				log.Fatalf("Error: -snippets: %v\n", err)
+			}
+			writeExport(*snippets, data, quiet)
+		}
+		if *tokens != "" {
+			data, err := export.DesignTokens(outputAssets(result, outputDir))
+			if err != nil {
+				log.Fatalf("Error: -design-tokens: %v\n", err)
+			}
+			writeExport(*tokens, data, quiet)
+		}
+		if *byteArrays != "" {
+			var names []string
+			if *byteArrayOutputs != "" {
+				names = strings.Split(*byteArrayOutputs, ",")
+			}
+			data, err := byteArrayFile(*byteArrays, names, *byteArrayRGB565, result)
+			if err != nil {
+				log.Fatalf("Error: -byte-arrays: %v\n", err)
+			}
+			writeExport(*byteArrays, data, quiet)
+		}
+		if *palette != "" {
+			kind, err := export.PaletteKind(*palette)
+			if err != nil {
+				log.Fatalf("Error: -palette: %v\n", err)
+			}
+			colors := make([]export.PaletteColor, len(result.Palette))
+			for i, c := range result.Palette {
+				colors[i] = export.PaletteColor{Hex: c.Hex, Coverage: c.Coverage}
+			}
+			data, err := export.PaletteFile(kind, colors)
+			if err != nil {
+				log.Fatalf("Error: -palette: %v\n", err)
+			}
+			writeExport(*palette, data, quiet)
+		}
+	}
+}
+
+// writeSprite packs the named outputs of result, or all of them, into the
+// sprite sheet at path and writes its JSON and CSS descriptions next to it.
+func writeSprite(path string, names []string, result *imageprocessor.Result, quiet bool) error {
+	if filepath.Ext(path) != ".png" {
+		return fmt.Errorf("%s: sprite sheets are written as PNG", path)
+	}
+	var images []export.SpriteImage
+	for _, out := range result.Outputs {
+		name := filepath.ToSlash(out.Dimension.Name)
+		if !out.Status.Succeeded() || (names != nil && !slices.Contains(names, name)) {
+			continue
+		}
+		data, err := os.ReadFile(out.Path)
+		if err != nil {
+			return err
+		}
+		img, err := imageprocessor.DecodeOutput(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		images = append(images, export.SpriteImage{Name: name, Image: img})
+	}
+	if len(images) != len(names) && names != nil {
+		for _, name := range names {
+			if !slices.ContainsFunc(images, func(img export.SpriteImage) bool { return img.Name == name }) {
+				return fmt.Errorf("%s is not generated by this run", name)
+			}
+		}
+	}
+
+	sheet, frames, err := export.PackSprite(images)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	if err := png.Encode(&data, sheet); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(path, ".png")
+	js, err := export.SpriteJSON(filepath.Base(path), sheet.Bounds(), frames)
+	if err != nil {
+		return err
+	}
+	css, err := export.SpriteCSS(filepath.Base(path), frames)
+	if err != nil {
+		return err
+	}
+	writeExport(path, data.Bytes(), quiet)
+	writeExport(base+".json", js, quiet)
+	writeExport(base+".css", css, quiet)
+	return nil
+}
+
+// byteArrayFile renders the byte array file at path for the named outputs
+// of result, or all of them, as encoded bytes or RGB565 pixels.
+func byteArrayFile(path string, names []string, rgb565 bool, result *imageprocessor.Result) ([]byte, error) {
+	kind, err := export.ByteArrayKind(path)
+	if err != nil {
+		return nil, err
+	}
+	var arrays []export.ByteArray
+	for _, out := range result.Outputs {
+		name := filepath.ToSlash(out.Dimension.Name)
+		if !out.Status.Succeeded() || (names != nil && !slices.Contains(names, name)) {
+			continue
+		}
+		data, err := os.ReadFile(out.Path)
+		if err != nil {
+			return nil, err
+		}
+		array := export.ByteArray{Name: name, Data: data}
+		if rgb565 {
+			if array.Pixels, err = imageprocessor.DecodeOutput(data); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		arrays = append(arrays, array)
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(arrays, func(a export.ByteArray) bool { return a.Name == name }) {
+			return nil, fmt.Errorf("%s is not generated by this run", name)
+		}
+	}
+	return export.ByteArrays(kind, path, arrays)
+}
+
+// snippetFile renders the snippet file at path for the outputs of result,
+// referencing outputDir relative to it.
+func snippetFile(path, pkg string, result *imageprocessor.Result, outputDir string) ([]byte, error) {
+	kind, err := export.SnippetKind(path)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "kotlin" && pkg == "" {
+		return nil, fmt.Errorf("-snippet-package is required for Kotlin snippets")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	absOutput, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Rel(filepath.Dir(abs), absOutput)
+	if err != nil {
+		return nil, err
+	}
+	return export.Snippets(kind, pkg, filepath.ToSlash(dir), outputAssets(result, outputDir))
+}
+
+// outputAssets describes the outputs of result that are in place, in
+// outputDir, for the exports; their data is not read.
+func outputAssets(result *imageprocessor.Result, outputDir string) []export.Asset {
+	var assets []export.Asset
+	for _, out := range result.Outputs {
+		if out.Status.Succeeded() {
+			dim := out.Dimension
+			assets = append(assets, export.Asset{
+				Name: filepath.ToSlash(dim.Name), Path: filepath.ToSlash(filepath.Join(outputDir, dim.Name)),
+				Width: dim.Width, Height: dim.Height, Format: dim.Format, Tags: dim.Tags,
+			})
+		}
+	}
+	return assets
+}
+
+// dataURIFile renders the data URI file at path for the outputs of result
+// of at most maxSize. Go files declare the package named after their
+// directory.
+func dataURIFile(path, maxSize string, result *imageprocessor.Result) ([]byte, error) {
+	kind, err := export.DataURIKind(path)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := imageprocessor.ParseByteSize(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("-data-uri-max: %w", err)
+	}
+	var assets []export.Asset
+	for _, out := range result.Outputs {
+		if !out.Status.Succeeded() || out.Bytes > limit {
+			continue
+		}
+		data, err := os.ReadFile(out.Path)
+		if err != nil {
+			return nil, err
+		}
+		dim := out.Dimension
+		assets = append(assets, export.Asset{
+			Name: filepath.ToSlash(dim.Name), Path: filepath.ToSlash(out.Path),
+			Width: dim.Width, Height: dim.Height, Format: dim.Format, Tags: dim.Tags, Data: data,
+		})
+	}
+	if len(assets) == 0 {
+		return nil, fmt.Errorf("no output is %s or smaller; raise -data-uri-max", imageprocessor.FormatBytes(limit))
+	}
+	var pkg string
+	if kind == "go" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		pkg = filepath.Base(filepath.Dir(abs))
+	}
+	return export.DataURIs(kind, pkg, assets)
+}
+
+// writeExport writes an exported file.
+func writeExport(path string, data []byte, quiet bool) {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if !quiet {
+		fmt.Println("Wrote", path)
+	}
+}
@@ -0,0 +1,181 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ByteArray is an output declared as an array in C or Rust source.
+type ByteArray struct {
+	Name string
+	// Data holds the encoded output, unless Pixels is set.
+	Data []byte
+	// Pixels is the decoded output, declared as RGB565 pixels instead.
+	Pixels image.Image
+}
+
+// ByteArrayKind returns the language of the file ByteArrays writes for a
+// file name: c or rust, by its extension.
+func ByteArrayKind(name string) (string, error) {
+	switch path.Ext(name) {
+	case ".h":
+		return "c", nil
+	case ".rs":
+		return "rust", nil
+	default:
+		return "", fmt.Errorf("%s: byte arrays are written as .h or .rs files", name)
+	}
+}
+
+// arrayIdentifierParts splits names into runs of ASCII letters and digits, the
+// characters C and Rust identifiers share.
+var arrayIdentifierParts = regexp.MustCompile(`[A-Za-z0-9]+`)
+
+// Identifier turns a name into a lower snake_case identifier valid in C
+// and Rust, prefixed with icon_ when it would start with a digit. The
+// extension is part of the name, so favicon-32x32.png becomes
+// favicon_32x32_png; callers trim it where it is not wanted.
+func Identifier(name string) string {
+	id := strings.ToLower(strings.Join(arrayIdentifierParts.FindAllString(name, -1), "_"))
+	if id == "" || id[0] >= '0' && id[0] <= '9' {
+		id = "icon_" + id
+	}
+	return id
+}
+
+// ArrayWriter writes a C header or a Rust module declaring constant
+// arrays, for firmware that has no file system. C headers get an include
+// guard named after their file and include <stdint.h>.
+type ArrayWriter struct {
+	kind  string
+	guard string
+	b     bytes.Buffer
+}
+
+// NewArrayWriter starts the file of the given kind, c or rust, with the
+// comment lines, each without its leading //.
+func NewArrayWriter(kind, file string, comment ...string) *ArrayWriter {
+	w := &ArrayWriter{kind: kind}
+	for _, line := range comment {
+		w.Comment("%s", line)
+	}
+	w.b.WriteByte('\n')
+	if kind == "c" {
+		w.guard = strings.ToUpper(Identifier(path.Base(file)))
+		fmt.Fprintf(&w.b, "#ifndef %s\n#define %s\n\n#include <stdint.h>\n\n", w.guard, w.guard)
+	} else {
+		w.b.WriteString("#![allow(dead_code)]\n\n")
+	}
+	return w
+}
+
+// Comment writes a comment line.
+func (w *ArrayWriter) Comment(format string, args ...any) {
+	fmt.Fprintf(&w.b, "// "+format+"\n", args...)
+}
+
+// Const declares an integer constant, a macro in C, named after id in
+// upper case.
+func (w *ArrayWriter) Const(id string, value int) {
+	if w.kind == "c" {
+		fmt.Fprintf(&w.b, "#define %s %d\n", strings.ToUpper(id), value)
+	} else {
+		fmt.Fprintf(&w.b, "pub const %s: usize = %d;\n", strings.ToUpper(id), value)
+	}
+}
+
+// Bytes declares data as an array of bytes, with an id_LEN macro in C.
+func (w *ArrayWriter) Bytes(id string, data []byte) {
+	if w.kind == "c" {
+		w.Const(id+"_len", len(data))
+	}
+	w.array(id, "uint8_t", "u8", len(data), 12, func(i int) string { return fmt.Sprintf("0x%02x", data[i]) })
+}
+
+// Uint16s declares values as an array of 16-bit integers.
+func (w *ArrayWriter) Uint16s(id string, values []uint16) {
+	w.array(id, "uint16_t", "u16", len(values), 8, func(i int) string { return fmt.Sprintf("0x%04x", values[i]) })
+}
+
+// array declares n values of the given C and Rust types, perLine to a
+// line. C arrays are named id, Rust statics id in upper case.
+func (w *ArrayWriter) array(id, cType, rustType string, n, perLine int, value func(i int) string) {
+	if w.kind == "c" {
+		fmt.Fprintf(&w.b, "static const %s %s[%d] = {", cType, id, n)
+	} else {
+		fmt.Fprintf(&w.b, "pub static %s: [%s; %d] = [", strings.ToUpper(id), rustType, n)
+	}
+	for i := range n {
+		if i%perLine == 0 {
+			w.b.WriteString("\n    ")
+		} else {
+			w.b.WriteByte(' ')
+		}
+		w.b.WriteString(value(i) + ",")
+	}
+	if w.kind == "c" {
+		w.b.WriteString("\n};\n\n")
+	} else {
+		w.b.WriteString("\n];\n\n")
+	}
+}
+
+// Finish ends the file and returns it.
+func (w *ArrayWriter) Finish() []byte {
+	if w.kind == "c" {
+		fmt.Fprintf(&w.b, "#endif // %s\n", w.guard)
+	}
+	return w.b.Bytes()
+}
+
+// ByteArrays returns a C header or Rust module, as kind says, declaring an
+// array per output for firmware that has no file system. Encoded outputs
+// are byte arrays; decoded ones are RGB565 pixels in rows top to bottom,
+// flattened over black, with width and height constants. file names the
+// header for its include guard.
+func ByteArrays(kind, file string, arrays []ByteArray) ([]byte, error) {
+	if len(arrays) == 0 {
+		return nil, fmt.Errorf("no outputs to export")
+	}
+	ids := make([]string, len(arrays))
+	seen := map[string]string{}
+	for i, a := range arrays {
+		ids[i] = Identifier(a.Name)
+		if other, ok := seen[ids[i]]; ok {
+			return nil, fmt.Errorf("%s and %s both map to the identifier %s", other, a.Name, ids[i])
+		}
+		seen[ids[i]] = a.Name
+	}
+
+	w := NewArrayWriter(kind, file, "Code generated by logo-generator; DO NOT EDIT.")
+	for i, a := range arrays {
+		if a.Pixels == nil {
+			w.Comment("%s, %d bytes.", a.Name, len(a.Data))
+			w.Bytes(ids[i], a.Data)
+			continue
+		}
+		bounds := a.Pixels.Bounds()
+		width, height := bounds.Dx(), bounds.Dy()
+		w.Comment("%s, %dx%d RGB565 pixels.", a.Name, width, height)
+		w.Const(ids[i]+"_width", width)
+		w.Const(ids[i]+"_height", height)
+		pixels := make([]uint16, 0, width*height)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixels = append(pixels, rgb565(a.Pixels.At(x, y).RGBA()))
+			}
+		}
+		w.Uint16s(ids[i], pixels)
+	}
+	return w.Finish(), nil
+}
+
+// rgb565 packs premultiplied 16-bit channels, which are the color over
+// black, into 5 bits of red, 6 of green and 5 of blue.
+func rgb565(r, g, b, _ uint32) uint16 {
+	return uint16(r>>11<<11 | g>>10<<5 | b>>11)
+}
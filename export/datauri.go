@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// mediaTypes maps output formats to the media types of their data URIs.
+var mediaTypes = map[string]string{
+	"":     "image/png",
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"ico":  "image/x-icon",
+	"icns": "image/icns",
+	"ktx2": "image/ktx2",
+	"dds":  "image/vnd-ms.dds",
+	"gif":  "image/gif",
+	"h":    "text/x-c",
+	"xml":  "application/xml",
+}
+
+// DataURI returns the base64 data URI of an asset.
+func DataURI(a Asset) string {
+	mediaType, ok := mediaTypes[a.Format]
+	if !ok {
+		mediaType = "application/octet-stream"
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// DataURIKind returns the kind of data URI file DataURIs writes for a file
+// name: json, css or go, by its extension.
+func DataURIKind(name string) (string, error) {
+	switch ext := path.Ext(name); ext {
+	case ".json", ".css", ".go":
+		return ext[1:], nil
+	default:
+		return "", fmt.Errorf("%s: data URIs are written as .json, .css or .go files", name)
+	}
+}
+
+// cssUnsafe matches the characters of output names that custom property
+// names cannot hold unescaped.
+var cssUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// DataURIs renders the data URIs of assets as a file of the given kind:
+// "json" for an object mapping output names to URIs, "css" for custom
+// properties on :root such as --icon-favicon-16x16-png, usable as
+// background-image values, or "go" for a map in package pkg.
+func DataURIs(kind, pkg string, assets []Asset) ([]byte, error) {
+	names := make([]string, len(assets))
+	for i, a := range assets {
+		names[i] = a.Name
+	}
+	if err := checkNames(names); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	switch kind {
+	case "json":
+		uris := make(map[string]string, len(assets))
+		for _, a := range assets {
+			uris[a.Name] = DataURI(a)
+		}
+		data, err := json.MarshalIndent(uris, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "css":
+		b.WriteString("/* Generated by logo-generator; do not edit. */\n:root {\n")
+		seen := map[string]string{}
+		for _, a := range assets {
+			property := "--icon-" + cssUnsafe.ReplaceAllString(a.Name, "-")
+			if other, ok := seen[property]; ok {
+				return nil, fmt.Errorf("%s and %s both map to the CSS property %s", other, a.Name, property)
+			}
+			seen[property] = a.Name
+			fmt.Fprintf(&b, "  %s: url(\"%s\");\n", property, DataURI(a))
+		}
+		b.WriteString("}\n")
+		return b.Bytes(), nil
+	case "go":
+		if !token.IsIdentifier(pkg) || token.IsKeyword(pkg) {
+			return nil, fmt.Errorf("%q is not a valid Go package name", pkg)
+		}
+		fmt.Fprintf(&b, "// Code generated by logo-generator; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+		b.WriteString("// DataURIs maps icon names to their data URIs, for inlining into pages.\nvar DataURIs = map[string]string{\n")
+		for _, a := range assets {
+			fmt.Fprintf(&b, "%s: %s,\n", strconv.Quote(a.Name), strconv.Quote(DataURI(a)))
+		}
+		b.WriteString("}\n")
+		return format.Source(b.Bytes())
+	default:
+		return nil, fmt.Errorf("unknown data URI file kind %q", kind)
+	}
+}
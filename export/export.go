@@ -0,0 +1,39 @@
+// Package export writes generated icons in forms other programs consume
+// directly, such as Go source files embedding them and data URIs for
+// inlining.
+package export
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Asset is a generated file to export. Each export reads the fields it
+// needs: data URIs embed Data, snippets declare the size, and design tokens
+// also point at Path and sort the Tags into platforms and purposes.
+type Asset struct {
+	// Name is the output name, with forward slashes.
+	Name string
+	// Path is where tools using the export find the file.
+	Path          string
+	Width, Height uint
+	// Format is the output format, e.g. png or ico; empty means PNG.
+	Format string
+	Tags   []string
+	// Data holds the contents of the file.
+	Data []byte
+}
+
+// checkNames rejects output names that cannot be referenced from the
+// generated files.
+func checkNames(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no outputs to export")
+	}
+	for _, name := range names {
+		if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) {
+			return fmt.Errorf("invalid output name %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// GoEmbedFile is the name of the file GoEmbed's output is meant to be
+// written to, in the directory holding the outputs.
+const GoEmbedFile = "icons_embed.go"
+
+// GoEmbed returns the source of a Go file declaring package pkg that embeds
+// the named outputs, relative to its directory, with //go:embed. The
+// package exposes them as an embed.FS, a map from name to contents and a
+// Lookup function. source names the master logo in the doc comment.
+func GoEmbed(pkg, source string, names []string) ([]byte, error) {
+	if !token.IsIdentifier(pkg) || token.IsKeyword(pkg) {
+		return nil, fmt.Errorf("%q is not a valid Go package name", pkg)
+	}
+	if err := checkNames(names); err != nil {
+		return nil, err
+	}
+	names = slices.Sorted(slices.Values(names))
+	patterns := make([]string, len(names))
+	for i, name := range names {
+		// Embed patterns are globs, and module rules keep some names out
+		if strings.ContainsAny(name, "*?[]\"'`") || slices.Contains(strings.Split(name, "/"), "..") {
+			return nil, fmt.Errorf("%s cannot be embedded: its name holds characters //go:embed does not accept", name)
+		}
+		patterns[i] = strconv.Quote(name)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by logo-generator from %s; DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "// Package %s holds the icon set generated from %s.\n", pkg, source)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import (\n\"embed\"\n\"io/fs\"\n)\n\n")
+	b.WriteString("// FS holds the icons under their output names.\n//\n")
+	for _, pattern := range patterns {
+		fmt.Fprintf(&b, "//go:embed %s\n", pattern)
+	}
+	b.WriteString("var FS embed.FS\n\n")
+	b.WriteString("// Names lists the icons, sorted.\nvar Names = []string{\n")
+	for _, pattern := range patterns {
+		fmt.Fprintf(&b, "%s,\n", pattern)
+	}
+	b.WriteString("}\n\n")
+	b.WriteString(`// Files maps each icon's name to its contents.
+var Files = func() map[string][]byte {
+	files := make(map[string][]byte, len(Names))
+	for _, name := range Names {
+		data, err := fs.ReadFile(FS, name)
+		if err != nil {
+			panic(err)
+		}
+		files[name] = data
+	}
+	return files
+}()
+
+// Lookup returns the contents of the named icon.
+func Lookup(name string) ([]byte, bool) {
+	data, ok := Files[name]
+	return data, ok
+}
+`)
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// PaletteColor is a dominant color of the source.
+type PaletteColor struct {
+	// Hex is the color as #rrggbb.
+	Hex string `json:"hex"`
+	// Coverage is the percentage of the source's opaque pixels the color
+	// stands for.
+	Coverage float64 `json:"coverage"`
+}
+
+// hexColor matches the colors PaletteFile accepts.
+var hexColor = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// PaletteKind returns the kind of palette file PaletteFile writes for a
+// file name: json or scss, by its extension.
+func PaletteKind(name string) (string, error) {
+	switch ext := path.Ext(name); ext {
+	case ".json", ".scss":
+		return ext[1:], nil
+	default:
+		return "", fmt.Errorf("%s: palettes are written as .json or .scss files", name)
+	}
+}
+
+// PaletteFile renders the palette, most common color first, as a palette
+// of the given kind:
+//   - "json": {"colors": [{"name": "logo-1", "hex": ..., "coverage": ...}]}
+//   - "scss": variables $logo-1, $logo-2, ... and a $logo-palette list of
+//     them, for deriving theme colors in stylesheets.
+func PaletteFile(kind string, colors []PaletteColor) ([]byte, error) {
+	if len(colors) == 0 {
+		return nil, fmt.Errorf("the source has no opaque pixels to take a palette from")
+	}
+	for _, c := range colors {
+		if !hexColor.MatchString(c.Hex) {
+			return nil, fmt.Errorf("invalid palette color %q", c.Hex)
+		}
+	}
+
+	var b bytes.Buffer
+	switch kind {
+	case "json":
+		type namedColor struct {
+			Name string `json:"name"`
+			PaletteColor
+		}
+		named := make([]namedColor, len(colors))
+		for i, c := range colors {
+			named[i] = namedColor{fmt.Sprintf("logo-%d", i+1), c}
+		}
+		data, err := json.MarshalIndent(map[string]any{"colors": named}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "scss":
+		b.WriteString("// Generated by logo-generator; do not edit.\n")
+		for i, c := range colors {
+			fmt.Fprintf(&b, "$logo-%d: %s; // %g%% of the logo\n", i+1, c.Hex, c.Coverage)
+		}
+		b.WriteString("$logo-palette: (")
+		for i := range colors {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$logo-%d", i+1)
+		}
+		b.WriteString(");\n")
+		return b.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown palette file kind %q", kind)
+	}
+}
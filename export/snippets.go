@@ -0,0 +1,166 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// SnippetKind returns the language of the snippet file Snippets writes for a
+// file name: swift, kotlin or typescript, by its extension.
+func SnippetKind(name string) (string, error) {
+	switch path.Ext(name) {
+	case ".swift":
+		return "swift", nil
+	case ".kt":
+		return "kotlin", nil
+	case ".ts":
+		return "typescript", nil
+	default:
+		return "", fmt.Errorf("%s: snippets are written as .swift, .kt or .ts files", name)
+	}
+}
+
+// reservedWords are keywords of Swift, Kotlin or TypeScript that icon names
+// may spell; identifiers matching one get an Icon suffix.
+var reservedWords = map[string]bool{
+	"as": true, "break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "default": true, "do": true, "else": true, "enum": true, "export": true,
+	"extends": true, "false": true, "for": true, "fun": true, "func": true, "if": true,
+	"import": true, "in": true, "is": true, "let": true, "new": true, "null": true,
+	"object": true, "private": true, "public": true, "return": true, "self": true, "static": true,
+	"super": true, "switch": true, "this": true, "throw": true, "true": true, "try": true,
+	"typealias": true, "typeof": true, "val": true, "var": true, "void": true, "when": true,
+	"where": true, "while": true,
+}
+
+// identifierParts splits names into runs of letters and digits.
+var identifierParts = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// identifier turns an output name into a lowerCamelCase identifier, such as
+// favicon32x32 for favicon-32x32.png.
+func identifier(name string) string {
+	var b strings.Builder
+	for i, part := range identifierParts.FindAllString(strings.TrimSuffix(name, path.Ext(name)), -1) {
+		runes := []rune(part)
+		if i == 0 {
+			runes[0] = unicode.ToLower(runes[0])
+		} else {
+			// Keep digits of adjacent parts apart, as in icon128x128_2x
+			if prev := b.String(); unicode.IsDigit(rune(prev[len(prev)-1])) && unicode.IsDigit(runes[0]) {
+				b.WriteByte('_')
+			}
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		b.WriteString(string(runes))
+	}
+	id := b.String()
+	switch {
+	case id == "":
+		return "icon"
+	case unicode.IsDigit([]rune(id)[0]):
+		return "icon" + id
+	case reservedWords[id]:
+		return id + "Icon"
+	}
+	return id
+}
+
+// androidResource matches valid Android resource names.
+var androidResource = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// kotlinPackage matches dotted Kotlin package names.
+var kotlinPackage = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// quote quotes s as a string literal of lang. Output names hold no control
+// characters, so only quotes, backslashes and interpolation need escaping.
+func quote(lang, s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+	if lang == "kotlin" {
+		s = strings.ReplaceAll(s, "$", `\$`)
+	}
+	return `"` + s + `"`
+}
+
+// Snippets renders a source file of the given kind referencing the PNG and
+// JPEG icons, which are the formats UI toolkits load:
+//   - "swift": a SwiftUI Icons enum of Image values, by asset catalog name
+//   - "kotlin": a Jetpack Compose Icons object in package pkg, whose
+//     properties are the painterResource of each drawable
+//   - "typescript": an icons map importing each icon from dir, the output
+//     directory relative to the snippet file, for bundlers
+func Snippets(kind, pkg, dir string, icons []Asset) ([]byte, error) {
+	names := make([]string, len(icons))
+	for i, icon := range icons {
+		names[i] = icon.Name
+	}
+	if err := checkNames(names); err != nil {
+		return nil, err
+	}
+	var images []Asset
+	for _, icon := range icons {
+		if icon.Format == "" || icon.Format == "png" || icon.Format == "jpeg" {
+			images = append(images, icon)
+		}
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no PNG or JPEG outputs to reference")
+	}
+	ids := make([]string, len(images))
+	seen := map[string]string{}
+	for i, icon := range images {
+		ids[i] = identifier(icon.Name)
+		if other, ok := seen[ids[i]]; ok {
+			return nil, fmt.Errorf("%s and %s both map to the identifier %s", other, icon.Name, ids[i])
+		}
+		seen[ids[i]] = icon.Name
+	}
+
+	var b bytes.Buffer
+	switch kind {
+	case "swift":
+		b.WriteString("// Generated by logo-generator; do not edit.\nimport SwiftUI\n\n")
+		b.WriteString("/// The generated icons, loaded from the asset catalog by output name without extension.\nenum Icons {\n")
+		for i, icon := range images {
+			fmt.Fprintf(&b, "    /// %s, %dx%d\n    static let %s = Image(%s)\n", icon.Name, icon.Width, icon.Height,
+				ids[i], quote(kind, strings.TrimSuffix(icon.Name, path.Ext(icon.Name))))
+		}
+		b.WriteString("}\n")
+	case "kotlin":
+		if !kotlinPackage.MatchString(pkg) {
+			return nil, fmt.Errorf("%q is not a valid Kotlin package name", pkg)
+		}
+		fmt.Fprintf(&b, "// Generated by logo-generator; do not edit.\npackage %s\n\n", pkg)
+		b.WriteString("import androidx.compose.runtime.Composable\nimport androidx.compose.ui.graphics.painter.Painter\nimport androidx.compose.ui.res.painterResource\n\n")
+		b.WriteString("/** The generated icons, loaded from the drawable resources named after them. */\nobject Icons {\n")
+		for i, icon := range images {
+			resource := strings.TrimSuffix(icon.Name, path.Ext(icon.Name))
+			if !androidResource.MatchString(resource) {
+				return nil, fmt.Errorf("%s is not a valid Android resource name; use lowercase letters, digits and underscores", icon.Name)
+			}
+			fmt.Fprintf(&b, "    /** %s, %dx%d */\n    val %s: Painter\n        @Composable get() = painterResource(R.drawable.%s)\n",
+				icon.Name, icon.Width, icon.Height, ids[i], resource)
+		}
+		b.WriteString("}\n")
+	case "typescript":
+		b.WriteString("// Generated by logo-generator; do not edit.\n")
+		for i, icon := range images {
+			src := path.Join(dir, icon.Name)
+			if !strings.HasPrefix(src, "../") {
+				src = "./" + src
+			}
+			fmt.Fprintf(&b, "import %sSrc from %s;\n", ids[i], quote(kind, src))
+		}
+		b.WriteString("\n/** The generated icons by name, with their sizes. */\nexport const icons = {\n")
+		for i, icon := range images {
+			fmt.Fprintf(&b, "  %s: { src: %sSrc, width: %d, height: %d },\n", ids[i], ids[i], icon.Width, icon.Height)
+		}
+		b.WriteString("} as const;\n\nexport type IconName = keyof typeof icons;\n")
+	default:
+		return nil, fmt.Errorf("unknown snippet kind %q", kind)
+	}
+	return b.Bytes(), nil
+}
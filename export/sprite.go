@@ -0,0 +1,123 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"slices"
+	"strings"
+)
+
+// spritePadding is the transparent gap around every frame of a sprite
+// sheet, so scaled or rounded background positions never show a neighbor.
+const spritePadding = 2
+
+// SpriteImage is an image to pack into a sprite sheet.
+type SpriteImage struct {
+	Name  string
+	Image image.Image
+}
+
+// SpriteFrame is where an image was placed on a sprite sheet.
+type SpriteFrame struct {
+	Name   string `json:"-"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// PackSprite packs images into one sheet, tallest first into rows about as
+// wide as the sheet is tall, and returns the sheet with the frames in the
+// order of images.
+func PackSprite(images []SpriteImage) (*image.NRGBA, []SpriteFrame, error) {
+	names := make([]string, len(images))
+	for i, img := range images {
+		names[i] = img.Name
+	}
+	if err := checkNames(names); err != nil {
+		return nil, nil, err
+	}
+
+	// Aim for a square sheet, but at least as wide as the widest image
+	area, widest := 0, 0
+	for _, img := range images {
+		size := img.Image.Bounds().Size().Add(image.Pt(2*spritePadding, 2*spritePadding))
+		area += size.X * size.Y
+		widest = max(widest, size.X)
+	}
+	width := max(widest, int(math.Ceil(math.Sqrt(float64(area)))))
+
+	order := make([]int, len(images))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return images[b].Image.Bounds().Dy() - images[a].Image.Bounds().Dy()
+	})
+
+	frames := make([]SpriteFrame, len(images))
+	x, y, rowHeight, height := 0, 0, 0, 0
+	for _, i := range order {
+		size := images[i].Image.Bounds().Size()
+		if x+size.X+2*spritePadding > width {
+			x, y, rowHeight = 0, y+rowHeight, 0
+		}
+		frames[i] = SpriteFrame{Name: images[i].Name, X: x + spritePadding, Y: y + spritePadding, Width: size.X, Height: size.Y}
+		x += size.X + 2*spritePadding
+		rowHeight = max(rowHeight, size.Y+2*spritePadding)
+		height = max(height, y+rowHeight)
+	}
+
+	sheet := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, frame := range frames {
+		r := image.Rect(frame.X, frame.Y, frame.X+frame.Width, frame.Y+frame.Height)
+		draw.Draw(sheet, r, images[i].Image, images[i].Image.Bounds().Min, draw.Src)
+	}
+	return sheet, frames, nil
+}
+
+// SpriteJSON describes the frames of the sprite sheet sheetName as JSON, an
+// object of the sheet's name and size and its frames by output name.
+func SpriteJSON(sheetName string, sheet image.Rectangle, frames []SpriteFrame) ([]byte, error) {
+	byName := make(map[string]SpriteFrame, len(frames))
+	for _, frame := range frames {
+		byName[frame.Name] = frame
+	}
+	data, err := json.MarshalIndent(struct {
+		Image  string                 `json:"image"`
+		Width  int                    `json:"width"`
+		Height int                    `json:"height"`
+		Frames map[string]SpriteFrame `json:"frames"`
+	}{sheetName, sheet.Dx(), sheet.Dy(), byName}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// SpriteCSS writes a class per frame, such as .icon-favicon-32x32-png,
+// showing it from the sprite sheet at sheetURL.
+func SpriteCSS(sheetURL string, frames []SpriteFrame) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("/* Generated by logo-generator; do not edit. */\n")
+	seen := map[string]string{}
+	for _, frame := range frames {
+		class := "icon-" + cssUnsafe.ReplaceAllString(frame.Name, "-")
+		if other, ok := seen[class]; ok {
+			return nil, fmt.Errorf("%s and %s both map to the CSS class %s", other, frame.Name, class)
+		}
+		seen[class] = frame.Name
+		fmt.Fprintf(&b, ".%s {\n  background: url(%s) no-repeat -%dpx -%dpx;\n  width: %dpx;\n  height: %dpx;\n}\n",
+			class, cssString(sheetURL), frame.X, frame.Y, frame.Width, frame.Height)
+	}
+	return b.Bytes(), nil
+}
+
+// cssString quotes s as a CSS string.
+func cssString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\a `).Replace(s) + `"`
+}
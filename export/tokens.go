@@ -0,0 +1,76 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// platformTags are the tags that name a platform rather than a purpose.
+var platformTags = []string{"android", "ios", "ipados", "linux", "macos", "standalone", "tvos", "watchos", "web", "windows"}
+
+// designToken is an asset token in the Style Dictionary format.
+type designToken struct {
+	Value      string          `json:"value"`
+	Type       string          `json:"type"`
+	Comment    string          `json:"comment,omitempty"`
+	Attributes tokenAttributes `json:"attributes"`
+}
+
+// tokenAttributes is the metadata of an asset token.
+type tokenAttributes struct {
+	Width    uint     `json:"width"`
+	Height   uint     `json:"height"`
+	Format   string   `json:"format"`
+	Platform []string `json:"platform,omitempty"`
+	Purpose  []string `json:"purpose,omitempty"`
+}
+
+// DesignTokens renders assets as Style Dictionary design tokens under
+// asset.icon, keyed like the CSS exports, such as favicon-32x32-png. Each
+// token's value is the asset's path and its attributes give its size,
+// format, and the platforms and purposes its tags name.
+func DesignTokens(assets []Asset) ([]byte, error) {
+	names := make([]string, len(assets))
+	for i, a := range assets {
+		names[i] = a.Name
+	}
+	if err := checkNames(names); err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[string]designToken, len(assets))
+	seen := map[string]string{}
+	for _, a := range assets {
+		key := cssUnsafe.ReplaceAllString(a.Name, "-")
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s and %s both map to the token %s", other, a.Name, key)
+		}
+		seen[key] = a.Name
+
+		format := a.Format
+		if format == "" {
+			format = "png"
+		}
+		attrs := tokenAttributes{Width: a.Width, Height: a.Height, Format: format}
+		for _, tag := range a.Tags {
+			if slices.Contains(platformTags, tag) {
+				attrs.Platform = append(attrs.Platform, tag)
+			} else {
+				attrs.Purpose = append(attrs.Purpose, tag)
+			}
+		}
+		tokens[key] = designToken{
+			Value:      a.Path,
+			Type:       "asset",
+			Comment:    fmt.Sprintf("%s, %dx%d", a.Name, a.Width, a.Height),
+			Attributes: attrs,
+		}
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"asset": map[string]any{"icon": tokens}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
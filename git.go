@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitFlags registers the flags that commit the generated icons, and returns
+// a function committing them after a run. The output directory is committed
+// together with the app manifests the patch flags changed and the files the
+// changelog and export flags wrote.
+func gitFlags(fs *flag.FlagSet) func(ctx context.Context, outputDir string, quiet bool) {
+	message := fs.String("git-commit", "", "commit the output directory with this message")
+	branch := fs.String("git-branch", "", "commit on this branch, created or reset to the current commit, for -git-commit")
+	pr := fs.Bool("git-pr", false, "push -git-branch to origin and open a GitHub pull request, using GITHUB_TOKEN")
+	base := fs.String("git-base", "", "branch the pull request targets (default: the branch checked out before the run)")
+
+	return func(ctx context.Context, outputDir string, quiet bool) {
+		if *message == "" {
+			if *branch != "" || *pr {
+				log.Fatal("Error: -git-branch and -git-pr need -git-commit")
+			}
+			return
+		}
+		if *pr && *branch == "" {
+			log.Fatal("Error: -git-pr needs -git-branch, the branch the pull request is opened from")
+		}
+		paths := []string{outputDir}
+		for _, name := range []string{"android-manifest", "ios-plist", "electron-config", "web-manifest", "changelog", "data-uris", "sprite", "snippets", "design-tokens", "palette"} {
+			if f := fs.Lookup(name); f != nil && f.Value.String() != "" && f.Value.String() != "-" {
+				paths = append(paths, f.Value.String())
+			}
+		}
+		if f := fs.Lookup("sprite"); f != nil && f.Value.String() != "" {
+			base := strings.TrimSuffix(f.Value.String(), ".png")
+			paths = append(paths, base+".json", base+".css")
+		}
+
+		repo, err := openGitRepo(ctx, outputDir)
+		if err != nil {
+			log.Fatalf("Error: -git-commit: %v\n", err)
+		}
+		// Git runs at the top of the repository, so paths given relative to
+		// the current directory are made relative to it
+		for i, path := range paths {
+			if paths[i], err = repo.relative(path); err != nil {
+				log.Fatalf("Error: -git-commit: %v\n", err)
+			}
+		}
+		target := *base
+		if target == "" {
+			if target, err = repo.run(ctx, "rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+				log.Fatalf("Error: -git-commit: %v\n", err)
+			}
+		}
+		// The manifest records the time of every run, so it alone changing
+		// means the icons did not
+		var manifest string
+		if f := fs.Lookup("manifest"); f != nil && f.Value.String() != "" {
+			prefix, err := (&gitRepo{dir: outputDir}).run(ctx, "rev-parse", "--show-prefix")
+			if err != nil {
+				log.Fatalf("Error: -git-commit: %v\n", err)
+			}
+			manifest = prefix + f.Value.String()
+		}
+		committed, err := repo.commit(ctx, *branch, *message, paths, manifest)
+		if err != nil {
+			log.Fatalf("Error: -git-commit: %v\n", err)
+		}
+		if !committed {
+			if !quiet {
+				fmt.Println("No icon changes to commit")
+			}
+			return
+		}
+		if !quiet {
+			fmt.Println("Committed the generated icons:", *message)
+		}
+		if !*pr {
+			return
+		}
+
+		// The branch only ever holds the latest regeneration, so it is
+		// replaced rather than appended to
+		if _, err := repo.run(ctx, "push", "--force", "origin", "HEAD:refs/heads/"+*branch); err != nil {
+			log.Fatalf("Error: -git-pr: %v\n", err)
+		}
+		prURL, err := repo.openPullRequest(ctx, *branch, target, *message)
+		if err != nil {
+			log.Fatalf("Error: -git-pr: %v\n", err)
+		}
+		if !quiet {
+			fmt.Println("Pull request:", prURL)
+		}
+	}
+}
+
+// gitRepo runs git commands in a working tree.
+type gitRepo struct {
+	dir string
+}
+
+// openGitRepo returns the repository holding dir.
+func openGitRepo(ctx context.Context, dir string) (*gitRepo, error) {
+	top, err := (&gitRepo{dir: dir}).run(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	return &gitRepo{dir: top}, nil
+}
+
+// relative returns path, relative to the current directory or absolute,
+// relative to the top of the repository instead. Symbolic links are
+// resolved, as git resolves them in the top directory's path.
+func (g *gitRepo) relative(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	} else if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(dir, filepath.Base(abs))
+	}
+	rel, err := filepath.Rel(g.dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository at %s", path, g.dir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// run runs git with args and returns its trimmed output. Failures carry
+// git's own message.
+func (g *gitRepo) run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commit commits paths with message, switching to branch first when one is
+// given. It reports false without committing when nothing changed but the
+// file ignore, a path relative to the top of the repository. Changes staged
+// outside paths are left out of the commit.
+func (g *gitRepo) commit(ctx context.Context, branch, message string, paths []string, ignore string) (bool, error) {
+	if _, err := g.run(ctx, append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return false, err
+	}
+	changed, err := g.run(ctx, append([]string{"diff", "--cached", "--name-only", "--"}, paths...)...)
+	if err != nil {
+		return false, err
+	}
+	if changed == "" || changed == ignore {
+		_, err := g.run(ctx, append([]string{"reset", "--quiet", "--"}, paths...)...)
+		return false, err
+	}
+	if branch != "" {
+		if _, err := g.run(ctx, "switch", "-C", branch); err != nil {
+			return false, err
+		}
+	}
+	if _, err := g.run(ctx, append([]string{"commit", "--quiet", "-m", message, "--"}, paths...)...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// openPullRequest opens a pull request from branch into base, or returns
+// the open one, which the push has just updated.
+func (g *gitRepo) openPullRequest(ctx context.Context, branch, base, title string) (string, error) {
+	gh, err := g.github(ctx)
+	if err != nil {
+		return "", err
+	}
+	owner, _, _ := strings.Cut(gh.repo, "/")
+	var open []struct {
+		URL string `json:"html_url"`
+	}
+	query := url.Values{"head": {owner + ":" + branch}, "state": {"open"}}
+	if err := gh.do(ctx, http.MethodGet, "/repos/"+gh.repo+"/pulls?"+query.Encode(), nil, &open); err != nil {
+		return "", err
+	}
+	if len(open) > 0 {
+		return open[0].URL, nil
+	}
+
+	stat, err := g.run(ctx, "show", "--stat", "--format=", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	body := "Icons regenerated by `logo-generator`.\n\n```\n" + stat + "\n```\n"
+	var created struct {
+		URL string `json:"html_url"`
+	}
+	req := map[string]string{"title": title, "head": branch, "base": base, "body": body}
+	if err := gh.do(ctx, http.MethodPost, "/repos/"+gh.repo+"/pulls", req, &created); err != nil {
+		return "", err
+	}
+	return created.URL, nil
+}
+
+// githubClient calls the GitHub REST API for one repository.
+type githubClient struct {
+	api   string
+	token string
+	// repo is owner/name.
+	repo string
+}
+
+// github returns a client for the repository of origin, authenticated with
+// GITHUB_TOKEN. GITHUB_REPOSITORY and GITHUB_API_URL, which GitHub Actions
+// sets, take precedence, the latter for GitHub Enterprise servers.
+func (g *gitRepo) github(ctx context.Context) (*githubClient, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, errors.New("GITHUB_TOKEN is not set")
+	}
+	gh := &githubClient{api: "https://api.github.com", token: token, repo: os.Getenv("GITHUB_REPOSITORY")}
+	if api := os.Getenv("GITHUB_API_URL"); api != "" {
+		gh.api = strings.TrimSuffix(api, "/")
+	}
+	if gh.repo == "" {
+		remote, err := g.run(ctx, "remote", "get-url", "origin")
+		if err != nil {
+			return nil, err
+		}
+		if gh.repo = githubRepoName(remote); gh.repo == "" {
+			return nil, fmt.Errorf("cannot tell the GitHub repository from origin %q; set GITHUB_REPOSITORY", remote)
+		}
+	}
+	return gh, nil
+}
+
+// githubRepoName returns owner/name from a remote URL such as
+// git@github.com:owner/name.git or https://github.com/owner/name.
+func githubRepoName(remote string) string {
+	remote = strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git")
+	parts := strings.FieldsFunc(remote, func(r rune) bool { return r == '/' || r == ':' })
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out, when given.
+func (gh *githubClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, gh.api+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+gh.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub API %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -3,3 +3,12 @@ module github.com/drewalth/logo-generator
 go 1.23.3
 
 require github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+
+require (
+	golang.org/x/image v0.25.0
+	golang.org/x/sync v0.16.0
+	golang.org/x/text v0.23.0
+	lukechampine.com/blake3 v1.4.1
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.9 // indirect
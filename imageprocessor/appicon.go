@@ -0,0 +1,107 @@
+package imageprocessor
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AppIconSlot is an entry of the Contents.json of an Xcode asset catalog
+// icon set, filled by the output listing it.
+type AppIconSlot struct {
+	Idiom    string `json:"idiom" doc:"Device family of the slot" schema:"enum=iphone|ipad|ios-marketing|universal|mac|watch|car"`
+	Size     string `json:"size" doc:"Size of the slot in points, such as 60x60 or 83.5x83.5; times the scale, it must equal the output's size"`
+	Scale    string `json:"scale,omitempty" doc:"Pixels per point; defaults to 1x" schema:"enum=1x|2x|3x"`
+	Platform string `json:"platform,omitempty" doc:"Platform of universal slots, such as ios"`
+}
+
+// appIconContentsName is the file Xcode reads an icon set from.
+const appIconContentsName = "Contents.json"
+
+// validate reports slots whose size in points does not match the output.
+func (s AppIconSlot) validate(dim Dimension) error {
+	switch s.Idiom {
+	case "iphone", "ipad", "ios-marketing", "universal", "mac", "watch", "car":
+	default:
+		return fmt.Errorf("unknown app icon idiom %q", s.Idiom)
+	}
+	scale := 1.0
+	switch s.Scale {
+	case "", "1x":
+	case "2x":
+		scale = 2
+	case "3x":
+		scale = 3
+	default:
+		return fmt.Errorf("unknown app icon scale %q, want 1x, 2x or 3x", s.Scale)
+	}
+	w, h, ok := strings.Cut(s.Size, "x")
+	width, err1 := strconv.ParseFloat(w, 64)
+	height, err2 := strconv.ParseFloat(h, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return fmt.Errorf("invalid app icon size %q, want points such as 60x60", s.Size)
+	}
+	if math.Round(width*scale) != float64(dim.Width) || math.Round(height*scale) != float64(dim.Height) {
+		return fmt.Errorf("the %s@%s %s app icon is %gx%g pixels, not %dx%d", s.Size, cmp.Or(s.Scale, "1x"), s.Idiom, width*scale, height*scale, dim.Width, dim.Height)
+	}
+	if formatOf(dim) != FormatPNG {
+		return fmt.Errorf("app icons must be png outputs")
+	}
+	return nil
+}
+
+// appIconContents returns the Contents.json of the icon set filled by the
+// app icon slots of dims, or nil when they list none.
+func appIconContents(dims []Dimension) ([]byte, error) {
+	type entry struct {
+		Filename string `json:"filename"`
+		AppIconSlot
+	}
+	contents := struct {
+		Images []entry `json:"images"`
+		Info   struct {
+			Author  string `json:"author"`
+			Version int    `json:"version"`
+		} `json:"info"`
+	}{}
+	for _, dim := range dims {
+		for _, slot := range dim.AppIcon {
+			contents.Images = append(contents.Images, entry{Filename: dim.Name, AppIconSlot: slot})
+		}
+	}
+	if len(contents.Images) == 0 {
+		return nil, nil
+	}
+	contents.Info.Author, contents.Info.Version = "xcode", 1
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeAppIconContents writes the Contents.json of the app icon slots of
+// dims to outputDir, so it can be dropped into an asset catalog as an icon
+// set, and returns its name, or "" when dims list no slots. An identical
+// existing file is kept unless rewrite is set.
+func writeAppIconContents(fsys FS, outputDir string, dims []Dimension, rewrite bool) (string, error) {
+	data, err := appIconContents(dims)
+	if err != nil || data == nil {
+		return "", err
+	}
+	path := filepath.Join(outputDir, appIconContentsName)
+	sum := sha256.Sum256(data)
+	if !rewrite && fileMatches(fsys, path, int64(len(data)), hex.EncodeToString(sum[:])) {
+		return appIconContentsName, nil
+	}
+	if err := fsys.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", appIconContentsName, err)
+	}
+	return appIconContentsName, nil
+}
@@ -0,0 +1,61 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// sourceAspect is the aspect ratio of every source, which must be
+	// 1080x1080 unless it is cropped to the output's aspect ratio first
+	// (see checkSourceSize).
+	sourceAspect = 1.0
+	// aspectTolerance is the relative aspect ratio difference that passes
+	// for equal, allowing for sizes rounded to whole pixels.
+	aspectTolerance = 0.01
+)
+
+// checkAspect requires a fit mode when the image reaching the resize, the
+// source after the dimension's filters, has another aspect ratio than the
+// output, so a wide tile is never distorted by accident.
+func checkAspect(dim Dimension) error {
+	switch dim.Fit {
+	case "", "pad", "crop", "stretch":
+	default:
+		return fmt.Errorf("unknown fit %q, want pad, crop or stretch", dim.Fit)
+	}
+	// Cards, placements and adaptive layers size the logo by themselves
+	if dim.Fit != "" || dim.Card != nil || dim.Place != nil || dim.AdaptiveLayer != nil || dim.Width == 0 || dim.Height == 0 {
+		return nil
+	}
+
+	output := float64(dim.Width) / float64(dim.Height)
+	aspect := filteredAspect(dim, sourceAspect)
+	if math.Abs(aspect-output)/output > aspectTolerance {
+		return fmt.Errorf("the %dx%d output has another aspect ratio than the image it is resized from (%.3g:1); set fit to pad, crop or stretch", dim.Width, dim.Height, aspect)
+	}
+	return nil
+}
+
+// filteredAspect returns the aspect ratio of an image of the given aspect
+// ratio after the dimension's filters.
+func filteredAspect(dim Dimension, aspect float64) float64 {
+	output := float64(dim.Width) / float64(dim.Height)
+	for _, spec := range dim.Filters {
+		switch spec.Type {
+		case "crop":
+			if len(spec.Rect) == 4 && spec.Rect[3] > 0 {
+				aspect *= spec.Rect[2] / spec.Rect[3]
+			} else {
+				aspect = output
+			}
+		case "extend":
+			aspect = output
+		case "rotate":
+			rad := spec.Angle * math.Pi / 180
+			sin, cos := math.Abs(math.Sin(rad)), math.Abs(math.Cos(rad))
+			aspect = (aspect*cos + sin) / (aspect*sin + cos)
+		}
+	}
+	return aspect
+}
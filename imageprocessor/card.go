@@ -0,0 +1,205 @@
+package imageprocessor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// Card composes an output as a social card: the logo on the left of a
+// solid canvas, with a title and subtitle beside it in the built-in font or
+// a font file.
+type Card struct {
+	Title    string `json:"title,omitempty" doc:"Page title drawn beside the logo, in a built-in upper case font unless font is set" schema:"maxLength=120"`
+	Subtitle string `json:"subtitle,omitempty" doc:"Smaller line drawn under the title" schema:"maxLength=200"`
+	// Font is a path to a TrueType or OpenType file; LoadConfig resolves it
+	// relative to the config file.
+	Font string `json:"font,omitempty" doc:"TrueType or OpenType font file the text is drawn in, relative to the config file; defaults to a built-in upper case font"`
+	// Color and Background default to black on white.
+	Color      string `json:"color,omitempty" doc:"Text color as #rgb, #rrggbb or #rrggbbaa; defaults to #000000"`
+	Background string `json:"background,omitempty" doc:"Canvas color as #rgb, #rrggbb or #rrggbbaa; defaults to #ffffff"`
+	Align      string `json:"align,omitempty" doc:"Alignment of the text beside the logo; defaults to left" schema:"enum=left|center|right"`
+}
+
+// Card layout, as fractions of the output height: the margin around the
+// logo and the text, and the starting height of title glyphs, which shrink
+// until the title fits in cardTitleLines lines.
+const (
+	cardMargin      = 0.1
+	cardTitleHeight = 0.12
+	cardTitleLines  = 3
+)
+
+// validate reports cards with bad colors or alignment, text the built-in
+// font cannot draw, or on outputs that leave no room beside the logo. Text
+// in a font file is checked when the font is loaded.
+func (c *Card) validate(dim Dimension) error {
+	if dim.Width <= dim.Height {
+		return fmt.Errorf("card outputs must be wider than tall, got %dx%d", dim.Width, dim.Height)
+	}
+	if c.Font == "" {
+		for _, text := range []string{c.Title, c.Subtitle} {
+			if err := checkBuiltinText(text); err != nil {
+				return fmt.Errorf("card: %w; set font to draw it", err)
+			}
+		}
+	}
+	for _, s := range []string{c.Color, c.Background} {
+		if s != "" {
+			if _, err := ParseHexColor(s); err != nil {
+				return fmt.Errorf("card: %w", err)
+			}
+		}
+	}
+	switch c.Align {
+	case "", "left", "center", "right":
+		return nil
+	default:
+		return fmt.Errorf("unknown card align %q, want left, center or right", c.Align)
+	}
+}
+
+// renderCard renders the logo of dim into a square beside its card text.
+// The logo takes the dimension's filters and fit; the watermark and
+// dithering apply to the whole card.
+func renderCard(ctx context.Context, src *sourceImage, dim Dimension, wm *watermarker, opts Options) (*image.RGBA, error) {
+	width, height := int(dim.Width), int(dim.Height)
+	margin := max(int(float64(height)*cardMargin), 1)
+	box := max(height-2*margin, 1)
+
+	var face typeface = builtinFont{}
+	if dim.Card.Font != "" {
+		f, err := loadOutlineFont(fsOf(opts), dim.Card.Font)
+		if err != nil {
+			return nil, fmt.Errorf("%w: card: %w", ErrConfigInvalid, err)
+		}
+		for _, text := range []string{dim.Card.Title, dim.Card.Subtitle} {
+			if err := f.check(text); err != nil {
+				return nil, fmt.Errorf("%w: card: %w", ErrConfigInvalid, err)
+			}
+		}
+		face = f
+	}
+
+	logo, err := renderLogo(ctx, src, dim, box, box, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Colors were validated with the dimension
+	fg, bg := color.NRGBA{A: 0xff}, color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	if dim.Card.Color != "" {
+		fg, _ = ParseHexColor(dim.Card.Color)
+	}
+	if dim.Card.Background != "" {
+		bg, _ = ParseHexColor(dim.Card.Background)
+	}
+	card := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(card, card.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(card, image.Rect(margin, margin, margin+box, margin+box), logo, image.Point{}, draw.Over)
+
+	// Shrink the title until it wraps into few enough lines, and draw the
+	// subtitle at half its size
+	left := 2*margin + box
+	column := max(width-left-margin, 1)
+	scale := max(int(float64(height)*cardTitleHeight)/glyphHeight, 1)
+	title := wrapText(face, dim.Card.Title, column, scale)
+	for scale > 1 && len(title) > cardTitleLines {
+		scale--
+		title = wrapText(face, dim.Card.Title, column, scale)
+	}
+	subScale := max(scale/2, 1)
+	subtitle := wrapText(face, dim.Card.Subtitle, column, subScale)
+
+	type line struct {
+		text  string
+		scale int
+	}
+	var lines []line
+	for _, text := range title {
+		lines = append(lines, line{text, scale})
+	}
+	for _, text := range subtitle {
+		lines = append(lines, line{text, subScale})
+	}
+
+	// Center the text block vertically, with a line of space between rows
+	total := 0
+	for _, l := range lines {
+		total += face.lineHeight(l.scale)
+	}
+	y := (height - total) / 2
+	ink := image.NewUniform(fg)
+	for _, l := range lines {
+		mask := face.render(l.text, l.scale)
+		x := left
+		switch dim.Card.Align {
+		case "center":
+			x += (column - mask.Rect.Dx()) / 2
+		case "right":
+			x += column - mask.Rect.Dx()
+		}
+		r := image.Rect(x, y, x+mask.Rect.Dx(), y+mask.Rect.Dy())
+		draw.DrawMask(card, r, ink, image.Point{}, mask, image.Point{}, draw.Over)
+		y += face.lineHeight(l.scale)
+	}
+	return finishImage(ctx, card, dim, wm), nil
+}
+
+// renderLogo renders the logo of a composed output at the given size, with
+// the output's filters and fit, defaulting to pad, but without the watermark,
+// dithering or composition, which apply to the whole output.
+func renderLogo(ctx context.Context, src *sourceImage, dim Dimension, width, height int, opts Options) (*image.RGBA, error) {
+	logoDim := dim
+	logoDim.Width, logoDim.Height = uint(width), uint(height)
+	logoDim.Card, logoDim.Place, logoDim.AdaptiveLayer, logoDim.Gray = nil, nil, nil, 0
+	if logoDim.Fit == "" {
+		logoDim.Fit = "pad"
+	}
+	return renderImage(ctx, src, logoDim, nil, opts)
+}
+
+// wrapText breaks text into lines at most width pixels wide when drawn in
+// face at scale, between words; words longer than a line are cut.
+func wrapText(face typeface, text string, width, scale int) []string {
+	fits := func(s string) bool { return face.width(s, scale) <= width }
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(text) {
+		for !fits(word) {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			// Keep at least one character so every line makes progress
+			runes := []rune(word)
+			n := len(runes) - 1
+			for n > 1 && !fits(string(runes[:n])) {
+				n--
+			}
+			n = max(n, 1)
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+			if word == "" {
+				break
+			}
+		}
+		switch {
+		case word == "":
+		case current == "":
+			current = word
+		case fits(current + " " + word):
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
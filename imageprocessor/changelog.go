@@ -0,0 +1,190 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kinds of AssetChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// visibleDelta is the difference in any channel, out of 255, from which a
+// pixel counts as visibly changed. Smaller differences are left by
+// resampler and encoder tweaks that nobody can see.
+const visibleDelta = 8
+
+// AssetChange describes how one output changed since the previous run.
+type AssetChange struct {
+	Kind  string
+	Entry ManifestEntry
+	// Diff is the fraction of pixels that visibly differ from the previous
+	// image, or -1 when the images could not be compared. It is only set
+	// for changed outputs.
+	Diff float64
+}
+
+// OutputSnapshot holds the decoded outputs of a previous run, taken before
+// a run replaces them so the new images can be compared with the old ones.
+type OutputSnapshot map[string]image.Image
+
+// SnapshotOutputs decodes the outputs listed in the previous manifest that
+// are still in outputDir with DecodeOutput. Files that cannot be decoded are
+// left out.
+func SnapshotOutputs(outputDir string, prev Manifest) OutputSnapshot {
+	snapshot := OutputSnapshot{}
+	for _, entry := range prev.Outputs {
+		data, err := os.ReadFile(longPath(filepath.Join(outputDir, filepath.FromSlash(entry.Name))))
+		if err != nil {
+			continue
+		}
+		if img, err := DecodeOutput(data); err == nil {
+			snapshot[entry.Name] = img
+		}
+	}
+	return snapshot
+}
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// DecodeOutput decodes an output file. ICO and ICNS files are decoded
+// through the PNG image they hold, and KTX2 and DDS textures through their
+// base level, as this package writes them.
+func DecodeOutput(data []byte) (image.Image, error) {
+	if img, _, err := DecodeSafe(bytes.NewReader(data), DecodeLimits{}); err == nil {
+		return img, nil
+	}
+	if img, ok, err := decodeTexture(data); ok {
+		return img, err
+	}
+	i := bytes.Index(data, pngSignature)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no PNG image found", ErrUnsupportedFormat)
+	}
+	img, _, err := DecodeSafe(bytes.NewReader(data[i:]), DecodeLimits{})
+	return img, err
+}
+
+// CompareOutputs lists the outputs result added, changed or no longer
+// generates compared with the previous manifest, measuring how much each
+// changed output differs from its image in before.
+func CompareOutputs(prev Manifest, before OutputSnapshot, result *Result) []AssetChange {
+	current := result.Manifest()
+	generated := make(map[string]bool, len(current.Outputs))
+	for _, entry := range current.Outputs {
+		generated[entry.Name] = true
+	}
+	previous := make(map[string]bool, len(prev.Outputs))
+	for _, entry := range prev.Outputs {
+		previous[entry.Name] = true
+	}
+
+	var changes []AssetChange
+	for _, entry := range ChangedOutputs(prev, current) {
+		if !previous[entry.Name] {
+			changes = append(changes, AssetChange{Kind: ChangeAdded, Entry: entry})
+			continue
+		}
+		change := AssetChange{Kind: ChangeChanged, Entry: entry, Diff: -1}
+		if old, ok := before[entry.Name]; ok {
+			data, err := os.ReadFile(longPath(filepath.Join(result.OutputDir, filepath.FromSlash(entry.Name))))
+			if err == nil {
+				if img, err := DecodeOutput(data); err == nil {
+					change.Diff = PixelDiff(old, img)
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+	for _, entry := range prev.Outputs {
+		if !generated[entry.Name] {
+			changes = append(changes, AssetChange{Kind: ChangeRemoved, Entry: entry})
+		}
+	}
+	return changes
+}
+
+// PixelDiff returns the fraction of pixels of two images that visibly
+// differ in color or opacity. Images of different sizes differ entirely.
+func PixelDiff(a, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Size() != bb.Size() {
+		return 1
+	}
+	if ab.Empty() {
+		return 0
+	}
+	differing := 0
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.At(bb.Min.X+x, bb.Min.Y+y)).(color.NRGBA)
+			// The color of fully transparent pixels does not show
+			if ca.A == 0 && cb.A == 0 {
+				continue
+			}
+			if channelDelta(ca.R, cb.R) > visibleDelta || channelDelta(ca.G, cb.G) > visibleDelta ||
+				channelDelta(ca.B, cb.B) > visibleDelta || channelDelta(ca.A, cb.A) > visibleDelta {
+				differing++
+			}
+		}
+	}
+	return float64(differing) / float64(ab.Dx()*ab.Dy())
+}
+
+// channelDelta returns the absolute difference of two channel values.
+func channelDelta(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// WriteChangelog writes a Markdown changelog entry listing changes, headed
+// by the time and source of the run, for ASSETS_CHANGELOG files and
+// release notes.
+func WriteChangelog(w io.Writer, changes []AssetChange, generatedAt time.Time, source string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s: %s\n\n", generatedAt.UTC().Format("2006-01-02 15:04 MST"), filepath.Base(source))
+	for _, change := range changes {
+		entry := change.Entry
+		switch change.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(&b, "- Added `%s` (%dx%d)\n", entry.Name, entry.Width, entry.Height)
+		case ChangeRemoved:
+			fmt.Fprintf(&b, "- Removed `%s`\n", entry.Name)
+		case ChangeChanged:
+			switch {
+			case change.Diff < 0:
+				fmt.Fprintf(&b, "- Changed `%s` (%dx%d)\n", entry.Name, entry.Width, entry.Height)
+			case change.Diff == 0:
+				fmt.Fprintf(&b, "- Re-encoded `%s` (%dx%d) with no visible difference\n", entry.Name, entry.Width, entry.Height)
+			default:
+				fmt.Fprintf(&b, "- Changed `%s` (%dx%d): %s of pixels differ\n", entry.Name, entry.Width, entry.Height, formatPercent(change.Diff))
+			}
+		}
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatPercent formats a fraction as a percentage, keeping small but
+// nonzero fractions from rounding to 0%.
+func formatPercent(f float64) string {
+	if f < 0.001 {
+		return "<0.1%"
+	}
+	return fmt.Sprintf("%.1f%%", f*100)
+}
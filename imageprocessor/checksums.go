@@ -0,0 +1,79 @@
+package imageprocessor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// ChecksumFiles maps the algorithms WriteChecksums supports to the names
+// their checksum files are conventionally published under.
+var ChecksumFiles = map[string]string{
+	"sha256": "SHA256SUMS",
+	"blake3": "B3SUMS",
+}
+
+// checksumHashes creates the hash of each checksum algorithm.
+var checksumHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"blake3": func() hash.Hash { return blake3.New(32, nil) },
+}
+
+// ChecksumAlgorithms returns the supported checksum algorithms, sorted.
+func ChecksumAlgorithms() []string {
+	var names []string
+	for name := range ChecksumFiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// WriteChecksums writes the checksums of the outputs in place to the
+// checksum file of algorithm in the output directory, in the format of
+// sha256sum and b3sum so `sha256sum -c SHA256SUMS` verifies them, and
+// returns the file's name.
+func (r *Result) WriteChecksums(algorithm string) (string, error) {
+	newHash, ok := checksumHashes[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unknown checksum algorithm %q, expected one of %s", algorithm, strings.Join(ChecksumAlgorithms(), ", "))
+	}
+
+	var b strings.Builder
+	for _, out := range r.Outputs {
+		if !out.Status.Succeeded() {
+			continue
+		}
+		sum, err := hashWith(newHash(), out.Path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, filepath.ToSlash(out.Dimension.Name))
+	}
+	name := ChecksumFiles[algorithm]
+	if err := os.WriteFile(longPath(filepath.Join(r.OutputDir, name)), []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// hashWith returns the hex digest of the file at path.
+func hashWith(h hash.Hash, path string) (string, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,61 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+)
+
+// Condition limits a dimension to some runs. Every field that lists values
+// must contain the run's value for the dimension to be generated.
+type Condition struct {
+	// OS and Arch are Go platform names such as darwin or arm64.
+	OS      []string `json:"os,omitempty" doc:"Operating systems the output is generated for, e.g. darwin, windows or linux"`
+	Arch    []string `json:"arch,omitempty" doc:"Architectures the output is generated for, e.g. amd64 or arm64"`
+	Profile []string `json:"profile,omitempty" doc:"Profiles selected with -profile that generate the output"`
+}
+
+// Environment describes a run that conditions are evaluated against.
+type Environment struct {
+	OS, Arch, Profile string
+}
+
+// HostEnvironment returns the environment of the running platform with the
+// given profile.
+func HostEnvironment(profile string) Environment {
+	return Environment{OS: runtime.GOOS, Arch: runtime.GOARCH, Profile: profile}
+}
+
+// Matches reports whether the condition holds in env. A nil condition always
+// holds.
+func (c *Condition) Matches(env Environment) bool {
+	if c == nil {
+		return true
+	}
+	matches := func(values []string, v string) bool { return len(values) == 0 || slices.Contains(values, v) }
+	return matches(c.OS, env.OS) && matches(c.Arch, env.Arch) && matches(c.Profile, env.Profile)
+}
+
+// validate reports empty values, which could never match.
+func (c *Condition) validate() error {
+	if c == nil {
+		return nil
+	}
+	for field, values := range map[string][]string{"os": c.OS, "arch": c.Arch, "profile": c.Profile} {
+		if slices.Contains(values, "") {
+			return fmt.Errorf("when.%s contains an empty value", field)
+		}
+	}
+	return nil
+}
+
+// SelectWhen returns the dimensions whose conditions hold in env.
+func SelectWhen(dims []Dimension, env Environment) []Dimension {
+	var selected []Dimension
+	for _, dim := range dims {
+		if dim.When.Matches(env) {
+			selected = append(selected, dim)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,381 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ConfigVersion is the current version of the config file format.
+const ConfigVersion = 2
+
+// Config is the config file format. Version 1 files were a bare JSON array of
+// dimensions; they are still loaded and can be upgraded with MigrateConfig.
+type Config struct {
+	Schema  string `json:"$schema,omitempty" doc:"URL of the JSON Schema, for editor support"`
+	Comment string `json:"$comment,omitempty" doc:"Free-form note; ignored when generating"`
+	Version int    `json:"version" doc:"Config format version" schema:"const=2"`
+	// Extends names a base config, a path relative to this file or a URL,
+	// whose dimensions and profiles this config overrides and adds to.
+	Extends string `json:"extends,omitempty" doc:"Base config extended by this one: a path relative to this file, or an http(s) URL"`
+	// Dimensions may be empty when the base config provides them.
+	Dimensions []Dimension `json:"dimensions,omitempty" doc:"Outputs to generate; entries replace base config entries of the same name"`
+	// Profiles are named variations of a run, selected with -profile.
+	Profiles map[string]Profile `json:"profiles,omitempty" doc:"Named variations of a run, selected with -profile"`
+}
+
+// Profile adjusts a run for one audience, such as external previews.
+type Profile struct {
+	Comment   string     `json:"$comment,omitempty" doc:"Free-form note; ignored when generating"`
+	Watermark *Watermark `json:"watermark,omitempty" doc:"Watermark tiled across every output"`
+}
+
+// Profile returns the named profile. The empty name selects no profile.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: unknown profile %q", ErrConfigInvalid, name)
+	}
+	return p, nil
+}
+
+// LoadDimensions reads the dimensions of a config file, for example:
+//
+//	{
+//	  "version": 2,
+//	  "dimensions": [{"width": 512, "height": 512, "name": "${APP_NAME}-512.png"}]
+//	}
+//
+// Version 1 files, a bare array of dimensions, are accepted as well.
+// ${NAME} references in string values are resolved from vars and then the
+// environment, so one shared file can produce differently named icon sets.
+// The dimensions are validated and their names normalized to NFC before they
+// are returned; errors wrap ErrConfigInvalid. Without a path, or when the
+// file is missing, the embedded DefaultDimensions are returned instead;
+// callers that should warn about a mistyped path check MissingConfig first.
+func LoadDimensions(path string, vars Variables) ([]Dimension, error) {
+	if path == "" || MissingConfig(path) {
+		return cloneDimensions(DefaultDimensions), nil
+	}
+	cfg, err := LoadConfig(path, vars)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Dimensions, nil
+}
+
+// LoadConfig reads a config file like LoadDimensions, returning its
+// profiles as well. Watermark images are resolved relative to the file.
+// A config that extends a base config is merged over it, see mergeConfigs.
+func LoadConfig(path string, vars Variables) (*Config, error) {
+	cfg, err := loadConfigChain(path, vars, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDimensions(cfg.Dimensions); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Dimensions = normalizeDimensions(cfg.Dimensions)
+	return cfg, nil
+}
+
+// maxExtendsDepth bounds chains of configs extending each other.
+const maxExtendsDepth = 8
+
+// loadConfigChain reads the config at path, a file or URL, and the configs
+// it extends. chain lists the configs that led to path, to detect cycles.
+func loadConfigChain(path string, vars Variables, chain []string) (*Config, error) {
+	if slices.Contains(chain, path) {
+		return nil, fmt.Errorf("%w: %s extends itself through %s", ErrConfigInvalid, path, strings.Join(chain, " -> "))
+	}
+	if len(chain) == maxExtendsDepth {
+		return nil, fmt.Errorf("%w: %s: configs extend each other more than %d levels deep", ErrConfigInvalid, path, maxExtendsDepth)
+	}
+
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read config: %w", ErrConfigInvalid, err)
+	}
+
+	data, err = expandConfig(data, vars)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrConfigInvalid, path, err)
+	}
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %w", ErrConfigInvalid, path, err)
+	}
+
+	for name, profile := range cfg.Profiles {
+		if wm := profile.Watermark; wm != nil {
+			if err := wm.validate(); err != nil {
+				return nil, fmt.Errorf("%w: %s: profile %s: %w", ErrConfigInvalid, path, name, err)
+			}
+			if wm.Image != "" && !filepath.IsAbs(wm.Image) {
+				// Images are read from disk, so a remote config cannot refer to its own
+				if isConfigURL(path) {
+					return nil, fmt.Errorf("%w: %s: profile %s: watermark images of remote configs must be absolute paths", ErrConfigInvalid, path, name)
+				}
+				wm.Image = filepath.Join(filepath.Dir(path), wm.Image)
+			}
+		}
+	}
+
+	for _, dim := range cfg.Dimensions {
+		if card := dim.Card; card != nil && card.Font != "" && !filepath.IsAbs(card.Font) {
+			// Fonts are read from disk like watermark images
+			if isConfigURL(path) {
+				return nil, fmt.Errorf("%w: %s: %s: card fonts of remote configs must be absolute paths", ErrConfigInvalid, path, dim.Name)
+			}
+			card.Font = filepath.Join(filepath.Dir(path), card.Font)
+		}
+	}
+
+	if cfg.Extends == "" {
+		return cfg, nil
+	}
+	basePath, err := resolveConfigRef(path, cfg.Extends)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrConfigInvalid, path, err)
+	}
+	base, err := loadConfigChain(basePath, vars, append(chain, path))
+	if err != nil {
+		return nil, err
+	}
+	return mergeConfigs(base, cfg), nil
+}
+
+// mergeConfigs applies cfg over the base config it extends. Dimensions of
+// cfg replace the base entries of the same name in place and are appended
+// otherwise; profiles replace base profiles of the same name.
+func mergeConfigs(base, cfg *Config) *Config {
+	merged := *cfg
+	merged.Dimensions = slices.Clone(base.Dimensions)
+	for _, dim := range cfg.Dimensions {
+		i := slices.IndexFunc(merged.Dimensions, func(d Dimension) bool { return nameKey(d.Name) == nameKey(dim.Name) })
+		if i < 0 {
+			merged.Dimensions = append(merged.Dimensions, dim)
+		} else {
+			merged.Dimensions[i] = dim
+		}
+	}
+
+	if len(base.Profiles) > 0 {
+		merged.Profiles = make(map[string]Profile, len(base.Profiles)+len(cfg.Profiles))
+		maps.Copy(merged.Profiles, base.Profiles)
+		maps.Copy(merged.Profiles, cfg.Profiles)
+	}
+	return &merged
+}
+
+// maxRemoteConfigSize bounds the size of configs fetched over HTTP.
+const maxRemoteConfigSize = 1 << 20
+
+// remoteConfigClient fetches configs given as URLs.
+var remoteConfigClient = &http.Client{Timeout: 30 * time.Second}
+
+// MissingConfig reports whether path names a local config file that does
+// not exist. URLs are never missing; fetching them reports their errors.
+func MissingConfig(path string) bool {
+	if isConfigURL(path) {
+		return false
+	}
+	_, err := os.Stat(path)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// isConfigURL reports whether a config reference is an http(s) URL.
+func isConfigURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// readConfigFile reads a config from a path or an http(s) URL.
+func readConfigFile(path string) ([]byte, error) {
+	if !isConfigURL(path) {
+		return os.ReadFile(longPath(path))
+	}
+	resp, err := remoteConfigClient.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(data) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("%s is larger than %s", path, FormatBytes(maxRemoteConfigSize))
+	}
+	return data, nil
+}
+
+// resolveConfigRef resolves the extends reference ref of the config at from.
+// Relative references are resolved against the config's directory or URL.
+func resolveConfigRef(from, ref string) (string, error) {
+	switch {
+	case isConfigURL(ref) || filepath.IsAbs(ref) && !isConfigURL(from):
+		return ref, nil
+	case isConfigURL(from):
+		base, err := url.Parse(from)
+		if err != nil {
+			return "", err
+		}
+		rel, err := url.Parse(filepath.ToSlash(ref))
+		if err != nil {
+			return "", fmt.Errorf("invalid extends reference %q: %w", ref, err)
+		}
+		return base.ResolveReference(rel).String(), nil
+	default:
+		return filepath.Join(filepath.Dir(from), ref), nil
+	}
+}
+
+// parseConfig decodes a config in any supported version, wrapping the
+// dimensions of a version 1 file in a Config.
+func parseConfig(data []byte) (*Config, error) {
+	if isLegacyConfig(data) {
+		var dims []Dimension
+		if err := decodeStrict(data, &dims); err != nil {
+			return nil, err
+		}
+		// Version 1 stretched the source to every size
+		for i := range dims {
+			if dims[i].Fit == "" && dims[i].Width != dims[i].Height {
+				dims[i].Fit = "stretch"
+			}
+		}
+		return &Config{Version: 1, Dimensions: dims}, nil
+	}
+
+	var cfg Config
+	if err := decodeStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Version != ConfigVersion {
+		return nil, fmt.Errorf("unsupported config version %d", cfg.Version)
+	}
+	return &cfg, nil
+}
+
+// isLegacyConfig reports whether data holds a version 1 config, a bare array.
+func isLegacyConfig(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+}
+
+// decodeStrict decodes JSON into v, rejecting unknown fields to match the
+// additionalProperties rule of ConfigSchema.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// expandConfig resolves variable references in the string values of a JSON
+// document. Expanding after parsing keeps values containing quotes or
+// backslashes from corrupting the document.
+func expandConfig(data []byte, vars Variables) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	doc, err := vars.expandAll(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// MigrateConfig upgrades a version 1 config, a bare array of width, height and
+// name entries, to the current format. Every entry is preserved, including
+// ${NAME} references. Formats are inferred from the file extensions, because
+// version 1 wrote PNG data regardless of the name. Each change is recorded in
+// the entry's $comment and returned as a human-readable note.
+func MigrateConfig(data []byte) (*Config, []string, error) {
+	if !isLegacyConfig(data) {
+		return nil, nil, fmt.Errorf("%w: config is not in the version 1 format", ErrConfigInvalid)
+	}
+
+	var dims []Dimension
+	if err := decodeStrict(data, &dims); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to parse config: %w", ErrConfigInvalid, err)
+	}
+
+	var notes []string
+	for i := range dims {
+		dim := &dims[i]
+		if dim.Fit == "" && dim.Width != dim.Height {
+			dim.Fit = "stretch"
+			dim.Comment = "Fit set to stretch; version 1 stretched the source to every size."
+			notes = append(notes, fmt.Sprintf("%s: %s", dim.Name, dim.Comment))
+		}
+		if dim.Format != "" {
+			continue
+		}
+
+		format := formatFromExtension(dim.Name)
+		if format == FormatPNG {
+			continue
+		}
+		candidate := *dim
+		candidate.Format = format
+		var note string
+		if err := validateFormat(candidate); err != nil {
+			note = fmt.Sprintf("Kept PNG data: %v.", err)
+		} else {
+			dim.Format = format
+			note = fmt.Sprintf("Format set to %s from the file extension; version 1 wrote PNG data under this name.", format)
+		}
+		dim.Comment = strings.TrimSpace(dim.Comment + " " + note)
+		notes = append(notes, fmt.Sprintf("%s: %s", dim.Name, note))
+	}
+
+	cfg := &Config{
+		Comment:    fmt.Sprintf("Migrated from the version 1 flat dimensions format to version %d.", ConfigVersion),
+		Version:    ConfigVersion,
+		Dimensions: dims,
+	}
+	return cfg, notes, nil
+}
+
+// formatFromExtension infers an output format from a file name.
+func formatFromExtension(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return FormatJPEG
+	case ".ico":
+		return FormatICO
+	case ".icns":
+		return FormatICNS
+	case ".ktx2":
+		return FormatKTX2
+	case ".dds":
+		return FormatDDS
+	case ".gif":
+		return FormatGIF
+	case ".h":
+		return FormatCHeader
+	case ".xml":
+		return FormatAdaptiveIcon
+	default:
+		return FormatPNG
+	}
+}
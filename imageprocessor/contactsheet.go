@@ -0,0 +1,109 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"github.com/nfnt/resize"
+)
+
+// contactSheetColumns is the number of cells in a row of a contact sheet.
+const contactSheetColumns = 6
+
+// Contact sheet colors: a checkerboard showing transparency, and labels.
+var (
+	sheetLight = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	sheetDark  = color.NRGBA{0xe4, 0xe4, 0xe4, 0xff}
+	sheetLabel = color.NRGBA{0x40, 0x40, 0x40, 0xff}
+)
+
+// ContactSheet renders every dimension from the source at inputPath and
+// lays them out on one PNG, for reviewing a whole set at a glance. Each
+// image gets a cell of cellSize pixels labeled with its name; larger images
+// are scaled down to fit, smaller ones are shown at their actual size.
+func ContactSheet(ctx context.Context, inputPath string, dims []Dimension, opts Options, cellSize int) ([]byte, error) {
+	dims = normalizeDimensions(dims)
+	if err := validate(dims, opts); err != nil {
+		return nil, err
+	}
+	if len(dims) == 0 {
+		return nil, fmt.Errorf("no dimensions to render")
+	}
+	src, wm, err := loadSource(inputPath, dims, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cells are padded by a margin and leave room for the label below
+	const margin = 8
+	cellW, cellH := cellSize+2*margin, cellSize+3*margin+glyphHeight
+	cols := min(len(dims), contactSheetColumns)
+	rows := (len(dims) + cols - 1) / cols
+	sheet := image.NewNRGBA(image.Rect(0, 0, cols*cellW, rows*cellH))
+	checkerboard(sheet, margin)
+
+	for i, dim := range dims {
+		if err := ctx.Err(); err != nil {
+			return nil, canceled(ctx)
+		}
+		img, err := renderImage(ctx, src, dim, wm, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dim.Name, err)
+		}
+		var shown image.Image = img
+		if int(dim.Width) > cellSize || int(dim.Height) > cellSize {
+			shown = resize.Thumbnail(uint(cellSize), uint(cellSize), img, resize.Lanczos3)
+		}
+
+		// Center the image in its cell, and its label underneath
+		x0, y0 := i%cols*cellW, i/cols*cellH
+		size := shown.Bounds().Size()
+		at := image.Pt(x0+margin+(cellSize-size.X)/2, y0+margin+(cellSize-size.Y)/2)
+		draw.Draw(sheet, image.Rectangle{Min: at, Max: at.Add(size)}, shown, shown.Bounds().Min, draw.Over)
+
+		label := fitLabel(dim.Name, cellSize)
+		mask := renderText(label, 1)
+		at = image.Pt(x0+margin+(cellSize-mask.Bounds().Dx())/2, y0+2*margin+cellSize)
+		draw.DrawMask(sheet, mask.Bounds().Add(at), image.NewUniform(sheetLabel), image.Point{}, mask, image.Point{}, draw.Over)
+	}
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, sheet); err != nil {
+		return nil, fmt.Errorf("failed to encode contact sheet: %w", err)
+	}
+	return data.Bytes(), nil
+}
+
+// checkerboard fills img with squares of size pixels in two light grays.
+func checkerboard(img *image.NRGBA, size int) {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := sheetLight
+			if (x/size+y/size)%2 == 1 {
+				c = sheetDark
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+}
+
+// fitLabel shortens name with a trailing ".." until it is at most width
+// pixels wide in the built-in font.
+func fitLabel(name string, width int) string {
+	runes := []rune(name)
+	if textWidth(name) <= width {
+		return name
+	}
+	for n := len(runes) - 1; n > 0; n-- {
+		if label := string(runes[:n]) + ".."; textWidth(label) <= width {
+			return label
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package imageprocessor
+
+import (
+	"image/color"
+	"math"
+)
+
+// WCAG 2 contrast ratios a color pair must reach for each level. Large text
+// and graphical objects such as icons need less contrast than body text.
+const (
+	ContrastAAA     = 7.0
+	ContrastAA      = 4.5
+	ContrastAALarge = 3.0
+)
+
+// ContrastEntry is the contrast of a color against a background.
+type ContrastEntry struct {
+	Color      string  `json:"color"`
+	Background string  `json:"background"`
+	Ratio      float64 `json:"ratio"`
+	// Level is the best WCAG level the pair passes: AAA, AA, AA large or
+	// fail.
+	Level string `json:"level"`
+}
+
+// BelowAA reports whether the pair fails AA for normal text.
+func (e ContrastEntry) BelowAA() bool {
+	return e.Ratio < ContrastAA
+}
+
+// ContrastMatrix returns the contrast of every color against every
+// background, row by row. Colors are #rgb or #rrggbb; alpha is ignored.
+func ContrastMatrix(colors, backgrounds []string) ([]ContrastEntry, error) {
+	var entries []ContrastEntry
+	for _, fg := range colors {
+		a, err := ParseHexColor(fg)
+		if err != nil {
+			return nil, err
+		}
+		for _, bg := range backgrounds {
+			b, err := ParseHexColor(bg)
+			if err != nil {
+				return nil, err
+			}
+			ratio := ContrastRatio(a, b)
+			entries = append(entries, ContrastEntry{Color: fg, Background: bg, Ratio: ratio, Level: ContrastLevel(ratio)})
+		}
+	}
+	return entries, nil
+}
+
+// ContrastRatio returns the WCAG 2 contrast ratio of two colors, from 1 to
+// 21, truncated to two decimals so a pair never passes by rounding.
+func ContrastRatio(a, b color.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	ratio := (max(la, lb) + 0.05) / (min(la, lb) + 0.05)
+	return math.Floor(ratio*100) / 100
+}
+
+// ContrastLevel returns the best WCAG level a contrast ratio passes.
+func ContrastLevel(ratio float64) string {
+	switch {
+	case ratio >= ContrastAAA:
+		return "AAA"
+	case ratio >= ContrastAA:
+		return "AA"
+	case ratio >= ContrastAALarge:
+		return "AA large"
+	default:
+		return "fail"
+	}
+}
+
+// relativeLuminance returns the WCAG relative luminance of a color's sRGB
+// channels, ignoring alpha.
+func relativeLuminance(c color.Color) float64 {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return luminance(n.R, n.G, n.B)
+}
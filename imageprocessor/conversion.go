@@ -0,0 +1,302 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// SourceConversion is a change made to the source as it is read, to bring
+// it to the 8-bit, upright, sRGB image every output is rendered from.
+type SourceConversion struct {
+	// Kind is "color-model", "bit-depth", "orientation" or "color-profile".
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+	// Exact reports conversions that only change how the pixels are stored,
+	// such as expanding a palette, and leave the image as it looks.
+	Exact bool `json:"exact"`
+}
+
+// String returns the conversion as "kind: detail".
+func (c SourceConversion) String() string {
+	return c.Kind + ": " + c.Detail
+}
+
+// decodeSource decodes the source, turns it upright following its EXIF
+// orientation and lists the conversions made. With strict, a source needing
+// conversions that are not exact is rejected with ErrSourceConverted
+// instead, for teams whose masters must be used exactly as delivered.
+func decodeSource(file io.ReadSeeker, strict bool) (*sourceImage, []SourceConversion, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	decoded, _, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := readSourceMetadata(data)
+
+	conversions := colorConversions(decoded)
+	if meta.profile != "" {
+		conversions = append(conversions, SourceConversion{Kind: "color-profile", Detail: fmt.Sprintf("embedded ICC profile %q ignored; pixel values are read as sRGB", meta.profile)})
+	}
+	if meta.orientation > 1 && meta.orientation <= 8 {
+		conversions = append(conversions, SourceConversion{Kind: "orientation", Detail: fmt.Sprintf("EXIF orientation %d applied (%s)", meta.orientation, orientations[meta.orientation].name)})
+	}
+	if strict {
+		var changes []string
+		for _, c := range conversions {
+			if !c.Exact {
+				changes = append(changes, c.String())
+			}
+		}
+		if len(changes) > 0 {
+			return nil, conversions, fmt.Errorf("%w: %s", ErrSourceConverted, strings.Join(changes, "; "))
+		}
+	}
+
+	src := newSourceImage(decoded)
+	if meta.orientation > 1 && meta.orientation <= 8 {
+		src = &sourceImage{pixels: orient(src.readOnly(), meta.orientation)}
+	}
+	return src, conversions, nil
+}
+
+// colorConversions describes the conversion of a decoded image to NRGBA.
+func colorConversions(img image.Image) []SourceConversion {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return nil
+	case *image.RGBA:
+		// Premultiplied colors only round trip when opaque, as decoded RGB
+		// images are
+		if img.Opaque() {
+			return []SourceConversion{{Kind: "color-model", Detail: "RGB expanded to RGBA", Exact: true}}
+		}
+		return []SourceConversion{{Kind: "color-model", Detail: "premultiplied RGBA converted to straight alpha"}}
+	case *image.Paletted:
+		return []SourceConversion{{Kind: "color-model", Detail: fmt.Sprintf("palette of %d colors expanded to RGBA", len(img.Palette)), Exact: true}}
+	case *image.Gray:
+		return []SourceConversion{{Kind: "color-model", Detail: "grayscale expanded to RGBA", Exact: true}}
+	case *image.Gray16:
+		return []SourceConversion{{Kind: "bit-depth", Detail: "16-bit grayscale reduced to 8 bits per channel", Exact: only8Bit(img.Pix)}}
+	case *image.NRGBA64:
+		return []SourceConversion{{Kind: "bit-depth", Detail: "16 bits per channel reduced to 8", Exact: only8Bit(img.Pix)}}
+	case *image.RGBA64:
+		return []SourceConversion{{Kind: "bit-depth", Detail: "16 bits per channel reduced to 8", Exact: img.Opaque() && only8Bit(img.Pix)}}
+	case *image.YCbCr:
+		// Every viewer shows JPEGs through the same conversion
+		return []SourceConversion{{Kind: "color-model", Detail: "YCbCr decoded to RGB", Exact: true}}
+	case *image.CMYK:
+		return []SourceConversion{{Kind: "color-model", Detail: "CMYK converted to RGB without a color profile"}}
+	}
+	return []SourceConversion{{Kind: "color-model", Detail: fmt.Sprintf("%T converted to RGBA", img)}}
+}
+
+// only8Bit reports whether 16-bit samples all hold 8-bit values scaled up,
+// as written by editors saving 8-bit artwork at 16 bits, so reducing them
+// loses nothing.
+func only8Bit(pix []uint8) bool {
+	for i := 0; i+1 < len(pix); i += 2 {
+		if pix[i] != pix[i+1] {
+			return false
+		}
+	}
+	return true
+}
+
+// orientations maps EXIF orientations to the quarter turns clockwise and
+// horizontal mirroring, applied after the turns, that make an image upright.
+var orientations = [9]struct {
+	name   string
+	turns  int
+	mirror bool
+}{
+	2: {"mirrored", 0, true},
+	3: {"rotated 180°", 2, false},
+	4: {"flipped vertically", 2, true},
+	5: {"transposed", 1, true},
+	6: {"rotated 90° clockwise", 1, false},
+	7: {"transversed", 3, true},
+	8: {"rotated 90° counterclockwise", 3, false},
+}
+
+// orient returns img made upright for an EXIF orientation.
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	o := orientations[orientation]
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if o.turns%2 == 1 {
+		w, h = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			dx, dy := x, y
+			switch o.turns {
+			case 1:
+				dx, dy = b.Dy()-1-y, x
+			case 2:
+				dx, dy = b.Dx()-1-x, b.Dy()-1-y
+			case 3:
+				dx, dy = y, b.Dx()-1-x
+			}
+			if o.mirror {
+				dx = w - 1 - dx
+			}
+			i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			copy(dst.Pix[dst.PixOffset(dx, dy):], img.Pix[i:i+4])
+		}
+	}
+	return dst
+}
+
+// sourceMetadata is what the decoders ignore about a source that changes
+// how it should look.
+type sourceMetadata struct {
+	// orientation is the EXIF orientation, 0 when absent.
+	orientation int
+	// profile is the description of an embedded ICC profile other than
+	// sRGB.
+	profile string
+}
+
+// readSourceMetadata reads the EXIF orientation and ICC profile of a PNG or
+// JPEG file. Malformed metadata is ignored, like the decoders do.
+func readSourceMetadata(data []byte) sourceMetadata {
+	var meta sourceMetadata
+	var profile []byte
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		// Walk the chunks before the image data
+		for p := data[8:]; len(p) >= 12; {
+			n := int(binary.BigEndian.Uint32(p))
+			kind := string(p[4:8])
+			if n < 0 || n > len(p)-12 || kind == "IDAT" {
+				break
+			}
+			chunk := p[8 : 8+n]
+			switch kind {
+			case "eXIf":
+				meta.orientation = exifOrientation(chunk)
+			case "iCCP":
+				// A name, a compression method and the deflated profile
+				if i := bytes.IndexByte(chunk, 0); i >= 0 && i+2 <= len(chunk) {
+					if r, err := zlib.NewReader(bytes.NewReader(chunk[i+2:])); err == nil {
+						profile, _ = io.ReadAll(io.LimitReader(r, 1<<22))
+					}
+				}
+			}
+			p = p[12+n:]
+		}
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		// Walk the segments before the scan; ICC profiles may be split
+		// across several APP2 segments, in order
+		for p := data[2:]; len(p) >= 4 && p[0] == 0xff; {
+			marker := p[1]
+			n := int(binary.BigEndian.Uint16(p[2:]))
+			if marker == 0xda || n < 2 || n > len(p)-2 {
+				break
+			}
+			segment := p[4 : 2+n]
+			switch {
+			case marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+				meta.orientation = exifOrientation(segment[6:])
+			case marker == 0xe2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) && len(segment) > 14:
+				profile = append(profile, segment[14:]...)
+			}
+			p = p[2+n:]
+		}
+	}
+	if len(profile) > 0 {
+		if desc := ICCDescription(profile); !strings.Contains(desc, "sRGB") {
+			meta.profile = desc
+		}
+	}
+	return meta
+}
+
+// exifOrientation returns the orientation tag of the first IFD of TIFF
+// formatted EXIF data, or 0.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd > len(tiff)-2 {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := range entries {
+		e := ifd + 2 + 12*i
+		if e+12 > len(tiff) {
+			break
+		}
+		// The orientation is a SHORT stored in the value field
+		if order.Uint16(tiff[e:]) == 0x0112 && order.Uint16(tiff[e+2:]) == 3 {
+			return int(order.Uint16(tiff[e+8:]))
+		}
+	}
+	return 0
+}
+
+// ICCDescription returns the description of an ICC profile, or "unnamed"
+// when it has none that can be read.
+func ICCDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return "unnamed"
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := range count {
+		t := 132 + 12*i
+		if t+12 > len(profile) {
+			break
+		}
+		if string(profile[t:t+4]) != "desc" {
+			continue
+		}
+		off, size := int(binary.BigEndian.Uint32(profile[t+4:])), int(binary.BigEndian.Uint32(profile[t+8:]))
+		if off < 0 || size < 12 || off > len(profile)-size {
+			break
+		}
+		tag := profile[off : off+size]
+		switch string(tag[:4]) {
+		case "desc":
+			// ICC v2: an ASCII string with its length, including the NUL
+			if n := int(binary.BigEndian.Uint32(tag[8:])); n > 0 && n <= len(tag)-12 {
+				return strings.TrimRight(string(tag[12:12+n]), "\x00")
+			}
+		case "mluc":
+			// ICC v4: UTF-16BE records per language; the first one is used
+			if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+				break
+			}
+			n, at := int(binary.BigEndian.Uint32(tag[20:])), int(binary.BigEndian.Uint32(tag[24:]))
+			if at < 0 || n < 0 || at > len(tag)-n {
+				break
+			}
+			units := make([]uint16, n/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(tag[at+2*j:])
+			}
+			return string(utf16.Decode(units))
+		}
+		break
+	}
+	return "unnamed"
+}
@@ -0,0 +1,129 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+)
+
+// DecodeLimits bounds the memory an untrusted image may make a decoder
+// allocate. Zero fields take the value of DefaultDecodeLimits.
+type DecodeLimits struct {
+	// MaxBytes caps the size of the encoded image.
+	MaxBytes int64
+	// MaxWidth and MaxHeight cap the size announced by the image header,
+	// which decoders allocate pixel memory for before reading the pixels.
+	MaxWidth, MaxHeight int
+	// MaxPixels caps the width times the height.
+	MaxPixels int64
+}
+
+// DefaultDecodeLimits leaves room for sources well beyond the 1080x1080 the
+// processor accepts, while keeping a decoded image under 128 MiB.
+var DefaultDecodeLimits = DecodeLimits{
+	MaxBytes:  32 << 20,
+	MaxWidth:  16384,
+	MaxHeight: 16384,
+	MaxPixels: 4096 * 4096,
+}
+
+// withDefaults fills the zero fields of l from DefaultDecodeLimits.
+func (l DecodeLimits) withDefaults() DecodeLimits {
+	if l.MaxBytes == 0 {
+		l.MaxBytes = DefaultDecodeLimits.MaxBytes
+	}
+	if l.MaxWidth == 0 {
+		l.MaxWidth = DefaultDecodeLimits.MaxWidth
+	}
+	if l.MaxHeight == 0 {
+		l.MaxHeight = DefaultDecodeLimits.MaxHeight
+	}
+	if l.MaxPixels == 0 {
+		l.MaxPixels = DefaultDecodeLimits.MaxPixels
+	}
+	return l
+}
+
+// check reports an image size outside the limits.
+func (l DecodeLimits) check(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: image header announces an empty %dx%d image", ErrUnsupportedFormat, width, height)
+	}
+	if width > l.MaxWidth || height > l.MaxHeight || int64(width)*int64(height) > l.MaxPixels {
+		return fmt.Errorf("%w: %dx%d image is larger than the allowed %dx%d and %d pixels", ErrLimitExceeded, width, height, l.MaxWidth, l.MaxHeight, l.MaxPixels)
+	}
+	return nil
+}
+
+// DecodeSafe decodes an untrusted image, such as an upload, from r within
+// limits and returns it with its format name. It reads at most MaxBytes,
+// checks the size in the header before any pixel memory is allocated and
+// turns a decoder panic into an error, so malformed input cannot crash the
+// caller. Inputs over the limits wrap ErrLimitExceeded; unknown or malformed
+// ones wrap ErrUnsupportedFormat or carry the decoder's error.
+func DecodeSafe(r io.Reader, limits DecodeLimits) (image.Image, string, error) {
+	limits = limits.withDefaults()
+	data, err := readLimited(r, limits.MaxBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, _, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := limits.check(cfg.Width, cfg.Height); err != nil {
+		return nil, "", err
+	}
+	img, format, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	// A decoder must not return more than its header announced
+	if b := img.Bounds(); b.Dx() != cfg.Width || b.Dy() != cfg.Height {
+		return nil, "", fmt.Errorf("%w: decoded %dx%d image does not match its %dx%d header", ErrUnsupportedFormat, b.Dx(), b.Dy(), cfg.Width, cfg.Height)
+	}
+	return img, format, nil
+}
+
+// readLimited reads all of r, failing with ErrLimitExceeded once it holds
+// more than maxBytes.
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: image is larger than %s", ErrLimitExceeded, FormatBytes(maxBytes))
+	}
+	return data, nil
+}
+
+// decodeConfig reads an image header, classifying failures like
+// decodeError and recovering from decoder panics.
+func decodeConfig(r io.Reader) (cfg image.Config, format string, err error) {
+	defer recoverDecode(&err)
+	cfg, format, err = image.DecodeConfig(r)
+	if err != nil {
+		return cfg, format, decodeError(err)
+	}
+	return cfg, format, nil
+}
+
+// decodeImage decodes an image, classifying failures like decodeError and
+// recovering from decoder panics.
+func decodeImage(r io.Reader) (img image.Image, format string, err error) {
+	defer recoverDecode(&err)
+	img, format, err = image.Decode(r)
+	if err != nil {
+		return nil, format, decodeError(err)
+	}
+	return img, format, nil
+}
+
+// recoverDecode turns a panic of a decoder on malformed input into an error.
+func recoverDecode(err *error) {
+	if p := recover(); p != nil {
+		*err = fmt.Errorf("%w: decoder failed on malformed input: %v", ErrUnsupportedFormat, p)
+	}
+}
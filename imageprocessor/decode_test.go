@@ -0,0 +1,111 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// fuzzLimits keeps the images a fuzzed header may announce small.
+var fuzzLimits = DecodeLimits{MaxBytes: 1 << 20, MaxWidth: 2048, MaxHeight: 2048, MaxPixels: 1 << 20}
+
+// seedImage returns a small image with some transparency and detail.
+func seedImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 8), uint8(y * 10), uint8(x * y), uint8(x*8 + 7)})
+		}
+	}
+	return img
+}
+
+// seedPNG returns seedImage as a PNG.
+func seedPNG(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, seedImage()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// seedJPEG returns seedImage as a JPEG.
+func seedJPEG(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, seedImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// oversizedPNG rewrites the IHDR chunk of data, which directly follows the
+// signature, to announce a width x height image, with a valid checksum.
+func oversizedPNG(data []byte, width, height uint32) []byte {
+	data = bytes.Clone(data)
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	return data
+}
+
+// oversizedJPEG rewrites the baseline frame header of data to announce a
+// width x height image.
+func oversizedJPEG(t testing.TB, data []byte, width, height uint16) []byte {
+	data = bytes.Clone(data)
+	i := bytes.Index(data, []byte{0xff, 0xc0})
+	if i < 0 {
+		t.Fatal("no baseline frame header in the seed JPEG")
+	}
+	binary.BigEndian.PutUint16(data[i+5:], height)
+	binary.BigEndian.PutUint16(data[i+7:], width)
+	return data
+}
+
+// TestDecodeSafeSeeds checks the fuzz seeds decode or fail as intended.
+func TestDecodeSafeSeeds(t *testing.T) {
+	for _, data := range [][]byte{seedPNG(t), seedJPEG(t)} {
+		if _, _, err := DecodeSafe(bytes.NewReader(data), fuzzLimits); err != nil {
+			t.Errorf("valid seed: %v", err)
+		}
+	}
+	for _, data := range [][]byte{oversizedPNG(seedPNG(t), 1<<16, 1<<16), oversizedJPEG(t, seedJPEG(t), 65535, 65535)} {
+		if _, _, err := DecodeSafe(bytes.NewReader(data), fuzzLimits); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("oversized seed: got %v, want ErrLimitExceeded", err)
+		}
+	}
+}
+
+// FuzzDecodeSafe checks that DecodeSafe never panics and never returns an
+// image outside the limits, whatever the input.
+func FuzzDecodeSafe(f *testing.F) {
+	pngData, jpegData := seedPNG(f), seedJPEG(f)
+	f.Add(pngData)
+	f.Add(jpegData)
+	f.Add(pngData[:len(pngData)/2])
+	f.Add(jpegData[:len(jpegData)/2])
+	f.Add(oversizedPNG(pngData, 1<<16, 1<<16))
+	f.Add(oversizedPNG(pngData, 2048, 2048))
+	f.Add(oversizedJPEG(f, jpegData, 65535, 65535))
+	f.Add(oversizedJPEG(f, jpegData, 2048, 2048))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, _, err := DecodeSafe(bytes.NewReader(data), fuzzLimits)
+		if err != nil {
+			if img != nil {
+				t.Fatalf("DecodeSafe returned an image with error %v", err)
+			}
+			return
+		}
+		b := img.Bounds()
+		if b.Dx() <= 0 || b.Dy() <= 0 || b.Dx() > fuzzLimits.MaxWidth || b.Dy() > fuzzLimits.MaxHeight || int64(b.Dx())*int64(b.Dy()) > fuzzLimits.MaxPixels {
+			t.Fatalf("DecodeSafe returned a %dx%d image outside the limits", b.Dx(), b.Dy())
+		}
+	})
+}
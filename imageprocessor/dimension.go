@@ -0,0 +1,199 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Dimension describes a single output image.
+type Dimension struct {
+	Width  uint   `json:"width" doc:"Output width in pixels" schema:"minimum=1"`
+	Height uint   `json:"height" doc:"Output height in pixels" schema:"minimum=1"`
+	Name   string `json:"name" doc:"Output file name; may reference ${VARIABLES}" schema:"minLength=1,maxLength=255"`
+	// Format is the output encoding; empty means PNG.
+	Format string `json:"format,omitempty" doc:"Output encoding; defaults to png" schema:"enum=png|jpeg|ico|icns|ktx2|dds|gif|h|xml"`
+	// Sizes lists the square images embedded in an ICO output, in order;
+	// empty embeds the output's own size only.
+	Sizes []uint `json:"sizes,omitempty" doc:"Sizes of the square images embedded in an ico output, e.g. [16, 32, 48]; the largest must equal the width and height" schema:"minItems=1"`
+	// Gray dithers the output to this many gray levels for monochrome and
+	// grayscale displays; zero keeps its colors.
+	Gray uint `json:"gray,omitempty" doc:"Gray levels the output is dithered to for e-ink and other monochrome displays: 2 for 1-bit, 4 for 2-bit grayscale; required by h outputs" schema:"minimum=2,maximum=4"`
+	// Card composes the output as a social card with text beside the logo.
+	Card *Card `json:"card,omitempty" doc:"Compose the output as a social card: the logo on the left and a title and subtitle beside it"`
+	// Place draws the logo at a corner of the output instead of filling it.
+	Place *Placement `json:"place,omitempty" doc:"Draw the logo at a corner or the center of the output at a fixed margin, such as for slide templates, instead of filling it"`
+	// AdaptiveLayer renders the output as a layer of an Android adaptive
+	// icon instead of resizing the logo to fill it.
+	AdaptiveLayer *AdaptiveLayer `json:"adaptiveLayer,omitempty" doc:"Render the output as the foreground or background layer of an Android adaptive icon, referenced by xml outputs"`
+	// AppIcon lists the Xcode icon set slots the output fills; the
+	// processor writes their Contents.json beside the outputs.
+	AppIcon []AppIconSlot `json:"appIcon,omitempty" doc:"Slots of an Xcode AppIcon.appiconset the output fills, written to a Contents.json in the output directory"`
+	// Encoder names the encoder profile of the output, overriding the run's.
+	Encoder string `json:"encoder,omitempty" doc:"Encoder profile bundling the quality, compression and metadata settings of every format" schema:"enum=web|store|archive|legacy"`
+	// TargetSSIM lowers the quality of a JPEG output as far as the
+	// similarity target allows, overriding the run's.
+	TargetSSIM float64 `json:"targetSSIM,omitempty" doc:"Lowest SSIM similarity to the lossless render a JPEG output may have; the lowest quality reaching it is used" schema:"exclusiveMinimum=0,exclusiveMaximum=1"`
+	// Tags label the output so a run can select a subset of the config.
+	Tags []string `json:"tags,omitempty" doc:"Labels used to select outputs with -tags"`
+	// Fit is how the output takes an aspect ratio other than the source's;
+	// it is required when they differ, see checkAspect.
+	Fit string `json:"fit,omitempty" doc:"How the image takes an aspect ratio that differs from the source's: pad with transparency, crop to the most detailed region, or stretch" schema:"enum=pad|crop|stretch"`
+	// When limits the output to runs on some platforms or with some profiles.
+	When *Condition `json:"when,omitempty" doc:"Conditions under which the output is generated; all listed fields must match"`
+	// Filters run on a private copy of the source before this output is resized.
+	Filters []FilterSpec `json:"filters,omitempty" doc:"Filters applied to the source before resizing"`
+	// InstallPath is where -install copies the output within a project,
+	// for platforms that expect icons at fixed paths.
+	InstallPath string `json:"installPath,omitempty" doc:"Slash separated path the output is copied to within the project given to -install"`
+	// PostCmd post-processes the encoded output, such as with an external
+	// optimizer, before it is written; {file} stands for its path.
+	PostCmd string `json:"postCmd,omitempty" doc:"Command run on the encoded output before it is written, such as an optimizer; {file} is replaced with its path, or appended when absent"`
+	// Comment documents the entry; it is ignored when generating.
+	Comment string `json:"$comment,omitempty" doc:"Free-form note; ignored when generating"`
+}
+
+// DefaultDimensions to resize the image to: the icon set of a Tauri app,
+// with icon.icns and icon.ico written in their native formats. The list is
+// the embedded "tauri" preset.
+var DefaultDimensions = mustPreset(DefaultPreset)
+
+// LegacyDimensions reproduces the hard-coded list of the original
+// logo-generator.go script, which wrote PNG data under every name,
+// including icon.icns and icon.ico.
+var LegacyDimensions = []Dimension{
+	{Width: 310, Height: 310, Name: "Square310x310Logo.png"},
+	{Width: 284, Height: 284, Name: "Square284x284Logo.png"},
+	{Width: 150, Height: 150, Name: "Square150x150Logo.png"},
+	{Width: 142, Height: 142, Name: "Square142x142Logo.png"},
+	{Width: 107, Height: 107, Name: "Square107x107Logo.png"},
+	{Width: 89, Height: 89, Name: "Square89x89Logo.png"},
+	{Width: 71, Height: 71, Name: "Square71x71Logo.png"},
+	{Width: 44, Height: 44, Name: "Square44x44Logo.png"},
+	{Width: 30, Height: 30, Name: "Square30x30Logo.png"},
+	{Width: 512, Height: 512, Name: "icon.png"},
+	{Width: 512, Height: 512, Name: "icon.icns"},
+	{Width: 256, Height: 256, Name: "icon.ico"},
+	{Width: 256, Height: 256, Name: "128x128@2x.png"},
+	{Width: 50, Height: 50, Name: "StoreLogo.png"},
+	{Width: 128, Height: 128, Name: "128x128.png"},
+	{Width: 32, Height: 32, Name: "32x32.png"},
+}
+
+// SelectTags returns the dimensions carrying at least one of tags. Without
+// tags every dimension is returned.
+func SelectTags(dims []Dimension, tags []string) []Dimension {
+	if len(tags) == 0 {
+		return dims
+	}
+
+	var selected []Dimension
+	for _, dim := range dims {
+		for _, tag := range tags {
+			if slices.Contains(dim.Tags, tag) {
+				selected = append(selected, dim)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// validateDimensions reports empty sizes, unsupported formats and filters,
+// names that cannot be written on every platform, and names that collide on
+// case- or normalization-insensitive file systems.
+func validateDimensions(dims []Dimension) error {
+	if len(dims) == 0 {
+		return fmt.Errorf("%w: no dimensions to generate", ErrConfigInvalid)
+	}
+
+	seen := make(map[string]string, len(dims))
+	installed := map[string]string{}
+	for _, dim := range dims {
+		if dim.Width == 0 || dim.Height == 0 {
+			return fmt.Errorf("%w: %s has an empty size %dx%d", ErrConfigInvalid, dim.Name, dim.Width, dim.Height)
+		}
+		if err := validateName(dim.Name); err != nil {
+			return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+		}
+		if err := validateFormat(dim); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if err := validateEncoder(dim.Encoder); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if dim.Card != nil && dim.Place != nil {
+			return fmt.Errorf("%w: %s: card and place cannot be combined", ErrConfigInvalid, dim.Name)
+		}
+		if dim.AdaptiveLayer != nil && (dim.Card != nil || dim.Place != nil || formatOf(dim) == FormatAdaptiveIcon) {
+			return fmt.Errorf("%w: %s: adaptiveLayer cannot be combined with card, place or the xml format", ErrConfigInvalid, dim.Name)
+		}
+		if dim.Card != nil {
+			if err := dim.Card.validate(dim); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+			}
+		}
+		if dim.Place != nil {
+			if err := dim.Place.validate(dim); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+			}
+		}
+		if dim.AdaptiveLayer != nil {
+			if err := dim.AdaptiveLayer.validate(dim); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+			}
+		}
+		for _, slot := range dim.AppIcon {
+			if err := slot.validate(dim); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+			}
+		}
+		if err := validateGray(dim); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if err := validateTargetSSIM(dim.TargetSSIM); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if _, err := buildFilters(dim); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if err := checkAspect(dim); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if dim.PostCmd != "" {
+			if _, err := splitCommand(dim.PostCmd); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+			}
+		}
+		if err := dim.When.validate(); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+		if dim.InstallPath != "" {
+			if err := validateInstallPath(dim.InstallPath); err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+			}
+			key := nameKey(dim.InstallPath)
+			if prev, ok := installed[key]; ok {
+				return fmt.Errorf("%w: %s and %s are both installed to %s", ErrConfigInvalid, prev, dim.Name, dim.InstallPath)
+			}
+			installed[key] = dim.Name
+		}
+		key := nameKey(dim.Name)
+		if prev, ok := seen[key]; ok && prev == dim.Name {
+			return fmt.Errorf("%w: duplicate output name %q", ErrConfigInvalid, dim.Name)
+		} else if ok {
+			return fmt.Errorf("%w: output names %q and %q collide on case- or normalization-insensitive file systems", ErrConfigInvalid, prev, dim.Name)
+		}
+		seen[key] = dim.Name
+	}
+	return nil
+}
+
+// normalizeDimensions returns a copy of dims with every name in NFC.
+func normalizeDimensions(dims []Dimension) []Dimension {
+	normalized := make([]Dimension, len(dims))
+	for i, dim := range dims {
+		dim.Name = normalizeName(dim.Name)
+		normalized[i] = dim
+	}
+	return normalized
+}
@@ -0,0 +1,109 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/drewalth/logo-generator/export"
+)
+
+// GrayLevels lists the gray levels Dimension.Gray can dither to: 1-bit
+// black and white, and 2-bit grayscale.
+var GrayLevels = []uint{2, 4}
+
+// validateGray reports gray levels that are not supported, and C headers
+// without them.
+func validateGray(dim Dimension) error {
+	switch {
+	case dim.Gray != 0 && dim.Gray != 2 && dim.Gray != 4:
+		return fmt.Errorf("gray must be one of %v, got %d", GrayLevels, dim.Gray)
+	case dim.Gray == 0 && formatOf(dim) == FormatCHeader:
+		return fmt.Errorf("h outputs need gray levels, one of %v", GrayLevels)
+	}
+	return nil
+}
+
+// ditherGray turns img into an opaque image of the given number of evenly
+// spaced grays, flattened over white like e-paper, diffusing the rounding
+// error of each pixel to its neighbors with Floyd-Steinberg weights.
+func ditherGray(img *image.RGBA, levels uint) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	steps := float32(levels - 1)
+
+	flat := FlattenOverWhite(img)
+	lum := make([]float32, width*height)
+	for y := range height {
+		for x := range width {
+			i := y*flat.Stride + x*4
+			lum[y*width+x] = 0.299*float32(flat.Pix[i]) + 0.587*float32(flat.Pix[i+1]) + 0.114*float32(flat.Pix[i+2])
+		}
+	}
+
+	for y := range height {
+		for x := range width {
+			old := lum[y*width+x]
+			level := min(max(old*steps/0xff+0.5, 0), steps)
+			level = float32(int(level))
+			gray := uint8(level * 0xff / steps)
+			i := y*img.Stride + x*4
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = gray, gray, gray, 0xff
+
+			spread := func(dx, dy int, weight float32) {
+				if nx, ny := x+dx, y+dy; nx >= 0 && nx < width && ny < height {
+					lum[ny*width+nx] += (old - float32(gray)) * weight
+				}
+			}
+			spread(1, 0, 7.0/16)
+			spread(-1, 1, 3.0/16)
+			spread(0, 1, 5.0/16)
+			spread(1, 1, 1.0/16)
+		}
+	}
+}
+
+// encodeCHeader writes a dithered img as a C header declaring its pixels
+// as a byte array, for firmware drawing on monochrome and grayscale
+// displays. Rows are stored top to bottom, each padded to a whole byte,
+// with the leftmost pixel in the most significant bits; 0 is black. The
+// array is named after the output without its extension, such as
+// logo_128x64 for icons/logo-128x64.h.
+func encodeCHeader(w io.Writer, img *image.RGBA, dim Dimension) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	bits := 1
+	if dim.Gray == 4 {
+		bits = 2
+	}
+	steps := int(dim.Gray) - 1
+
+	// Pack each row's gray levels, as they were dithered, into bytes
+	stride := (width*bits + 7) / 8
+	data := make([]byte, stride*height)
+	for y := range height {
+		for x := range width {
+			level := (int(img.Pix[y*img.Stride+x*4])*steps + 0x7f) / 0xff
+			bit := x * bits
+			data[y*stride+bit/8] |= byte(level << (8 - bits - bit%8))
+		}
+	}
+
+	base := path.Base(strings.ReplaceAll(dim.Name, "\\", "/"))
+	id := export.Identifier(strings.TrimSuffix(base, path.Ext(base)))
+	unit := "bit"
+	if bits > 1 {
+		unit = "bits"
+	}
+	out := export.NewArrayWriter("c", base,
+		fmt.Sprintf("%s: %dx%d pixels, %d %s per pixel, generated by logo-generator.", base, width, height, bits, unit),
+		"Rows run top to bottom, each padded to a whole byte, with the leftmost",
+		fmt.Sprintf("pixel in the most significant bits. 0 is black and %d is white.", steps))
+	out.Const(id+"_width", width)
+	out.Const(id+"_height", height)
+	out.Bytes(id, data)
+	_, err := w.Write(out.Finish())
+	return err
+}
@@ -0,0 +1,179 @@
+package imageprocessor
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// EdgeReport describes the transparency of a source and the quality of its
+// anti-aliased edges.
+type EdgeReport struct {
+	// Transparent and SemiTransparent are the percentages of pixels that
+	// are fully and partially transparent.
+	Transparent     float64
+	SemiTransparent float64
+	// Fringe is the percentage of edge pixels, partially transparent pixels
+	// between opaque and transparent ones, whose color is pulled toward a matte rather than
+	// matching the artwork beside them: the halo left by exporting over a
+	// background. Matte is "white" or "black", whichever most of them lean
+	// toward, and empty without a fringe.
+	Fringe float64
+	Matte  string
+}
+
+// Edge analysis constants.
+const (
+	// edgeOpaque and edgeClear bound the alpha of partially transparent
+	// pixels; values within a few steps of either end count as that end.
+	edgeOpaque = 248
+	edgeClear  = 8
+	// edgeRadius is how far opaque neighbors are looked for around an edge
+	// pixel.
+	edgeRadius = 2
+	// fringeShift is how much lighter or darker than its opaque neighbors,
+	// in relative luminance, an edge pixel must be to count as fringe.
+	fringeShift = 0.12
+	// FringeWarning is the Fringe percentage from which a source is
+	// considered to have a halo worth cleaning with Defringe.
+	FringeWarning = 20.0
+	// fringeMinEdges keeps sources with only a handful of edge pixels from
+	// being flagged.
+	fringeMinEdges = 64
+)
+
+// HasFringe reports whether the source has a halo worth cleaning.
+func (r EdgeReport) HasFringe() bool {
+	return r.Fringe >= FringeWarning
+}
+
+// AnalyzeEdges measures the transparency of img and looks for matte
+// fringes along the edges of its artwork.
+func AnalyzeEdges(img *image.NRGBA) EdgeReport {
+	b := img.Bounds()
+	total := b.Dx() * b.Dy()
+	if total == 0 {
+		return EdgeReport{}
+	}
+	var clear, partial, edges, white, black int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			a := img.Pix[i+3]
+			switch {
+			case a < edgeClear:
+				clear++
+				continue
+			case a >= edgeOpaque:
+				continue
+			}
+			partial++
+
+			// Wide translucent areas, such as a glass effect, are artwork
+			// rather than edges
+			r, g, bl, ok := opaqueNeighbors(img, x, y, edgeRadius)
+			if !ok || !clearNeighbor(img, x, y, edgeRadius) {
+				continue
+			}
+			edges++
+			shift := luminance(img.Pix[i], img.Pix[i+1], img.Pix[i+2]) - luminance(r, g, bl)
+			switch {
+			case shift > fringeShift:
+				white++
+			case shift < -fringeShift:
+				black++
+			}
+		}
+	}
+
+	report := EdgeReport{
+		Transparent:     percent(clear, total),
+		SemiTransparent: percent(partial, total),
+	}
+	if edges >= fringeMinEdges && white+black > 0 {
+		report.Fringe = percent(white+black, edges)
+		report.Matte = "white"
+		if black > white {
+			report.Matte = "black"
+		}
+	}
+	return report
+}
+
+// Defringe is a Filter removing matte fringes: partially transparent pixels
+// take the color of the opaque artwork next to them, keeping their alpha,
+// so edges fade out in the artwork's color instead of the matte's.
+func Defringe(img *image.NRGBA) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			if a := img.Pix[i+3]; a == 0 || a >= edgeOpaque {
+				continue
+			}
+			// Neighbors are read from the original so fixed pixels do not
+			// spread into each other
+			if r, g, bl, ok := opaqueNeighbors(img, x, y, edgeRadius+1); ok {
+				dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = r, g, bl
+			}
+		}
+	}
+	return dst
+}
+
+// opaqueNeighbors returns the average color of the opaque pixels within
+// radius of (x, y), and whether there are any.
+func opaqueNeighbors(img *image.NRGBA, x, y, radius int) (r, g, b uint8, ok bool) {
+	bounds := img.Bounds()
+	var sum [3]int
+	n := 0
+	for ny := max(y-radius, bounds.Min.Y); ny <= min(y+radius, bounds.Max.Y-1); ny++ {
+		for nx := max(x-radius, bounds.Min.X); nx <= min(x+radius, bounds.Max.X-1); nx++ {
+			i := img.PixOffset(nx, ny)
+			if img.Pix[i+3] < edgeOpaque {
+				continue
+			}
+			sum[0] += int(img.Pix[i])
+			sum[1] += int(img.Pix[i+1])
+			sum[2] += int(img.Pix[i+2])
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0, 0, false
+	}
+	return uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), true
+}
+
+// clearNeighbor reports whether a transparent pixel lies within radius of
+// (x, y).
+func clearNeighbor(img *image.NRGBA, x, y, radius int) bool {
+	bounds := img.Bounds()
+	for ny := max(y-radius, bounds.Min.Y); ny <= min(y+radius, bounds.Max.Y-1); ny++ {
+		for nx := max(x-radius, bounds.Min.X); nx <= min(x+radius, bounds.Max.X-1); nx++ {
+			if img.Pix[img.PixOffset(nx, ny)+3] < edgeClear {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// luminance returns the relative luminance of an sRGB color, from 0 to 1.
+func luminance(r, g, b uint8) float64 {
+	linear := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.04045 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
+
+// percent returns n as a percentage of total, rounded to a tenth.
+func percent(n, total int) float64 {
+	return math.Round(1000*float64(n)/float64(total)) / 10
+}
@@ -0,0 +1,108 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// EncoderProfile bundles the encoder settings of every format, so an output
+// names its purpose instead of setting each knob.
+type EncoderProfile struct {
+	// PNGEffort and PNGIndexed are as in Options.
+	PNGEffort  int
+	PNGIndexed bool
+	// JPEGQuality is the quality of JPEG outputs, from 1 to 100.
+	JPEGQuality int
+	// TargetSSIM is as in Options; JPEGQuality becomes the highest quality
+	// tried.
+	TargetSSIM float64
+	// ICOBitmaps writes the entries of ICO outputs as 8-bit bitmaps with a
+	// 1-bit transparency mask instead of PNG images, for old readers.
+	ICOBitmaps bool
+	// Metadata marks PNG outputs as sRGB and names the generator in them;
+	// without it they carry no metadata.
+	Metadata bool
+	// Description is shown by the presets command.
+	Description string
+}
+
+// EncoderProfiles are the named encoder profiles selectable per output with
+// Dimension.Encoder or per run with Options.Encoder.
+var EncoderProfiles = map[string]EncoderProfile{
+	"web": {
+		PNGEffort: 6, PNGIndexed: true, JPEGQuality: 82,
+		Description: "Small files for websites: indexed PNGs where colors allow, JPEG quality 82, no metadata",
+	},
+	"store": {
+		PNGEffort: MaxPNGEffort, JPEGQuality: 95, Metadata: true,
+		Description: "App store submissions: RGBA PNGs tagged sRGB at maximum effort, JPEG quality 95",
+	},
+	"legacy": {
+		PNGEffort: 6, JPEGQuality: 90, ICOBitmaps: true,
+		Description: "Old browsers and kiosks: ICO entries as 8-bit bitmaps, JPEG quality 90, no metadata",
+	},
+	"archive": {
+		PNGEffort: PNGEffortExtreme, JPEGQuality: 100, Metadata: true,
+		Description: "Masters kept for later: the smallest lossless PNGs tagged sRGB, JPEG quality 100",
+	},
+}
+
+// EncoderProfileNames returns the names of the encoder profiles, sorted.
+func EncoderProfileNames() []string {
+	return slices.Sorted(maps.Keys(EncoderProfiles))
+}
+
+// defaultJPEGQuality is the quality of JPEG outputs without an encoder
+// profile.
+const defaultJPEGQuality = 90
+
+// encoderOf returns the encoder settings of dim: its own encoder profile,
+// the run's, or the individual settings of opts, with the similarity target
+// of dim or else of opts. Dithered outputs are always indexed.
+func encoderOf(dim Dimension, opts Options) EncoderProfile {
+	name := dim.Encoder
+	if name == "" {
+		name = opts.Encoder
+	}
+	profile, ok := EncoderProfiles[name]
+	if !ok {
+		profile = EncoderProfile{PNGEffort: opts.PNGEffort, PNGIndexed: opts.PNGIndexed, JPEGQuality: defaultJPEGQuality}
+	}
+	profile.TargetSSIM = cmp.Or(dim.TargetSSIM, opts.TargetSSIM)
+	// Dithered outputs have a handful of grays, which an indexed PNG holds
+	// in a few bits per pixel
+	if dim.Gray > 0 {
+		profile.PNGIndexed = true
+	}
+	return profile
+}
+
+// validateEncoder reports an unknown encoder profile name.
+func validateEncoder(name string) error {
+	if _, ok := EncoderProfiles[name]; name != "" && !ok {
+		return fmt.Errorf("unknown encoder profile %q, want one of %v", name, EncoderProfileNames())
+	}
+	return nil
+}
+
+// pngMetadata returns the chunks Metadata adds after the IHDR chunk of a
+// PNG: sRGB with the perceptual rendering intent, and the generator.
+func pngMetadata() []byte {
+	var chunks bytes.Buffer
+	writePNGChunk(&chunks, "sRGB", []byte{0})
+	writePNGChunk(&chunks, "tEXt", []byte("Software\x00logo-generator"))
+	return chunks.Bytes()
+}
+
+// withPNGMetadata inserts the metadata chunks into an encoded PNG, after its
+// signature and IHDR chunk.
+func withPNGMetadata(data []byte) []byte {
+	const ihdrEnd = 8 + 8 + 13 + 4
+	if len(data) < ihdrEnd {
+		return data
+	}
+	return slices.Concat(data[:ihdrEnd], pngMetadata(), data[ihdrEnd:])
+}
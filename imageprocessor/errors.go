@@ -0,0 +1,44 @@
+package imageprocessor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors describing why a run failed. Errors returned by this
+// package wrap one of them, so callers can branch with errors.Is.
+var (
+	// ErrUnsupportedFormat reports a source image that cannot be decoded.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrBadDimensions reports a source image with the wrong size.
+	ErrBadDimensions = errors.New("bad image dimensions")
+	// ErrConfigInvalid reports invalid options or dimensions.
+	ErrConfigInvalid = errors.New("invalid configuration")
+	// ErrCanceled reports a run that was canceled before it completed.
+	ErrCanceled = errors.New("processing canceled")
+	// ErrNotApproved reports a source that does not match any approved master.
+	ErrNotApproved = errors.New("source is not an approved master")
+	// ErrSignatureInvalid reports a manifest signature, or a file covered by
+	// a signed manifest, that does not verify.
+	ErrSignatureInvalid = errors.New("signature verification failed")
+	// ErrLimitExceeded reports an image larger than its decode limits.
+	ErrLimitExceeded = errors.New("image exceeds decode limits")
+	// ErrSourceConverted reports a source that strict mode refuses because
+	// reading it would change how it looks.
+	ErrSourceConverted = errors.New("source would be converted")
+)
+
+// OutputError reports a failure to produce a single output file.
+// Use errors.As to recover the name of the output that failed.
+type OutputError struct {
+	Name string
+	Err  error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("failed to create resized image %s: %v", e.Name, e.Err)
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,418 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FilterSpec configures a filter applied to the source before one output is
+// resized. Type selects the filter; the other fields are its parameters.
+type FilterSpec struct {
+	Type  string `json:"type" doc:"Filter to apply" schema:"enum=background|mask|crop|extend|rotate|flip|defringe"`
+	Color string `json:"color,omitempty" doc:"Color as #rgb, #rrggbb or #rrggbbaa (background, extend, rotate)"`
+	Shape string `json:"shape,omitempty" doc:"Shape to keep; everything outside it becomes transparent (mask)" schema:"enum=circle|rounded"`
+	// Rect and Focus are fractions of the image size, so they survive
+	// re-exporting the master at another resolution.
+	Rect  []float64 `json:"rect,omitempty" doc:"Region to keep as x, y, width and height fractions of the image (crop)"`
+	Focus []float64 `json:"focus,omitempty" doc:"Point to center the largest region with the output's aspect ratio on, as x and y fractions of the image (crop)"`
+	// Padding and Fill extend the canvas, see extendFilter.
+	Padding float64 `json:"padding,omitempty" doc:"Space added on every side, as a fraction of the image size (extend)" schema:"minimum=0"`
+	Fill    string  `json:"fill,omitempty" doc:"How the added space is filled: transparent, a color, or by repeating or mirroring the edge pixels (extend)" schema:"enum=transparent|color|edge|mirror"`
+	// Angle is in degrees clockwise; Axis is the direction of a flip.
+	Angle float64 `json:"angle,omitempty" doc:"Clockwise rotation in degrees (rotate)"`
+	Axis  string  `json:"axis,omitempty" doc:"Direction to mirror the image in (flip)" schema:"enum=horizontal|vertical"`
+	// Smart picks the region with the output's aspect ratio that holds the
+	// most detail instead of a fixed focal point.
+	Smart string `json:"smart,omitempty" doc:"Keep the region with the output's aspect ratio holding the most detail, measured by entropy or edge density, or frame the detected subject (crop)" schema:"enum=entropy|edges|subject"`
+}
+
+// filterBuilders constructs filters from their specs, keyed by type.
+// Builders get the dimension for filters that depend on the output.
+var filterBuilders = map[string]func(spec FilterSpec, dim Dimension) (Filter, error){
+	"background": backgroundFilter,
+	"mask":       maskFilter,
+	"crop":       cropFilter,
+	"extend":     extendFilter,
+	"rotate":     rotateFilter,
+	"flip":       flipFilter,
+	"defringe":   func(FilterSpec, Dimension) (Filter, error) { return Defringe, nil },
+}
+
+// fitFilters are the filters appended for the fit modes that change the
+// image before it is resized; stretch needs none. The crop keeps the most
+// detailed region, which is the center for flat or symmetric artwork.
+var fitFilters = map[string]FilterSpec{
+	"crop": {Type: "crop", Smart: "entropy"},
+	"pad":  {Type: "extend"},
+}
+
+// buildFilters turns the filter specs of a dimension, followed by the filter
+// of its fit mode, into filters.
+func buildFilters(dim Dimension) ([]Filter, error) {
+	specs := dim.Filters
+	if spec, ok := fitFilters[dim.Fit]; ok {
+		specs = append(slices.Clip(specs), spec)
+	}
+	filters := make([]Filter, 0, len(specs))
+	for _, spec := range specs {
+		build, ok := filterBuilders[spec.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q", spec.Type)
+		}
+		f, err := build(spec, dim)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", spec.Type, err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// backgroundFilter composites the image over a solid color, which removes
+// transparency for formats and platforms that do not support it.
+func backgroundFilter(spec FilterSpec, _ Dimension) (Filter, error) {
+	c, err := ParseHexColor(spec.Color)
+	if err != nil {
+		return nil, err
+	}
+	return func(img *image.NRGBA) *image.NRGBA {
+		dst := image.NewNRGBA(img.Bounds())
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+		return dst
+	}, nil
+}
+
+// RoundedCornerRadius is the corner radius of the rounded mask relative to
+// the image size, close to the corners of app icons on mobile platforms.
+const RoundedCornerRadius = 0.225
+
+// maskFilter clears everything outside a circle or a rounded square
+// inscribed in the image, with an antialiased edge.
+func maskFilter(spec FilterSpec, _ Dimension) (Filter, error) {
+	if spec.Shape != "circle" && spec.Shape != "rounded" {
+		return nil, fmt.Errorf("unknown shape %q, want circle or rounded", spec.Shape)
+	}
+	return func(img *image.NRGBA) *image.NRGBA {
+		b := img.Bounds()
+		w, h := float64(b.Dx()), float64(b.Dy())
+		half := min(w, h) / 2
+		radius := half
+		if spec.Shape == "rounded" {
+			radius = min(w, h) * RoundedCornerRadius
+		}
+
+		dst := image.NewNRGBA(b)
+		draw.Draw(dst, b, img, b.Min, draw.Src)
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				// Signed distance from the pixel center to the edge of a
+				// square with rounded corners, negative inside
+				dx := math.Abs(float64(x)+0.5-w/2) - (half - radius)
+				dy := math.Abs(float64(y)+0.5-h/2) - (half - radius)
+				dist := math.Hypot(max(dx, 0), max(dy, 0)) + min(max(dx, dy), 0) - radius
+				coverage := min(max(0.5-dist, 0), 1)
+				if coverage < 1 {
+					i := dst.PixOffset(b.Min.X+x, b.Min.Y+y) + 3
+					dst.Pix[i] = uint8(float64(dst.Pix[i])*coverage + 0.5)
+				}
+			}
+		}
+		return dst
+	}, nil
+}
+
+// cropFilter keeps a region of the image, such as the mark of a lockup that
+// also holds the wordmark. The region is either a rectangle, or the largest
+// region with the output's aspect ratio, centered on a focal point as far as
+// the image allows or placed where the image holds the most detail.
+func cropFilter(spec FilterSpec, dim Dimension) (Filter, error) {
+	fraction := func(v float64) bool { return v >= 0 && v <= 1 }
+	set := 0
+	for _, ok := range []bool{len(spec.Rect) > 0, len(spec.Focus) > 0, spec.Smart != ""} {
+		if ok {
+			set++
+		}
+	}
+	switch {
+	case set != 1:
+		return nil, fmt.Errorf("set exactly one of rect, focus and smart")
+	case len(spec.Rect) > 0:
+		if len(spec.Rect) != 4 || !fraction(spec.Rect[0]) || !fraction(spec.Rect[1]) ||
+			spec.Rect[2] <= 0 || spec.Rect[3] <= 0 || spec.Rect[0]+spec.Rect[2] > 1 || spec.Rect[1]+spec.Rect[3] > 1 {
+			return nil, fmt.Errorf("rect must be x, y, width and height fractions of the image, within it")
+		}
+	case len(spec.Focus) > 0:
+		if len(spec.Focus) != 2 || !fraction(spec.Focus[0]) || !fraction(spec.Focus[1]) {
+			return nil, fmt.Errorf("focus must be x and y fractions of the image")
+		}
+	case spec.Smart != "entropy" && spec.Smart != "edges" && spec.Smart != "subject":
+		return nil, fmt.Errorf("unknown smart crop %q, want entropy, edges or subject", spec.Smart)
+	}
+
+	return func(img *image.NRGBA) *image.NRGBA {
+		b := img.Bounds()
+		w, h := float64(b.Dx()), float64(b.Dy())
+		var r image.Rectangle
+		switch {
+		case len(spec.Rect) > 0:
+			r = image.Rect(int(math.Round(spec.Rect[0]*w)), int(math.Round(spec.Rect[1]*h)),
+				int(math.Round((spec.Rect[0]+spec.Rect[2])*w)), int(math.Round((spec.Rect[1]+spec.Rect[3])*h)))
+		case spec.Smart == "subject":
+			r = subjectRegion(img, float64(dim.Width)/float64(dim.Height))
+		default:
+			aspect := float64(dim.Width) / float64(dim.Height)
+			cw, ch := w, h
+			if w/h > aspect {
+				cw = h * aspect
+			} else {
+				ch = w / aspect
+			}
+			size := image.Pt(max(int(math.Round(cw)), 1), max(int(math.Round(ch)), 1))
+			var origin image.Point
+			if spec.Smart != "" {
+				origin = smartCropOrigin(img, size, spec.Smart)
+			} else {
+				// Center on the focal point, shifted back inside the image
+				origin.X = int(math.Round(min(max(spec.Focus[0]*w-cw/2, 0), w-cw)))
+				origin.Y = int(math.Round(min(max(spec.Focus[1]*h-ch/2, 0), h-ch)))
+			}
+			r = image.Rectangle{Min: origin, Max: origin.Add(size)}.Intersect(image.Rect(0, 0, b.Dx(), b.Dy()))
+		}
+		if r.Empty() {
+			r.Max = r.Min.Add(image.Pt(1, 1))
+		}
+
+		dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+		draw.Draw(dst, dst.Bounds(), img, b.Min.Add(r.Min), draw.Src)
+		return dst
+	}, nil
+}
+
+// extendFilter grows the canvas by Padding on every side and then to the
+// output's aspect ratio, centering the image, so a logo can become a
+// full-bleed tile without being stretched. The new area is transparent, a
+// color, or continues the image by repeating (edge) or mirroring its border
+// pixels.
+func extendFilter(spec FilterSpec, dim Dimension) (Filter, error) {
+	var fill color.NRGBA
+	switch spec.Fill {
+	case "", "transparent", "edge", "mirror":
+		if spec.Color != "" {
+			return nil, fmt.Errorf("color only applies to fill color")
+		}
+	case "color":
+		c, err := ParseHexColor(spec.Color)
+		if err != nil {
+			return nil, err
+		}
+		fill = c
+	default:
+		return nil, fmt.Errorf("unknown fill %q, want transparent, color, edge or mirror", spec.Fill)
+	}
+	if spec.Padding < 0 || spec.Padding > 10 {
+		return nil, fmt.Errorf("padding must be between 0 and 10")
+	}
+
+	return func(img *image.NRGBA) *image.NRGBA {
+		b := img.Bounds()
+		sw, sh := b.Dx(), b.Dy()
+		w := float64(sw) * (1 + 2*spec.Padding)
+		h := float64(sh) * (1 + 2*spec.Padding)
+		if aspect := float64(dim.Width) / float64(dim.Height); w/h < aspect {
+			w = h * aspect
+		} else {
+			h = w / aspect
+		}
+		dw, dh := max(int(math.Round(w)), sw), max(int(math.Round(h)), sh)
+		ox, oy := (dw-sw)/2, (dh-sh)/2
+
+		dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+		for y := range dh {
+			for x := range dw {
+				sx, sy := x-ox, y-oy
+				inside := sx >= 0 && sy >= 0 && sx < sw && sy < sh
+				var p []uint8
+				switch {
+				case inside || spec.Fill == "edge":
+					sx, sy = min(max(sx, 0), sw-1), min(max(sy, 0), sh-1)
+				case spec.Fill == "mirror":
+					sx, sy = mirrorIndex(sx, sw), mirrorIndex(sy, sh)
+				case spec.Fill == "color":
+					p = []uint8{fill.R, fill.G, fill.B, fill.A}
+				default:
+					continue
+				}
+				if p == nil {
+					i := img.PixOffset(b.Min.X+sx, b.Min.Y+sy)
+					p = img.Pix[i : i+4]
+				}
+				copy(dst.Pix[dst.PixOffset(x, y):], p)
+			}
+		}
+		return dst
+	}, nil
+}
+
+// mirrorIndex reflects i into [0, n) about the edges without repeating the
+// edge pixel, for any distance outside.
+func mirrorIndex(i, n int) int {
+	if n == 1 {
+		return 0
+	}
+	period := 2 * (n - 1)
+	i %= period
+	if i < 0 {
+		i += period
+	}
+	if i >= n {
+		i = period - i
+	}
+	return i
+}
+
+// rotateFilter turns the image clockwise by Angle degrees. Quarter turns
+// move pixels exactly; other angles grow the canvas to hold the whole
+// rotated image, resampled bilinearly, with the corners filled with Color or
+// left transparent.
+func rotateFilter(spec FilterSpec, _ Dimension) (Filter, error) {
+	var fill color.NRGBA
+	if spec.Color != "" {
+		c, err := ParseHexColor(spec.Color)
+		if err != nil {
+			return nil, err
+		}
+		fill = c
+	}
+	angle := math.Mod(math.Mod(spec.Angle, 360)+360, 360)
+
+	return func(img *image.NRGBA) *image.NRGBA {
+		b := img.Bounds()
+		sw, sh := b.Dx(), b.Dy()
+		if angle == 0 {
+			return img
+		}
+		if math.Mod(angle, 90) == 0 {
+			turns := int(angle / 90)
+			dw, dh := sw, sh
+			if turns%2 == 1 {
+				dw, dh = sh, sw
+			}
+			dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+			for y := range sh {
+				for x := range sw {
+					var dx, dy int
+					switch turns {
+					case 1:
+						dx, dy = sh-1-y, x
+					case 2:
+						dx, dy = sw-1-x, sh-1-y
+					case 3:
+						dx, dy = y, sw-1-x
+					}
+					i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+					copy(dst.Pix[dst.PixOffset(dx, dy):], img.Pix[i:i+4])
+				}
+			}
+			return dst
+		}
+
+		rad := angle * math.Pi / 180
+		sin, cos := math.Sin(rad), math.Cos(rad)
+		dw := int(math.Ceil(math.Abs(float64(sw)*cos) + math.Abs(float64(sh)*sin)))
+		dh := int(math.Ceil(math.Abs(float64(sw)*sin) + math.Abs(float64(sh)*cos)))
+		dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+		scx, scy := float64(sw)/2, float64(sh)/2
+		dcx, dcy := float64(dw)/2, float64(dh)/2
+		for y := range dh {
+			for x := range dw {
+				// Map the pixel center back into the source
+				px, py := float64(x)+0.5-dcx, float64(y)+0.5-dcy
+				sx := px*cos + py*sin + scx - 0.5
+				sy := -px*sin + py*cos + scy - 0.5
+				c := sampleBilinear(img, sx, sy, fill)
+				copy(dst.Pix[dst.PixOffset(x, y):], []uint8{c.R, c.G, c.B, c.A})
+			}
+		}
+		return dst
+	}, nil
+}
+
+// sampleBilinear interpolates the image at a fractional position relative
+// to its bounds, treating pixels outside it as fill. Colors are weighted by
+// opacity so transparent pixels do not darken the edges.
+func sampleBilinear(img *image.NRGBA, x, y float64, fill color.NRGBA) color.NRGBA {
+	b := img.Bounds()
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	var r, g, bl, a float64
+	for _, s := range [4]struct {
+		x, y int
+		w    float64
+	}{{x0, y0, (1 - fx) * (1 - fy)}, {x0 + 1, y0, fx * (1 - fy)}, {x0, y0 + 1, (1 - fx) * fy}, {x0 + 1, y0 + 1, fx * fy}} {
+		c := fill
+		if s.x >= 0 && s.y >= 0 && s.x < b.Dx() && s.y < b.Dy() {
+			c = img.NRGBAAt(b.Min.X+s.x, b.Min.Y+s.y)
+		}
+		wa := s.w * float64(c.A)
+		r += wa * float64(c.R)
+		g += wa * float64(c.G)
+		bl += wa * float64(c.B)
+		a += wa
+	}
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{R: uint8(r/a + 0.5), G: uint8(g/a + 0.5), B: uint8(bl/a + 0.5), A: uint8(a + 0.5)}
+}
+
+// flipFilter mirrors the image horizontally (left to right) or vertically,
+// e.g. for right-to-left variants of a brand.
+func flipFilter(spec FilterSpec, _ Dimension) (Filter, error) {
+	if spec.Axis != "horizontal" && spec.Axis != "vertical" {
+		return nil, fmt.Errorf("unknown axis %q, want horizontal or vertical", spec.Axis)
+	}
+	return func(img *image.NRGBA) *image.NRGBA {
+		b := img.Bounds()
+		dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		for y := range b.Dy() {
+			for x := range b.Dx() {
+				sx, sy := x, y
+				if spec.Axis == "horizontal" {
+					sx = b.Dx() - 1 - x
+				} else {
+					sy = b.Dy() - 1 - y
+				}
+				i := img.PixOffset(b.Min.X+sx, b.Min.Y+sy)
+				copy(dst.Pix[dst.PixOffset(x, y):], img.Pix[i:i+4])
+			}
+		}
+		return dst
+	}, nil
+}
+
+// ParseHexColor parses #rgb, #rrggbb and #rrggbbaa colors, as used in configs.
+func ParseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
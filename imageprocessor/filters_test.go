@@ -0,0 +1,42 @@
+package imageprocessor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestFitCropFollowsDetail crops a source whose only artwork, a vertical
+// gradient, sits near the top to a wide output and checks the crop keeps
+// all of it rather than the empty center.
+func TestFitCropFollowsDetail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	for y := 10; y < 50; y++ {
+		for x := 20; x < 180; x++ {
+			v := uint8((y - 10) * 6)
+			src.SetNRGBA(x, y, color.NRGBA{v, v, v, 0xff})
+		}
+	}
+
+	filters, err := buildFilters(Dimension{Name: "banner.png", Width: 400, Height: 100, Fit: "crop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := src
+	for _, f := range filters {
+		img = f(img)
+	}
+
+	if got := img.Bounds().Size(); got != image.Pt(200, 50) {
+		t.Fatalf("cropped to %v, want 200x50", got)
+	}
+	opaque := 0
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0 {
+			opaque++
+		}
+	}
+	if want := 160 * 40; opaque != want {
+		t.Errorf("crop kept %d opaque pixels of the subject, want all %d", opaque, want)
+	}
+}
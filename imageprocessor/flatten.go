@@ -0,0 +1,26 @@
+package imageprocessor
+
+import "image"
+
+// FlattenOverWhite returns an opaque copy of img composited over white, the
+// way paper, e-ink displays and formats without partial transparency show
+// it.
+func FlattenOverWhite(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	flat := image.NewRGBA(b)
+	for y := range b.Dy() {
+		src := img.Pix[y*img.Stride : y*img.Stride+b.Dx()*4]
+		dst := flat.Pix[y*flat.Stride:]
+		for i := 0; i < len(src); i += 4 {
+			// Premultiplied colors over white only need the uncovered part
+			// added. Resampling can leave a channel above its alpha, so the
+			// sum saturates rather than wraps around to black
+			white := int(0xff - src[i+3])
+			for c := range 3 {
+				dst[i+c] = uint8(min(int(src[i+c])+white, 0xff))
+			}
+			dst[i+3] = 0xff
+		}
+	}
+	return flat
+}
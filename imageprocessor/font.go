@@ -0,0 +1,229 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// glyphWidth and glyphHeight are the size of a glyph of the built-in font;
+// glyphs are separated by one blank column.
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// font5x7 is a built-in bitmap font covering upper case letters, digits and
+// common punctuation. Each row holds five pixels in its low bits, the most
+// significant bit on the left.
+var font5x7 = map[rune][glyphHeight]uint8{
+	'A':  {0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'B':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C':  {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D':  {0b11100, 0b10010, 0b10001, 0b10001, 0b10001, 0b10010, 0b11100},
+	'E':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F':  {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G':  {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H':  {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I':  {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J':  {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K':  {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L':  {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M':  {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N':  {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q':  {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R':  {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S':  {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T':  {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V':  {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W':  {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X':  {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y':  {0b10001, 0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100},
+	'Z':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'0':  {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1':  {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3':  {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4':  {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5':  {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6':  {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7':  {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8':  {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9':  {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	' ':  {},
+	'-':  {0, 0, 0, 0b11111, 0, 0, 0},
+	'_':  {0, 0, 0, 0, 0, 0, 0b11111},
+	'.':  {0, 0, 0, 0, 0, 0b01100, 0b01100},
+	',':  {0, 0, 0, 0, 0b01100, 0b00100, 0b01000},
+	':':  {0, 0b01100, 0b01100, 0, 0b01100, 0b01100, 0},
+	'!':  {0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0, 0b00100},
+	'?':  {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0, 0b00100},
+	'/':  {0, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0},
+	'#':  {0b01010, 0b01010, 0b11111, 0b01010, 0b11111, 0b01010, 0b01010},
+	'(':  {0b00010, 0b00100, 0b01000, 0b01000, 0b01000, 0b00100, 0b00010},
+	')':  {0b01000, 0b00100, 0b00010, 0b00010, 0b00010, 0b00100, 0b01000},
+	'\'': {0b01100, 0b00100, 0b01000, 0, 0, 0, 0},
+	'&':  {0b01100, 0b10010, 0b10100, 0b01000, 0b10101, 0b10010, 0b01101},
+	'+':  {0, 0b00100, 0b00100, 0b11111, 0b00100, 0b00100, 0},
+	'@':  {0b01110, 0b10001, 0b10111, 0b10101, 0b10111, 0b10000, 0b01110},
+}
+
+// checkBuiltinText reports characters of text the built-in font cannot
+// draw, once lower case letters are drawn in upper case.
+func checkBuiltinText(text string) error {
+	for _, r := range text {
+		if _, ok := font5x7[unicode.ToUpper(r)]; !ok && !unicode.IsSpace(r) {
+			return fmt.Errorf("the built-in font cannot draw %q in %q; it has A-Z, 0-9 and -_.,:!?/#()'&+@", r, text)
+		}
+	}
+	return nil
+}
+
+// textWidth returns the width in font pixels of text rendered at scale 1.
+func textWidth(text string) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return n*(glyphWidth+1) - 1
+}
+
+// renderText draws text in the built-in font as a mask, each font pixel
+// scaled to a scale x scale square. Lower case letters are drawn in upper
+// case and unknown characters as '?'.
+func renderText(text string, scale int) *image.Alpha {
+	text = strings.ToUpper(text)
+	mask := image.NewAlpha(image.Rect(0, 0, textWidth(text)*scale, glyphHeight*scale))
+	for i, r := range []rune(text) {
+		glyph, ok := font5x7[r]
+		if !ok {
+			glyph = font5x7['?']
+		}
+		x0 := i * (glyphWidth + 1) * scale
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						mask.Pix[mask.PixOffset(x0+col*scale+dx, row*scale+dy)] = 0xff
+					}
+				}
+			}
+		}
+	}
+	return mask
+}
+
+// typeface draws the text of composed outputs. Sizes are given as a scale
+// of the built-in font, whose glyphs are glyphHeight pixels tall at scale 1.
+type typeface interface {
+	// width returns the width in pixels of text drawn at scale.
+	width(text string, scale int) int
+	// lineHeight returns the distance between lines drawn at scale.
+	lineHeight(scale int) int
+	// render draws text at scale as a mask at most lineHeight tall.
+	render(text string, scale int) *image.Alpha
+}
+
+// builtinFont is the built-in bitmap font.
+type builtinFont struct{}
+
+func (builtinFont) width(text string, scale int) int { return textWidth(text) * scale }
+
+// lineHeight leaves three font pixels between lines.
+func (builtinFont) lineHeight(scale int) int { return (glyphHeight + 3) * scale }
+
+func (builtinFont) render(text string, scale int) *image.Alpha { return renderText(text, scale) }
+
+// outlineFont is a TrueType or OpenType font. It is sized so that its
+// capital letters are about as tall as those of the built-in font at the
+// same scale. It keeps a face per scale, so it must not be shared between
+// goroutines.
+type outlineFont struct {
+	font  *opentype.Font
+	faces map[int]font.Face
+}
+
+// loadOutlineFont parses the TrueType or OpenType font file at path.
+func loadOutlineFont(fsys FS, path string) (*outlineFont, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open font: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", path, err)
+	}
+	return &outlineFont{font: parsed, faces: map[int]font.Face{}}, nil
+}
+
+// face returns the face of the font at scale. Capital letters take about
+// 70% of the em square, so the em is sized accordingly.
+func (f *outlineFont) face(scale int) font.Face {
+	if face, ok := f.faces[scale]; ok {
+		return face
+	}
+	// NewFace never fails
+	face, _ := opentype.NewFace(f.font, &opentype.FaceOptions{
+		Size:    float64(glyphHeight*scale) / 0.7,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	f.faces[scale] = face
+	return face
+}
+
+// check reports characters of text the font has no glyph for.
+func (f *outlineFont) check(text string) error {
+	var buf sfnt.Buffer
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		if i, err := f.font.GlyphIndex(&buf, r); err != nil || i == 0 {
+			return fmt.Errorf("the font has no glyph for %q in %q", r, text)
+		}
+	}
+	return nil
+}
+
+func (f *outlineFont) width(text string, scale int) int {
+	return font.MeasureString(f.face(scale), text).Ceil()
+}
+
+func (f *outlineFont) lineHeight(scale int) int {
+	return f.face(scale).Metrics().Height.Ceil()
+}
+
+// render draws text with its baseline at the ascent of the face, so accents
+// and descenders stay inside the mask.
+func (f *outlineFont) render(text string, scale int) *image.Alpha {
+	face := f.face(scale)
+	metrics := face.Metrics()
+	mask := image.NewAlpha(image.Rect(0, 0, max(f.width(text, scale), 1), (metrics.Ascent + metrics.Descent).Ceil()))
+	d := font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.Point26_6{Y: metrics.Ascent},
+	}
+	d.DrawString(text)
+	return mask
+}
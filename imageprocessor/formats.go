@@ -0,0 +1,210 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"slices"
+)
+
+// Output formats supported by Dimension.Format.
+const (
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+	FormatICO  = "ico"
+	FormatICNS = "icns"
+	FormatKTX2 = "ktx2"
+	FormatDDS  = "dds"
+	FormatGIF  = "gif"
+	// FormatCHeader is a C header declaring the pixels of a Dimension.Gray
+	// output as a byte array.
+	FormatCHeader = "h"
+	// FormatAdaptiveIcon is the XML of an Android adaptive icon referencing
+	// the layers of Dimension.AdaptiveLayer outputs.
+	FormatAdaptiveIcon = "xml"
+)
+
+// OutputFormats lists the output formats compiled in.
+var OutputFormats = []string{FormatPNG, FormatJPEG, FormatICO, FormatICNS, FormatKTX2, FormatDDS, FormatGIF, FormatCHeader, FormatAdaptiveIcon}
+
+// SourceFormats lists the source image formats that can be decoded. Codecs
+// behind build tags add themselves here when they are compiled in.
+var SourceFormats = []string{"png", "jpeg"}
+
+// icnsTypes maps the square sizes supported by ICNS to their PNG element types.
+var icnsTypes = map[uint]string{
+	16:   "icp4",
+	32:   "icp5",
+	64:   "icp6",
+	128:  "ic07",
+	256:  "ic08",
+	512:  "ic09",
+	1024: "ic10",
+}
+
+// formatOf returns the format of dim, defaulting to PNG.
+func formatOf(dim Dimension) string {
+	if dim.Format == "" {
+		return FormatPNG
+	}
+	return dim.Format
+}
+
+// validateFormat reports formats that are unknown or cannot hold the dimension's size.
+func validateFormat(dim Dimension) error {
+	format := formatOf(dim)
+	if len(dim.Sizes) > 0 && format != FormatICO {
+		return fmt.Errorf("sizes only apply to ico outputs, not %s", format)
+	}
+	switch format {
+	case FormatPNG, FormatJPEG, FormatKTX2, FormatDDS, FormatGIF, FormatCHeader, FormatAdaptiveIcon:
+		return nil
+	case FormatICO:
+		if dim.Width > 256 || dim.Height > 256 {
+			return fmt.Errorf("ico images cannot be larger than 256x256, got %dx%d", dim.Width, dim.Height)
+		}
+		return validateICOSizes(dim)
+	case FormatICNS:
+		if _, ok := icnsTypes[dim.Width]; !ok || dim.Width != dim.Height {
+			return fmt.Errorf("icns images must be square with a size of 16, 32, 64, 128, 256, 512 or 1024, got %dx%d", dim.Width, dim.Height)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// encode writes the rendered images of dim to w in its format, with the
+// settings of its encoder profile. ICO outputs hold all of imgs, one per
+// embedded size; other formats hold the first. PNG data, including the PNG
+// images held by ICO and ICNS files, is compressed with the profile's
+// effort; only PNG outputs are indexed or carry metadata.
+func encode(w io.Writer, imgs []*image.RGBA, dim Dimension, opts Options) error {
+	img, enc := imgs[0], encoderOf(dim, opts)
+	switch formatOf(dim) {
+	case FormatJPEG:
+		if enc.TargetSSIM > 0 {
+			return encodeJPEGTarget(w, img, enc.TargetSSIM, enc.JPEGQuality)
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: enc.JPEGQuality})
+	case FormatICO:
+		return encodeICO(w, imgs, enc.PNGEffort, enc.ICOBitmaps)
+	case FormatICNS:
+		return encodeICNS(w, img, enc.PNGEffort)
+	case FormatKTX2:
+		return encodeKTX2(w, img)
+	case FormatDDS:
+		return encodeDDS(w, img)
+	case FormatGIF:
+		return encodeGIF(w, img)
+	case FormatCHeader:
+		return encodeCHeader(w, img, dim)
+	case FormatAdaptiveIcon:
+		return encodeAdaptiveIcon(w)
+	default:
+		if !enc.Metadata {
+			return encodePNG(w, img, enc.PNGEffort, enc.PNGIndexed)
+		}
+		var data bytes.Buffer
+		if err := encodePNG(&data, img, enc.PNGEffort, enc.PNGIndexed); err != nil {
+			return err
+		}
+		_, err := w.Write(withPNGMetadata(data.Bytes()))
+		return err
+	}
+}
+
+// validateICOSizes reports embedded ICO sizes that are out of range,
+// repeated, or whose largest is not the output's size.
+func validateICOSizes(dim Dimension) error {
+	if len(dim.Sizes) == 0 {
+		return nil
+	}
+	for i, size := range dim.Sizes {
+		if size == 0 || size > 256 {
+			return fmt.Errorf("ico sizes must be between 1 and 256, got %d", size)
+		}
+		if slices.Contains(dim.Sizes[:i], size) {
+			return fmt.Errorf("ico size %d is listed twice", size)
+		}
+	}
+	if largest := slices.Max(dim.Sizes); dim.Width != largest || dim.Height != largest {
+		return fmt.Errorf("an ico with sizes must be %dx%d, its largest size, got %dx%d", largest, largest, dim.Width, dim.Height)
+	}
+	return nil
+}
+
+// encodeICO writes an ICO file holding an entry per image, in order. Entries
+// are PNG-compressed, which Windows Vista and later read natively, or 8-bit
+// bitmaps with bitmaps set.
+func encodeICO(w io.Writer, imgs []*image.RGBA, pngEffort int, bitmaps bool) error {
+	type entry struct {
+		Width, Height           uint8
+		Colors, Reserved        uint8
+		Planes, BitCount        uint16
+		BytesInRes, ImageOffset uint32
+	}
+
+	// Images follow the header and the directory, one entry per image
+	var images bytes.Buffer
+	entries := make([]entry, len(imgs))
+	offset := 6 + 16*len(imgs)
+	for i, img := range imgs {
+		start := images.Len()
+		bitCount := uint16(32)
+		if bitmaps {
+			bitCount = 8
+			if err := encodeICOBitmap(&images, img); err != nil {
+				return err
+			}
+		} else if err := encodePNG(&images, img, pngEffort, false); err != nil {
+			return err
+		}
+		// Sizes of 256 are stored as 0 in the one-byte directory fields
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+		entries[i] = entry{
+			Width: uint8(width % 256), Height: uint8(height % 256),
+			Planes: 1, BitCount: bitCount,
+			BytesInRes: uint32(images.Len() - start), ImageOffset: uint32(offset + start),
+		}
+	}
+
+	header := struct{ Reserved, Type, Count uint16 }{Type: 1, Count: uint16(len(imgs))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, entries); err != nil {
+		return err
+	}
+	_, err := w.Write(images.Bytes())
+	return err
+}
+
+// encodeICNS writes an Apple icon image holding a single PNG element.
+func encodeICNS(w io.Writer, img *image.RGBA, pngEffort int) error {
+	var data bytes.Buffer
+	if err := encodePNG(&data, img, pngEffort, false); err != nil {
+		return err
+	}
+
+	iconType, ok := icnsTypes[uint(img.Bounds().Dx())]
+	if !ok {
+		return fmt.Errorf("unsupported icns size %d", img.Bounds().Dx())
+	}
+
+	elementLen := uint32(8 + data.Len())
+	var header bytes.Buffer
+	header.WriteString("icns")
+	binary.Write(&header, binary.BigEndian, 8+elementLen)
+	header.WriteString(iconType)
+	binary.Write(&header, binary.BigEndian, elementLen)
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(data.Bytes())
+	return err
+}
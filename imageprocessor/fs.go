@@ -0,0 +1,228 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FS is the file system the processor reads sources and watermark images
+// from and writes outputs to. Names are paths as passed to ProcessImage, in
+// the host's syntax, rather than the slash separated names of io/fs.
+type FS interface {
+	Open(name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// HostFS is the operating system's file system, used when Options.FS is nil.
+var HostFS FS = hostFS{}
+
+// hostFS implements FS with the os package, extending long Windows paths.
+type hostFS struct{}
+
+func (hostFS) Open(name string) (fs.File, error)     { return os.Open(longPath(name)) }
+func (hostFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(longPath(name)) }
+
+func (hostFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(longPath(name), perm)
+}
+
+func (hostFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(longPath(name), data, perm)
+}
+
+// fsOf returns the file system of a run.
+func fsOf(opts Options) FS {
+	if opts.FS == nil {
+		return HostFS
+	}
+	return opts.FS
+}
+
+// MemFS is an FS held in memory, so embedders can test asset generation
+// without touching the disk. The zero value is an empty file system ready
+// to use, and it is safe for concurrent use.
+type MemFS struct {
+	// Clock sets the modification times of written files; nil leaves them
+	// zero.
+	Clock Clock
+
+	mu    sync.Mutex
+	files map[string]*memEntry
+}
+
+// memEntry is a file or directory of a MemFS.
+type memEntry struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// clean maps a name to its key in the file map.
+func (m *MemFS) clean(name string) string {
+	return filepath.Clean(name)
+}
+
+// lookup returns the entry at name, treating the roots as directories.
+// m.mu must be held.
+func (m *MemFS) lookup(name string) (*memEntry, bool) {
+	if name == "." || name == filepath.Dir(name) {
+		return &memEntry{mode: fs.ModeDir | 0755}, true
+	}
+	e, ok := m.files[name]
+	return e, ok
+}
+
+// Open opens the named file for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = m.clean(name)
+	e, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{Reader: bytes.NewReader(e.data), info: memInfo{name: filepath.Base(name), entry: *e}}, nil
+}
+
+// Stat describes the named file.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = m.clean(name)
+	e, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memInfo{name: filepath.Base(name), entry: *e}, nil
+}
+
+// MkdirAll creates the named directory and any missing parents.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = map[string]*memEntry{}
+	}
+	for dir := m.clean(name); ; dir = filepath.Dir(dir) {
+		e, ok := m.lookup(dir)
+		if ok && !e.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+		if ok {
+			return nil
+		}
+		m.files[dir] = &memEntry{mode: fs.ModeDir | perm.Perm(), modTime: m.now()}
+	}
+}
+
+// WriteFile writes data to the named file, replacing its contents. Like
+// os.WriteFile, it fails when the parent directory does not exist.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = map[string]*memEntry{}
+	}
+	name = m.clean(name)
+	if parent, ok := m.lookup(filepath.Dir(name)); !ok || !parent.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e, ok := m.files[name]; ok && e.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	m.files[name] = &memEntry{data: bytes.Clone(data), mode: perm.Perm(), modTime: m.now()}
+	return nil
+}
+
+// ReadFile returns the contents of the named file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// now returns the time of the MemFS clock. m.mu must be held.
+func (m *MemFS) now() time.Time {
+	if m.Clock == nil {
+		return time.Time{}
+	}
+	return m.Clock.Now()
+}
+
+// memFile is an open MemFS file.
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memInfo describes a MemFS entry.
+type memInfo struct {
+	name  string
+	entry memEntry
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.entry.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.entry.mode }
+func (i memInfo) ModTime() time.Time { return i.entry.modTime }
+func (i memInfo) IsDir() bool        { return i.entry.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
+
+// Clock tells the processor the time for durations and manifest timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+// HostClock is the system clock, used when Options.Clock is nil.
+var HostClock Clock = hostClock{}
+
+type hostClock struct{}
+
+func (hostClock) Now() time.Time { return time.Now() }
+
+// clockOf returns the clock of a run.
+func clockOf(opts Options) Clock {
+	if opts.Clock == nil {
+		return HostClock
+	}
+	return opts.Clock
+}
+
+// FakeClock is a Clock that only moves when advanced, for deterministic
+// durations and timestamps in tests. It is safe for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock stopped at t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,238 @@
+package imageprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// selftestFS holds the config rendered by the self test and the golden
+// hashes of its outputs.
+//
+//go:embed selftest/reference.json selftest/golden.txt
+var selftestFS embed.FS
+
+// referenceSize is the side of the reference sources, the size
+// checkSourceSize requires.
+const referenceSize = 1080
+
+// referenceSources draws the reference sources of the self test. They are
+// drawn rather than shipped as files, so every build renders from the same
+// pixels regardless of the decoders compiled in.
+var referenceSources = map[string]func() *image.NRGBA{
+	"logo":  drawReferenceLogo,
+	"photo": drawReferencePhoto,
+}
+
+// Golden maps self test outputs, named "<source>/<output>", to the
+// perceptual hashes they are expected to have.
+type Golden map[string]PerceptualHash
+
+// GoldenCheck is the outcome of comparing one self test output with its
+// golden hash.
+type GoldenCheck struct {
+	// Name is the reference source and output, as in "logo/plain.png".
+	Name string
+	Hash PerceptualHash
+	// Want is the golden hash; Missing reports that there is none.
+	Want     PerceptualHash
+	Missing  bool
+	Distance int
+}
+
+// Passed reports whether the output is within maxDistance bits of its
+// golden hash.
+func (c GoldenCheck) Passed(maxDistance int) bool {
+	return !c.Missing && c.Distance <= maxDistance
+}
+
+// ReferenceDimensions returns the outputs the self test renders by default,
+// covering every filter and fit mode.
+func ReferenceDimensions() []Dimension {
+	data, err := selftestFS.ReadFile("selftest/reference.json")
+	if err != nil {
+		panic(err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		panic(fmt.Errorf("selftest reference: %w", err))
+	}
+	return normalizeDimensions(cfg.Dimensions)
+}
+
+// ReferenceGolden returns the golden hashes of ReferenceDimensions.
+func ReferenceGolden() Golden {
+	data, err := selftestFS.ReadFile("selftest/golden.txt")
+	if err != nil {
+		panic(err)
+	}
+	golden, err := parseGolden(bytes.NewReader(data), "golden.txt")
+	if err != nil {
+		panic(err)
+	}
+	return golden
+}
+
+// LoadGolden reads a golden file: one perceptual hash and output name per
+// line, with blank lines and text after a # ignored, as written by
+// Golden.Write.
+func LoadGolden(path string) (Golden, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read golden hashes: %w", ErrConfigInvalid, err)
+	}
+	defer f.Close()
+	return parseGolden(f, path)
+}
+
+// parseGolden parses the golden file read from r, naming it path in errors.
+func parseGolden(r io.Reader, path string) (Golden, error) {
+	golden := Golden{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: %s:%d: expected a hash and an output name", ErrConfigInvalid, path, line)
+		}
+		hash, err := ParsePerceptualHash(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s:%d: %w", ErrConfigInvalid, path, line, err)
+		}
+		golden[fields[1]] = hash
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to read golden hashes: %w", ErrConfigInvalid, err)
+	}
+	return golden, nil
+}
+
+// Write writes the golden hashes sorted by output name.
+func (g Golden) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Perceptual hashes of the selftest outputs, written by logo-generator selftest -write")
+	for _, name := range slices.Sorted(maps.Keys(g)) {
+		fmt.Fprintf(bw, "%s  %s\n", g[name], name)
+	}
+	return bw.Flush()
+}
+
+// SelfTest renders dims from every reference source and compares the
+// perceptual hash of each output with golden, in source and config order.
+// The hashes are taken before encoding, so lossy formats compare like
+// lossless ones. When outputDir is set the outputs are also written there,
+// one directory per source, for inspection.
+func SelfTest(ctx context.Context, dims []Dimension, golden Golden, outputDir string, opts Options) ([]GoldenCheck, error) {
+	dims = normalizeDimensions(dims)
+	if err := validateDimensions(dims); err != nil {
+		return nil, err
+	}
+	var wm *watermarker
+	if opts.Watermark != nil {
+		var err error
+		if wm, err = newWatermarker(fsOf(opts), opts.Watermark); err != nil {
+			return nil, err
+		}
+	}
+
+	var checks []GoldenCheck
+	for _, source := range slices.Sorted(maps.Keys(referenceSources)) {
+		src := newSourceImage(referenceSources[source]())
+		for _, dim := range dims {
+			if ctx.Err() != nil {
+				return checks, canceled(ctx)
+			}
+			img, err := renderImage(ctx, src, dim, wm, opts)
+			if err != nil {
+				return checks, &OutputError{Name: source + "/" + dim.Name, Err: err}
+			}
+			if outputDir != "" {
+				if err := writeSelfTestOutput(filepath.Join(outputDir, source, dim.Name), img, dim); err != nil {
+					return checks, &OutputError{Name: source + "/" + dim.Name, Err: err}
+				}
+			}
+
+			check := GoldenCheck{Name: source + "/" + dim.Name, Hash: HashImage(img)}
+			want, ok := golden[check.Name]
+			check.Want, check.Missing, check.Distance = want, !ok, check.Hash.Distance(want)
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// writeSelfTestOutput encodes a rendered self test output to path.
+func writeSelfTestOutput(path string, img *image.RGBA, dim Dimension) error {
+	var data bytes.Buffer
+	if err := encode(&data, []*image.RGBA{img}, dim, Options{}); err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	if err := os.MkdirAll(longPath(filepath.Dir(path)), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(longPath(path), data.Bytes(), 0644)
+}
+
+// paintShape fills the pixels of img whose center, in fractions of the
+// image size, lies inside the shape.
+func paintShape(img *image.NRGBA, c color.NRGBA, inside func(x, y float64) bool) {
+	b := img.Bounds()
+	for py := b.Min.Y; py < b.Max.Y; py++ {
+		y := (float64(py-b.Min.Y) + 0.5) / float64(b.Dy())
+		for px := b.Min.X; px < b.Max.X; px++ {
+			if inside((float64(px-b.Min.X)+0.5)/float64(b.Dx()), y) {
+				img.SetNRGBA(px, py, c)
+			}
+		}
+	}
+}
+
+// ellipse returns a shape test for the ellipse centered on cx, cy.
+func ellipse(cx, cy, rx, ry float64) func(x, y float64) bool {
+	return func(x, y float64) bool {
+		dx, dy := (x-cx)/rx, (y-cy)/ry
+		return dx*dx+dy*dy <= 1
+	}
+}
+
+// drawReferenceLogo draws an asymmetric mark on a transparent background, so
+// masks, crops, rotations and flips all change the hash.
+func drawReferenceLogo() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, referenceSize, referenceSize))
+	paintShape(img, color.NRGBA{0x1f, 0x6f, 0xeb, 0xff}, ellipse(0.38, 0.45, 0.28, 0.28))
+	paintShape(img, color.NRGBA{0xff, 0x8c, 0x1a, 0xff}, func(x, y float64) bool {
+		return (x >= 0.62 && x <= 0.92 && y >= 0.08 && y <= 0.18) || (x >= 0.82 && x <= 0.92 && y >= 0.08 && y <= 0.45)
+	})
+	paintShape(img, color.NRGBA{0x2e, 0xa0, 0x43, 0xff}, func(x, y float64) bool {
+		return x >= 0.55 && y >= 0.7 && y <= 0.95 && math.Mod((x+y)*20, 2) < 1
+	})
+	paintShape(img, color.NRGBA{0xff, 0xff, 0xff, 0xff}, ellipse(0.3, 0.38, 0.07, 0.07))
+	return img
+}
+
+// drawReferencePhoto draws a flat headshot on an opaque backdrop for the
+// subject crop.
+func drawReferencePhoto() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, referenceSize, referenceSize))
+	paintShape(img, color.NRGBA{0xc8, 0xd2, 0xdc, 0xff}, func(x, y float64) bool { return true })
+	paintShape(img, color.NRGBA{0x2b, 0x33, 0x4a, 0xff}, func(x, y float64) bool {
+		return y >= 0.72 && math.Abs(x-0.6) <= 0.12+(y-0.72)*0.9
+	})
+	paintShape(img, color.NRGBA{0x3a, 0x26, 0x18, 0xff}, ellipse(0.6, 0.36, 0.15, 0.17))
+	paintShape(img, color.NRGBA{0xe0, 0xac, 0x8c, 0xff}, ellipse(0.6, 0.44, 0.12, 0.16))
+	return img
+}
@@ -0,0 +1,92 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// encodeGIF writes img as an opaque GIF, flattened over white, since GIF
+// transparency is all or nothing and leaves jagged edges.
+func encodeGIF(w io.Writer, img *image.RGBA) error {
+	return gif.Encode(w, quantize(FlattenOverWhite(img)), nil)
+}
+
+// quantize returns an opaque img with at most 256 colors: exactly when it
+// has no more, and otherwise dithered to the Plan 9 palette.
+func quantize(img *image.RGBA) *image.Paletted {
+	if paletted := toPaletted(img); paletted != nil {
+		return paletted
+	}
+	b := img.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, b.Min)
+	return paletted
+}
+
+// encodeICOBitmap writes img as the 8-bit bitmap of an ICO entry, for
+// readers older than PNG entries, such as Internet Explorer before
+// version 11. Pixels at least half covered are opaque in their full color,
+// and the others are cut out by the 1-bit mask.
+func encodeICOBitmap(w io.Writer, img *image.RGBA) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	opaque := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		if a := img.Pix[i+3]; a >= 0x80 {
+			c := color.NRGBAModel.Convert(color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], a}).(color.NRGBA)
+			opaque.Pix[i], opaque.Pix[i+1], opaque.Pix[i+2] = c.R, c.G, c.B
+		}
+		opaque.Pix[i+3] = 0xff
+	}
+	paletted := quantize(opaque)
+
+	// The header counts the color and mask bitmaps together in its height
+	colorStride, maskStride := (width+3)&^3, ((width+31)/32)*4
+	header := struct {
+		Size                     uint32
+		Width, Height            int32
+		Planes, BitCount         uint16
+		Compression, SizeImage   uint32
+		XPerMeter, YPerMeter     int32
+		ColorsUsed, ColorsImport uint32
+	}{
+		Size: 40, Width: int32(width), Height: int32(2 * height),
+		Planes: 1, BitCount: 8,
+		SizeImage: uint32((colorStride + maskStride) * height),
+	}
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, header)
+	for i := range 256 {
+		var entry [4]byte
+		if i < len(paletted.Palette) {
+			r, g, b, _ := paletted.Palette[i].RGBA()
+			entry = [4]byte{uint8(b >> 8), uint8(g >> 8), uint8(r >> 8), 0}
+		}
+		data.Write(entry[:])
+	}
+
+	// Both bitmaps store rows bottom up, padded to four bytes
+	row := make([]byte, colorStride)
+	for y := height - 1; y >= 0; y-- {
+		copy(row, paletted.Pix[y*paletted.Stride:y*paletted.Stride+width])
+		data.Write(row)
+	}
+	mask := make([]byte, maskStride)
+	for y := height - 1; y >= 0; y-- {
+		clear(mask)
+		for x := range width {
+			if img.Pix[y*img.Stride+x*4+3] < 0x80 {
+				mask[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		data.Write(mask)
+	}
+	_, err := w.Write(data.Bytes())
+	return err
+}
@@ -0,0 +1,30 @@
+package imageprocessor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// loggerKey is the context key under which the request-scoped logger is stored.
+type loggerKey struct{}
+
+// discardLogger is used when the context carries no logger, keeping the
+// package silent for library consumers that do not opt in.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// WithLogger returns a copy of ctx carrying logger. ProcessImage and the
+// server log through it, so attributes such as request IDs added with
+// logger.With appear on every record of that run.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger carried by ctx, or a logger that discards
+// everything when there is none.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return discardLogger
+}
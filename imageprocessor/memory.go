@@ -0,0 +1,155 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memoryTracker keeps a running estimate of the pixel buffers held by a run
+// and remembers the highest value seen.
+type memoryTracker struct {
+	mu      sync.Mutex
+	current int64
+	peak    int64
+}
+
+// acquire records that n bytes of pixel memory are now in use.
+func (m *memoryTracker) acquire(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current += n
+	if m.current > m.peak {
+		m.peak = m.current
+	}
+}
+
+// release records that n bytes of pixel memory have been freed.
+func (m *memoryTracker) release(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current -= n
+}
+
+// Peak returns the highest estimated pixel memory seen so far.
+func (m *memoryTracker) Peak() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.peak
+}
+
+// bytesPerPixel returns the in-memory size of one pixel for a decoded color model.
+func bytesPerPixel(model color.Model) int64 {
+	switch model {
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// estimateSourceMemory estimates the size of the shared source: the decoded
+// image, its NRGBA conversion when the decoder produced another model, and the
+// premultiplied copy used by the tiled resampler.
+func estimateSourceMemory(width, height int, model color.Model, opts Options) int64 {
+	pixels := int64(width) * int64(height)
+	total := pixels * bytesPerPixel(model)
+	if model != color.NRGBAModel {
+		total += pixels * 4
+	}
+	if opts.Tiled {
+		total += pixels * 4
+	}
+	return total
+}
+
+// estimateJobMemory estimates the pixel buffers held while a single output is
+// being produced: the resized image plus its RGBA copy, a private source copy
+// when filters are configured, and the float intermediate buffer of the tiled
+// resampler.
+func estimateJobMemory(srcWidth, srcHeight int, dim Dimension, opts Options) int64 {
+	width, height := dim.Width, dim.Height
+	out := int64(width) * int64(height) * 4
+	total := 2 * out
+	if len(opts.Filters)+len(dim.Filters) > 0 {
+		total += int64(srcWidth) * int64(srcHeight) * 4
+	}
+	if opts.Tiled && width*height >= tiledMinPixels {
+		total += int64(width) * int64(srcHeight) * 16
+	}
+	return total
+}
+
+// fitWorkers returns the number of workers that keeps the estimated pixel
+// memory within maxMemory. A maxMemory of zero disables the limit.
+func fitWorkers(workers int, sourceMemory, largestJob, maxMemory int64) (int, error) {
+	if maxMemory <= 0 {
+		return workers, nil
+	}
+
+	available := maxMemory - sourceMemory
+	if available < largestJob {
+		return 0, fmt.Errorf("%w: estimated memory %s exceeds the limit of %s", ErrConfigInvalid, FormatBytes(sourceMemory+largestJob), FormatBytes(maxMemory))
+	}
+
+	if fit := int(available / largestJob); fit < workers {
+		return fit, nil
+	}
+	return workers, nil
+}
+
+// byteUnits maps size suffixes accepted by ParseByteSize to their multipliers.
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes such as "512MiB", "2G" or "1048576".
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatBytes renders a byte count using binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
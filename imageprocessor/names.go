@@ -0,0 +1,98 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxNameLength is the longest file name accepted by common file systems.
+const maxNameLength = 255
+
+// reservedNames are device names that Windows refuses as file names,
+// regardless of case or extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// validateName reports output names that cannot be written portably. Names
+// are checked against Windows rules on every platform, since generated icon
+// sets are routinely committed and checked out on Windows machines.
+func validateName(name string) error {
+	switch {
+	case name == "" || name == "." || name == "..":
+		return fmt.Errorf("invalid output name %q", name)
+	case filepath.Base(name) != name || strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("output name %q must not contain path separators", name)
+	case len(name) > maxNameLength:
+		return fmt.Errorf("output name %q is longer than %d bytes", name, maxNameLength)
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		return fmt.Errorf("output name %q must not end with a dot or space", name)
+	}
+
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("output name %q is not valid UTF-8", name)
+	}
+	for _, r := range name {
+		switch {
+		case r < 0x20 || strings.ContainsRune(`<>:"|?*`, r):
+			return fmt.Errorf("output name %q contains the character %q, which is invalid on Windows", name, r)
+		case isBidiControl(r):
+			return fmt.Errorf("output name %q contains the bidirectional control character %U, which can disguise the file extension", name, r)
+		case isNoncharacter(r):
+			return fmt.Errorf("output name %q contains the noncharacter %U", name, r)
+		}
+	}
+
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return fmt.Errorf("output name %q uses the reserved Windows device name %s", name, base)
+	}
+	return nil
+}
+
+// validateInstallPath reports install paths that are not relative,
+// slash separated paths of portable names.
+func validateInstallPath(path string) error {
+	if strings.HasPrefix(path, "/") || strings.Contains(path, `\`) {
+		return fmt.Errorf("install path %q must be relative and use forward slashes", path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if err := validateName(segment); err != nil {
+			return fmt.Errorf("install path %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// isBidiControl reports the explicit bidirectional formatting characters.
+func isBidiControl(r rune) bool {
+	return r == 0x061C || r == 0x200E || r == 0x200F || (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069)
+}
+
+// isNoncharacter reports code points permanently reserved for internal use,
+// which several file systems and archive formats reject.
+func isNoncharacter(r rune) bool {
+	return (r >= 0xFDD0 && r <= 0xFDEF) || r&0xFFFE == 0xFFFE
+}
+
+// normalizeName returns the NFC form of an output name. macOS file systems
+// and some design tools hand out decomposed (NFD) names, so output names are
+// normalized to produce identical files and manifests on every platform.
+func normalizeName(name string) string {
+	return norm.NFC.String(name)
+}
+
+// nameKey returns the key under which two names collide on case-insensitive
+// or normalization-insensitive file systems such as the Windows and macOS
+// defaults.
+func nameKey(name string) string {
+	return strings.ToLower(normalizeName(name))
+}
@@ -0,0 +1,180 @@
+package imageprocessor
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+)
+
+// PaletteColor is one of the dominant colors of an image.
+type PaletteColor struct {
+	// Hex is the color as #rrggbb.
+	Hex string `json:"hex"`
+	// Coverage is the percentage of the image's opaque pixels the color
+	// stands for, rounded to a tenth.
+	Coverage float64 `json:"coverage"`
+}
+
+// DefaultPaletteSize is the number of colors ExtractPalette is asked for by
+// ProcessImage.
+const DefaultPaletteSize = 6
+
+// Palette extraction constants.
+const (
+	// paletteSamples is the side of the grid of pixels sampled from the
+	// source, bounding the cost for large sources.
+	paletteSamples = 128
+	// paletteMinCoverage drops colors covering less than this percentage,
+	// such as anti-aliased edges between two regions.
+	paletteMinCoverage = 1.0
+)
+
+// ExtractPalette returns up to n dominant colors of img, most common first,
+// found by median cut over a grid of samples. Pixels that are mostly
+// transparent are ignored, so a logo's palette follows its artwork rather
+// than its background. Images without opaque pixels have no palette.
+func ExtractPalette(img image.Image, n int) []PaletteColor {
+	b := img.Bounds()
+	if b.Empty() || n < 1 {
+		return nil
+	}
+
+	// Sample the opaque pixels on a grid, unpremultiplied
+	var pixels [][3]uint8
+	for sy := 0; sy < min(paletteSamples, b.Dy()); sy++ {
+		y := b.Min.Y + (2*sy+1)*b.Dy()/(2*min(paletteSamples, b.Dy()))
+		for sx := 0; sx < min(paletteSamples, b.Dx()); sx++ {
+			x := b.Min.X + (2*sx+1)*b.Dx()/(2*min(paletteSamples, b.Dx()))
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A >= 0x80 {
+				pixels = append(pixels, [3]uint8{c.R, c.G, c.B})
+			}
+		}
+	}
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	// Split the box with the widest spread, weighted by its population,
+	// until there are n boxes or none can be split
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < n {
+		best, bestScore, bestChannel := -1, 0, 0
+		for i, box := range boxes {
+			channel, spread := widestChannel(box)
+			if score := spread * len(box); len(box) > 1 && spread > 0 && score > bestScore {
+				best, bestScore, bestChannel = i, score, channel
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		slices.SortFunc(box, func(a, b [3]uint8) int {
+			if c := cmp.Compare(a[bestChannel], b[bestChannel]); c != 0 {
+				return c
+			}
+			return cmp.Compare(uint32(a[0])<<16|uint32(a[1])<<8|uint32(a[2]), uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2]))
+		})
+		// Cut between distinct values so equal colors stay together
+		mid := len(box) / 2
+		for mid > 0 && box[mid][bestChannel] == box[mid-1][bestChannel] {
+			mid--
+		}
+		if mid == 0 {
+			mid = len(box) / 2
+			for mid < len(box) && box[mid][bestChannel] == box[mid-1][bestChannel] {
+				mid++
+			}
+		}
+		boxes = append(boxes[:best], append([][][3]uint8{box[:mid], box[mid:]}, boxes[best+1:]...)...)
+	}
+
+	// Each box stands for its average color
+	var palette []PaletteColor
+	for _, box := range boxes {
+		coverage := math.Round(1000*float64(len(box))/float64(len(pixels))) / 10
+		if coverage < paletteMinCoverage {
+			continue
+		}
+		var sum [3]int
+		for _, p := range box {
+			for c := range sum {
+				sum[c] += int(p[c])
+			}
+		}
+		hex := fmt.Sprintf("#%02x%02x%02x", (sum[0]+len(box)/2)/len(box), (sum[1]+len(box)/2)/len(box), (sum[2]+len(box)/2)/len(box))
+		palette = append(palette, PaletteColor{Hex: hex, Coverage: coverage})
+	}
+	slices.SortStableFunc(palette, func(a, b PaletteColor) int {
+		if c := cmp.Compare(b.Coverage, a.Coverage); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Hex, b.Hex)
+	})
+	return palette
+}
+
+// widestChannel returns the RGB channel the pixels spread most along and
+// the size of that spread.
+func widestChannel(pixels [][3]uint8) (channel, spread int) {
+	lo, hi := [3]uint8{255, 255, 255}, [3]uint8{}
+	for _, p := range pixels {
+		for c := range p {
+			lo[c], hi[c] = min(lo[c], p[c]), max(hi[c], p[c])
+		}
+	}
+	for c := range lo {
+		if s := int(hi[c]) - int(lo[c]); s > spread {
+			channel, spread = c, s
+		}
+	}
+	return channel, spread
+}
+
+// ThemeColors picks the theme and background colors of a web app from a
+// palette. The theme is the most common saturated color, falling back to
+// the most common color. The background is the most common neutral color,
+// such as the white plate of a logo, falling back to white. An empty
+// palette gives empty colors.
+func ThemeColors(palette []PaletteColor) (theme, background string) {
+	if len(palette) == 0 {
+		return "", ""
+	}
+	theme, background = palette[0].Hex, "#ffffff"
+	for _, c := range palette {
+		if !c.neutral() {
+			theme = c.Hex
+			break
+		}
+	}
+	for _, c := range palette {
+		if c.neutral() {
+			background = c.Hex
+			break
+		}
+	}
+	return theme, background
+}
+
+// rgb returns the color's channels between 0 and 1.
+func (c PaletteColor) rgb() (r, g, b float64) {
+	n, _ := ParseHexColor(c.Hex)
+	return float64(n.R) / 255, float64(n.G) / 255, float64(n.B) / 255
+}
+
+// neutral reports whether the color is close to a gray, white or black, by
+// its HSL saturation and lightness.
+func (c PaletteColor) neutral() bool {
+	r, g, b := c.rgb()
+	hi, lo := max(r, g, b), min(r, g, b)
+	lightness := (hi + lo) / 2
+	if lightness <= 0.06 || lightness >= 0.94 {
+		return true
+	}
+	saturation := (hi - lo) / (1 - math.Abs(2*lightness-1))
+	return saturation < 0.15
+}
@@ -0,0 +1,31 @@
+package imageprocessor
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// longPathThreshold is the length beyond which Win32 path APIs fail without
+// the extended-length prefix. Directories are limited to 248 characters so an
+// 8.3 file name still fits within MAX_PATH.
+const longPathThreshold = 248
+
+// longPath returns path in extended-length form (\\?\C:\... or
+// \\?\UNC\server\share\...) when it is too long for MAX_PATH, so deep CI
+// workspaces can hold the longer preset file names.
+func longPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+
+	// Relative paths are resolved against the working directory, which can
+	// itself be deep enough to exceed the limit
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) < longPathThreshold {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,174 @@
+package imageprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PerceptualHash is a 64 bit DCT hash of an image's luminance. Re-encoding,
+// resizing and small compression artifacts barely change it, while edits to
+// the artwork flip many bits.
+type PerceptualHash uint64
+
+// phashSize is the side of the grayscale thumbnail the DCT runs on; the
+// hash keeps its lowest 8x8 frequencies.
+const phashSize = 32
+
+// DefaultMaxHashDistance is the number of differing bits up to which two
+// perceptual hashes are considered the same image.
+const DefaultMaxHashDistance = 2
+
+// String returns the hash as 16 hex digits.
+func (h PerceptualHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Distance returns the number of bits in which two hashes differ.
+func (h PerceptualHash) Distance(other PerceptualHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+// ParsePerceptualHash parses 16 hex digits.
+func ParsePerceptualHash(s string) (PerceptualHash, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("perceptual hash %q must be 16 hex digits", s)
+	}
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("perceptual hash %q must be 16 hex digits", s)
+	}
+	return PerceptualHash(n), nil
+}
+
+// HashImage returns the perceptual hash of img. Transparent areas are
+// treated as white, so the hash follows the artwork rather than the alpha
+// channel.
+func HashImage(img image.Image) PerceptualHash {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	// Average the luminance into a 32x32 grid
+	var sums, counts [phashSize][phashSize]float64
+	for y := 0; y < h; y++ {
+		cy := y * phashSize / h
+		for x := 0; x < w; x++ {
+			cx := x * phashSize / w
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			sums[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl) + float64(0xffff-a)
+			counts[cy][cx]++
+		}
+	}
+	var gray [phashSize][phashSize]float64
+	for y := range gray {
+		for x := range gray[y] {
+			if counts[y][x] > 0 {
+				gray[y][x] = sums[y][x] / counts[y][x]
+			}
+		}
+	}
+
+	// Keep the lowest frequencies of a two dimensional DCT
+	freq := dct2(gray)
+	var coeffs []float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			coeffs = append(coeffs, freq[y][x])
+		}
+	}
+
+	// Each bit records whether a coefficient is above the median, ignoring
+	// the DC term, which only reflects overall brightness
+	sorted := slices.Clone(coeffs[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash PerceptualHash
+	for i, c := range coeffs {
+		if i > 0 && c > median {
+			hash |= 1 << (63 - i)
+		}
+	}
+	return hash
+}
+
+// dct2 returns the two dimensional DCT-II of a square block.
+func dct2(in [phashSize][phashSize]float64) [phashSize][phashSize]float64 {
+	var cos [phashSize][phashSize]float64
+	for k := range cos {
+		for n := range cos[k] {
+			cos[k][n] = math.Cos(math.Pi / phashSize * (float64(n) + 0.5) * float64(k))
+		}
+	}
+
+	var rows, out [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		for k := 0; k < phashSize; k++ {
+			for n := 0; n < phashSize; n++ {
+				rows[y][k] += in[y][n] * cos[k][n]
+			}
+		}
+	}
+	for x := 0; x < phashSize; x++ {
+		for k := 0; k < phashSize; k++ {
+			for n := 0; n < phashSize; n++ {
+				out[k][x] += rows[n][x] * cos[k][n]
+			}
+		}
+	}
+	return out
+}
+
+// LoadApprovedHashes reads a file of approved perceptual hashes, one per
+// line. Blank lines and text after a # are ignored, so each hash can note
+// which master it belongs to.
+func LoadApprovedHashes(path string) ([]PerceptualHash, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read approved hashes: %w", ErrConfigInvalid, err)
+	}
+	defer f.Close()
+
+	var hashes []PerceptualHash
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		hash, err := ParsePerceptualHash(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s:%d: %w", ErrConfigInvalid, path, line, err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to read approved hashes: %w", ErrConfigInvalid, err)
+	}
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("%w: %s lists no approved hashes", ErrConfigInvalid, path)
+	}
+	return hashes, nil
+}
+
+// checkApproved reports a source whose hash is further than maxDistance bits
+// from every approved hash.
+func checkApproved(hash PerceptualHash, approved []PerceptualHash, maxDistance int) error {
+	nearest := 64
+	for _, a := range approved {
+		nearest = min(nearest, hash.Distance(a))
+	}
+	if nearest > maxDistance {
+		return fmt.Errorf("%w: source perceptual hash %s is %d bits from the nearest approved master, more than the allowed %d", ErrNotApproved, hash, nearest, maxDistance)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package imageprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Placement positions the logo on a larger canvas, such as a corner of a
+// presentation slide, instead of resizing it to fill the output.
+type Placement struct {
+	Corner string `json:"corner,omitempty" doc:"Where the logo goes; defaults to bottom-right" schema:"enum=top-left|top-right|bottom-left|bottom-right|center"`
+	// Margin and Size are fractions of the output height, so the logo keeps
+	// its proportions on slides of any aspect ratio.
+	Margin     float64 `json:"margin,omitempty" doc:"Space between the logo and the nearest edges, as a fraction of the output height; defaults to 0.05" schema:"minimum=0,maximum=0.5"`
+	Size       float64 `json:"size,omitempty" doc:"Height of the logo as a fraction of the output height; defaults to 0.1" schema:"minimum=0,maximum=1"`
+	Background string  `json:"background,omitempty" doc:"Canvas color as #rgb, #rrggbb or #rrggbbaa; defaults to transparent"`
+}
+
+// Placement defaults, as fractions of the output height. A 5% margin keeps
+// the logo inside the action-safe area of 16:9 slides.
+const (
+	defaultPlaceMargin = 0.05
+	defaultPlaceSize   = 0.1
+)
+
+// margin returns the placement's margin, or the default.
+func (p *Placement) margin() float64 {
+	if p.Margin == 0 {
+		return defaultPlaceMargin
+	}
+	return p.Margin
+}
+
+// size returns the placement's logo height, or the default.
+func (p *Placement) size() float64 {
+	if p.Size == 0 {
+		return defaultPlaceSize
+	}
+	return p.Size
+}
+
+// validate reports placements with an unknown corner, a bad color, or a
+// logo that does not fit the output within its margin.
+func (p *Placement) validate(dim Dimension) error {
+	switch p.Corner {
+	case "", "top-left", "top-right", "bottom-left", "bottom-right", "center":
+	default:
+		return fmt.Errorf("unknown place corner %q, want top-left, top-right, bottom-left, bottom-right or center", p.Corner)
+	}
+	if p.Background != "" {
+		if _, err := ParseHexColor(p.Background); err != nil {
+			return fmt.Errorf("place: %w", err)
+		}
+	}
+	if p.Margin < 0 || p.Size < 0 {
+		return errors.New("place margin and size must not be negative")
+	}
+	w, h := placedSize(dim)
+	margin := int(math.Round(p.margin() * float64(dim.Height)))
+	if w+2*margin > int(dim.Width) || h+2*margin > int(dim.Height) {
+		return fmt.Errorf("a %dx%d logo with a %d pixel margin does not fit the %dx%d output", w, h, margin, dim.Width, dim.Height)
+	}
+	return nil
+}
+
+// placedSize returns the size of the logo of a placed output: Size of the
+// output height, as wide as the image reaching the resize. Filters that
+// take the output's aspect ratio keep the logo square.
+func placedSize(dim Dimension) (int, int) {
+	aspect := filteredAspect(Dimension{Width: 1, Height: 1, Filters: dim.Filters}, sourceAspect)
+	h := max(int(math.Round(dim.Place.size()*float64(dim.Height))), 1)
+	return max(int(math.Round(float64(h)*aspect)), 1), h
+}
+
+// renderPlaced renders the logo of dim and draws it at its placement on a
+// canvas of the output's size.
+func renderPlaced(ctx context.Context, src *sourceImage, dim Dimension, wm *watermarker, opts Options) (*image.RGBA, error) {
+	w, h := placedSize(dim)
+	logo, err := renderLogo(ctx, src, dim, w, h, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, int(dim.Width), int(dim.Height)))
+	if dim.Place.Background != "" {
+		// The color was validated with the dimension
+		bg, _ := ParseHexColor(dim.Place.Background)
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+
+	margin := int(math.Round(dim.Place.margin() * float64(dim.Height)))
+	x, y := int(dim.Width)-w-margin, int(dim.Height)-h-margin
+	switch dim.Place.Corner {
+	case "top-left":
+		x, y = margin, margin
+	case "top-right":
+		y = margin
+	case "bottom-left":
+		x = margin
+	case "center":
+		x, y = (int(dim.Width)-w)/2, (int(dim.Height)-h)/2
+	}
+	draw.Draw(canvas, image.Rect(x, y, x+w, y+h), logo, image.Point{}, draw.Over)
+	return finishImage(ctx, canvas, dim, wm), nil
+}
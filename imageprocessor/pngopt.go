@@ -0,0 +1,423 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"cmp"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+)
+
+// PNG recompression efforts for Options.PNGEffort. Zero keeps the standard
+// library's encoder; 1 to MaxPNGEffort trade encoding time for smaller
+// files, and PNGEffortExtreme searches hardest.
+const (
+	MaxPNGEffort     = 9
+	PNGEffortExtreme = 10
+)
+
+// PNG filter types.
+const (
+	pngFilterNone = iota
+	pngFilterSub
+	pngFilterUp
+	pngFilterAverage
+	pngFilterPaeth
+	pngFilterCount
+)
+
+// Strategies choosing the filter of each row, besides using one filter for
+// every row.
+const (
+	// pngMinSum picks the filter with the smallest sum of absolute
+	// differences, the heuristic of the standard library and libpng.
+	pngMinSum = pngFilterCount + iota
+	// pngEntropy picks the filter whose bytes have the lowest entropy.
+	pngEntropy
+	// pngBrute picks the filter that deflates smallest after the rows
+	// before it.
+	pngBrute
+)
+
+// pngBruteWindow is how many previous rows pngBrute compresses a candidate
+// row after, standing in for the history deflate matches against.
+const pngBruteWindow = 2
+
+// encodePNG writes img as a PNG. With an effort, the rows are filtered with
+// several strategies, each deflated at the effort's level, and the smallest
+// result is kept; the pixels are the same as the standard encoder's. With
+// indexed, an image of at most 256 colors is written with a palette when
+// that is smaller.
+func encodePNG(w io.Writer, img *image.RGBA, effort int, indexed bool) error {
+	var paletted *image.Paletted
+	if indexed {
+		paletted = toPaletted(img)
+	}
+	if paletted == nil {
+		return writePNG(w, img, nil, effort)
+	}
+
+	// The palette costs up to a kilobyte, more than indexing saves on some
+	// small images, so the smaller encoding is kept
+	var rgba, index bytes.Buffer
+	if err := writePNG(&rgba, img, nil, effort); err != nil {
+		return err
+	}
+	if err := writePNG(&index, img, paletted, effort); err != nil {
+		return err
+	}
+	smaller := &rgba
+	if index.Len() < rgba.Len() {
+		smaller = &index
+	}
+	_, err := w.Write(smaller.Bytes())
+	return err
+}
+
+// writePNG writes img as a PNG, or paletted instead when it is set.
+func writePNG(w io.Writer, img *image.RGBA, paletted *image.Paletted, effort int) error {
+	if effort <= 0 {
+		if paletted != nil {
+			return png.Encode(w, paletted)
+		}
+		return png.Encode(w, img)
+	}
+
+	b := img.Bounds()
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(b.Dy()))
+	var rows [][]byte
+	var bpp int
+	var plte, trns []byte
+	if paletted != nil {
+		rows, ihdr[8] = palettedRows(paletted)
+		ihdr[9], bpp = 3, 1
+		plte, trns = paletteChunks(paletted.Palette)
+	} else {
+		rows, ihdr[9], bpp = pngRows(img)
+		ihdr[8] = 8
+	}
+
+	strategies, level := pngStrategies(effort)
+	var best []byte
+	for _, strategy := range strategies {
+		data, err := deflateRows(rows, bpp, strategy, level)
+		if err != nil {
+			return err
+		}
+		if best == nil || len(data) < len(best) {
+			best = data
+		}
+	}
+
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return err
+	}
+	for _, chunk := range []struct {
+		kind string
+		data []byte
+	}{{"IHDR", ihdr[:]}, {"PLTE", plte}, {"tRNS", trns}, {"IDAT", best}, {"IEND", nil}} {
+		if chunk.data == nil && (chunk.kind == "PLTE" || chunk.kind == "tRNS") {
+			continue
+		}
+		if err := writePNGChunk(w, chunk.kind, chunk.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toPaletted returns img as a paletted image with the colors PNG stores for
+// it, or nil when it has more than 256. Translucent colors come first, so
+// the tRNS chunk listing their alphas stays short.
+func toPaletted(img *image.RGBA) *image.Paletted {
+	rows, colorType, bpp := pngRows(img)
+	b := img.Bounds()
+	indices := map[color.NRGBA]int{}
+	var colors []color.NRGBA
+	for _, row := range rows {
+		for i := 0; i < len(row); i += bpp {
+			c := color.NRGBA{R: row[i], G: row[i+1], B: row[i+2], A: 0xff}
+			if colorType == 6 {
+				c.A = row[i+3]
+			}
+			if _, ok := indices[c]; !ok {
+				if len(colors) == 256 {
+					return nil
+				}
+				indices[c] = len(colors)
+				colors = append(colors, c)
+			}
+		}
+	}
+	slices.SortStableFunc(colors, func(a, b color.NRGBA) int {
+		return cmp.Compare(a.A/0xff, b.A/0xff)
+	})
+	palette := make(color.Palette, len(colors))
+	for i, c := range colors {
+		palette[i], indices[c] = c, i
+	}
+
+	dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette)
+	for y, row := range rows {
+		for x := 0; x < b.Dx(); x++ {
+			i := x * bpp
+			c := color.NRGBA{R: row[i], G: row[i+1], B: row[i+2], A: 0xff}
+			if colorType == 6 {
+				c.A = row[i+3]
+			}
+			dst.Pix[y*dst.Stride+x] = uint8(indices[c])
+		}
+	}
+	return dst
+}
+
+// palettedRows returns the rows of a paletted image packed at the smallest
+// bit depth its palette fits, as the standard encoder writes them.
+func palettedRows(img *image.Paletted) ([][]byte, byte) {
+	depth := 8
+	switch n := len(img.Palette); {
+	case n <= 2:
+		depth = 1
+	case n <= 4:
+		depth = 2
+	case n <= 16:
+		depth = 4
+	}
+	b := img.Bounds()
+	perByte := 8 / depth
+	rows := make([][]byte, b.Dy())
+	for y := range rows {
+		row := make([]byte, (b.Dx()+perByte-1)/perByte)
+		for x := range b.Dx() {
+			shift := 8 - depth*(x%perByte+1)
+			row[x/perByte] |= img.Pix[y*img.Stride+x] << shift
+		}
+		rows[y] = row
+	}
+	return rows, byte(depth)
+}
+
+// paletteChunks returns the data of the PLTE chunk of a palette and of its
+// tRNS chunk, nil when every color is opaque.
+func paletteChunks(palette color.Palette) (plte, trns []byte) {
+	for _, c := range palette {
+		n := c.(color.NRGBA)
+		plte = append(plte, n.R, n.G, n.B)
+		if n.A != 0xff {
+			trns = append(trns, n.A)
+		}
+	}
+	return plte, trns
+}
+
+// pngStrategies returns the filter strategies tried at an effort and the
+// deflate level they are compressed with.
+func pngStrategies(effort int) ([]int, int) {
+	switch {
+	case effort <= 3:
+		return []int{pngMinSum}, effort
+	case effort <= 6:
+		return []int{pngMinSum, pngEntropy, pngFilterNone}, effort
+	case effort <= MaxPNGEffort:
+		return []int{pngMinSum, pngEntropy, pngFilterNone, pngFilterSub, pngFilterUp, pngFilterAverage, pngFilterPaeth}, effort
+	}
+	return []int{pngMinSum, pngEntropy, pngBrute, pngFilterNone, pngFilterSub, pngFilterUp, pngFilterAverage, pngFilterPaeth}, zlib.BestCompression
+}
+
+// pngRows returns the unfiltered rows of img as the standard encoder stores
+// them: RGB when it is opaque, otherwise RGBA without premultiplication.
+func pngRows(img *image.RGBA) (rows [][]byte, colorType byte, bpp int) {
+	b := img.Bounds()
+	opaque := img.Opaque()
+	colorType, bpp = 6, 4
+	if opaque {
+		colorType, bpp = 2, 3
+	}
+	rows = make([][]byte, b.Dy())
+	for y := range rows {
+		row := make([]byte, 0, b.Dx()*bpp)
+		src := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):img.PixOffset(b.Max.X, b.Min.Y+y)]
+		for ; len(src) >= 4; src = src[4:] {
+			switch a := uint32(src[3]); {
+			case opaque:
+				row = append(row, src[0], src[1], src[2])
+			case a == 0:
+				row = append(row, 0, 0, 0, 0)
+			case a == 0xff:
+				row = append(row, src[:4]...)
+			default:
+				// The conversion of color.NRGBAModel, as in image/png
+				const m = 0x101 * 0xffff
+				a *= 0x101
+				row = append(row, uint8((uint32(src[0])*m/a)>>8), uint8((uint32(src[1])*m/a)>>8), uint8((uint32(src[2])*m/a)>>8), src[3])
+			}
+		}
+		rows[y] = row
+	}
+	return rows, colorType, bpp
+}
+
+// deflateRows filters the rows with a strategy and compresses them into the
+// zlib stream of an IDAT chunk.
+func deflateRows(rows [][]byte, bpp, strategy, level int) ([]byte, error) {
+	var out bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&out, level)
+	if err != nil {
+		return nil, err
+	}
+	var prev []byte
+	var window [][]byte
+	var probe *zlib.Writer
+	var candidates [pngFilterCount][]byte
+	for _, row := range rows {
+		if prev == nil {
+			prev = make([]byte, len(row))
+		}
+		var filtered []byte
+		switch {
+		case strategy < pngFilterCount:
+			filtered = filterRow(nil, row, prev, bpp, strategy)
+		default:
+			best, bestScore := 0, math.Inf(1)
+			for f := range candidates {
+				candidates[f] = filterRow(candidates[f][:0], row, prev, bpp, f)
+				var score float64
+				switch strategy {
+				case pngMinSum:
+					score = float64(absSum(candidates[f][1:]))
+				case pngEntropy:
+					score = byteEntropy(candidates[f][1:])
+				case pngBrute:
+					if probe == nil {
+						probe, _ = zlib.NewWriterLevel(io.Discard, level)
+					}
+					var counter countingWriter
+					probe.Reset(&counter)
+					for _, w := range window {
+						probe.Write(w)
+					}
+					probe.Write(candidates[f])
+					probe.Close()
+					score = float64(counter)
+				}
+				if score < bestScore {
+					best, bestScore = f, score
+				}
+			}
+			filtered = append([]byte(nil), candidates[best]...)
+		}
+		if _, err := zw.Write(filtered); err != nil {
+			return nil, err
+		}
+		if strategy == pngBrute {
+			window = append(window, filtered)
+			if len(window) > pngBruteWindow {
+				window = window[1:]
+			}
+		}
+		prev = row
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// filterRow appends the filter type and the filtered bytes of row to dst.
+func filterRow(dst, row, prev []byte, bpp, filter int) []byte {
+	dst = append(dst, byte(filter))
+	for i, x := range row {
+		var a, b, c byte
+		if i >= bpp {
+			a, c = row[i-bpp], prev[i-bpp]
+		}
+		b = prev[i]
+		switch filter {
+		case pngFilterSub:
+			x -= a
+		case pngFilterUp:
+			x -= b
+		case pngFilterAverage:
+			x -= byte((int(a) + int(b)) / 2)
+		case pngFilterPaeth:
+			x -= paeth(a, b, c)
+		}
+		dst = append(dst, x)
+	}
+	return dst
+}
+
+// paeth returns the Paeth predictor of a pixel from its left, upper and
+// upper left neighbors.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+// absSum returns the sum of the filtered bytes read as signed differences.
+func absSum(data []byte) int {
+	sum := 0
+	for _, v := range data {
+		sum += abs(int(int8(v)))
+	}
+	return sum
+}
+
+// byteEntropy returns the Shannon entropy of the bytes of data.
+func byteEntropy(data []byte) float64 {
+	hist := make([]float64, 256)
+	for _, v := range data {
+		hist[v]++
+	}
+	return entropy(hist)
+}
+
+// abs returns the absolute value of v.
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int
+
+// Write implements io.Writer.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+// writePNGChunk writes a PNG chunk with its length and checksum.
+func writePNGChunk(w io.Writer, kind string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	copy(header[4:], kind)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+	for _, p := range [][]byte{header[:], data, footer[:]} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultPostCmdTimeout bounds a dimension's post-processing command when
+// Options.PostCmdTimeout is zero.
+const DefaultPostCmdTimeout = time.Minute
+
+// postCmdOutputLimit is how much of a post-processing command's output is
+// kept, from its end, where tools print their summary or error.
+const postCmdOutputLimit = 4 << 10
+
+// splitCommand splits a post-processing command into its program and
+// arguments. Words are separated by spaces and may be quoted with single or
+// double quotes; there is no shell, so pipes, variables and backslash
+// escapes are not interpreted, and Windows paths work as typed. A command
+// without a {file} word gets the path of the output appended.
+func splitCommand(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("postCmd %q has an unterminated %c quote", command, quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("postCmd %q names no program", command)
+	}
+	if !strings.Contains(command, "{file}") {
+		words = append(words, "{file}")
+	}
+	return words, nil
+}
+
+// runPostCmd runs a dimension's post-processing command on the encoded
+// output and returns the bytes it leaves in the file along with its output.
+// The command works on a temporary file named like the output, so tools
+// that detect the format from the extension recognize it, and the output
+// is only written once the command has succeeded.
+func runPostCmd(ctx context.Context, dim Dimension, data []byte, timeout time.Duration) ([]byte, string, error) {
+	words, err := splitCommand(dim.PostCmd)
+	if err != nil {
+		return nil, "", err
+	}
+	if timeout <= 0 {
+		timeout = DefaultPostCmdTimeout
+	}
+
+	dir, err := os.MkdirTemp("", "logo-generator-post-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create a directory for postCmd: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, filepath.Base(dim.Name))
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return nil, "", fmt.Errorf("failed to write the file for postCmd: %w", err)
+	}
+	for i, w := range words {
+		words[i] = strings.ReplaceAll(w, "{file}", file)
+	}
+
+	// Capture stdout and stderr together, as a terminal would show them
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, words[0], words[1:]...)
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	runErr := cmd.Run()
+	captured := tail(strings.TrimSpace(output.String()), postCmdOutputLimit)
+	switch {
+	case errors.Is(cmdCtx.Err(), context.DeadlineExceeded):
+		return nil, captured, withOutput(fmt.Errorf("postCmd %s timed out after %s", words[0], timeout), captured)
+	case ctx.Err() != nil:
+		return nil, captured, canceled(ctx)
+	case runErr != nil:
+		return nil, captured, withOutput(fmt.Errorf("postCmd %s failed: %w", words[0], runErr), captured)
+	}
+
+	processed, err := os.ReadFile(file)
+	if err != nil {
+		return nil, captured, fmt.Errorf("postCmd %s removed the file: %w", words[0], err)
+	}
+	if len(processed) == 0 {
+		return nil, captured, withOutput(fmt.Errorf("postCmd %s left the file empty", words[0]), captured)
+	}
+	return processed, captured, nil
+}
+
+// withOutput appends a command's output to its error.
+func withOutput(err error, output string) error {
+	if output == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, output)
+}
+
+// tail returns the last n bytes of s, marking a cut.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "…" + s[len(s)-n:]
+}
@@ -0,0 +1,115 @@
+package imageprocessor
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultPreset is the preset generated when no config is given.
+const DefaultPreset = "tauri"
+
+// presetFS holds the built-in presets, one config file per platform, so the
+// binary works from any directory without shipping config files.
+//
+//go:embed presets/*.json
+var presetFS embed.FS
+
+// Preset describes a built-in set of dimensions.
+type Preset struct {
+	Name        string
+	Description string
+	Dimensions  []Dimension
+	// Version identifies the revision of the preset: the first 12 hex
+	// digits of the SHA-256 of its embedded config.
+	Version string
+}
+
+// Presets returns the built-in presets sorted by name.
+func Presets() []Preset {
+	entries, err := presetFS.ReadDir("presets")
+	if err != nil {
+		panic(err)
+	}
+
+	var presets []Preset
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		presets = append(presets, mustLoadPreset(name))
+	}
+	slices.SortFunc(presets, func(a, b Preset) int { return strings.Compare(a.Name, b.Name) })
+	return presets
+}
+
+// LoadPreset returns the dimensions of the built-in preset with the given
+// name. Unknown names wrap ErrConfigInvalid.
+func LoadPreset(name string) ([]Dimension, error) {
+	preset, err := loadPreset(name)
+	if err != nil {
+		return nil, err
+	}
+	return preset.Dimensions, nil
+}
+
+// loadPreset parses and validates an embedded preset.
+func loadPreset(name string) (Preset, error) {
+	if name == "" || strings.ContainsAny(name, `./\`) {
+		return Preset{}, fmt.Errorf("%w: unknown preset %q", ErrConfigInvalid, name)
+	}
+	data, err := presetFS.ReadFile(path.Join("presets", name+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Preset{}, fmt.Errorf("%w: unknown preset %q", ErrConfigInvalid, name)
+	}
+	if err != nil {
+		return Preset{}, err
+	}
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return Preset{}, fmt.Errorf("%w: preset %s: %w", ErrConfigInvalid, name, err)
+	}
+	if err := validateDimensions(cfg.Dimensions); err != nil {
+		return Preset{}, fmt.Errorf("preset %s: %w", name, err)
+	}
+	sum := sha256.Sum256(data)
+	return Preset{
+		Name:        name,
+		Description: cfg.Comment,
+		Dimensions:  normalizeDimensions(cfg.Dimensions),
+		Version:     hex.EncodeToString(sum[:])[:12],
+	}, nil
+}
+
+// ProcessPreset generates the built-in preset with the given name, such as
+// android, from the source at inputPath, like ProcessImage with the
+// preset's dimensions. Unknown names wrap ErrConfigInvalid. The returned
+// Result is never nil.
+func ProcessPreset(ctx context.Context, inputPath, outputDir, name string, opts Options) (*Result, error) {
+	dims, err := LoadPreset(name)
+	if err != nil {
+		return &Result{Source: inputPath, OutputDir: outputDir}, err
+	}
+	return ProcessImage(ctx, inputPath, outputDir, dims, opts)
+}
+
+// mustLoadPreset loads an embedded preset. The presets ship inside the
+// binary, so a failure is a programming error rather than bad input.
+func mustLoadPreset(name string) Preset {
+	preset, err := loadPreset(name)
+	if err != nil {
+		panic(err)
+	}
+	return preset
+}
+
+// mustPreset returns the dimensions of an embedded preset.
+func mustPreset(name string) []Dimension {
+	return mustLoadPreset(name).Dimensions
+}
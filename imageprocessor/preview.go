@@ -0,0 +1,103 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+)
+
+// RenderPreview renders the output of a single dimension from the source at
+// inputPath and returns its encoded bytes without writing any file, for
+// previews that are tweaked interactively.
+func RenderPreview(ctx context.Context, inputPath string, dim Dimension, opts Options) ([]byte, error) {
+	var data bytes.Buffer
+	err := renderSingle(ctx, inputPath, dim, opts, func(imgs []*image.RGBA, dim Dimension) error {
+		if err := encode(&data, imgs, dim, opts); err != nil {
+			return fmt.Errorf("failed to encode image: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// RenderImage renders the output of a single dimension from the source at
+// inputPath and returns its pixels, for callers that encode it themselves.
+func RenderImage(ctx context.Context, inputPath string, dim Dimension, opts Options) (*image.RGBA, error) {
+	var img *image.RGBA
+	err := renderSingle(ctx, inputPath, dim, opts, func(imgs []*image.RGBA, _ Dimension) error {
+		img = imgs[0]
+		return nil
+	})
+	return img, err
+}
+
+// renderSingle validates dim, renders it from the source at inputPath and
+// passes its images and the dimension as normalized to use, while the
+// render still holds its slot from opts.Acquire.
+func renderSingle(ctx context.Context, inputPath string, dim Dimension, opts Options, use func([]*image.RGBA, Dimension) error) error {
+	dims := normalizeDimensions([]Dimension{dim})
+	if err := validate(dims, opts); err != nil {
+		return err
+	}
+
+	src, wm, err := loadSource(inputPath, dims, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Acquire != nil {
+		release, err := opts.Acquire(ctx)
+		if err != nil {
+			return canceled(ctx)
+		}
+		defer release()
+	}
+	imgs, err := renderSizes(ctx, src, dims[0], wm, opts)
+	if err != nil {
+		return err
+	}
+	return use(imgs, dims[0])
+}
+
+// loadSource decodes the source at inputPath for rendering dims one by one,
+// checking it against the approved masters, and loads the watermark of opts.
+func loadSource(inputPath string, dims []Dimension, opts Options) (*sourceImage, *watermarker, error) {
+	fsys := fsOf(opts)
+	file, err := openSource(fsys, inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, _, err := decodeConfig(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkSourceSize(cfg, dims); err != nil {
+		return nil, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, fmt.Errorf("failed to rewind image file: %w", err)
+	}
+	src, _, err := decodeSource(file, opts.Strict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(opts.Approved) > 0 {
+		if err := checkApproved(HashImage(src.readOnly()), opts.Approved, opts.MaxHashDistance); err != nil {
+			return nil, nil, err
+		}
+	}
+	var wm *watermarker
+	if opts.Watermark != nil {
+		if wm, err = newWatermarker(fsys, opts.Watermark); err != nil {
+			return nil, nil, err
+		}
+	}
+	return src, wm, nil
+}
@@ -0,0 +1,627 @@
+// Package imageprocessor resizes a square source logo into the set of icon
+// sizes required by an application.
+package imageprocessor
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"io"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultIOWorkers is the number of outputs written concurrently when
+// Options.IOWorkers is zero. Writes mostly wait on disks and networks, so
+// more of them than CPUs pay off for remote storage.
+const DefaultIOWorkers = 8
+
+// Options controls how the resized images are produced.
+type Options struct {
+	// Tiled routes the largest outputs through the experimental parallel band resampler.
+	Tiled bool
+	// Workers is the number of outputs rendered and encoded concurrently.
+	Workers int
+	// IOWorkers is the number of encoded outputs written, and uploaded,
+	// concurrently, apart from the Workers, so slow writes do not hold up
+	// encoding; zero means DefaultIOWorkers.
+	IOWorkers int
+	// MaxMemory caps the estimated pixel memory of a run in bytes; zero disables the limit.
+	MaxMemory int64
+	// Filters run on a private copy of the source before every output is resized.
+	Filters []Filter
+	// KeepGoing generates the remaining outputs after a failure instead of canceling them.
+	KeepGoing bool
+	// Approved lists the perceptual hashes of the approved master logos. When
+	// set, sources further than MaxHashDistance bits from all of them are
+	// rejected with ErrNotApproved; zero distance requires an exact match.
+	Approved        []PerceptualHash
+	MaxHashDistance int
+	// Watermark is tiled across every output after it is resized.
+	Watermark *Watermark
+	// Rewrite writes every output even when the existing file already holds
+	// identical bytes. By default such files are left untouched so their
+	// modification times stay stable for incremental builds.
+	Rewrite bool
+	// Acquire, when set, is called before each output is rendered and
+	// must return a function called once it is encoded. Servers use it to
+	// share the CPUs between runs; an error cancels the output.
+	Acquire func(ctx context.Context) (release func(), err error)
+	// Upload, when set, is called by the I/O workers with each output and
+	// its bytes once it is written or found unchanged, so outputs bound for
+	// remote storage upload while the rest are still encoding. It must be
+	// safe for concurrent use; an error fails the output.
+	Upload func(ctx context.Context, out OutputResult, data []byte) error
+	// Progress, when set, is called with each output once it is written or
+	// has failed, from the worker that handled it last, so it must be safe
+	// for concurrent use. Interactive front ends use it to show a live view.
+	Progress func(out OutputResult)
+	// Strict rejects sources whose conversion to the image outputs are
+	// rendered from would change how they look, such as 16-bit sources,
+	// embedded color profiles or EXIF orientations, with ErrSourceConverted.
+	Strict bool
+	// PostCmdTimeout bounds the post-processing command of each dimension;
+	// zero means DefaultPostCmdTimeout.
+	PostCmdTimeout time.Duration
+	// PNGEffort recompresses PNG outputs harder: 1 to MaxPNGEffort try more
+	// filter strategies at higher deflate levels, and PNGEffortExtreme also
+	// picks filters by trial compression. Zero uses the standard encoder.
+	PNGEffort int
+	// PNGIndexed writes PNG outputs with at most 256 distinct colors,
+	// counting alpha, as indexed PNGs with the same pixels. Small flat icons
+	// shrink the most; ICO and ICNS files keep RGBA images.
+	PNGIndexed bool
+	// Encoder names the encoder profile of outputs that do not name their
+	// own; its settings replace PNGEffort and PNGIndexed.
+	Encoder string
+	// TargetSSIM encodes JPEG outputs at the lowest quality, up to that of
+	// the encoder, whose result is at least this similar to the lossless
+	// render by SSIM, from 0 to 1; typical targets are 0.95 to 0.99. Zero
+	// uses the encoder's quality as is.
+	TargetSSIM float64
+	// FS is the file system sources, watermark images and outputs are read
+	// from and written to; nil uses HostFS. A MemFS keeps a run in memory.
+	FS FS
+	// Clock times the run and dates its manifest; nil uses HostClock.
+	Clock Clock
+}
+
+// validate reports options and dimensions that cannot produce a run.
+func validate(dims []Dimension, opts Options) error {
+	if err := validateDimensions(dims); err != nil {
+		return err
+	}
+	if opts.Workers < 1 {
+		return fmt.Errorf("%w: workers must be at least 1, got %d", ErrConfigInvalid, opts.Workers)
+	}
+	if opts.IOWorkers < 0 {
+		return fmt.Errorf("%w: I/O workers must not be negative, got %d", ErrConfigInvalid, opts.IOWorkers)
+	}
+	if opts.MaxHashDistance < 0 || opts.MaxHashDistance > 64 {
+		return fmt.Errorf("%w: max hash distance must be between 0 and 64, got %d", ErrConfigInvalid, opts.MaxHashDistance)
+	}
+	if err := validateEncoder(opts.Encoder); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	if err := validateTargetSSIM(opts.TargetSSIM); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	if opts.PNGEffort < 0 || opts.PNGEffort > PNGEffortExtreme {
+		return fmt.Errorf("%w: PNG effort must be between 0 and %d, got %d", ErrConfigInvalid, PNGEffortExtreme, opts.PNGEffort)
+	}
+	if opts.MaxMemory < 0 {
+		return fmt.Errorf("%w: max memory must not be negative", ErrConfigInvalid)
+	}
+	return nil
+}
+
+// canceled wraps a context error so it matches both ErrCanceled and the
+// original context error.
+func canceled(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrCanceled, context.Cause(ctx))
+}
+
+// ProcessImage reads the input image, validates its format and size,
+// and generates resized images in the given dimensions. Output names are
+// normalized to NFC. The first failure cancels the remaining outputs unless
+// opts.KeepGoing is set, in which case every failure is reported together.
+// The returned Result is never nil.
+func ProcessImage(ctx context.Context, inputPath, outputDir string, dims []Dimension, opts Options) (*Result, error) {
+	fsys, clock := fsOf(opts), clockOf(opts)
+	start := clock.Now()
+	dims = normalizeDimensions(dims)
+	result := &Result{Source: inputPath, OutputDir: outputDir, Outputs: make([]OutputResult, len(dims))}
+	for i, dim := range dims {
+		result.Outputs[i] = OutputResult{Dimension: dim, Path: filepath.Join(outputDir, dim.Name), Status: StatusPending}
+	}
+	defer func() {
+		end := clock.Now()
+		result.Duration, result.GeneratedAt = end.Sub(start), end.UTC()
+	}()
+
+	logger := Logger(ctx)
+	if err := validate(dims, opts); err != nil {
+		return result, err
+	}
+
+	// Open the input image file
+	file, err := openSource(fsys, inputPath)
+	if err != nil {
+		return result, err
+	}
+
+	// Record the checksum of the source so outputs can be traced back to it
+	sourceHash := sha256.New()
+	if _, err := io.Copy(sourceHash, file); err != nil {
+		return result, fmt.Errorf("failed to read image file: %w", err)
+	}
+	result.SourceSHA256 = hex.EncodeToString(sourceHash.Sum(nil))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return result, fmt.Errorf("failed to rewind image file: %w", err)
+	}
+
+	// Read the header first so oversized runs are rejected before decoding
+	cfg, _, err := decodeConfig(file)
+	if err != nil {
+		return result, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return result, fmt.Errorf("failed to rewind image file: %w", err)
+	}
+
+	// Validate the image dimensions
+	if err := checkSourceSize(cfg, dims); err != nil {
+		return result, err
+	}
+
+	var wm *watermarker
+	if opts.Watermark != nil {
+		if wm, err = newWatermarker(fsys, opts.Watermark); err != nil {
+			return result, err
+		}
+	}
+
+	// Fit the number of workers into the memory budget
+	sourceMemory := estimateSourceMemory(cfg.Width, cfg.Height, cfg.ColorModel, opts)
+	var largestJob int64
+	for _, dim := range dims {
+		largestJob = max(largestJob, estimateJobMemory(cfg.Width, cfg.Height, dim, opts))
+	}
+	workers, err := fitWorkers(min(opts.Workers, len(dims)), sourceMemory, largestJob, opts.MaxMemory)
+	if err != nil {
+		return result, err
+	}
+	result.Workers = workers
+	logger.Debug("source accepted", "path", inputPath, "width", cfg.Width, "height", cfg.Height, "workers", workers)
+
+	// Decode the image once; workers share it through a read-only view
+	srcImg, conversions, err := decodeSource(file, opts.Strict)
+	result.Conversions = conversions
+	if err != nil {
+		return result, err
+	}
+	for _, c := range conversions {
+		logger.Debug("source converted", "kind", c.Kind, "detail", c.Detail, "exact", c.Exact)
+	}
+
+	// Refuse sources that are not an approved master before writing anything
+	result.SourcePHash = HashImage(srcImg.readOnly())
+	result.Palette = ExtractPalette(srcImg.readOnly(), DefaultPaletteSize)
+	edges := AnalyzeEdges(srcImg.readOnly())
+	result.Edges = &edges
+	if len(opts.Approved) > 0 {
+		if err := checkApproved(result.SourcePHash, opts.Approved, opts.MaxHashDistance); err != nil {
+			return result, err
+		}
+	}
+
+	var mem memoryTracker
+	mem.acquire(sourceMemory)
+
+	// Ensure the output directory exists
+	if err := fsys.MkdirAll(outputDir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Render and encode outputs on the workers, and hand the encoded files
+	// to separate I/O workers, so slow writes and uploads do not hold up
+	// encoding and the other way round
+	g, gctx := errgroup.WithContext(ctx)
+	ioWorkers := min(cmp.Or(opts.IOWorkers, DefaultIOWorkers), len(dims))
+	jobs := make(chan int)
+	writes := make(chan encodedOutput, ioWorkers)
+
+	// fail records the failure of an output and returns the error that
+	// stops its worker, unless the run keeps going
+	fail := func(out *OutputResult, err error) error {
+		out.Status = StatusFailed
+		out.Err = &OutputError{Name: out.Dimension.Name, Err: err}
+		logger.Error("output failed", "name", out.Dimension.Name, "error", err)
+		if opts.Progress != nil {
+			opts.Progress(*out)
+		}
+		if !opts.KeepGoing {
+			return out.Err
+		}
+		return nil
+	}
+
+	var encoding sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		encoding.Add(1)
+		g.Go(func() error {
+			defer encoding.Done()
+			for i := range jobs {
+				if gctx.Err() != nil {
+					return canceled(gctx)
+				}
+
+				// Each worker owns the result slot of the dimension it is processing
+				// until it hands the output over
+				out := &result.Outputs[i]
+				dim := out.Dimension
+				release := func() {}
+				if opts.Acquire != nil {
+					var err error
+					if release, err = opts.Acquire(gctx); err != nil {
+						return canceled(gctx)
+					}
+				}
+				jobMemory := estimateJobMemory(cfg.Width, cfg.Height, dim, opts)
+				mem.acquire(jobMemory)
+				jobStart := clock.Now()
+				enc, err := renderAndEncode(gctx, srcImg, dim, wm, opts)
+				out.Duration = clock.Now().Sub(jobStart)
+				mem.release(jobMemory)
+				release()
+				if err != nil {
+					if err := fail(out, err); err != nil {
+						return err
+					}
+					continue
+				}
+
+				enc.index = i
+				select {
+				case writes <- enc:
+				case <-gctx.Done():
+					return canceled(gctx)
+				}
+			}
+			return nil
+		})
+	}
+	go func() {
+		encoding.Wait()
+		close(writes)
+	}()
+
+	for w := 0; w < ioWorkers; w++ {
+		g.Go(func() error {
+			for enc := range writes {
+				if gctx.Err() != nil {
+					return canceled(gctx)
+				}
+
+				out := &result.Outputs[enc.index]
+				writeStart := clock.Now()
+				var err error
+				out.Status, err = saveOutput(fsys, enc, out.Path, opts)
+				if err == nil && opts.Upload != nil {
+					uploaded := *out
+					uploaded.Bytes, uploaded.SHA256 = enc.size(), enc.sum
+					if err = opts.Upload(gctx, uploaded, enc.data); err != nil {
+						err = fmt.Errorf("failed to upload output: %w", err)
+					}
+				}
+				out.Duration += clock.Now().Sub(writeStart)
+				if err != nil {
+					if err := fail(out, err); err != nil {
+						return err
+					}
+					continue
+				}
+				out.Bytes, out.SHA256 = enc.size(), enc.sum
+				logger.Info("output "+string(out.Status), "name", out.Dimension.Name, "bytes", out.Bytes, "duration", out.Duration)
+				if opts.Progress != nil {
+					opts.Progress(*out)
+				}
+			}
+			return nil
+		})
+	}
+
+	// Feed the workers until every dimension is queued or the run is canceled
+feed:
+	for i := range dims {
+		select {
+		case jobs <- i:
+		case <-gctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+
+	err = g.Wait()
+	// Workers stop quietly once the feed stops, so a canceled run must be
+	// reported here
+	if err == nil && ctx.Err() != nil {
+		err = canceled(ctx)
+	}
+	// Describe the outputs filling Xcode icon set slots once they all exist
+	if err == nil && result.Count(StatusFailed) == 0 {
+		result.AppIconContents, err = writeAppIconContents(fsys, outputDir, dims, opts.Rewrite)
+	}
+	result.PeakMemory = mem.Peak()
+	logger.Info("processing finished", "generated", result.Count(StatusGenerated), "unchanged", result.Count(StatusUnchanged), "outputs", len(dims), "duration", clock.Now().Sub(start))
+	if opts.KeepGoing {
+		errs := []error{err}
+		for _, out := range result.Outputs {
+			errs = append(errs, out.Err)
+		}
+		return result, errors.Join(errs...)
+	}
+	return result, err
+}
+
+// openSource reads the source image into memory, where it can be read again
+// after its header is checked. Files over DefaultDecodeLimits.MaxBytes are
+// refused with ErrLimitExceeded.
+func openSource(fsys FS, path string) (io.ReadSeeker, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image file: %w", err)
+	}
+	defer f.Close()
+	data, err := readLimited(f, DefaultDecodeLimits.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// checkSourceSize rejects sources that are not the expected 1080x1080,
+// unless every dimension first crops the source to its own aspect ratio,
+// so photos of any size can feed smart or focus crops. Those sources must
+// still be within DefaultDecodeLimits.
+func checkSourceSize(cfg image.Config, dims []Dimension) error {
+	if cfg.Width == 1080 && cfg.Height == 1080 {
+		return nil
+	}
+	if len(dims) > 0 && !slices.ContainsFunc(dims, func(dim Dimension) bool { return !cropsFirst(dim) }) {
+		return DefaultDecodeLimits.check(cfg.Width, cfg.Height)
+	}
+	return fmt.Errorf("%w: image dimensions must be 1080x1080, got %dx%d; only entries whose first filter is a focus or smart crop accept other sizes", ErrBadDimensions, cfg.Width, cfg.Height)
+}
+
+// cropsFirst reports whether the first filter of dim crops the source to
+// the output's aspect ratio, whatever the size of the source.
+func cropsFirst(dim Dimension) bool {
+	return len(dim.Filters) > 0 && dim.Filters[0].Type == "crop" && len(dim.Filters[0].Rect) == 0
+}
+
+// decodeError classifies a decoder failure, mapping unknown formats to
+// ErrUnsupportedFormat.
+func decodeError(err error) error {
+	if errors.Is(err, image.ErrFormat) {
+		return fmt.Errorf("%w: %w", ErrUnsupportedFormat, err)
+	}
+	return fmt.Errorf("failed to decode image: %w", err)
+}
+
+// encodedOutput is an output rendered and encoded in its format, on its
+// way to being written.
+type encodedOutput struct {
+	// index is the output's slot in the run's results.
+	index int
+	data  []byte
+	// sum is the hex encoded SHA-256 checksum of data.
+	sum string
+}
+
+// size returns the size of the encoded file.
+func (e encodedOutput) size() int64 {
+	return int64(len(e.data))
+}
+
+// renderAndEncode renders the output of one dimension, encodes it in the
+// dimension's format and runs its post-processing command, if any.
+func renderAndEncode(ctx context.Context, src *sourceImage, dim Dimension, wm *watermarker, opts Options) (encodedOutput, error) {
+	imgs, err := renderSizes(ctx, src, dim, wm, opts)
+	if err != nil {
+		return encodedOutput{}, err
+	}
+	traced := tracing(ctx)
+
+	// Encode the resized RGBA image, hashing the bytes on the way
+	start := time.Now()
+	var data bytes.Buffer
+	hash := sha256.New()
+	if err := encode(io.MultiWriter(&data, hash), imgs, dim, opts); err != nil {
+		return encodedOutput{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+	enc := encodedOutput{data: data.Bytes(), sum: hex.EncodeToString(hash.Sum(nil))}
+	if traced {
+		Logger(ctx).Debug("trace", "name", dim.Name, "step", "encode", "duration", time.Since(start), "bytes", enc.size())
+	}
+
+	// Hand the encoded file to the dimension's post-processing command
+	if dim.PostCmd != "" {
+		start = time.Now()
+		processed, output, err := runPostCmd(ctx, dim, enc.data, opts.PostCmdTimeout)
+		if err != nil {
+			return encodedOutput{}, err
+		}
+		Logger(ctx).Info("postCmd finished", "name", dim.Name, "duration", time.Since(start), "bytes", len(processed), "output", output)
+		digest := sha256.Sum256(processed)
+		enc.data, enc.sum = processed, hex.EncodeToString(digest[:])
+	}
+	return enc, nil
+}
+
+// saveOutput writes an encoded output to outputPath and reports whether it
+// was written. An existing file with identical bytes is left untouched
+// unless opts.Rewrite is set.
+func saveOutput(fsys FS, enc encodedOutput, outputPath string, opts Options) (Status, error) {
+	// Keep an identical existing file so its modification time does not change
+	if !opts.Rewrite && fileMatches(fsys, outputPath, enc.size(), enc.sum) {
+		return StatusUnchanged, nil
+	}
+
+	// Save the encoded image to the specified file
+	if err := fsys.WriteFile(outputPath, enc.data, 0644); err != nil {
+		return StatusFailed, fmt.Errorf("failed to write output file: %w", err)
+	}
+	return StatusGenerated, nil
+}
+
+// renderSizes renders the images of dim: one per embedded size of an ICO
+// output with sizes, in order, or else the one image of its size.
+func renderSizes(ctx context.Context, src *sourceImage, dim Dimension, wm *watermarker, opts Options) ([]*image.RGBA, error) {
+	if len(dim.Sizes) == 0 {
+		img, err := renderImage(ctx, src, dim, wm, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []*image.RGBA{img}, nil
+	}
+	imgs := make([]*image.RGBA, 0, len(dim.Sizes))
+	for _, size := range dim.Sizes {
+		sized := dim
+		sized.Width, sized.Height = size, size
+		img, err := renderImage(ctx, src, sized, wm, opts)
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+// renderImage applies the run's and the dimension's filters to a private copy
+// of the shared source, resizes it to the specified dimensions, converts it
+// to RGBA format and applies the watermark if any.
+func renderImage(ctx context.Context, src *sourceImage, dim Dimension, wm *watermarker, opts Options) (*image.RGBA, error) {
+	switch {
+	case dim.Card != nil:
+		return renderCard(ctx, src, dim, wm, opts)
+	case dim.Place != nil:
+		return renderPlaced(ctx, src, dim, wm, opts)
+	case dim.AdaptiveLayer != nil:
+		return renderAdaptiveLayer(ctx, src, dim, wm, opts)
+	}
+	width, height := dim.Width, dim.Height
+	traced := tracing(ctx)
+
+	dimFilters, err := buildFilters(dim)
+	if err != nil {
+		return nil, err
+	}
+	filters := append(append([]Filter{}, opts.Filters...), dimFilters...)
+
+	// Filters never see the shared source, only a copy made on demand
+	img := src.withFilters(ctx, dim.Name, filters)
+
+	// Resize the image to the specified dimensions
+	start := time.Now()
+	var resizedImg image.Image
+	if opts.Tiled && width*height >= tiledMinPixels {
+		if len(filters) == 0 {
+			// Reuse the shared premultiplied source instead of converting per output
+			img = src.premultiplied()
+		}
+		resizedImg = resizeTiled(img, width, height)
+	} else {
+		resizedImg = resize.Resize(width, height, img, resize.Lanczos3)
+	}
+	if traced {
+		trace(ctx, dim.Name, "resize", start, resizedImg)
+	}
+
+	// Convert the resized image to RGBA format
+	rgbaImg := image.NewRGBA(resizedImg.Bounds())
+	draw.Draw(rgbaImg, rgbaImg.Bounds(), resizedImg, image.Point{}, draw.Over)
+
+	// Remove or comment out the applyAlpha function to preserve original alpha
+	// applyAlpha(rgbaImg)
+
+	return finishImage(ctx, rgbaImg, dim, wm), nil
+}
+
+// finishImage applies the steps that follow resizing to a rendered output:
+// the watermark, then dithering.
+func finishImage(ctx context.Context, rgbaImg *image.RGBA, dim Dimension, wm *watermarker) *image.RGBA {
+	traced := tracing(ctx)
+
+	// Mark the output after resizing so the watermark stays legible at every size
+	if wm != nil {
+		start := time.Now()
+		wm.apply(rgbaImg)
+		if traced {
+			trace(ctx, dim.Name, "watermark", start, rgbaImg)
+		}
+	}
+
+	// Dither last, so the watermark is reduced to the display's grays too
+	if dim.Gray > 0 {
+		start := time.Now()
+		ditherGray(rgbaImg, dim.Gray)
+		if traced {
+			trace(ctx, dim.Name, "dither", start, rgbaImg)
+		}
+	}
+	return rgbaImg
+}
+
+// fileMatches reports whether the file at path has the given size and hex
+// encoded SHA-256 checksum.
+func fileMatches(fsys FS, path string, size int64, sum string) bool {
+	info, err := fsys.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return false
+	}
+	fileSum, err := hashFile(fsys, path)
+	return err == nil && fileSum == sum
+}
+
+// hashFile returns the hex encoded SHA-256 checksum of the file at path.
+func hashFile(fsys FS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// applyAlpha ensures the alpha channel is properly set for the RGBA image.
+// In this example, it retains transparency if present or applies a full-opacity alpha channel.
+func applyAlpha(img *image.RGBA) {
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// If alpha is missing, set it to full opacity (255)
+			if a == 0 {
+				img.Set(x, y, color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255})
+			}
+		}
+	}
+}
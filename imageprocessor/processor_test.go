@@ -0,0 +1,90 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// TestCheckSourceSize checks which sources other than 1080x1080 are
+// accepted, depending on the dimensions they are rendered for.
+func TestCheckSourceSize(t *testing.T) {
+	subject := Dimension{Name: "avatar.png", Width: 256, Height: 256, Filters: []FilterSpec{{Type: "crop", Smart: "subject"}}}
+	focus := Dimension{Name: "banner.png", Width: 400, Height: 100, Filters: []FilterSpec{{Type: "crop", Focus: []float64{0.5, 0.5}}}}
+	rect := Dimension{Name: "mark.png", Width: 64, Height: 64, Filters: []FilterSpec{{Type: "crop", Rect: []float64{0, 0, 0.5, 0.5}}}}
+	late := Dimension{Name: "late.png", Width: 64, Height: 64, Filters: []FilterSpec{{Type: "flip", Axis: "horizontal"}, {Type: "crop", Smart: "subject"}}}
+	plain := Dimension{Name: "icon.png", Width: 64, Height: 64}
+
+	tests := []struct {
+		name          string
+		width, height int
+		dims          []Dimension
+		want          error
+	}{
+		{"square source", 1080, 1080, []Dimension{plain}, nil},
+		{"photo with smart crops", 4032, 3024, []Dimension{subject, focus}, nil},
+		{"photo with a plain entry", 4032, 3024, []Dimension{subject, plain}, ErrBadDimensions},
+		{"photo with a rect crop", 4032, 3024, []Dimension{rect}, ErrBadDimensions},
+		{"photo cropped after another filter", 4032, 3024, []Dimension{late}, ErrBadDimensions},
+		{"photo without entries", 4032, 3024, nil, ErrBadDimensions},
+		{"huge photo", 8000, 6000, []Dimension{subject}, ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSourceSize(image.Config{Width: tt.width, Height: tt.height}, tt.dims)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestProcessImageSubjectPhoto frames the subject of a 4:3 photo, which is
+// not 1080x1080, into a square avatar.
+func TestProcessImageSubjectPhoto(t *testing.T) {
+	photo := image.NewRGBA(image.Rect(0, 0, 1600, 1200))
+	for y := 0; y < 1200; y++ {
+		for x := 0; x < 1600; x++ {
+			c := color.RGBA{0x30, 0x60, 0x90, 0xff}
+			if dx, dy := x-1100, y-500; dx*dx+dy*dy < 250*250 {
+				c = color.RGBA{0xe0, 0xac, 0x90, 0xff}
+			}
+			photo.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, photo, nil); err != nil {
+		t.Fatal(err)
+	}
+	fsys := &MemFS{}
+	if err := fsys.WriteFile("photo.jpg", buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dims := []Dimension{{Name: "avatar.png", Width: 256, Height: 256, Filters: []FilterSpec{{Type: "crop", Smart: "subject"}}}}
+	result, err := ProcessImage(context.Background(), "photo.jpg", "out", dims, Options{Workers: 1, FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Outputs[0].Status != StatusGenerated {
+		t.Fatalf("avatar.png: %s: %v", result.Outputs[0].Status, result.Outputs[0].Err)
+	}
+	avatar, err := png.Decode(bytes.NewReader(readOutputs(t, fsys, result)["avatar.png"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, b, _ := avatar.At(128, 128).RGBA(); r <= b {
+		t.Error("avatar.png is not centered on the subject")
+	}
+
+	// Other entries still need a square source
+	dims = append(dims, Dimension{Name: "icon.png", Width: 64, Height: 64})
+	if _, err := ProcessImage(context.Background(), "photo.jpg", "out", dims, Options{Workers: 1, FS: fsys}); !errors.Is(err, ErrBadDimensions) {
+		t.Errorf("got %v, want ErrBadDimensions", err)
+	}
+}
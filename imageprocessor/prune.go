@@ -0,0 +1,59 @@
+package imageprocessor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// StaleOutputs returns the manifest entries that no longer match any of
+// dims, compared the way file systems that ignore case and normalization
+// would. Entries whose names are not valid output names are never returned,
+// so a tampered manifest cannot point pruning outside the output directory.
+func StaleOutputs(m Manifest, dims []Dimension) []ManifestEntry {
+	current := make(map[string]bool, len(dims))
+	for _, dim := range dims {
+		current[nameKey(dim.Name)] = true
+	}
+
+	var stale []ManifestEntry
+	for _, entry := range m.Outputs {
+		if validateName(entry.Name) != nil || current[nameKey(entry.Name)] {
+			continue
+		}
+		stale = append(stale, entry)
+	}
+	return stale
+}
+
+// ChangedOutputs returns the entries of current whose checksum differs from
+// the entry of the same name in prev, including entries prev lacks.
+func ChangedOutputs(prev, current Manifest) []ManifestEntry {
+	previous := make(map[string]string, len(prev.Outputs))
+	for _, entry := range prev.Outputs {
+		previous[entry.Name] = entry.SHA256
+	}
+
+	var changed []ManifestEntry
+	for _, entry := range current.Outputs {
+		if sum, ok := previous[entry.Name]; !ok || sum != entry.SHA256 {
+			changed = append(changed, entry)
+		}
+	}
+	return changed
+}
+
+// Prune removes the stale outputs from outputDir. Files that are already
+// gone are skipped; every other failure is reported together.
+func Prune(outputDir string, stale []ManifestEntry) error {
+	var errs []error
+	for _, entry := range stale {
+		err := os.Remove(longPath(filepath.Join(outputDir, entry.Name)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", entry.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
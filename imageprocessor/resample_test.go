@@ -0,0 +1,37 @@
+package imageprocessor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/nfnt/resize"
+)
+
+// benchmarkSource returns a 1920x1080 gradient with transparency, so both
+// resamplers handle alpha as they do for real logos.
+func benchmarkSource() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 1920, 1080))
+	for y := 0; y < 1080; y++ {
+		for x := 0; x < 1920; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x ^ y), uint8(x + y)})
+		}
+	}
+	return img
+}
+
+// BenchmarkResize4K compares the tiled resampler with nfnt's Lanczos3 on a
+// 3840x2160 destination.
+func BenchmarkResize4K(b *testing.B) {
+	src := benchmarkSource()
+	b.Run("tiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			resizeTiled(src, 3840, 2160)
+		}
+	})
+	b.Run("nfnt", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			resize.Resize(3840, 2160, src, resize.Lanczos3)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package imageprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Status reports what happened to a single output during a run.
+type Status string
+
+const (
+	// StatusPending means the output was never started, usually because the run was canceled.
+	StatusPending Status = "pending"
+	// StatusGenerated means the output was written successfully.
+	StatusGenerated Status = "generated"
+	// StatusUnchanged means the existing file already held identical bytes
+	// and was left untouched, keeping its modification time.
+	StatusUnchanged Status = "unchanged"
+	// StatusFailed means producing the output returned an error.
+	StatusFailed Status = "failed"
+)
+
+// Succeeded reports whether the output file is in place, written or unchanged.
+func (s Status) Succeeded() bool {
+	return s == StatusGenerated || s == StatusUnchanged
+}
+
+// OutputResult describes the outcome of a single dimension.
+type OutputResult struct {
+	Dimension Dimension
+	// Path is the file the output was written to.
+	Path     string
+	Status   Status
+	Duration time.Duration
+	// Bytes is the size of the output file.
+	Bytes int64
+	// SHA256 is the hex encoded checksum of the output file.
+	SHA256 string
+	Err    error
+}
+
+// Result describes a run. ProcessImage returns it even when the run fails,
+// so callers can report which outputs were written before the failure.
+type Result struct {
+	Source string
+	// SourceSHA256 is the hex encoded checksum of the source file.
+	SourceSHA256 string
+	// SourcePHash is the perceptual hash of the source image.
+	SourcePHash PerceptualHash
+	// Palette lists the dominant colors of the source, most common first.
+	Palette []PaletteColor
+	// Edges describes the transparency and edge quality of the source; nil
+	// when the run failed before the source was decoded.
+	Edges *EdgeReport
+	// Conversions lists the changes made to the source as it was read.
+	Conversions []SourceConversion
+	OutputDir   string
+	Outputs     []OutputResult
+	Workers     int
+	PeakMemory  int64
+	Duration    time.Duration
+	// GeneratedAt is when the run finished, in UTC.
+	GeneratedAt time.Time
+
+	// AppIconContents names the Contents.json written beside outputs that
+	// fill Xcode icon set slots, or is empty.
+	AppIconContents string
+}
+
+// Count returns the number of outputs with the given status.
+func (r *Result) Count(status Status) int {
+	n := 0
+	for _, out := range r.Outputs {
+		if out.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// BytesWritten returns the total size of the outputs written by the run,
+// excluding unchanged files.
+func (r *Result) BytesWritten() int64 {
+	var n int64
+	for _, out := range r.Outputs {
+		if out.Status == StatusGenerated {
+			n += out.Bytes
+		}
+	}
+	return n
+}
+
+// Manifest lists the generated files of a run with their checksums.
+type Manifest struct {
+	Source       string             `json:"source"`
+	SourceSHA256 string             `json:"sourceSha256,omitempty"`
+	SourcePHash  string             `json:"sourcePhash,omitempty"`
+	Palette      []PaletteColor     `json:"palette,omitempty"`
+	Conversions  []SourceConversion `json:"conversions,omitempty"`
+	GeneratedAt  time.Time          `json:"generatedAt"`
+	Outputs      []ManifestEntry    `json:"outputs"`
+}
+
+// ManifestEntry describes one generated file.
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Width  uint   `json:"width"`
+	Height uint   `json:"height"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest builds the manifest of the outputs that are in place.
+func (r *Result) Manifest() Manifest {
+	m := Manifest{Source: r.Source, SourceSHA256: r.SourceSHA256, Palette: r.Palette, Conversions: r.Conversions, GeneratedAt: r.GeneratedAt, Outputs: []ManifestEntry{}}
+	if r.SourcePHash != 0 {
+		m.SourcePHash = r.SourcePHash.String()
+	}
+	for _, out := range r.Outputs {
+		if !out.Status.Succeeded() {
+			continue
+		}
+		m.Outputs = append(m.Outputs, ManifestEntry{
+			Name:   out.Dimension.Name,
+			Width:  out.Dimension.Width,
+			Height: out.Dimension.Height,
+			Bytes:  out.Bytes,
+			SHA256: out.SHA256,
+		})
+	}
+	return m
+}
+
+// WriteManifest writes the manifest as indented JSON to path.
+func (r *Result) WriteManifest(path string) error {
+	return r.Manifest().Write(path)
+}
+
+// Write writes the manifest as indented JSON to path.
+func (m Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(longPath(path), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads a manifest written by WriteManifest.
+func ReadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(longPath(path))
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseManifest decodes a manifest, for example one returned by VerifyFile.
+func ParseManifest(data []byte) (Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,116 @@
+package imageprocessor
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// schemaID identifies the config schema; editors use it to cache the schema.
+const schemaID = "https://github.com/drewalth/logo-generator/schema/config.json"
+
+// ConfigSchema returns the JSON Schema (draft 2020-12) of the config file
+// format read by LoadDimensions. It is generated from the Go types, so it
+// always matches what the loader accepts. Field descriptions come from the
+// `doc` struct tag and validation keywords from the `schema` struct tag, as
+// comma separated keyword=value pairs such as "minimum=1,enum=png|jpeg".
+func ConfigSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = schemaID
+	schema["title"] = "logo-generator config"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema builds the schema of a Go type as it is encoded by encoding/json.
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema describes the exported, JSON-encoded fields of a struct.
+// Fields without omitempty are required.
+func structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := typeSchema(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			prop["description"] = doc
+		}
+		applySchemaTag(prop, field.Tag.Get("schema"))
+		properties[name] = prop
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applySchemaTag copies the keyword=value pairs of a `schema` struct tag into
+// prop. Numeric values are emitted as numbers and enum values are separated
+// by "|".
+func applySchemaTag(prop map[string]any, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch {
+		case key == "enum":
+			prop["enum"] = strings.Split(value, "|")
+		case isNumber(value):
+			n, _ := strconv.ParseFloat(value, 64)
+			prop[key] = n
+		default:
+			prop[key] = value
+		}
+	}
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
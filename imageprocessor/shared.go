@@ -0,0 +1,105 @@
+package imageprocessor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Processor generates a fixed set of dimensions with fixed options, for
+// services that configure generation once at start and then serve many
+// requests with it.
+//
+// A Processor is safe for concurrent use by any number of goroutines.
+// NewProcessor validates its configuration and keeps a deep copy that is
+// never modified afterwards, so callers may change or reuse the values they
+// passed in, and every call keeps the decoded source and its other state to
+// itself. Concurrent calls must write to different output directories, and
+// the Filters, Acquire, Upload, FS and Clock given in the options must
+// themselves be safe for concurrent use, as the ones in this package are.
+type Processor struct {
+	dims []Dimension
+	opts Options
+}
+
+// NewProcessor returns a processor generating dims with opts, or an error
+// wrapping ErrConfigInvalid or ErrBadDimensions when they could never
+// produce a run.
+func NewProcessor(dims []Dimension, opts Options) (*Processor, error) {
+	p := &Processor{dims: cloneDimensions(normalizeDimensions(dims)), opts: cloneOptions(opts)}
+	if err := validate(p.dims, p.opts); err != nil {
+		return nil, err
+	}
+	// Catch bad filters now rather than on the first request
+	for _, dim := range p.dims {
+		if _, err := buildFilters(dim); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrConfigInvalid, dim.Name, err)
+		}
+	}
+	if p.opts.Watermark != nil {
+		if err := p.opts.Watermark.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+		}
+	}
+	return p, nil
+}
+
+// Dimensions returns a copy of the dimensions the processor generates.
+func (p *Processor) Dimensions() []Dimension {
+	return cloneDimensions(p.dims)
+}
+
+// Options returns a copy of the options the processor generates with.
+func (p *Processor) Options() Options {
+	return cloneOptions(p.opts)
+}
+
+// Process generates every dimension from the source at inputPath into
+// outputDir, as ProcessImage does.
+func (p *Processor) Process(ctx context.Context, inputPath, outputDir string) (*Result, error) {
+	return ProcessImage(ctx, inputPath, outputDir, p.dims, p.opts)
+}
+
+// Preview renders one output without writing it, as RenderPreview does.
+// The dimension need not be one of the processor's.
+func (p *Processor) Preview(ctx context.Context, inputPath string, dim Dimension) ([]byte, error) {
+	return RenderPreview(ctx, inputPath, dim, p.opts)
+}
+
+// ContactSheet renders every dimension onto one PNG, as the package's
+// ContactSheet does.
+func (p *Processor) ContactSheet(ctx context.Context, inputPath string, cellSize int) ([]byte, error) {
+	return ContactSheet(ctx, inputPath, p.dims, p.opts, cellSize)
+}
+
+// cloneDimensions returns a deep copy of dims.
+func cloneDimensions(dims []Dimension) []Dimension {
+	clones := slices.Clone(dims)
+	for i, dim := range clones {
+		dim.Tags = slices.Clone(dim.Tags)
+		if dim.When != nil {
+			when := *dim.When
+			when.OS, when.Arch, when.Profile = slices.Clone(when.OS), slices.Clone(when.Arch), slices.Clone(when.Profile)
+			dim.When = &when
+		}
+		dim.Filters = slices.Clone(dim.Filters)
+		for j, spec := range dim.Filters {
+			spec.Rect, spec.Focus = slices.Clone(spec.Rect), slices.Clone(spec.Focus)
+			dim.Filters[j] = spec
+		}
+		clones[i] = dim
+	}
+	return clones
+}
+
+// cloneOptions returns a copy of opts that shares no slices or watermark
+// with it.
+func cloneOptions(opts Options) Options {
+	opts.Filters = slices.Clone(opts.Filters)
+	opts.Approved = slices.Clone(opts.Approved)
+	if opts.Watermark != nil {
+		watermark := *opts.Watermark
+		opts.Watermark = &watermark
+	}
+	return opts
+}
@@ -0,0 +1,70 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestProcessorConcurrent shares one Processor between goroutines writing
+// to distinct directories of one file system, and checks every run
+// produces the same files. Run with -race to catch state shared between
+// calls.
+func TestProcessorConcurrent(t *testing.T) {
+	const runs = 4
+	dims := []Dimension{
+		{Name: "icon-16.png", Width: 16, Height: 16},
+		{Name: "icon-64.png", Width: 64, Height: 64, Filters: []FilterSpec{{Type: "mask", Shape: "circle"}}},
+		{Name: "icon-128.jpg", Width: 128, Height: 128, Format: "jpeg"},
+		{Name: "favicon.ico", Width: 48, Height: 48, Format: "ico", Sizes: []uint{16, 32, 48}},
+	}
+	fsys := testFS(t)
+	opts := Options{Workers: 2, FS: fsys, Watermark: &Watermark{Text: "PREVIEW"}}
+	p, err := NewProcessor(dims, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The processor keeps its own copy of what it was given
+	dims[1].Filters[0].Shape = "bogus"
+	opts.Watermark.Text = "é"
+
+	// Goroutines only record results; t.Fatal must run on the test goroutine
+	results := make([]*Result, runs)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := p.Process(context.Background(), "src.png", fmt.Sprintf("out-%d", i))
+			if err != nil {
+				t.Errorf("run %d: %v", i, err)
+				return
+			}
+			results[i] = result
+			if _, err := p.Preview(context.Background(), "src.png", p.Dimensions()[0]); err != nil {
+				t.Errorf("preview %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	files := make([]map[string][]byte, runs)
+	for i, result := range results {
+		files[i] = readOutputs(t, fsys, result)
+	}
+	for i := 1; i < runs; i++ {
+		if len(files[i]) != len(dims) {
+			t.Errorf("run %d wrote %d outputs, want %d", i, len(files[i]), len(dims))
+		}
+		for name, data := range files[0] {
+			if !bytes.Equal(files[i][name], data) {
+				t.Errorf("%s of run %d differs from run 0", name, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package imageprocessor
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// signatureComment heads every signature file, in the style of minisign.
+const signatureComment = "untrusted comment: logo-generator manifest signature"
+
+// GenerateSigningKey returns a new Ed25519 key pair, PEM encoded as PKCS #8
+// and PKIX, the formats written by openssl genpkey -algorithm ed25519.
+func GenerateSigningKey() (privatePEM, publicPEM []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
+
+// ParseSigningKey parses a PEM encoded PKCS #8 Ed25519 private key.
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("signing key is not a PEM encoded PRIVATE KEY")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key must be Ed25519, got %T", key)
+	}
+	return priv, nil
+}
+
+// ParseVerifyKey parses a PEM encoded PKIX Ed25519 public key.
+func ParseVerifyKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("verification key is not a PEM encoded PUBLIC KEY")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verification key: %w", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("verification key must be Ed25519, got %T", key)
+	}
+	return pub, nil
+}
+
+// SignFile writes a detached signature of the file at path to path.sig.
+func SignFile(path string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(longPath(path))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	if err := os.WriteFile(longPath(path+".sig"), []byte(signatureComment+"\n"+sig+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	return nil
+}
+
+// VerifyFile checks the detached signature at path.sig of the file at path
+// and returns the verified contents.
+func VerifyFile(path string, key ed25519.PublicKey) ([]byte, error) {
+	data, err := os.ReadFile(longPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sigFile, err := os.ReadFile(longPath(path + ".sig"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(sigFile)), "\n")
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %w", ErrSignatureInvalid, err)
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return nil, fmt.Errorf("%w: %s was not signed by this key or has been modified", ErrSignatureInvalid, path)
+	}
+	return data, nil
+}
+
+// VerifyOutputs checks every file listed in the manifest against its
+// recorded checksum, reporting all mismatches together.
+func VerifyOutputs(outputDir string, m Manifest) error {
+	var errs []error
+	for _, entry := range m.Outputs {
+		if err := validateName(entry.Name); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrSignatureInvalid, err))
+			continue
+		}
+		sum, err := hashFile(HostFS, filepath.Join(outputDir, entry.Name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrSignatureInvalid, err))
+			continue
+		}
+		if sum != entry.SHA256 {
+			errs = append(errs, fmt.Errorf("%w: %s does not match its recorded checksum", ErrSignatureInvalid, entry.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package imageprocessor
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// smartCropSamples is the longest side of the grid the detail of an
+	// image is measured on; finer grids barely move the crop.
+	smartCropSamples = 128
+	// entropyBins is the number of luminance levels entropy is measured on.
+	entropyBins = 32
+)
+
+// smartCropOrigin returns the origin of the region of the given size, which
+// spans the image along one axis, whose content has the highest entropy or
+// edge density. Among equally detailed regions the most central one wins,
+// so a uniform image is cropped in the center.
+func smartCropOrigin(img *image.NRGBA, size image.Point, mode string) image.Point {
+	b := img.Bounds()
+	horizontal := size.X < b.Dx()
+	if !horizontal && size.Y >= b.Dy() {
+		return image.Point{}
+	}
+
+	// Measure on a coarse grid of luminance, weighted by opacity so
+	// transparent padding counts as empty
+	scale := max(1, float64(max(b.Dx(), b.Dy()))/smartCropSamples)
+	gw, gh := max(1, int(float64(b.Dx())/scale)), max(1, int(float64(b.Dy())/scale))
+	luma := make([]float64, gw*gh)
+	alpha := make([]float64, gw*gh)
+	for y := range gh {
+		for x := range gw {
+			i := img.PixOffset(b.Min.X+int(float64(x)*scale), b.Min.Y+int(float64(y)*scale))
+			p := img.Pix[i : i+4 : i+4]
+			luma[y*gw+x] = (0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])) / 255
+			alpha[y*gw+x] = float64(p[3]) / 255
+		}
+	}
+
+	// Collapse the grid onto the axis the region slides along: each line
+	// across it contributes its edge strength or its luminance histogram
+	lines, across := gh, gw
+	at := func(line, k int) int { return line*gw + k }
+	if horizontal {
+		lines, across = gw, gh
+		at = func(line, k int) int { return k*gw + line }
+	}
+	window := max(1, int(math.Round(float64(lines)*float64(size.X)/float64(b.Dx()))))
+	if !horizontal {
+		window = max(1, int(math.Round(float64(lines)*float64(size.Y)/float64(b.Dy()))))
+	}
+	window = min(window, lines)
+
+	scores := make([]float64, lines-window+1)
+	switch mode {
+	case "edges":
+		// Gradient magnitude per line, summed over each window
+		edges := make([]float64, lines+1)
+		for line := range lines {
+			sum := 0.0
+			for k := range across {
+				v := luma[at(line, k)] * alpha[at(line, k)]
+				if line+1 < lines {
+					sum += math.Abs(luma[at(line+1, k)]*alpha[at(line+1, k)] - v)
+				}
+				if k+1 < across {
+					sum += math.Abs(luma[at(line, k+1)]*alpha[at(line, k+1)] - v)
+				}
+			}
+			edges[line+1] = edges[line] + sum
+		}
+		for i := range scores {
+			scores[i] = edges[i+window] - edges[i]
+		}
+	default:
+		// Luminance histograms per line, slid across as a window
+		hists := make([][entropyBins]float64, lines)
+		for line := range lines {
+			for k := range across {
+				bin := min(int(luma[at(line, k)]*entropyBins), entropyBins-1)
+				hists[line][bin] += alpha[at(line, k)]
+			}
+		}
+		var hist [entropyBins]float64
+		for line := range window {
+			for bin, n := range hists[line] {
+				hist[bin] += n
+			}
+		}
+		for i := range scores {
+			if i > 0 {
+				for bin := range entropyBins {
+					hist[bin] += hists[i+window-1][bin] - hists[i-1][bin]
+				}
+			}
+			scores[i] = entropy(hist[:])
+		}
+	}
+
+	best, center := 0, float64(len(scores)-1)/2
+	for i, score := range scores {
+		if score > scores[best]+1e-9 || (math.Abs(score-scores[best]) <= 1e-9 && math.Abs(float64(i)-center) < math.Abs(float64(best)-center)) {
+			best = i
+		}
+	}
+
+	// Map the window back to pixels, keeping the region inside the image
+	if horizontal {
+		return image.Pt(min(int(float64(best)*scale), b.Dx()-size.X), 0)
+	}
+	return image.Pt(0, min(int(float64(best)*scale), b.Dy()-size.Y))
+}
+
+// entropy returns the Shannon entropy in bits of a histogram.
+func entropy(hist []float64) float64 {
+	total := 0.0
+	for _, n := range hist {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	e := 0.0
+	for _, n := range hist {
+		if n > 0 {
+			p := n / total
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
@@ -0,0 +1,89 @@
+package imageprocessor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"time"
+)
+
+// Filter transforms an image that the caller owns exclusively. It may modify
+// img in place or return a new image.
+type Filter func(img *image.NRGBA) *image.NRGBA
+
+// sourceImage is an immutable view of the decoded source image. It is decoded
+// once and shared by every worker; nothing outside this file holds a mutable
+// reference to its pixels.
+type sourceImage struct {
+	pixels *image.NRGBA
+
+	premultipliedOnce sync.Once
+	premultipliedImg  *image.RGBA
+}
+
+// newSourceImage wraps a freshly decoded image. The decoder's result is
+// adopted without copying when it is already NRGBA, so the caller must not
+// keep using img afterwards.
+func newSourceImage(img image.Image) *sourceImage {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return &sourceImage{pixels: nrgba}
+	}
+
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	return &sourceImage{pixels: nrgba}
+}
+
+// ColorModel implements image.Image.
+func (s *sourceImage) ColorModel() color.Model { return color.NRGBAModel }
+
+// Bounds implements image.Image.
+func (s *sourceImage) Bounds() image.Rectangle { return s.pixels.Bounds() }
+
+// At implements image.Image.
+func (s *sourceImage) At(x, y int) color.Color { return s.pixels.At(x, y) }
+
+// readOnly exposes the shared pixels to resamplers that need the concrete type
+// for their fast paths. The returned image must never be modified.
+func (s *sourceImage) readOnly() *image.NRGBA { return s.pixels }
+
+// premultiplied returns a shared premultiplied copy of the source, built on
+// first use. The returned image must never be modified.
+func (s *sourceImage) premultiplied() *image.RGBA {
+	s.premultipliedOnce.Do(func() {
+		s.premultipliedImg = image.NewRGBA(s.pixels.Bounds())
+		draw.Draw(s.premultipliedImg, s.premultipliedImg.Bounds(), s.pixels, image.Point{}, draw.Src)
+	})
+	return s.premultipliedImg
+}
+
+// clone returns a private, mutable copy of the source.
+func (s *sourceImage) clone() *image.NRGBA {
+	dst := image.NewNRGBA(s.pixels.Bounds())
+	copy(dst.Pix, s.pixels.Pix)
+	return dst
+}
+
+// withFilters applies filters copy-on-write: without filters the shared source
+// is returned as is, otherwise the filters run on a private clone. name
+// identifies the output in per-filter traces.
+func (s *sourceImage) withFilters(ctx context.Context, name string, filters []Filter) image.Image {
+	if len(filters) == 0 {
+		return s.readOnly()
+	}
+
+	traced := tracing(ctx)
+	img := s.clone()
+	for i, f := range filters {
+		start := time.Now()
+		img = f(img)
+		if traced {
+			trace(ctx, name, fmt.Sprintf("filter %d", i+1), start, img)
+		}
+	}
+	return img
+}
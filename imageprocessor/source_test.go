@@ -0,0 +1,144 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"sync"
+	"testing"
+)
+
+// testSource returns a 1080x1080 PNG with a transparent border around an
+// opaque gradient, which every filter changes visibly.
+func testSource(t testing.TB) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 1080, 1080))
+	for y := 100; y < 980; y++ {
+		for x := 100; x < 980; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testFS returns a MemFS holding testSource as src.png.
+func testFS(t testing.TB) *MemFS {
+	t.Helper()
+	fsys := &MemFS{}
+	if err := fsys.WriteFile("src.png", testSource(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+// readOutputs returns the contents of the outputs of result by name.
+func readOutputs(t testing.TB, fsys FS, result *Result) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	for _, out := range result.Outputs {
+		f, err := fsys.Open(out.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[out.Dimension.Name] = data
+	}
+	return files
+}
+
+// filterDimensions mixes outputs rendered from the shared source with
+// outputs whose filters modify their copy in place.
+func filterDimensions() []Dimension {
+	var dims []Dimension
+	for i, size := range []uint{16, 48, 128, 512} {
+		dims = append(dims, Dimension{Name: fmt.Sprintf("plain-%d.png", size), Width: size, Height: size})
+		var filters []FilterSpec
+		switch i {
+		case 0:
+			filters = []FilterSpec{{Type: "background", Color: "#ff0000"}}
+		case 1:
+			filters = []FilterSpec{{Type: "mask", Shape: "circle"}}
+		case 2:
+			filters = []FilterSpec{{Type: "flip", Axis: "horizontal"}}
+		case 3:
+			filters = []FilterSpec{{Type: "rotate", Angle: 90}, {Type: "background", Color: "#00ff00"}}
+		}
+		dims = append(dims, Dimension{Name: fmt.Sprintf("filtered-%d.png", size), Width: size, Height: size, Filters: filters})
+	}
+	return dims
+}
+
+// TestProcessImageConcurrentFilters renders outputs with and without
+// filters on several workers, with the tiled resampler, and checks they
+// match a single worker run. Filters run on private copies of the shared
+// source; run with -race to catch one writing to the shared pixels.
+func TestProcessImageConcurrentFilters(t *testing.T) {
+	run := func(workers int) map[string][]byte {
+		fsys := testFS(t)
+		opts := Options{Workers: workers, Tiled: true, FS: fsys}
+		result, err := ProcessImage(context.Background(), "src.png", "out", filterDimensions(), opts)
+		if err != nil {
+			t.Fatalf("ProcessImage with %d workers: %v", workers, err)
+		}
+		if n := result.Count(StatusGenerated); n != len(result.Outputs) {
+			t.Fatalf("generated %d of %d outputs with %d workers", n, len(result.Outputs), workers)
+		}
+		return readOutputs(t, fsys, result)
+	}
+
+	want := run(1)
+	got := run(8)
+	for name, data := range want {
+		if !bytes.Equal(got[name], data) {
+			t.Errorf("%s differs between 1 and 8 workers", name)
+		}
+	}
+}
+
+// TestWithFiltersCopyOnWrite applies a filter that overwrites every pixel
+// from many goroutines and checks the shared source is untouched.
+func TestWithFiltersCopyOnWrite(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(testSource(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newSourceImage(img)
+	want := bytes.Clone(src.readOnly().Pix)
+
+	erase := func(img *image.NRGBA) *image.NRGBA {
+		for i := range img.Pix {
+			img.Pix[i] = 0
+		}
+		return img
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			src.premultiplied()
+			if out := src.withFilters(context.Background(), "test", []Filter{erase}).(*image.NRGBA); out == src.readOnly() {
+				t.Error("filters ran on the shared source")
+			}
+			// Outputs without filters read the shared pixels meanwhile
+			src.withFilters(context.Background(), "test", nil).(*image.NRGBA).At(540, 540)
+		}()
+	}
+	wg.Wait()
+
+	if !bytes.Equal(src.readOnly().Pix, want) {
+		t.Error("filters modified the shared source")
+	}
+}
@@ -0,0 +1,123 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// SSIM constants.
+const (
+	// ssimWindow and ssimStride are the side of the windows SSIM compares
+	// and the step between them.
+	ssimWindow = 8
+	ssimStride = 4
+	// ssimC1 and ssimC2 stabilize the division for flat windows, for
+	// 8-bit values.
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// validateTargetSSIM reports a similarity target outside (0, 1); zero
+// disables the search.
+func validateTargetSSIM(target float64) error {
+	if target < 0 || target >= 1 {
+		return fmt.Errorf("target SSIM must be between 0 and 1, exclusive, got %g", target)
+	}
+	return nil
+}
+
+// ssim returns the mean structural similarity of the luminance of two
+// images of the same size, from 1 for identical images down to 0 or
+// below. Images smaller than a window are compared as one window.
+func ssim(a, b image.Image) float64 {
+	la, lb := lumaPlane(a), lumaPlane(b)
+	w, h := a.Bounds().Dx(), a.Bounds().Dy()
+	win := min(ssimWindow, w, h)
+	if win == 0 {
+		return 1
+	}
+	var sum float64
+	n := 0
+	for y := 0; y+win <= h; y += ssimStride {
+		for x := 0; x+win <= w; x += ssimStride {
+			sum += ssimWindowAt(la, lb, w, x, y, win)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// ssimWindowAt returns the SSIM of the window at (x, y) of two planes.
+func ssimWindowAt(a, b []float64, stride, x, y, win int) float64 {
+	var sa, sb, saa, sbb, sab float64
+	for j := y; j < y+win; j++ {
+		for i := x; i < x+win; i++ {
+			va, vb := a[j*stride+i], b[j*stride+i]
+			sa += va
+			sb += vb
+			saa += va * va
+			sbb += vb * vb
+			sab += va * vb
+		}
+	}
+	n := float64(win * win)
+	ma, mb := sa/n, sb/n
+	va, vb := saa/n-ma*ma, sbb/n-mb*mb
+	cov := sab/n - ma*mb
+	return (2*ma*mb + ssimC1) * (2*cov + ssimC2) / ((ma*ma + mb*mb + ssimC1) * (va + vb + ssimC2))
+}
+
+// lumaPlane returns the BT.601 luminance of img from 0 to 255, row by row.
+// Colors are taken premultiplied, as the JPEG encoder sees them.
+func lumaPlane(img image.Image) []float64 {
+	b := img.Bounds()
+	plane := make([]float64, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			plane = append(plane, (0.299*float64(r)+0.587*float64(g)+0.114*float64(bl))/257)
+		}
+	}
+	return plane
+}
+
+// encodeJPEGTarget writes img as a JPEG at the lowest quality, up to
+// maxQuality, whose decoded image is at least target similar to img by
+// SSIM. Similarity grows with quality, so the quality is found by
+// bisection; when even maxQuality misses the target, maxQuality is used.
+func encodeJPEGTarget(w io.Writer, img *image.RGBA, target float64, maxQuality int) error {
+	encodeAt := func(q int) ([]byte, float64, error) {
+		var data bytes.Buffer
+		if err := jpeg.Encode(&data, img, &jpeg.Options{Quality: q}); err != nil {
+			return nil, 0, err
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			return nil, 0, err
+		}
+		return data.Bytes(), ssim(img, decoded), nil
+	}
+
+	best, _, err := encodeAt(maxQuality)
+	if err != nil {
+		return err
+	}
+	lo, hi := 1, maxQuality
+	for lo < hi {
+		q := (lo + hi) / 2
+		data, similarity, err := encodeAt(q)
+		if err != nil {
+			return err
+		}
+		if similarity >= target {
+			best, hi = data, q
+		} else {
+			lo = q + 1
+		}
+	}
+	_, err = w.Write(best)
+	return err
+}
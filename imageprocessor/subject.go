@@ -0,0 +1,168 @@
+package imageprocessor
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// subjectMargin is the room left around the detected subject, relative
+	// to its size.
+	subjectMargin = 1.3
+	// minSubjectRegion is the smallest region kept, relative to the shorter
+	// side of the image, so a small detection does not zoom into noise.
+	minSubjectRegion = 0.25
+	// faceMargin is the room left around skin-toned areas, enough for hair
+	// and shoulders.
+	faceMargin = 1.8
+	// minSkinShare is the share of the subject that must be skin toned for a
+	// portrait to be framed on the face.
+	minSkinShare = 0.05
+)
+
+// subjectRegion frames the subject of the image in a region with the given
+// aspect ratio. The subject is told apart from the background, estimated
+// from the image border, by color distance and opacity. When enough of it is
+// skin toned, as in a headshot, the skin is framed instead so the face is
+// centered. The region is centered on the weighted center and sized to the
+// extent plus a margin, within the image. Without a subject the largest
+// centered region is kept.
+func subjectRegion(img *image.NRGBA, aspect float64) image.Rectangle {
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	scale := max(1, max(w, h)/smartCropSamples)
+	gw, gh := max(1, int(w/scale)), max(1, int(h/scale))
+	sample := func(x, y int) []uint8 {
+		i := img.PixOffset(b.Min.X+int(float64(x)*scale), b.Min.Y+int(float64(y)*scale))
+		return img.Pix[i : i+4 : i+4]
+	}
+
+	// The background is the average opaque color along the border
+	var bg [3]float64
+	var count, transparent float64
+	for y := range gh {
+		for x := range gw {
+			if x != 0 && y != 0 && x != gw-1 && y != gh-1 {
+				continue
+			}
+			p := sample(x, y)
+			if p[3] < 128 {
+				transparent++
+				continue
+			}
+			for c := range bg {
+				bg[c] += float64(p[c])
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		for c := range bg {
+			bg[c] /= count
+		}
+	}
+	// Mostly transparent borders mean the subject is whatever is opaque
+	transparentBorder := transparent > count
+
+	subject := make([]float64, gw*gh)
+	skin := make([]float64, gw*gh)
+	var subjectTotal, skinTotal float64
+	for y := range gh {
+		for x := range gw {
+			p := sample(x, y)
+			alpha := float64(p[3]) / 255
+			var s float64
+			if transparentBorder {
+				s = alpha
+			} else {
+				dr, dg, db := float64(p[0])-bg[0], float64(p[1])-bg[1], float64(p[2])-bg[2]
+				s = alpha * math.Sqrt(dr*dr+dg*dg+db*db) / (255 * math.Sqrt(3))
+			}
+			if s < 0.1 {
+				continue
+			}
+			subject[y*gw+x] = s
+			subjectTotal += s
+			if isSkinTone(p[0], p[1], p[2]) {
+				skin[y*gw+x] = s
+				skinTotal += s
+			}
+		}
+	}
+
+	cw, ch := w, h
+	if w/h > aspect {
+		cw = h * aspect
+	} else {
+		ch = w / aspect
+	}
+	centerX, centerY := w/2, h/2
+	weights, total, margin := subject, subjectTotal, subjectMargin
+	if skinTotal >= minSkinShare*subjectTotal {
+		weights, total, margin = skin, skinTotal, faceMargin
+	}
+	if total > 0 {
+		var cx, cy float64
+		for i, v := range weights {
+			cx += v * (float64(i%gw) + 0.5)
+			cy += v * (float64(i/gw) + 0.5)
+		}
+		centerX, centerY = cx/total*scale, cy/total*scale
+
+		// The extent between the 5th and 95th percentile of the weight
+		// along each axis ignores stray detections
+		x0, x1 := weightedRange(weights, gw, gh, total, true)
+		y0, y1 := weightedRange(weights, gw, gh, total, false)
+		sw := max((x1-x0)*scale*margin, minSubjectRegion*min(w, h))
+		sh := max((y1-y0)*scale*margin, minSubjectRegion*min(w, h))
+		// Grow the box to the aspect ratio, within the largest region
+		if sw/sh > aspect {
+			sh = sw / aspect
+		} else {
+			sw = sh * aspect
+		}
+		if sw < cw {
+			cw, ch = sw, sh
+		}
+	}
+
+	x := min(max(centerX-cw/2, 0), w-cw)
+	y := min(max(centerY-ch/2, 0), h-ch)
+	return image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+cw)), int(math.Round(y+ch)))
+}
+
+// weightedRange returns the grid coordinates between which the 5th and 95th
+// percentiles of the weight lie, along x or y.
+func weightedRange(weights []float64, gw, gh int, total float64, alongX bool) (float64, float64) {
+	n, across := gh, gw
+	if alongX {
+		n, across = gw, gh
+	}
+	lo, hi := -1.0, float64(n)
+	sum := 0.0
+	for i := range n {
+		for k := range across {
+			if alongX {
+				sum += weights[k*gw+i]
+			} else {
+				sum += weights[i*gw+k]
+			}
+		}
+		if lo < 0 && sum >= 0.05*total {
+			lo = float64(i)
+		}
+		if sum >= 0.95*total {
+			hi = float64(i + 1)
+			break
+		}
+	}
+	return max(lo, 0), hi
+}
+
+// isSkinTone reports whether a color falls in the chroma range of human
+// skin, a widely used rule on the Cb and Cr components of YCbCr.
+func isSkinTone(r, g, b uint8) bool {
+	_, cb, cr := color.RGBToYCbCr(r, g, b)
+	return cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
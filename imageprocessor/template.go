@@ -0,0 +1,86 @@
+package imageprocessor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Variables holds values for ${NAME} references in config files. Names that
+// are not set fall back to the environment.
+type Variables map[string]string
+
+// lookup resolves name from the variables, then from the environment.
+func (v Variables) lookup(name string) (string, bool) {
+	if value, ok := v[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// expand replaces ${NAME} and ${NAME:-default} references in s. A literal
+// "${" is written as "$${". Undefined variables without a default are errors.
+func (v Variables) expand(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		// "$${" escapes the reference
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+		b.WriteString(s[:i])
+
+		name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable reference in %q", s)
+		}
+		value, ok := v.lookup(name)
+		switch {
+		case ok:
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			return "", fmt.Errorf("variable %s is not set and has no default", name)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// expandAll expands variables in every string of a decoded JSON document.
+func (v Variables) expandAll(doc any) (any, error) {
+	switch val := doc.(type) {
+	case string:
+		return v.expand(val)
+	case []any:
+		for i, item := range val {
+			expanded, err := v.expandAll(item)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = expanded
+		}
+	case map[string]any:
+		for key, item := range val {
+			expanded, err := v.expandAll(item)
+			if err != nil {
+				return nil, err
+			}
+			val[key] = expanded
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,244 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Texture containers hold uncompressed 8-bit RGBA pixels with straight alpha
+// and a full mip chain down to 1x1. Engines that want block compression
+// (BCn, ASTC, Basis) transcode them on import.
+
+// ktx2Identifier starts every KTX 2.0 file.
+var ktx2Identifier = []byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// vkFormatR8G8B8A8SRGB is VK_FORMAT_R8G8B8A8_SRGB, the Vulkan format of the
+// KTX2 outputs.
+const vkFormatR8G8B8A8SRGB = 43
+
+// mipChain returns img followed by its mip levels, each half the size of the
+// previous one rounded down, down to 1x1.
+func mipChain(img *image.RGBA) []*image.RGBA {
+	levels := []*image.RGBA{img}
+	for b := img.Bounds(); b.Dx() > 1 || b.Dy() > 1; b = img.Bounds() {
+		img = halveImage(img)
+		levels = append(levels, img)
+	}
+	return levels
+}
+
+// halveImage box filters img to half its size. Averaging premultiplied
+// pixels keeps the color of transparent areas from bleeding into edges.
+func halveImage(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, b.Dx()/2), max(1, b.Dy()/2)))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		y0, y1 := b.Min.Y+min(2*y, b.Dy()-1), b.Min.Y+min(2*y+1, b.Dy()-1)
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			x0, x1 := b.Min.X+min(2*x, b.Dx()-1), b.Min.X+min(2*x+1, b.Dx()-1)
+			var sum [4]int
+			for _, p := range [4]image.Point{{x0, y0}, {x1, y0}, {x0, y1}, {x1, y1}} {
+				c := img.RGBAAt(p.X, p.Y)
+				sum[0] += int(c.R)
+				sum[1] += int(c.G)
+				sum[2] += int(c.B)
+				sum[3] += int(c.A)
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8((sum[0] + 2) / 4), uint8((sum[1] + 2) / 4), uint8((sum[2] + 2) / 4), uint8((sum[3] + 2) / 4)})
+		}
+	}
+	return dst
+}
+
+// texturePixels returns the straight alpha RGBA bytes of img, row by row.
+func texturePixels(img *image.RGBA) []byte {
+	b := img.Bounds()
+	pix := make([]byte, 0, 4*b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.RGBAAt(x, y)).(color.NRGBA)
+			pix = append(pix, c.R, c.G, c.B, c.A)
+		}
+	}
+	return pix
+}
+
+// encodeKTX2 writes a KTX 2.0 texture of img and its mip levels.
+func encodeKTX2(w io.Writer, img *image.RGBA) error {
+	levels := mipChain(img)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// The data format descriptor: one basic block describing 8-bit sRGB
+	// R, G, B and linear A samples
+	var dfd bytes.Buffer
+	binary.Write(&dfd, binary.LittleEndian, uint32(4+24+4*16))
+	binary.Write(&dfd, binary.LittleEndian, struct {
+		VendorAndType    uint32
+		Version, Size    uint16
+		Model, Primaries uint8
+		Transfer, Flags  uint8
+		BlockDimensions  [4]uint8
+		BytesPlane       [8]uint8
+	}{
+		Version: 2, Size: 24 + 4*16,
+		Model: 1, Primaries: 1, Transfer: 2,
+		BytesPlane: [8]uint8{4},
+	})
+	for i, channel := range []uint8{0, 1, 2, 15 | 0x10} {
+		binary.Write(&dfd, binary.LittleEndian, struct {
+			BitOffset                uint16
+			BitLength, Channel       uint8
+			Position                 [4]uint8
+			SampleLower, SampleUpper uint32
+		}{BitOffset: uint16(8 * i), BitLength: 7, Channel: channel, SampleUpper: 255})
+	}
+
+	// The orientation tells tools the first row is the top of the image
+	var kvd bytes.Buffer
+	entry := "KTXorientation\x00rd\x00"
+	binary.Write(&kvd, binary.LittleEndian, uint32(len(entry)))
+	kvd.WriteString(entry)
+	kvd.Write(make([]byte, (4-kvd.Len()%4)%4))
+
+	// The file holds the header, the level index, the descriptors and then
+	// the levels, smallest first
+	const headerLen = 12 + 9*4 + 4*4 + 2*8
+	dfdOffset := headerLen + 24*len(levels)
+	kvdOffset := dfdOffset + dfd.Len()
+	offset := kvdOffset + kvd.Len()
+	pixels := make([][]byte, len(levels))
+	offsets := make([]int, len(levels))
+	for i := len(levels) - 1; i >= 0; i-- {
+		pixels[i] = texturePixels(levels[i])
+		offsets[i] = offset
+		offset += len(pixels[i])
+	}
+
+	var header bytes.Buffer
+	header.Write(ktx2Identifier)
+	binary.Write(&header, binary.LittleEndian, [9]uint32{
+		vkFormatR8G8B8A8SRGB, 1, uint32(width), uint32(height), 0, 0, 1, uint32(len(levels)), 0,
+	})
+	binary.Write(&header, binary.LittleEndian, [4]uint32{uint32(dfdOffset), uint32(dfd.Len()), uint32(kvdOffset), uint32(kvd.Len())})
+	binary.Write(&header, binary.LittleEndian, [2]uint64{0, 0})
+	for i := range levels {
+		binary.Write(&header, binary.LittleEndian, [3]uint64{uint64(offsets[i]), uint64(len(pixels[i])), uint64(len(pixels[i]))})
+	}
+
+	for _, part := range [][]byte{header.Bytes(), dfd.Bytes(), kvd.Bytes()} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		if _, err := w.Write(pixels[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ddsHeader is the header of a DDS file following its "DDS " magic.
+type ddsHeader struct {
+	Size, Flags, Height, Width   uint32
+	PitchOrLinearSize, Depth     uint32
+	MipMapCount                  uint32
+	Reserved1                    [11]uint32
+	PixelFormatSize, PixelFlags  uint32
+	FourCC, RGBBitCount          uint32
+	RBitMask, GBitMask, BBitMask uint32
+	ABitMask                     uint32
+	Caps, Caps2, Caps3, Caps4    uint32
+	Reserved2                    uint32
+}
+
+// DDS header flags.
+const (
+	ddsdCaps        = 0x1
+	ddsdHeight      = 0x2
+	ddsdWidth       = 0x4
+	ddsdPitch       = 0x8
+	ddsdPixelFormat = 0x1000
+	ddsdMipMapCount = 0x20000
+
+	ddpfAlphaPixels = 0x1
+	ddpfRGB         = 0x40
+
+	ddsCapsComplex = 0x8
+	ddsCapsTexture = 0x1000
+	ddsCapsMipMap  = 0x400000
+)
+
+// encodeDDS writes a DirectDraw Surface texture of img and its mip levels.
+func encodeDDS(w io.Writer, img *image.RGBA) error {
+	levels := mipChain(img)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	header := ddsHeader{
+		Size:              124,
+		Flags:             ddsdCaps | ddsdHeight | ddsdWidth | ddsdPitch | ddsdPixelFormat | ddsdMipMapCount,
+		Height:            uint32(height),
+		Width:             uint32(width),
+		PitchOrLinearSize: uint32(4 * width),
+		MipMapCount:       uint32(len(levels)),
+		PixelFormatSize:   32,
+		PixelFlags:        ddpfRGB | ddpfAlphaPixels,
+		RGBBitCount:       32,
+		RBitMask:          0x000000ff,
+		GBitMask:          0x0000ff00,
+		BBitMask:          0x00ff0000,
+		ABitMask:          0xff000000,
+		Caps:              ddsCapsTexture | ddsCapsMipMap | ddsCapsComplex,
+	}
+	if _, err := io.WriteString(w, "DDS "); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if _, err := w.Write(texturePixels(level)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeTexture decodes the base level of a KTX2 or DDS texture as written
+// by this package.
+func decodeTexture(data []byte) (image.Image, bool, error) {
+	var width, height, offset int
+	switch {
+	case bytes.HasPrefix(data, ktx2Identifier):
+		if len(data) < 80+24 {
+			return nil, true, fmt.Errorf("truncated ktx2 texture")
+		}
+		if binary.LittleEndian.Uint32(data[12:]) != vkFormatR8G8B8A8SRGB {
+			return nil, true, fmt.Errorf("%w: ktx2 textures other than R8G8B8A8_SRGB", ErrUnsupportedFormat)
+		}
+		width, height = int(binary.LittleEndian.Uint32(data[20:])), int(binary.LittleEndian.Uint32(data[24:]))
+		offset = int(binary.LittleEndian.Uint64(data[80:]))
+	case bytes.HasPrefix(data, []byte("DDS ")):
+		var header ddsHeader
+		if err := binary.Read(bytes.NewReader(data[4:]), binary.LittleEndian, &header); err != nil {
+			return nil, true, fmt.Errorf("truncated dds texture")
+		}
+		if header.PixelFlags&ddpfRGB == 0 || header.RGBBitCount != 32 || header.RBitMask != 0xff {
+			return nil, true, fmt.Errorf("%w: dds textures other than 32-bit RGBA", ErrUnsupportedFormat)
+		}
+		width, height = int(header.Width), int(header.Height)
+		offset = 4 + 124
+	default:
+		return nil, false, nil
+	}
+
+	if width <= 0 || height <= 0 || offset < 0 || offset > len(data) || (len(data)-offset)/4/width < height {
+		return nil, true, fmt.Errorf("truncated texture")
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	copy(img.Pix, data[offset:])
+	return img, true, nil
+}
@@ -0,0 +1,57 @@
+package imageprocessor
+
+import (
+	"context"
+	"image"
+	"log/slog"
+	"time"
+)
+
+// tracing reports whether per-image debug traces should be computed. The
+// statistics walk every pixel, so they are skipped unless debug logging is on.
+func tracing(ctx context.Context) bool {
+	return Logger(ctx).Enabled(ctx, slog.LevelDebug)
+}
+
+// trace logs a debug record for one step of producing an output, with the
+// step's duration and statistics of the image it produced.
+func trace(ctx context.Context, name, step string, start time.Time, img image.Image) {
+	Logger(ctx).Debug("trace", "name", name, "step", step, "duration", time.Since(start), imageStats(img))
+}
+
+// imageStats summarizes an intermediate image: its size, mean color and how
+// much of it is fully transparent or fully opaque.
+func imageStats(img image.Image) slog.Attr {
+	bounds := img.Bounds()
+	pixels := bounds.Dx() * bounds.Dy()
+	if pixels == 0 {
+		return slog.Group("stats", "width", 0, "height", 0)
+	}
+
+	var sumR, sumG, sumB, sumA uint64
+	var transparent, opaque int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			sumR += uint64(r >> 8)
+			sumG += uint64(g >> 8)
+			sumB += uint64(b >> 8)
+			sumA += uint64(a >> 8)
+			switch a {
+			case 0:
+				transparent++
+			case 0xffff:
+				opaque++
+			}
+		}
+	}
+
+	n := uint64(pixels)
+	return slog.Group("stats",
+		"width", bounds.Dx(),
+		"height", bounds.Dy(),
+		"mean_rgba", []uint64{sumR / n, sumG / n, sumB / n, sumA / n},
+		"transparent_pct", float64(transparent)*100/float64(pixels),
+		"opaque_pct", float64(opaque)*100/float64(pixels),
+	)
+}
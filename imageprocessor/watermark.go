@@ -0,0 +1,127 @@
+package imageprocessor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/nfnt/resize"
+)
+
+// Watermark is tiled across every output after it is resized, marking
+// assets meant for external previews.
+type Watermark struct {
+	Text string `json:"text,omitempty" doc:"Text tiled across every output, in a built-in upper case font" schema:"maxLength=64"`
+	// Image is a path to a PNG; LoadConfig resolves it relative to the config file.
+	Image   string  `json:"image,omitempty" doc:"Image tiled across every output, relative to the config file"`
+	Opacity float64 `json:"opacity,omitempty" doc:"Opacity of the watermark; defaults to 0.3" schema:"minimum=0,maximum=1"`
+	Color   string  `json:"color,omitempty" doc:"Text color as #rgb, #rrggbb or #rrggbbaa; defaults to #808080"`
+}
+
+// defaultWatermarkOpacity is used when a watermark sets no opacity.
+const defaultWatermarkOpacity = 0.3
+
+// validate reports watermarks that have nothing to draw, text the built-in
+// font cannot draw, or bad parameters.
+func (w *Watermark) validate() error {
+	if w.Text == "" && w.Image == "" {
+		return errors.New("watermark needs a text or an image")
+	}
+	if err := checkBuiltinText(w.Text); err != nil {
+		return fmt.Errorf("watermark: %w", err)
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("watermark opacity must be between 0 and 1, got %g", w.Opacity)
+	}
+	if w.Color != "" {
+		if _, err := ParseHexColor(w.Color); err != nil {
+			return fmt.Errorf("watermark: %w", err)
+		}
+	}
+	return nil
+}
+
+// watermarker draws a prepared watermark onto outputs. It is shared by all
+// workers and never modified after newWatermarker returns.
+type watermarker struct {
+	text    string
+	image   image.Image
+	color   color.NRGBA
+	opacity uint8
+}
+
+// newWatermarker validates w and decodes its image once for the run.
+func newWatermarker(fsys FS, w *Watermark) (*watermarker, error) {
+	if err := w.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+
+	wm := &watermarker{text: w.Text, color: color.NRGBA{0x80, 0x80, 0x80, 0xff}}
+	opacity := w.Opacity
+	if opacity == 0 {
+		opacity = defaultWatermarkOpacity
+	}
+	wm.opacity = uint8(opacity*255 + 0.5)
+	if w.Color != "" {
+		wm.color, _ = ParseHexColor(w.Color)
+	}
+
+	if w.Image != "" {
+		f, err := fsys.Open(w.Image)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to open watermark image: %w", ErrConfigInvalid, err)
+		}
+		defer f.Close()
+		if wm.image, _, err = DecodeSafe(f, DecodeLimits{}); err != nil {
+			return nil, fmt.Errorf("%w: failed to decode watermark image: %w", ErrConfigInvalid, err)
+		}
+	}
+	return wm, nil
+}
+
+// apply tiles the watermark across img. An image tile is a third of the
+// output wide and a line of text about half, and every other row is shifted by half a tile so the pattern
+// cannot be cropped away.
+func (wm *watermarker) apply(img *image.RGBA) {
+	width := img.Bounds().Dx()
+
+	if wm.image != nil {
+		b := wm.image.Bounds()
+		tileW := max(1, width/3)
+		tileH := max(1, tileW*b.Dy()/max(1, b.Dx()))
+		tile := resize.Resize(uint(tileW), uint(tileH), wm.image, resize.Lanczos3)
+		tileAcross(img, tile.Bounds().Size(), func(r image.Rectangle) {
+			draw.DrawMask(img, r, tile, tile.Bounds().Min, image.NewUniform(color.Alpha{wm.opacity}), image.Point{}, draw.Over)
+		})
+	}
+
+	if wm.text != "" {
+		// Text is much wider than tall, so it gets about half the output width
+		scale := max(1, (width/2+textWidth(wm.text)/2)/max(1, textWidth(wm.text)))
+		mask := renderText(wm.text, scale)
+		c := wm.color
+		c.A = uint8(uint16(c.A) * uint16(wm.opacity) / 255)
+		tileAcross(img, mask.Bounds().Size(), func(r image.Rectangle) {
+			draw.DrawMask(img, r, image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+		})
+	}
+}
+
+// tileAcross calls fn with the rectangle of every tile of the given size
+// covering img, spaced by half a tile horizontally and at least one tile
+// vertically, and offset on every other row.
+func tileAcross(img *image.RGBA, size image.Point, fn func(r image.Rectangle)) {
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+	b := img.Bounds()
+	stepX, stepY := size.X*3/2, max(size.Y*2, size.X/2)
+	for row, y := 0, b.Min.Y+size.Y/2; y < b.Max.Y; row, y = row+1, y+stepY {
+		x := b.Min.X - (row%2)*stepX/2
+		for ; x < b.Max.X; x += stepX {
+			fn(image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x+size.X, y+size.Y)})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// installFlag registers -install, which copies the outputs that have an
+// installPath into a project, and returns a function applying it after a run.
+func installFlag(fs *flag.FlagSet) func(result *imageprocessor.Result, quiet bool) {
+	project := fs.String("install", "", "copy outputs with an installPath, such as those of the unity and unreal presets, into this project directory")
+
+	return func(result *imageprocessor.Result, quiet bool) {
+		if *project == "" {
+			return
+		}
+		if info, err := os.Stat(*project); err != nil || !info.IsDir() {
+			log.Fatalf("Error: -install: %s is not a directory\n", *project)
+		}
+		installed := 0
+		for _, out := range result.Outputs {
+			if !out.Status.Succeeded() || out.Dimension.InstallPath == "" {
+				continue
+			}
+			path := filepath.Join(*project, filepath.FromSlash(out.Dimension.InstallPath))
+			changed, err := installFile(out.Path, path)
+			if err != nil {
+				log.Fatalf("Error: -install: %v\n", err)
+			}
+			installed++
+			if changed && !quiet {
+				fmt.Println("Installed", path)
+			}
+		}
+		if installed == 0 {
+			log.Fatal("Error: -install: no generated output has an installPath")
+		}
+	}
+}
+
+// installFile copies the output at src to dst unless dst already holds the
+// same bytes, so engines do not reimport unchanged icons. It reports whether
+// dst was written.
+func installFile(src, dst string) (bool, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return false, err
+	}
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an io.Writer that appends to a log file and rotates it once
+// it would grow beyond maxSize, keeping up to maxBackups older files named
+// path.1 (newest) through path.N (oldest).
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens or creates the log file at path for appending.
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first when it would exceed the size limit. A
+// failed rotation keeps appending to the current file, and is tried again
+// at the next write, rather than dropping every later line.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil && rf.file == nil {
+			return 0, err
+		}
+	}
+	// A file that could not be reopened is retried rather than written to
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the existing backups up by one, moves the current file to
+// path.1 and starts a new file. The oldest backup beyond maxBackups is
+// removed. The file at path is reopened even when moving it failed, so
+// rf.file is only nil when it cannot be opened at all.
+func (rf *rotatingFile) rotate() error {
+	err := rf.file.Close()
+	rf.file = nil
+	if err != nil {
+		err = fmt.Errorf("failed to close log file: %w", err)
+	} else if rf.maxBackups < 1 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if renameErr := os.Rename(rf.path, rf.path+".1"); renameErr != nil {
+			err = fmt.Errorf("failed to rotate log file: %w", renameErr)
+		}
+	}
+
+	if openErr := rf.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+// Close closes the current log file.
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Close()
+}
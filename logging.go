@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// logFlags holds the logging flags shared by every command.
+type logFlags struct {
+	quiet      bool
+	verbose    bool
+	trace      bool
+	file       string
+	maxSize    string
+	maxBackups int
+}
+
+// loggingFlags registers -q, -v, -vv and the log file flags on fs.
+func loggingFlags(fs *flag.FlagSet) *logFlags {
+	lf := &logFlags{}
+	fs.BoolVar(&lf.quiet, "q", false, "only log errors")
+	fs.BoolVar(&lf.verbose, "v", false, "log every generated image")
+	fs.BoolVar(&lf.trace, "vv", false, "also log per-image traces: filter and resize timings and intermediate image stats")
+	fs.StringVar(&lf.file, "log-file", "", "write logs to this file instead of stderr, rotating it by size")
+	fs.StringVar(&lf.maxSize, "log-max-size", "10MiB", "size at which the log file is rotated")
+	fs.IntVar(&lf.maxBackups, "log-max-backups", 3, "number of rotated log files to keep")
+	return lf
+}
+
+// level returns the log level selected by the flags, falling back to def.
+func (lf *logFlags) level(def slog.Level) slog.Level {
+	switch {
+	case lf.trace:
+		return slog.LevelDebug
+	case lf.verbose:
+		return min(def, slog.LevelInfo)
+	case lf.quiet:
+		return slog.LevelError
+	default:
+		return def
+	}
+}
+
+// logger returns a text logger at the selected level, writing to stderr or to
+// the rotating log file. The returned function closes the log file.
+func (lf *logFlags) logger(def slog.Level) (*slog.Logger, func()) {
+	var w io.Writer = os.Stderr
+	closeFn := func() {}
+
+	if lf.file != "" {
+		maxSize, err := imageprocessor.ParseByteSize(lf.maxSize)
+		if err != nil {
+			log.Fatalf("Error: -log-max-size: %v\n", err)
+		}
+		rf, err := openRotatingFile(lf.file, maxSize, lf.maxBackups)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		w = rf
+		closeFn = func() { rf.Close() }
+	}
+
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lf.level(def)})), closeFn
+}
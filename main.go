@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/cdn"
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// commands maps subcommand names to their entry points. Without a known
+// subcommand the CLI generates images from the given source.
+var commands = map[string]func(args []string){
+	"serve":             runServe,
+	"schema":            runSchema,
+	"migrate":           runMigrate,
+	"presets":           runPresets,
+	"update":            runUpdate,
+	"version":           runVersion,
+	"apply":             runApply,
+	"clean":             runClean,
+	"keygen":            runKeygen,
+	"verify":            runVerify,
+	"approve":           runApprove,
+	"worker":            runWorker,
+	"remote":            runRemote,
+	"urls":              runURLs,
+	"workspace":         runWorkspace,
+	"selftest":          runSelftest,
+	"pr-preview":        runPRPreview,
+	"daemon":            runDaemon,
+	"contrast":          runContrast,
+	"print":             runPrint,
+	"install-service":   runInstallService,
+	"install-shell-ext": runInstallShellExt,
+}
+
+func main() {
+	if len(os.Args) == 1 && isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		runInteractive()
+		return
+	}
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	runGenerate(os.Args[1:])
+}
+
+// processorFlags registers the flags shared by every command that runs the
+// processor and returns a function that builds the options once parsed.
+func processorFlags(fs *flag.FlagSet) func() imageprocessor.Options {
+	var opts imageprocessor.Options
+	var maxMemory, pngEffort string
+	fs.BoolVar(&opts.Tiled, "experimental-tiled", false, "resize the largest outputs with the experimental parallel tiled resampler")
+	fs.IntVar(&opts.Workers, "workers", runtime.NumCPU(), "number of images to generate concurrently")
+	fs.IntVar(&opts.IOWorkers, "io-workers", imageprocessor.DefaultIOWorkers, "number of generated images to write and upload concurrently, apart from -workers")
+	fs.StringVar(&maxMemory, "max-memory", "", "maximum estimated pixel memory, e.g. 512MiB; concurrency is reduced to fit")
+	fs.BoolVar(&opts.KeepGoing, "keep-going", false, "keep generating the remaining images after one fails")
+	fs.BoolVar(&opts.Rewrite, "rewrite", false, "rewrite outputs even when the existing file already holds identical bytes")
+	fs.StringVar(&pngEffort, "png-effort", "", "recompress PNG outputs harder, from 1 to 9 or extreme; slower, but smaller files with the same pixels")
+	fs.StringVar(&opts.Encoder, "encoder", "", "encoder profile of outputs whose config entry names none: web, store, archive or legacy; replaces -png-effort and -png-indexed")
+	fs.Float64Var(&opts.TargetSSIM, "target-ssim", 0, "encode JPEG outputs at the lowest quality whose SSIM similarity to the lossless render reaches this target, e.g. 0.98; the encoder's quality is the highest tried")
+	fs.BoolVar(&opts.PNGIndexed, "png-indexed", false, "write PNG outputs with at most 256 colors, counting alpha, as indexed PNGs with the same pixels")
+	fs.DurationVar(&opts.PostCmdTimeout, "post-cmd-timeout", imageprocessor.DefaultPostCmdTimeout, "time limit of the postCmd of each output")
+	fs.BoolVar(&opts.Strict, "strict", false, "fail instead of converting a source that is 16-bit, has a color profile other than sRGB or an EXIF orientation, or otherwise needs a conversion that changes how it looks")
+	defringe := fs.Bool("defringe", false, "recolor the semi-transparent edges of the source with the artwork beside them, removing halos left by exporting over a matte")
+	approved := fs.String("approved", "", "file of approved master perceptual hashes; other sources are refused")
+	fs.IntVar(&opts.MaxHashDistance, "approved-distance", imageprocessor.DefaultMaxHashDistance, "number of perceptual hash bits an approved source may differ by")
+
+	return func() imageprocessor.Options {
+		if *defringe {
+			opts.Filters = append(opts.Filters, imageprocessor.Defringe)
+		}
+		if *approved != "" {
+			hashes, err := imageprocessor.LoadApprovedHashes(*approved)
+			if err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+			opts.Approved = hashes
+		}
+		if maxMemory != "" {
+			n, err := imageprocessor.ParseByteSize(maxMemory)
+			if err != nil {
+				log.Fatalf("Error: -max-memory: %v\n", err)
+			}
+			opts.MaxMemory = n
+		}
+		switch n, err := strconv.Atoi(pngEffort); {
+		case pngEffort == "":
+		case pngEffort == "extreme":
+			opts.PNGEffort = imageprocessor.PNGEffortExtreme
+		case err != nil || n < 1 || n > imageprocessor.MaxPNGEffort:
+			log.Fatalf("Error: -png-effort: want 1 to %d or extreme, got %q\n", imageprocessor.MaxPNGEffort, pngEffort)
+		default:
+			opts.PNGEffort = n
+		}
+		return opts
+	}
+}
+
+// dimensionsFlag registers -config, -preset, -legacy-defaults, -tags, -var,
+// -profile, -target-os and -target-arch on fs and returns a function that
+// loads the configured dimensions and the selected profile once parsed,
+// defaulting to the built-in preset. Dimensions whose when conditions do not
+// hold are left out. The second function returns every dimension the config
+// lists once the first has run, when conditions aside, which pruning keeps.
+func dimensionsFlag(fs *flag.FlagSet) (func() ([]imageprocessor.Dimension, imageprocessor.Profile), func() []imageprocessor.Dimension) {
+	load, listed := dimensionsLoaders(fs)
+	return func() ([]imageprocessor.Dimension, imageprocessor.Profile) {
+		dims, profile, err := load()
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		return dims, profile
+	}, listed
+}
+
+// dimensionsLoader registers the flags of dimensionsFlag and returns a
+// function reporting errors instead of exiting, for commands that reload
+// the config while running.
+func dimensionsLoader(fs *flag.FlagSet) func() ([]imageprocessor.Dimension, imageprocessor.Profile, error) {
+	load, _ := dimensionsLoaders(fs)
+	return load
+}
+
+// dimensionsLoaders registers the flags of dimensionsFlag and returns the
+// loader of dimensionsLoader, and a function returning the dimensions it
+// last loaded before the when conditions and -tags were applied.
+func dimensionsLoaders(fs *flag.FlagSet) (func() ([]imageprocessor.Dimension, imageprocessor.Profile, error), func() []imageprocessor.Dimension) {
+	path := fs.String("config", "", "JSON file listing the dimensions to generate; defaults to the built-in "+imageprocessor.DefaultPreset+" preset")
+	presets := fs.String("preset", "", "comma separated built-in presets to generate, see the presets command")
+	legacy := fs.Bool("legacy-defaults", false, "generate the hard-coded list of the original logo-generator.go script, which wrote PNG data for icon.icns and icon.ico")
+	tags := fs.String("tags", "", "only generate dimensions carrying one of these comma separated tags")
+	profileName := fs.String("profile", "", "apply a profile defined in the -config file, e.g. a watermark for previews")
+	targetOS := fs.String("target-os", runtime.GOOS, "operating system the when conditions of the config are evaluated for")
+	targetArch := fs.String("target-arch", runtime.GOARCH, "architecture the when conditions of the config are evaluated for")
+	vars := imageprocessor.Variables{}
+	fs.Func("var", "set a config variable as NAME=VALUE, referenced as ${NAME} (repeatable)", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("expected NAME=VALUE, got %q", s)
+		}
+		vars[name] = value
+		return nil
+	})
+
+	var listed []imageprocessor.Dimension
+	return func() ([]imageprocessor.Dimension, imageprocessor.Profile, error) {
+		dims := imageprocessor.DefaultDimensions
+		var profile imageprocessor.Profile
+		switch {
+		case *profileName != "" && *path == "":
+			return nil, profile, errors.New("-profile needs a -config file defining the profile")
+		case *legacy && *path != "":
+			return nil, profile, errors.New("-legacy-defaults cannot be combined with -config")
+		case *presets != "" && (*legacy || *path != ""):
+			return nil, profile, errors.New("-preset cannot be combined with -config or -legacy-defaults")
+		case *legacy:
+			dims = imageprocessor.LegacyDimensions
+		case *presets != "":
+			dims = nil
+			for _, name := range strings.Split(*presets, ",") {
+				preset, err := imageprocessor.LoadPreset(name)
+				if err != nil {
+					return nil, profile, err
+				}
+				dims = append(dims, preset...)
+			}
+		}
+		// A missing config file falls back to the built-in preset, with a
+		// warning in case the path is mistyped
+		if *path != "" && imageprocessor.MissingConfig(*path) {
+			if *profileName != "" {
+				return nil, profile, fmt.Errorf("-profile needs the -config file defining the profile, but %s does not exist", *path)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: -config file %s does not exist; generating the built-in %s preset\n", *path, imageprocessor.DefaultPreset)
+		} else if *path != "" {
+			cfg, err := imageprocessor.LoadConfig(*path, vars)
+			if err != nil {
+				return nil, profile, err
+			}
+			if profile, err = cfg.Profile(*profileName); err != nil {
+				return nil, profile, err
+			}
+			dims = cfg.Dimensions
+		}
+		listed = dims
+		dims = imageprocessor.SelectWhen(dims, imageprocessor.Environment{OS: *targetOS, Arch: *targetArch, Profile: *profileName})
+		if *tags != "" {
+			dims = imageprocessor.SelectTags(dims, strings.Split(*tags, ","))
+		}
+		return dims, profile, nil
+	}, func() []imageprocessor.Dimension { return listed }
+}
+
+// runGenerate resizes a single source image into the output directory. The
+// source may also be given as the only positional argument, as the original
+// logo-generator.go script accepted it.
+func runGenerate(args []string) {
+	fs := flag.NewFlagSet("logo-generator", flag.ExitOnError)
+	input := fs.String("input", "", "path to the source image, or clipboard to read it from the system clipboard")
+	outputDir := fs.String("output", "output", "directory the generated images are written to, or a storage URL such as s3://bucket/prefix")
+	options := processorFlags(fs)
+	dimensions, listedDimensions := dimensionsFlag(fs)
+	manifestName := fs.String("manifest", "manifest.json", "name of the manifest written to the output directory; empty disables it")
+	signKey := signingKeyFlag(fs)
+	checksums := fs.String("checksums", "", "comma separated checksum files to write next to the outputs: "+strings.Join(imageprocessor.ChecksumAlgorithms(), ", "))
+	prune := fs.Bool("prune", false, "remove files listed in the previous manifest that the current config no longer generates")
+	purge := fs.String("purge", "", "invalidate changed outputs on a CDN: cloudflare:<zone id>, fastly or cloudfront:<distribution id>")
+	purgeURL := fs.String("purge-url", "", "public base URL the output directory is served from, for -purge")
+	changelog := changelogFlag(fs)
+	patchManifests := patchFlags(fs)
+	install := installFlag(fs)
+	exportOutputs := exportFlags(fs)
+	commitOutputs := gitFlags(fs)
+	logs := loggingFlags(fs)
+	fs.Parse(args)
+
+	imagePath := *input
+	switch {
+	case imagePath == "" && fs.NArg() == 1:
+		imagePath = fs.Arg(0)
+	case imagePath == "" || fs.NArg() != 0:
+		log.Fatal("Usage: logo-generator [flags] -input <path_to_image>")
+	}
+
+	// Stop outstanding work when the user interrupts the run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logger, closeLog := logs.logger(slog.LevelWarn)
+	defer closeLog()
+	ctx = imageprocessor.WithLogger(ctx, logger)
+
+	// Outputs bound for a storage URL are generated in a scratch directory
+	// and uploaded once the set is complete
+	target := *outputDir
+	var store storage.Storage
+	if !storage.IsLocal(target) {
+		store = openOutputStorage(ctx, fs, target)
+		defer store.Close()
+		scratch, err := os.MkdirTemp("", "logo-generator-")
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		defer os.RemoveAll(scratch)
+		*outputDir = scratch
+	}
+
+	dims, profile := dimensions()
+	opts := options()
+	opts.Watermark = profile.Watermark
+	if store != nil {
+		opts.Upload = uploadOutput(store)
+	}
+	if imagePath == clipboardInput {
+		fsys, err := clipboardFS()
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		opts.FS = fsys
+	}
+	key := signKey()
+	if key != nil && *manifestName == "" {
+		log.Fatal("Error: -sign-key signs the manifest, but -manifest is empty")
+	}
+	var purger cdn.Purger
+	var previous imageprocessor.Manifest
+	if *purge != "" {
+		purger = purgerFlags(*purge, *purgeURL, *manifestName)
+		// Changes are found against the manifest of the deployed set
+		previous = readPreviousManifest(filepath.Join(*outputDir, *manifestName))
+	}
+	var stale []imageprocessor.ManifestEntry
+	if *prune {
+		if *manifestName == "" {
+			log.Fatal("Error: -prune needs the manifest of the previous run, but -manifest is empty")
+		}
+		// Outputs only left out by when conditions, such as those of another
+		// platform, are not stale
+		manifest := previousManifest(fs, filepath.Join(*outputDir, *manifestName))
+		stale = imageprocessor.StaleOutputs(manifest, listedDimensions())
+	}
+
+	var algorithms []string
+	if *checksums != "" {
+		algorithms = strings.Split(*checksums, ",")
+		for _, algorithm := range algorithms {
+			if _, ok := imageprocessor.ChecksumFiles[algorithm]; !ok {
+				log.Fatalf("Error: -checksums: unknown algorithm %q, expected one of %s\n", algorithm, strings.Join(imageprocessor.ChecksumAlgorithms(), ", "))
+			}
+		}
+	}
+
+	writeChangelog := changelog(*outputDir, *manifestName)
+
+	result, err := imageprocessor.ProcessImage(ctx, imagePath, *outputDir, dims, opts)
+	if !logs.quiet {
+		printSummary(result)
+		printSourceReport(result, fs.Lookup("defringe").Value.String() == "true")
+	}
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Files describing the set are written, and uploaded, after the outputs
+	var listings []string
+	if result.AppIconContents != "" {
+		listings = append(listings, result.AppIconContents)
+	}
+	if *manifestName != "" {
+		manifestPath := filepath.Join(*outputDir, *manifestName)
+		if err := result.WriteManifest(manifestPath); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		listings = append(listings, *manifestName)
+		if key != nil {
+			if err := imageprocessor.SignFile(manifestPath, key); err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+			listings = append(listings, *manifestName+".sig")
+		}
+	}
+	for _, algorithm := range algorithms {
+		name, err := result.WriteChecksums(algorithm)
+		if err != nil {
+			log.Fatalf("Error: -checksums: %v\n", err)
+		}
+		listings = append(listings, name)
+	}
+	if store != nil {
+		if err := uploadListings(ctx, store, *outputDir, listings); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
+	// Remove stale files only once the new set is in place
+	if err := imageprocessor.Prune(*outputDir, stale); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if !logs.quiet {
+		for _, entry := range stale {
+			fmt.Printf("  %-9s %s\n", "pruned", entry.Name)
+		}
+	}
+
+	writeChangelog(result)
+	patchManifests(result, *outputDir, logs.quiet)
+	install(result, logs.quiet)
+	exportOutputs(result, *outputDir, logs.quiet)
+	commitOutputs(ctx, *outputDir, logs.quiet)
+
+	// Invalidate only what changed, including files that were just pruned
+	if purger != nil {
+		var names []string
+		for _, entry := range append(imageprocessor.ChangedOutputs(previous, result.Manifest()), stale...) {
+			names = append(names, entry.Name)
+		}
+		if len(names) > 0 {
+			if err := purger.Purge(ctx, cdn.URLs(*purgeURL, names)); err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+		}
+		if !logs.quiet {
+			fmt.Printf("Purged %d changed files from the CDN\n", len(names))
+		}
+	}
+	if !logs.quiet {
+		fmt.Println("Image processing complete. Resized images saved to:", target)
+	}
+}
+
+// printSourceReport reports the conversions made to the source and its
+// transparency, and warns about a matte fringe along its edges unless
+// -defringe cleaned it. Runs that failed before the source was analyzed
+// have no transparency to report.
+func printSourceReport(result *imageprocessor.Result, defringed bool) {
+	for _, c := range result.Conversions {
+		exact := ""
+		if c.Exact {
+			exact = " (exact)"
+		}
+		fmt.Printf("Source converted: %s%s\n", c, exact)
+	}
+	edges := result.Edges
+	if edges == nil {
+		return
+	}
+	fmt.Printf("Source: %.1f%% transparent, %.1f%% semi-transparent\n", edges.Transparent, edges.SemiTransparent)
+	if edges.HasFringe() && !defringed {
+		fmt.Printf("Warning: %.1f%% of the source's edge pixels have a %s halo from exporting over a matte; -defringe cleans it\n", edges.Fringe, edges.Matte)
+	}
+}
+
+// printSummary prints one line per output followed by the run totals.
+func printSummary(result *imageprocessor.Result) {
+	for _, out := range result.Outputs {
+		if out.Status == imageprocessor.StatusPending {
+			continue
+		}
+		fmt.Printf("  %-9s %-24s %4dx%-4d %10s %8s\n", out.Status, out.Dimension.Name, out.Dimension.Width, out.Dimension.Height,
+			imageprocessor.FormatBytes(out.Bytes), out.Duration.Round(time.Millisecond))
+	}
+	fmt.Printf("Generated %d of %d images (%s, %d unchanged) in %s with %d workers, peak estimated pixel memory: %s\n",
+		result.Count(imageprocessor.StatusGenerated), len(result.Outputs), imageprocessor.FormatBytes(result.BytesWritten()), result.Count(imageprocessor.StatusUnchanged),
+		result.Duration.Round(time.Millisecond), result.Workers, imageprocessor.FormatBytes(result.PeakMemory))
+}
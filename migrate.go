@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runMigrate upgrades a version 1 dimensions file to the current config
+// format, printing a note for every entry it changed.
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	out := fs.String("o", "", "write the migrated config to this file instead of stdout")
+	inPlace := fs.Bool("w", false, "overwrite the input file, keeping the original as <file>.bak")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: logo-generator migrate [-o file | -w] <config.json>")
+	}
+	path := fs.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	cfg, notes, err := imageprocessor.MigrateConfig(data)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	migrated, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	migrated = append(migrated, '\n')
+
+	for _, note := range notes {
+		fmt.Fprintln(os.Stderr, note)
+	}
+
+	switch {
+	case *inPlace:
+		if err := os.WriteFile(path+".bak", data, 0644); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if err := os.WriteFile(path, migrated, 0644); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Migrated %s (original saved as %s.bak)\n", path, path)
+	case *out != "":
+		if err := os.WriteFile(*out, migrated, 0644); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	default:
+		os.Stdout.Write(migrated)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// localOutputFlags read, patch or commit files next to the outputs, so they need
+// -output to be a directory.
+var localOutputFlags = []string{"prune", "purge", "android-manifest", "ios-plist", "electron-config", "web-manifest", "install", "changelog", "go-embed", "snippets", "design-tokens", "git-commit"}
+
+// openOutputStorage opens the storage URL given as -output, refusing the
+// flags that only work with a local directory.
+func openOutputStorage(ctx context.Context, fs *flag.FlagSet, target string) storage.Storage {
+	fs.Visit(func(f *flag.Flag) {
+		if slices.Contains(localOutputFlags, f.Name) {
+			log.Fatalf("Error: -%s needs -output to be a directory, not a storage URL\n", f.Name)
+		}
+	})
+	store, err := storage.Open(ctx, target)
+	if err != nil {
+		log.Fatalf("Error: -output: %v\n", err)
+	}
+	return store
+}
+
+// uploadOutput returns the Options.Upload hook that stores each output as
+// soon as it is written, while the rest of the set is still encoding.
+func uploadOutput(store storage.Storage) func(ctx context.Context, out imageprocessor.OutputResult, data []byte) error {
+	return func(ctx context.Context, out imageprocessor.OutputResult, data []byte) error {
+		return store.Put(ctx, out.Dimension.Name, data)
+	}
+}
+
+// uploadListings stores the listings written to dir after the run, such as
+// the manifest and its signature. The outputs are already uploaded by then,
+// so consumers never find a manifest listing files that are not in place
+// yet.
+func uploadListings(ctx context.Context, store storage.Storage, dir string, listings []string) error {
+	for _, name := range listings {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if err := store.Put(ctx, name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/patch"
+)
+
+// patchFlags registers the flags that update app manifests to reference the
+// generated icons, and returns a function applying them after a run.
+func patchFlags(fs *flag.FlagSet) func(result *imageprocessor.Result, outputDir string, quiet bool) {
+	androidManifest := fs.String("android-manifest", "", "AndroidManifest.xml whose application icon attributes are pointed at the generated icons")
+	androidIcon := fs.String("android-icon", "ic_launcher.png", "output used as android:icon, for -android-manifest")
+	androidRoundIcon := fs.String("android-round-icon", "", "output used as android:roundIcon, for -android-manifest")
+	iosPlist := fs.String("ios-plist", "", "Info.plist whose CFBundleIcons list the generated PNG icons")
+	electronConfig := fs.String("electron-config", "", "package.json or electron-builder.json/.yml whose mac, win and linux icons are pointed at the generated icons")
+	webManifest := fs.String("web-manifest", "", "web app manifest, created if missing, whose icons list the pwa outputs and whose theme_color and background_color come from the logo's palette")
+	themeColor := fs.String("theme-color", "", "theme_color for -web-manifest instead of the one picked from the palette")
+	backgroundColor := fs.String("background-color", "", "background_color for -web-manifest instead of the one picked from the palette")
+
+	return func(result *imageprocessor.Result, outputDir string, quiet bool) {
+		var generated []string
+		var succeeded []imageprocessor.Dimension
+		for _, out := range result.Outputs {
+			if out.Status.Succeeded() {
+				generated = append(generated, out.Dimension.Name)
+				succeeded = append(succeeded, out.Dimension)
+			}
+		}
+
+		if *androidManifest != "" {
+			// Refuse to reference icons this run did not produce
+			names := []string{*androidIcon}
+			if *androidRoundIcon != "" {
+				names = append(names, *androidRoundIcon)
+			}
+			if err := patch.Require(generated, names...); err != nil {
+				log.Fatalf("Error: -android-manifest: %v\n", err)
+			}
+			patchFile(*androidManifest, quiet, func(data []byte) ([]byte, error) {
+				return patch.AndroidManifest(data, *androidIcon, *androidRoundIcon)
+			})
+		}
+		if *iosPlist != "" {
+			patchFile(*iosPlist, quiet, func(data []byte) ([]byte, error) {
+				return patch.InfoPlist(data, generated)
+			})
+		}
+		if *electronConfig != "" {
+			icons := electronIcons(succeeded, outputDir, filepath.Dir(*electronConfig))
+			if icons == (patch.ElectronIcons{}) {
+				log.Fatal("Error: -electron-config: no icns, ico or PNG icons were generated")
+			}
+			patchFile(*electronConfig, quiet, func(data []byte) ([]byte, error) {
+				return patch.ElectronBuilder(*electronConfig, data, icons)
+			})
+		}
+		if *webManifest != "" {
+			theme, background := imageprocessor.ThemeColors(result.Palette)
+			if *themeColor != "" {
+				theme = *themeColor
+			}
+			if *backgroundColor != "" {
+				background = *backgroundColor
+			}
+			// A missing manifest is generated from scratch
+			if _, err := os.Stat(*webManifest); os.IsNotExist(err) {
+				if err := os.WriteFile(*webManifest, nil, 0644); err != nil {
+					log.Fatalf("Error: %v\n", err)
+				}
+			}
+			icons := webManifestIcons(succeeded, outputDir, filepath.Dir(*webManifest))
+			patchFile(*webManifest, quiet, func(data []byte) ([]byte, error) {
+				return patch.WebManifest(data, icons, theme, background)
+			})
+		}
+	}
+}
+
+// webManifestIcons lists the PNG outputs tagged pwa as web app manifest
+// icons, with paths relative to the manifest's directory. Outputs also
+// tagged maskable are marked as such. Without pwa outputs it returns nil,
+// leaving the manifest's icons alone.
+func webManifestIcons(dims []imageprocessor.Dimension, outputDir, manifestDir string) []patch.WebManifestIcon {
+	var icons []patch.WebManifestIcon
+	for _, dim := range dims {
+		if !slices.Contains(dim.Tags, "pwa") || (dim.Format != "" && dim.Format != "png") {
+			continue
+		}
+		src := filepath.Join(outputDir, dim.Name)
+		if r, err := filepath.Rel(manifestDir, src); err == nil {
+			src = r
+		}
+		icon := patch.WebManifestIcon{Src: filepath.ToSlash(src), Sizes: fmt.Sprintf("%dx%d", dim.Width, dim.Height), Type: "image/png"}
+		if slices.Contains(dim.Tags, "maskable") {
+			icon.Purpose = "maskable"
+		}
+		icons = append(icons, icon)
+	}
+	return icons
+}
+
+// sizedPNG matches the PNG names electron-builder reads sizes from.
+var sizedPNG = regexp.MustCompile(`^\d+x\d+\.png$`)
+
+// electronIcons picks the generated icons of each platform, as paths
+// relative to the directory of the electron-builder config. Linux takes the
+// whole output directory when it holds sized PNGs such as 256x256.png, and
+// the largest PNG otherwise.
+func electronIcons(dims []imageprocessor.Dimension, outputDir, configDir string) patch.ElectronIcons {
+	rel := func(name string) string {
+		path := filepath.Join(outputDir, name)
+		if r, err := filepath.Rel(configDir, path); err == nil {
+			path = r
+		}
+		return filepath.ToSlash(path)
+	}
+
+	var icons patch.ElectronIcons
+	var largest imageprocessor.Dimension
+	for _, dim := range dims {
+		switch dim.Format {
+		case "icns":
+			if icons.Mac == "" {
+				icons.Mac = rel(dim.Name)
+			}
+		case "ico":
+			if icons.Win == "" {
+				icons.Win = rel(dim.Name)
+			}
+		case "", "png":
+			if sizedPNG.MatchString(dim.Name) {
+				icons.Linux = rel("")
+			}
+			if dim.Width*dim.Height > largest.Width*largest.Height {
+				largest = dim
+			}
+		}
+	}
+	if icons.Linux == "" && largest.Name != "" {
+		icons.Linux = rel(largest.Name)
+	}
+	return icons
+}
+
+// patchFile rewrites the file at path with edit, keeping its permissions.
+func patchFile(path string, quiet bool, edit func([]byte) ([]byte, error)) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	patched, err := edit(data)
+	if err != nil {
+		log.Fatalf("Error: %s: %v\n", path, err)
+	}
+	if err := os.WriteFile(path, patched, info.Mode().Perm()); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if !quiet {
+		fmt.Println("Patched", path)
+	}
+}
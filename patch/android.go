@@ -0,0 +1,97 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// attrPattern matches an attribute with the whitespace before it.
+var attrPattern = regexp.MustCompile(`(\s+)[\w:.-]+\s*=`)
+
+// androidResourceName matches the file names Android accepts as resources.
+var androidResourceName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// AndroidManifest points the icon and roundIcon attributes of the
+// <application> element at the mipmap resources of the named outputs, e.g.
+// ic_launcher.png becomes @mipmap/ic_launcher. An empty roundIcon leaves that
+// attribute alone. The manifest is edited as text, so its formatting and
+// comments are kept.
+func AndroidManifest(data []byte, icon, roundIcon string) ([]byte, error) {
+	start, end, err := findStartTag(data, "application")
+	if err != nil {
+		return nil, err
+	}
+	tag := data[start:end]
+	for _, attr := range []struct{ name, file string }{{"icon", icon}, {"roundIcon", roundIcon}} {
+		if attr.file == "" {
+			continue
+		}
+		res := trimExt(attr.file)
+		if !androidResourceName.MatchString(res) {
+			return nil, fmt.Errorf("%s is not a valid Android resource name; use lower case letters, digits and underscores", attr.file)
+		}
+		tag = setAttr(tag, "android:"+attr.name, "@mipmap/"+res)
+	}
+	return slices.Concat(data[:start], tag, data[end:]), nil
+}
+
+// findStartTag returns the bounds of the first start tag of the element name
+// outside comments, up to and including its closing '>'.
+func findStartTag(data []byte, name string) (int, int, error) {
+	open := []byte("<" + name)
+	for i := 0; i < len(data); {
+		if bytes.HasPrefix(data[i:], []byte("<!--")) {
+			n := bytes.Index(data[i:], []byte("-->"))
+			if n < 0 {
+				break
+			}
+			i += n + 3
+			continue
+		}
+		if bytes.HasPrefix(data[i:], open) && i+len(open) < len(data) && bytes.IndexByte([]byte(" \t\r\n/>"), data[i+len(open)]) >= 0 {
+			// The tag ends at the first '>' outside a quoted value
+			var quote byte
+			for j := i + len(open); j < len(data); j++ {
+				switch c := data[j]; {
+				case quote != 0:
+					if c == quote {
+						quote = 0
+					}
+				case c == '"' || c == '\'':
+					quote = c
+				case c == '>':
+					return i, j + 1, nil
+				}
+			}
+			break
+		}
+		i++
+	}
+	return 0, 0, fmt.Errorf("no <%s> element found", name)
+}
+
+// setAttr sets the attribute name of the start tag to value, replacing the
+// existing value or adding the attribute with the indentation of the last
+// one.
+func setAttr(tag []byte, name, value string) []byte {
+	re := regexp.MustCompile(`(\s` + regexp.QuoteMeta(name) + `\s*=\s*)("[^"]*"|'[^']*')`)
+	if loc := re.FindSubmatchIndex(tag); loc != nil {
+		return slices.Concat(tag[:loc[4]], []byte(`"`+value+`"`), tag[loc[5]:])
+	}
+
+	sep := []byte(" ")
+	if attrs := attrPattern.FindAllSubmatch(tag, -1); len(attrs) > 0 {
+		sep = attrs[len(attrs)-1][1]
+	}
+	end := len(tag) - 1
+	if bytes.HasSuffix(tag, []byte("/>")) {
+		end--
+	}
+	// Keep whitespace before the end of the tag where it was
+	for end > 0 && bytes.IndexByte([]byte(" \t\r\n"), tag[end-1]) >= 0 {
+		end--
+	}
+	return slices.Concat(tag[:end], sep, []byte(name+`="`+value+`"`), tag[end:])
+}
@@ -0,0 +1,266 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ElectronIcons are the icon paths of an electron-builder config by
+// platform. Empty paths leave that platform's icon alone.
+type ElectronIcons struct {
+	Mac, Win, Linux string
+}
+
+// ElectronBuilder sets the mac.icon, win.icon and linux.icon fields of an
+// electron-builder config: the build field of a package.json, or an
+// electron-builder.json, .yml or .yaml file, picked by the file name.
+func ElectronBuilder(name string, data []byte, icons ElectronIcons) ([]byte, error) {
+	switch base := filepath.Base(name); {
+	case base == "package.json":
+		return electronJSON(data, "build", icons)
+	case strings.HasSuffix(base, ".json"):
+		return electronJSON(data, "", icons)
+	case strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml"):
+		return electronYAML(data, icons)
+	default:
+		return nil, fmt.Errorf("unsupported electron-builder config %s; use package.json, JSON or YAML", base)
+	}
+}
+
+// platforms pairs the electron-builder platform keys with their icons.
+func (icons ElectronIcons) platforms() [][2]string {
+	return [][2]string{{"mac", icons.Mac}, {"win", icons.Win}, {"linux", icons.Linux}}
+}
+
+// electronJSON sets the icons in a JSON config, under the top-level field
+// build when set. Key order and the file's indentation are kept.
+func electronJSON(data []byte, build string, icons ElectronIcons) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	root, err := parseJSON(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if root.kind != '{' {
+		return nil, errors.New("invalid config: the root is not an object")
+	}
+
+	config := root
+	if build != "" {
+		if config = root.object(build); config == nil {
+			return nil, fmt.Errorf("%s is not an object", build)
+		}
+	}
+	for _, p := range icons.platforms() {
+		if p[1] == "" {
+			continue
+		}
+		platform := config.object(p[0])
+		if platform == nil {
+			return nil, fmt.Errorf("%s is not an object", p[0])
+		}
+		value, _ := json.Marshal(p[1])
+		platform.set("icon", &jsonNode{raw: value})
+	}
+
+	var buf bytes.Buffer
+	root.write(&buf, jsonIndent(data), 0)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// jsonIndentation matches the indentation of the first nested line of a
+// JSON file.
+var jsonIndentation = regexp.MustCompile(`\n([ \t]+)\S`)
+
+// jsonIndent returns the indentation a JSON file uses, so edits keep it: two
+// spaces unless the file says otherwise.
+func jsonIndent(data []byte) string {
+	if m := jsonIndentation.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	return "  "
+}
+
+// jsonNode is a JSON value that keeps the order of object keys: an object
+// ('{') with keys and values, an array ('[') with values, or a scalar kept as
+// its raw encoding.
+type jsonNode struct {
+	kind   byte
+	keys   []string
+	values []*jsonNode
+	raw    []byte
+}
+
+// object returns the object under key, adding an empty one if the key is
+// missing. It returns nil if the key holds another kind of value.
+func (n *jsonNode) object(key string) *jsonNode {
+	for i, k := range n.keys {
+		if k == key {
+			if n.values[i].kind != '{' {
+				return nil
+			}
+			return n.values[i]
+		}
+	}
+	o := &jsonNode{kind: '{'}
+	n.set(key, o)
+	return o
+}
+
+// set replaces the value of key, or appends the key.
+func (n *jsonNode) set(key string, v *jsonNode) {
+	for i, k := range n.keys {
+		if k == key {
+			n.values[i] = v
+			return
+		}
+	}
+	n.keys = append(n.keys, key)
+	n.values = append(n.values, v)
+}
+
+// write writes the node, indenting nested values.
+func (n *jsonNode) write(buf *bytes.Buffer, indent string, depth int) {
+	if n.kind == 0 {
+		buf.Write(n.raw)
+		return
+	}
+	closing := byte('}')
+	if n.kind == '[' {
+		closing = ']'
+	}
+	buf.WriteByte(n.kind)
+	for i, v := range n.values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("\n" + strings.Repeat(indent, depth+1))
+		if n.kind == '{' {
+			key, _ := json.Marshal(n.keys[i])
+			buf.Write(key)
+			buf.WriteString(": ")
+		}
+		v.write(buf, indent, depth+1)
+	}
+	if len(n.values) > 0 {
+		buf.WriteString("\n" + strings.Repeat(indent, depth))
+	}
+	buf.WriteByte(closing)
+}
+
+// parseJSON parses the next value from d.
+func parseJSON(d *json.Decoder) (*jsonNode, error) {
+	tok, err := d.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(tok); err != nil {
+			return nil, err
+		}
+		return &jsonNode{raw: bytes.TrimSuffix(buf.Bytes(), []byte("\n"))}, nil
+	}
+
+	n := &jsonNode{kind: byte(delim)}
+	for d.More() {
+		if n.kind == '{' {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+		}
+		v, err := parseJSON(d)
+		if err != nil {
+			return nil, err
+		}
+		n.values = append(n.values, v)
+	}
+	// Consume the closing delimiter
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// yamlPlain matches the values that need no quotes in YAML.
+var yamlPlain = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// electronYAML sets the icons in a YAML config. The file is edited line by
+// line, so comments and formatting are kept; the platform keys must be block
+// mappings at the top level, or absent.
+func electronYAML(data []byte, icons ElectronIcons) ([]byte, error) {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, p := range icons.platforms() {
+		if p[1] == "" {
+			continue
+		}
+		value := p[1]
+		if !yamlPlain.MatchString(value) {
+			quoted, _ := json.Marshal(value)
+			value = string(quoted)
+		}
+
+		var err error
+		if lines, err = setYAMLIcon(lines, p[0], value); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// setYAMLIcon sets the icon key of the top-level mapping platform.
+func setYAMLIcon(lines []string, platform, value string) ([]string, error) {
+	keyLine := regexp.MustCompile(`^` + platform + `:\s*(#.*)?$`)
+	start := -1
+	for i, line := range lines {
+		if keyLine.MatchString(line) {
+			start = i
+			break
+		}
+		if strings.HasPrefix(line, platform+":") {
+			return nil, fmt.Errorf("%s is not a block mapping; set its icon manually", platform)
+		}
+	}
+	if start < 0 {
+		return append(lines, platform+":", "  icon: "+value), nil
+	}
+
+	// The mapping runs until the next line that is not indented
+	indent := ""
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if len(trimmed) == len(lines[i]) {
+			break
+		}
+		if indent == "" {
+			indent = lines[i][:len(lines[i])-len(trimmed)]
+		}
+		if lines[i][:len(lines[i])-len(trimmed)] == indent && strings.HasPrefix(trimmed, "icon:") {
+			lines[i] = indent + "icon: " + value
+			return lines, nil
+		}
+	}
+	if indent == "" {
+		indent = "  "
+	}
+	lines = append(lines[:start+1], append([]string{indent + "icon: " + value}, lines[start+1:]...)...)
+	return lines, nil
+}
@@ -0,0 +1,26 @@
+// Package patch updates the app manifests and build configs that reference
+// icons, so they point at generated files. Edits are made in place, keeping
+// the rest of each file as it was written.
+package patch
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// Require reports the names that are not among generated, so a file is never
+// pointed at an icon the run did not produce.
+func Require(generated []string, names ...string) error {
+	for _, name := range names {
+		if !slices.Contains(generated, name) {
+			return fmt.Errorf("%s is not generated by this config", name)
+		}
+	}
+	return nil
+}
+
+// trimExt returns name without its extension.
+func trimExt(name string) string {
+	return name[:len(name)-len(path.Ext(name))]
+}
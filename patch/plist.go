@@ -0,0 +1,219 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// InfoPlist sets the CFBundleIconFiles of the primary icon in CFBundleIcons
+// to the PNG outputs among names, without their extensions and @2x or @3x
+// scale suffixes as iOS expects. The rest of the property list is kept, and
+// it is written back in the format Xcode uses.
+func InfoPlist(data []byte, names []string) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("bplist")) {
+		return nil, errors.New("binary property lists are not supported; convert it with plutil -convert xml1")
+	}
+	root, err := parsePlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid property list: %w", err)
+	}
+	if root.kind != "dict" {
+		return nil, errors.New("invalid property list: the root is not a dictionary")
+	}
+
+	files := &plistNode{kind: "array"}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !strings.EqualFold(path.Ext(name), ".png") {
+			continue
+		}
+		base := trimExt(name)
+		base = strings.TrimSuffix(strings.TrimSuffix(base, "@2x"), "@3x")
+		if !seen[base] {
+			seen[base] = true
+			files.values = append(files.values, &plistNode{kind: "string", text: base})
+		}
+	}
+	if len(files.values) == 0 {
+		return nil, errors.New("no PNG outputs to list in CFBundleIconFiles")
+	}
+
+	icons := root.dict("CFBundleIcons")
+	if icons == nil {
+		return nil, errors.New("CFBundleIcons is not a dictionary")
+	}
+	primary := icons.dict("CFBundlePrimaryIcon")
+	if primary == nil {
+		return nil, errors.New("CFBundlePrimaryIcon is not a dictionary")
+	}
+	primary.set("CFBundleIconFiles", files)
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buf.WriteString(`<plist version="1.0">` + "\n")
+	root.write(&buf, 0)
+	buf.WriteString("</plist>\n")
+	return buf.Bytes(), nil
+}
+
+// plistNode is a property list value: a dict with keys and values, an array
+// with values, or a scalar element (string, integer, real, date, data, true
+// or false) with its text.
+type plistNode struct {
+	kind   string
+	text   string
+	keys   []string
+	values []*plistNode
+}
+
+// dict returns the dictionary under key, adding an empty one if the key is
+// missing. It returns nil if the key holds another kind of value.
+func (n *plistNode) dict(key string) *plistNode {
+	for i, k := range n.keys {
+		if k == key {
+			if n.values[i].kind != "dict" {
+				return nil
+			}
+			return n.values[i]
+		}
+	}
+	d := &plistNode{kind: "dict"}
+	n.set(key, d)
+	return d
+}
+
+// set replaces the value of key, or appends the key.
+func (n *plistNode) set(key string, v *plistNode) {
+	for i, k := range n.keys {
+		if k == key {
+			n.values[i] = v
+			return
+		}
+	}
+	n.keys = append(n.keys, key)
+	n.values = append(n.values, v)
+}
+
+// write writes the node indented by depth tabs.
+func (n *plistNode) write(buf *bytes.Buffer, depth int) {
+	indent := strings.Repeat("\t", depth)
+	switch n.kind {
+	case "dict", "array":
+		if len(n.values) == 0 {
+			buf.WriteString(indent + "<" + n.kind + "/>\n")
+			return
+		}
+		buf.WriteString(indent + "<" + n.kind + ">\n")
+		for i, v := range n.values {
+			if n.kind == "dict" {
+				buf.WriteString(indent + "\t<key>" + escapeText(n.keys[i]) + "</key>\n")
+			}
+			v.write(buf, depth+1)
+		}
+		buf.WriteString(indent + "</" + n.kind + ">\n")
+	case "true", "false":
+		buf.WriteString(indent + "<" + n.kind + "/>\n")
+	default:
+		buf.WriteString(indent + "<" + n.kind + ">" + escapeText(n.text) + "</" + n.kind + ">\n")
+	}
+}
+
+// escapeText escapes the characters XML text cannot contain, as Xcode does.
+func escapeText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// parsePlist parses the root value of an XML property list.
+func parsePlist(data []byte) (*plistNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		start, err := nextElement(d)
+		if err != nil {
+			return nil, err
+		}
+		if start == nil {
+			return nil, errors.New("unexpected end of element")
+		}
+		if start.Name.Local != "plist" {
+			return parseValue(d, *start)
+		}
+	}
+}
+
+// nextElement returns the next start element, or nil at the end of the
+// enclosing element.
+func nextElement(d *xml.Decoder) (*xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return &t, nil
+		case xml.EndElement:
+			return nil, nil
+		}
+	}
+}
+
+// parseValue parses the value whose start element was just read.
+func parseValue(d *xml.Decoder, start xml.StartElement) (*plistNode, error) {
+	n := &plistNode{kind: start.Name.Local}
+	switch n.kind {
+	case "dict":
+		for {
+			key, err := nextElement(d)
+			if err != nil || key == nil {
+				return n, err
+			}
+			if key.Name.Local != "key" {
+				return nil, fmt.Errorf("expected <key>, found <%s>", key.Name.Local)
+			}
+			var name string
+			if err := d.DecodeElement(&name, key); err != nil {
+				return nil, err
+			}
+			elem, err := nextElement(d)
+			if err != nil {
+				return nil, err
+			}
+			if elem == nil {
+				return nil, fmt.Errorf("key %s has no value", name)
+			}
+			v, err := parseValue(d, *elem)
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, name)
+			n.values = append(n.values, v)
+		}
+	case "array":
+		for {
+			elem, err := nextElement(d)
+			if err != nil || elem == nil {
+				return n, err
+			}
+			v, err := parseValue(d, *elem)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+		}
+	case "true", "false":
+		return n, d.Skip()
+	case "string", "integer", "real", "date", "data":
+		return n, d.DecodeElement(&n.text, &start)
+	default:
+		return nil, fmt.Errorf("unknown element <%s>", n.kind)
+	}
+}
@@ -0,0 +1,58 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WebManifestIcon is an entry of a web app manifest's icons.
+type WebManifestIcon struct {
+	Src     string `json:"src"`
+	Sizes   string `json:"sizes"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// WebManifest sets the icons, theme_color and background_color of a web app
+// manifest such as site.webmanifest, keeping its other fields, key order and
+// indentation. Empty data starts a new manifest. Nil icons and empty colors
+// leave those fields alone.
+func WebManifest(data []byte, icons []WebManifestIcon, themeColor, backgroundColor string) ([]byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}")
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	root, err := parseJSON(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if root.kind != '{' {
+		return nil, errors.New("invalid web manifest: the root is not an object")
+	}
+
+	if icons != nil {
+		encoded, err := json.Marshal(icons)
+		if err != nil {
+			return nil, err
+		}
+		node, err := parseJSON(json.NewDecoder(bytes.NewReader(encoded)))
+		if err != nil {
+			return nil, err
+		}
+		root.set("icons", node)
+	}
+	for _, field := range [][2]string{{"theme_color", themeColor}, {"background_color", backgroundColor}} {
+		if field[1] != "" {
+			value, _ := json.Marshal(field[1])
+			root.set(field[0], &jsonNode{raw: value})
+		}
+	}
+
+	var buf bytes.Buffer
+	root.write(&buf, jsonIndent(data), 0)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
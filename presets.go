@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runPresets lists the built-in presets, or prints one as a config file that
+// can be saved and customized with -config.
+func runPresets(args []string) {
+	fs := flag.NewFlagSet("presets", flag.ExitOnError)
+	fs.Parse(args)
+
+	switch fs.NArg() {
+	case 0:
+		for _, preset := range imageprocessor.Presets() {
+			fmt.Printf("%-10s %3d outputs  %s\n", preset.Name, len(preset.Dimensions), preset.Description)
+		}
+		fmt.Println("\nEncoder profiles, for -encoder and the encoder field of config entries:")
+		for _, name := range imageprocessor.EncoderProfileNames() {
+			fmt.Printf("%-10s %s\n", name, imageprocessor.EncoderProfiles[name].Description)
+		}
+	case 1:
+		dims, err := imageprocessor.LoadPreset(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		cfg := imageprocessor.Config{Version: imageprocessor.ConfigVersion, Dimensions: dims}
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		os.Stdout.Write(append(data, '\n'))
+	default:
+		log.Fatal("Usage: logo-generator presets [name]")
+	}
+}
@@ -0,0 +1,522 @@
+package press
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Intents lists the rendering intents a Profile can convert with, and the
+// ICC tags holding them.
+var Intents = []string{"perceptual", "relative", "saturation"}
+
+var intentTags = map[string]string{
+	"perceptual": "B2A0",
+	"relative":   "B2A1",
+	"saturation": "B2A2",
+}
+
+// Profile is an ICC output profile of a CMYK printing condition, such as
+// the FOGRA or GRACoL profile a print shop supplies.
+type Profile struct {
+	Description string
+	// Data is the profile as read, embedded in the files written with it.
+	Data []byte
+
+	lab bool
+	lut *lut
+}
+
+// LoadProfile parses an ICC profile of a CMYK output device and reads the
+// table converting to its inks with the given intent. Profiles without
+// that table use the perceptual one, as the ICC specification says.
+func LoadProfile(data []byte, intent string) (*Profile, error) {
+	tag, ok := intentTags[intent]
+	if !ok {
+		return nil, fmt.Errorf("unknown rendering intent %q, want one of %v", intent, Intents)
+	}
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("not an ICC profile")
+	}
+	if space := string(data[16:20]); space != "CMYK" {
+		return nil, fmt.Errorf("the profile converts to %q, not CMYK", space)
+	}
+	p := &Profile{Description: imageprocessor.ICCDescription(data), Data: data}
+	switch string(data[20:24]) {
+	case "Lab ":
+		p.lab = true
+	case "XYZ ":
+	default:
+		return nil, fmt.Errorf("unsupported profile connection space %q", data[20:24])
+	}
+
+	table := findTag(data, tag)
+	if table == nil {
+		tag = "B2A0"
+		table = findTag(data, tag)
+	}
+	if table == nil {
+		return nil, fmt.Errorf("the profile has no table converting to CMYK")
+	}
+	var err error
+	if p.lut, err = parseLUT(table, p.lab); err != nil {
+		return nil, fmt.Errorf("%s: %w", tag, err)
+	}
+	if len(p.lut.clut.points) != 3 || p.lut.clut.out != 4 {
+		return nil, fmt.Errorf("%s: the table converts %d channels to %d, want 3 to 4", tag, len(p.lut.clut.points), p.lut.clut.out)
+	}
+	return p, nil
+}
+
+// findTag returns the data of the tag with the signature sig, or nil.
+func findTag(data []byte, sig string) []byte {
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := range count {
+		t := 132 + 12*i
+		if t+12 > len(data) {
+			break
+		}
+		if string(data[t:t+4]) != sig {
+			continue
+		}
+		off, size := int(binary.BigEndian.Uint32(data[t+4:])), int(binary.BigEndian.Uint32(data[t+8:]))
+		if off < 0 || size < 12 || off > len(data)-size {
+			return nil
+		}
+		return data[off : off+size]
+	}
+	return nil
+}
+
+// convert converts an sRGB color to the profile's inks.
+func (p *Profile) convert(rgb [3]uint8) [4]uint8 {
+	x, y, z := srgbToXYZ(rgb)
+	var in [3]float64
+	if p.lab {
+		l, a, b := xyzToLab(x, y, z)
+		in = p.lut.encodeLab(l, a, b)
+	} else {
+		// XYZ is encoded as u1Fixed15 numbers, with 1.0 at 0x8000
+		in = [3]float64{x * 0x8000 / 0xffff, y * 0x8000 / 0xffff, z * 0x8000 / 0xffff}
+	}
+	var ink [4]uint8
+	for i, v := range p.lut.eval(in[:]) {
+		ink[i] = uint8(math.Round(min(max(v, 0), 1) * 0xff))
+	}
+	return ink
+}
+
+// srgbToXYZ converts an sRGB color to XYZ adapted to the D50 white of the
+// profile connection space.
+func srgbToXYZ(rgb [3]uint8) (x, y, z float64) {
+	var lin [3]float64
+	for i, c := range rgb {
+		v := float64(c) / 0xff
+		if v <= 0.04045 {
+			lin[i] = v / 12.92
+		} else {
+			lin[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	x = 0.4360747*lin[0] + 0.3850649*lin[1] + 0.1430804*lin[2]
+	y = 0.2225045*lin[0] + 0.7168786*lin[1] + 0.0606169*lin[2]
+	z = 0.0139322*lin[0] + 0.0971045*lin[1] + 0.7141733*lin[2]
+	return x, y, z
+}
+
+// xyzToLab converts a D50 XYZ color to CIELAB.
+func xyzToLab(x, y, z float64) (l, a, b float64) {
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return t*24389/27/116 + 16.0/116
+	}
+	fx, fy, fz := f(x/0.9642), f(y), f(z/0.8249)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// lut is a table converting from the profile connection space, in the
+// order of a lutBToAType: B curves, a matrix, M curves, a color lookup
+// table and A curves. Stages a table type lacks are nil.
+type lut struct {
+	// legacy marks lut16Type tables, which encode Lab with L* 100 at 0xff00.
+	legacy bool
+	b      []curve
+	matrix []float64
+	m      []curve
+	clut   clut
+	a      []curve
+}
+
+// curve maps a channel from 0 to 1 onto 0 to 1.
+type curve func(float64) float64
+
+// encodeLab encodes a Lab color as the table's inputs, from 0 to 1.
+func (t *lut) encodeLab(l, a, b float64) [3]float64 {
+	if t.legacy {
+		return [3]float64{l / 100 * 0xff00 / 0xffff, (a + 128) * 0x100 / 0xffff, (b + 128) * 0x100 / 0xffff}
+	}
+	return [3]float64{l / 100, (a + 128) / 0xff, (b + 128) / 0xff}
+}
+
+// eval runs the inputs through each stage of the table.
+func (t *lut) eval(in []float64) []float64 {
+	var buf [16]float64
+	v := buf[:len(in)]
+	copy(v, in)
+	for i, c := range t.b {
+		v[i] = c(clamp(v[i]))
+	}
+	if t.matrix != nil {
+		var r [3]float64
+		for i := range 3 {
+			r[i] = t.matrix[3*i]*v[0] + t.matrix[3*i+1]*v[1] + t.matrix[3*i+2]*v[2]
+			if len(t.matrix) == 12 {
+				r[i] += t.matrix[9+i]
+			}
+		}
+		copy(v, r[:])
+	}
+	for i, c := range t.m {
+		v[i] = c(clamp(v[i]))
+	}
+	out := t.clut.eval(v)
+	for i, c := range t.a {
+		out[i] = c(clamp(out[i]))
+	}
+	return out
+}
+
+// clamp limits v to the range from 0 to 1.
+func clamp(v float64) float64 {
+	return min(max(v, 0), 1)
+}
+
+// clut is a multidimensional color lookup table, interpolated linearly.
+type clut struct {
+	points []int
+	out    int
+	// values holds the output channels of every grid point, with the first
+	// input varying slowest.
+	values []float64
+}
+
+// eval interpolates the outputs of the table at the inputs, each from 0
+// to 1, between the corners of the grid cell around them.
+func (g *clut) eval(in []float64) []float64 {
+	n := len(g.points)
+	base := 0
+	stride := g.out
+	var frac [16]float64
+	var step [16]int
+	for d := n - 1; d >= 0; d-- {
+		pos := clamp(in[d]) * float64(g.points[d]-1)
+		i := min(int(pos), max(g.points[d]-2, 0))
+		frac[d] = pos - float64(i)
+		base += i * stride
+		if g.points[d] > 1 {
+			step[d] = stride
+		}
+		stride *= g.points[d]
+	}
+
+	out := make([]float64, g.out)
+	for corner := range 1 << n {
+		weight, at := 1.0, base
+		for d := range n {
+			if corner&(1<<d) != 0 {
+				weight *= frac[d]
+				at += step[d]
+			} else {
+				weight *= 1 - frac[d]
+			}
+		}
+		if weight == 0 {
+			continue
+		}
+		for c := range g.out {
+			out[c] += weight * g.values[at+c]
+		}
+	}
+	return out
+}
+
+// parseLUT parses a lut8Type, lut16Type or lutBToAType table.
+func parseLUT(tag []byte, lab bool) (*lut, error) {
+	if len(tag) < 32 {
+		return nil, fmt.Errorf("truncated table")
+	}
+	in, out := int(tag[8]), int(tag[9])
+	if in < 1 || in > 15 || out < 1 || out > 15 {
+		return nil, fmt.Errorf("invalid table of %d inputs and %d outputs", in, out)
+	}
+	switch string(tag[:4]) {
+	case "mft1", "mft2":
+		return parseMFT(tag, in, out, lab)
+	case "mBA ":
+		return parseMBA(tag, in, out)
+	default:
+		return nil, fmt.Errorf("unsupported table type %q", tag[:4])
+	}
+}
+
+// parseMFT parses a lut8Type or lut16Type table: a matrix used with XYZ,
+// input tables, a lookup table with the same number of points on every
+// side, and output tables.
+func parseMFT(tag []byte, in, out int, lab bool) (*lut, error) {
+	wide := string(tag[:4]) == "mft2"
+	t := &lut{legacy: wide}
+	if len(tag) < 52 {
+		return nil, fmt.Errorf("truncated table")
+	}
+	if !lab {
+		t.matrix = make([]float64, 9)
+		for i := range t.matrix {
+			t.matrix[i] = s15Fixed16(tag[12+4*i:])
+		}
+	}
+
+	size, inEntries, outEntries, at := 1, 256, 256, 48
+	if wide {
+		size = 2
+		inEntries, outEntries = int(binary.BigEndian.Uint16(tag[48:])), int(binary.BigEndian.Uint16(tag[50:]))
+		at = 52
+		if inEntries < 2 || outEntries < 2 {
+			return nil, fmt.Errorf("tables need at least 2 entries")
+		}
+	}
+	read := func(n int) ([]float64, error) {
+		if n > (len(tag)-at)/size {
+			return nil, fmt.Errorf("truncated table")
+		}
+		values := make([]float64, n)
+		for i := range values {
+			if wide {
+				values[i] = float64(binary.BigEndian.Uint16(tag[at+2*i:])) / 0xffff
+			} else {
+				values[i] = float64(tag[at+i]) / 0xff
+			}
+		}
+		at += n * size
+		return values, nil
+	}
+
+	for range in {
+		table, err := read(inEntries)
+		if err != nil {
+			return nil, err
+		}
+		t.m = append(t.m, sampled(table))
+	}
+	points := make([]int, in)
+	for i := range points {
+		points[i] = int(tag[10])
+	}
+	var err error
+	if t.clut, err = newCLUT(points, out, read); err != nil {
+		return nil, err
+	}
+	for range out {
+		table, err := read(outEntries)
+		if err != nil {
+			return nil, err
+		}
+		t.a = append(t.a, sampled(table))
+	}
+	return t, nil
+}
+
+// parseMBA parses a lutBToAType table, whose stages are each optional and
+// found at offsets in its header.
+func parseMBA(tag []byte, in, out int) (*lut, error) {
+	t := &lut{}
+	offset := func(i int) int { return int(binary.BigEndian.Uint32(tag[12+4*i:])) }
+	var err error
+	if off := offset(0); off != 0 {
+		if t.b, err = parseCurves(tag, off, in); err != nil {
+			return nil, err
+		}
+	}
+	if off := offset(1); off != 0 {
+		if in != 3 || off < 0 || off > len(tag)-48 {
+			return nil, fmt.Errorf("invalid matrix")
+		}
+		t.matrix = make([]float64, 12)
+		for i := range t.matrix {
+			t.matrix[i] = s15Fixed16(tag[off+4*i:])
+		}
+	}
+	if off := offset(2); off != 0 {
+		if t.m, err = parseCurves(tag, off, in); err != nil {
+			return nil, err
+		}
+	}
+
+	off := offset(3)
+	if off == 0 {
+		return nil, fmt.Errorf("tables without a color lookup table are not supported")
+	}
+	if off < 0 || off > len(tag)-20 {
+		return nil, fmt.Errorf("truncated table")
+	}
+	points := make([]int, in)
+	for i := range points {
+		points[i] = int(tag[off+i])
+	}
+	size, at := int(tag[off+16]), off+20
+	if size != 1 && size != 2 {
+		return nil, fmt.Errorf("invalid lookup table precision %d", size)
+	}
+	read := func(n int) ([]float64, error) {
+		if n > (len(tag)-at)/size {
+			return nil, fmt.Errorf("truncated table")
+		}
+		values := make([]float64, n)
+		for i := range values {
+			if size == 2 {
+				values[i] = float64(binary.BigEndian.Uint16(tag[at+2*i:])) / 0xffff
+			} else {
+				values[i] = float64(tag[at+i]) / 0xff
+			}
+		}
+		return values, nil
+	}
+	if t.clut, err = newCLUT(points, out, read); err != nil {
+		return nil, err
+	}
+
+	if off := offset(4); off != 0 {
+		if t.a, err = parseCurves(tag, off, out); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// newCLUT reads a lookup table with the given points per input.
+func newCLUT(points []int, out int, read func(n int) ([]float64, error)) (clut, error) {
+	n := out
+	for _, p := range points {
+		if p < 1 {
+			return clut{}, fmt.Errorf("lookup tables need at least one point per input")
+		}
+		if n *= p; n > 1<<24 {
+			return clut{}, fmt.Errorf("lookup table too large")
+		}
+	}
+	values, err := read(n)
+	if err != nil {
+		return clut{}, err
+	}
+	return clut{points: slices.Clone(points), out: out, values: values}, nil
+}
+
+// parseCurves parses n curves stored one after another from off, each
+// padded to four bytes.
+func parseCurves(tag []byte, off, n int) ([]curve, error) {
+	curves := make([]curve, n)
+	for i := range curves {
+		if off < 0 || off > len(tag)-12 {
+			return nil, fmt.Errorf("truncated curve")
+		}
+		var size int
+		switch string(tag[off : off+4]) {
+		case "curv":
+			count := int(binary.BigEndian.Uint32(tag[off+8:]))
+			if count > (len(tag)-off-12)/2 {
+				return nil, fmt.Errorf("truncated curve")
+			}
+			size = 12 + 2*count
+			switch count {
+			case 0:
+				curves[i] = func(x float64) float64 { return x }
+			case 1:
+				gamma := float64(binary.BigEndian.Uint16(tag[off+12:])) / 0x100
+				curves[i] = func(x float64) float64 { return math.Pow(x, gamma) }
+			default:
+				table := make([]float64, count)
+				for j := range table {
+					table[j] = float64(binary.BigEndian.Uint16(tag[off+12+2*j:])) / 0xffff
+				}
+				curves[i] = sampled(table)
+			}
+		case "para":
+			kind := int(binary.BigEndian.Uint16(tag[off+8:]))
+			counts := []int{1, 3, 4, 5, 7}
+			if kind >= len(counts) {
+				return nil, fmt.Errorf("unknown parametric curve type %d", kind)
+			}
+			size = 12 + 4*counts[kind]
+			if size > len(tag)-off {
+				return nil, fmt.Errorf("truncated curve")
+			}
+			var p [7]float64
+			for j := range counts[kind] {
+				p[j] = s15Fixed16(tag[off+12+4*j:])
+			}
+			curves[i] = parametric(kind, p)
+		default:
+			return nil, fmt.Errorf("unsupported curve type %q", tag[off:off+4])
+		}
+		off += (size + 3) &^ 3
+	}
+	return curves, nil
+}
+
+// parametric returns a parametricCurveType function of the given type,
+// with the parameters g, a, b, c, d, e and f in order.
+func parametric(kind int, p [7]float64) curve {
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	pow := func(x float64) float64 { return math.Pow(max(x, 0), g) }
+	switch kind {
+	case 1:
+		return func(x float64) float64 {
+			if x >= -b/a {
+				return pow(a*x + b)
+			}
+			return 0
+		}
+	case 2:
+		return func(x float64) float64 {
+			if x >= -b/a {
+				return pow(a*x+b) + c
+			}
+			return c
+		}
+	case 3:
+		return func(x float64) float64 {
+			if x >= d {
+				return pow(a*x + b)
+			}
+			return c * x
+		}
+	case 4:
+		return func(x float64) float64 {
+			if x >= d {
+				return pow(a*x+b) + e
+			}
+			return c*x + f
+		}
+	default:
+		return func(x float64) float64 { return math.Pow(x, g) }
+	}
+}
+
+// sampled returns a curve interpolating linearly between evenly spaced
+// samples.
+func sampled(table []float64) curve {
+	return func(x float64) float64 {
+		pos := clamp(x) * float64(len(table)-1)
+		i := min(int(pos), len(table)-2)
+		return table[i] + (pos-float64(i))*(table[i+1]-table[i])
+	}
+}
+
+// s15Fixed16 decodes a signed 15.16 fixed point number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 0x10000
+}
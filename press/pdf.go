@@ -0,0 +1,87 @@
+package press
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+)
+
+// EncodePDF writes img as a single-page PDF of width by height points, the
+// image filling the page. With a profile, the image's colors are tagged
+// with it; otherwise they are device CMYK.
+func EncodePDF(w io.Writer, img *image.CMYK, width, height float64, profile *Profile) error {
+	b := img.Bounds()
+	pixels, err := deflate(img.Pix)
+	if err != nil {
+		return err
+	}
+	pageSize := fmt.Sprintf("[0 0 %s %s]", pdfNumber(width), pdfNumber(height))
+	colorSpace := "/DeviceCMYK"
+	if profile != nil {
+		colorSpace = "[/ICCBased 6 0 R]"
+	}
+	content := fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q\n", pdfNumber(width), pdfNumber(height))
+
+	// Objects are numbered from 1 in order; the profile, when there is one,
+	// comes last
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox %s /TrimBox %s /Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", pageSize, pageSize),
+		pdfStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode", b.Dx(), b.Dy(), colorSpace), pixels),
+		pdfStream("", []byte(content)),
+	}
+	if profile != nil {
+		data, err := deflate(profile.Data)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, pdfStream("/N 4 /Alternate /DeviceCMYK /Filter /FlateDecode", data))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// pdfStream returns a stream object with the given dictionary entries.
+func pdfStream(dict string, data []byte) string {
+	if dict != "" {
+		dict += " "
+	}
+	return fmt.Sprintf("<< %s/Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// pdfNumber formats a length in points to a thousandth of a point.
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// deflate compresses data for the FlateDecode filter.
+func deflate(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
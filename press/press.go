@@ -0,0 +1,95 @@
+// Package press converts rendered logos to CMYK and writes them as print
+// deliverables: TIFF images and single-page PDFs at physical sizes.
+package press
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Points per unit accepted by ParseSize. PDF measures pages in points,
+// 72 to the inch.
+var sizeUnits = []struct {
+	suffix string
+	points float64
+}{
+	{"mm", 72 / 25.4},
+	{"cm", 72 / 2.54},
+	{"in", 72},
+	{"pt", 1},
+}
+
+// ParseSize parses a physical size such as "85x55mm", "3.5x2in" or
+// "200x200pt" and returns its width and height in points.
+func ParseSize(s string) (width, height float64, err error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	for _, unit := range sizeUnits {
+		if !strings.HasSuffix(value, unit.suffix) {
+			continue
+		}
+		w, h, ok := strings.Cut(strings.TrimSuffix(value, unit.suffix), "x")
+		width, err1 := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		height, err2 := strconv.ParseFloat(strings.TrimSpace(h), 64)
+		if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+			break
+		}
+		return width * unit.points, height * unit.points, nil
+	}
+	return 0, 0, fmt.Errorf("invalid size %q, want WIDTHxHEIGHT with a unit of mm, cm, in or pt, e.g. 85x55mm", s)
+}
+
+// Pixels returns the pixel size of a print of width by height points at
+// dpi dots per inch.
+func Pixels(width, height, dpi float64) (int, int) {
+	return max(int(math.Round(width/72*dpi)), 1), max(int(math.Round(height/72*dpi)), 1)
+}
+
+// ToCMYK flattens img over white paper and converts it to CMYK with the
+// profile, or when it is nil, with a naive conversion that puts all of the
+// gray in the black ink; that is fine for proofs, but only the printer's
+// profile matches what the press will print.
+func ToCMYK(img *image.RGBA, profile *Profile) *image.CMYK {
+	flat := imageprocessor.FlattenOverWhite(img)
+	b := flat.Bounds()
+	out := image.NewCMYK(image.Rect(0, 0, b.Dx(), b.Dy()))
+
+	// Logos have few colors, so convert each one once
+	cache := map[[3]uint8][4]uint8{}
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			i := y*flat.Stride + x*4
+			rgb := [3]uint8{flat.Pix[i], flat.Pix[i+1], flat.Pix[i+2]}
+			ink, ok := cache[rgb]
+			if !ok {
+				if profile != nil {
+					ink = profile.convert(rgb)
+				} else {
+					ink = naiveCMYK(rgb)
+				}
+				cache[rgb] = ink
+			}
+			copy(out.Pix[y*out.Stride+x*4:], ink[:])
+		}
+	}
+	return out
+}
+
+// naiveCMYK converts an sRGB color to CMYK by taking the black ink from
+// its darkest channel, with no ink limit or dot gain compensation.
+func naiveCMYK(rgb [3]uint8) [4]uint8 {
+	k := 0xff - max(rgb[0], rgb[1], rgb[2])
+	if k == 0xff {
+		return [4]uint8{0, 0, 0, 0xff}
+	}
+	var ink [4]uint8
+	for c := range 3 {
+		ink[c] = uint8((int(0xff-rgb[c]-k)*0xff + int(0xff-k)/2) / int(0xff-k))
+	}
+	ink[3] = k
+	return ink
+}
@@ -0,0 +1,262 @@
+package press
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Swatch is a named color of a spot color library, such as a Pantone or
+// HKS guide, in D50 CIELAB.
+type Swatch struct {
+	Name    string
+	L, A, B float64
+}
+
+// SpotMatch is the swatch nearest to a color and how far from it it is.
+type SpotMatch struct {
+	Swatch Swatch
+	// DeltaE is the CIEDE2000 difference; below 2 is hard to tell apart
+	// on paper.
+	DeltaE float64
+}
+
+// LoadSwatches parses a spot color library by its file name's extension:
+//   - ".ase": an Adobe Swatch Exchange file, as design tools export their
+//     color books; swatches defined in Lab or RGB are read, and CMYK and
+//     gray ones are skipped, as their look depends on the press.
+//   - ".csv": rows of a name followed by either a #rrggbb color or its L,
+//     a and b values.
+func LoadSwatches(name string, data []byte) ([]Swatch, error) {
+	var swatches []Swatch
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".ase":
+		swatches, err = parseASE(data)
+	case ".csv":
+		swatches, err = parseSwatchCSV(data)
+	default:
+		return nil, fmt.Errorf("spot color libraries are read from .ase or .csv files, not %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(swatches) == 0 {
+		return nil, fmt.Errorf("the library holds no Lab or RGB swatches")
+	}
+	return swatches, nil
+}
+
+// parseASE reads the Lab and RGB color entries of an Adobe Swatch
+// Exchange file, in any group.
+func parseASE(data []byte) ([]Swatch, error) {
+	if len(data) < 12 || string(data[:4]) != "ASEF" {
+		return nil, fmt.Errorf("not an Adobe Swatch Exchange file")
+	}
+	blocks := binary.BigEndian.Uint32(data[8:])
+	r := bytes.NewReader(data[12:])
+	var swatches []Swatch
+	for range blocks {
+		var header struct {
+			Type   uint16
+			Length uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return nil, fmt.Errorf("truncated swatch file: %w", err)
+		}
+		if int64(header.Length) > int64(r.Len()) {
+			return nil, fmt.Errorf("truncated swatch file")
+		}
+		block := make([]byte, header.Length)
+		io.ReadFull(r, block)
+		// Only color entries matter; groups just organize them
+		if header.Type != 0x0001 {
+			continue
+		}
+		swatch, ok, err := parseASEColor(block)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			swatches = append(swatches, swatch)
+		}
+	}
+	return swatches, nil
+}
+
+// parseASEColor parses a color entry: its UTF-16 name, color model and
+// values. It reports false for entries in models other than Lab and RGB.
+func parseASEColor(block []byte) (Swatch, bool, error) {
+	if len(block) < 2 {
+		return Swatch{}, false, fmt.Errorf("truncated swatch entry")
+	}
+	// The name's length counts UTF-16 units, its terminating zero included
+	units := int(binary.BigEndian.Uint16(block))
+	if len(block) < 2+2*units+4 {
+		return Swatch{}, false, fmt.Errorf("truncated swatch entry")
+	}
+	name := make([]uint16, units)
+	for i := range name {
+		name[i] = binary.BigEndian.Uint16(block[2+2*i:])
+	}
+	swatch := Swatch{Name: strings.TrimRight(string(utf16.Decode(name)), "\x00")}
+	model, values := string(block[2+2*units:6+2*units]), block[6+2*units:]
+	value := func(i int) float64 {
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(values[4*i:])))
+	}
+	switch model {
+	case "LAB ":
+		if len(values) < 12 {
+			return Swatch{}, false, fmt.Errorf("truncated swatch %q", swatch.Name)
+		}
+		// Lightness is stored from 0 to 1
+		swatch.L, swatch.A, swatch.B = value(0)*100, value(1), value(2)
+	case "RGB ":
+		if len(values) < 12 {
+			return Swatch{}, false, fmt.Errorf("truncated swatch %q", swatch.Name)
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			rgb[i] = uint8(math.Round(clamp(value(i)) * 0xff))
+		}
+		swatch.L, swatch.A, swatch.B = xyzToLab(srgbToXYZ(rgb))
+	default:
+		return Swatch{}, false, nil
+	}
+	return swatch, true, nil
+}
+
+// parseSwatchCSV reads rows of a swatch name and its color, as #rrggbb or
+// as L, a and b values. A first row that is not a color is a header.
+func parseSwatchCSV(data []byte) ([]Swatch, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var swatches []Swatch
+	for i, row := range rows {
+		swatch, err := parseSwatchRow(row)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		swatches = append(swatches, swatch)
+	}
+	return swatches, nil
+}
+
+// parseSwatchRow parses a row of a swatch CSV file.
+func parseSwatchRow(row []string) (Swatch, error) {
+	switch len(row) {
+	case 2:
+		hex := strings.TrimPrefix(row[1], "#")
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return Swatch{}, fmt.Errorf("invalid color %q, want #rrggbb", row[1])
+		}
+		l, a, b := xyzToLab(srgbToXYZ([3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}))
+		return Swatch{Name: row[0], L: l, A: a, B: b}, nil
+	case 4:
+		var lab [3]float64
+		for i, s := range row[1:] {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return Swatch{}, fmt.Errorf("invalid Lab value %q", s)
+			}
+			lab[i] = v
+		}
+		return Swatch{Name: row[0], L: lab[0], A: lab[1], B: lab[2]}, nil
+	default:
+		return Swatch{}, fmt.Errorf("want a name and #rrggbb, or a name and L, a and b")
+	}
+}
+
+// NearestSwatch returns the swatch closest to an sRGB color, which must
+// not be empty.
+func NearestSwatch(rgb [3]uint8, swatches []Swatch) SpotMatch {
+	l, a, b := xyzToLab(srgbToXYZ(rgb))
+	best := SpotMatch{DeltaE: math.Inf(1)}
+	for _, s := range swatches {
+		if d := deltaE2000(l, a, b, s.L, s.A, s.B); d < best.DeltaE {
+			best = SpotMatch{Swatch: s, DeltaE: d}
+		}
+	}
+	return best
+}
+
+// PaperDeltaE returns the CIEDE2000 difference between an sRGB color and
+// white paper, where no ink is printed.
+func PaperDeltaE(rgb [3]uint8) float64 {
+	l, a, b := xyzToLab(srgbToXYZ(rgb))
+	return deltaE2000(l, a, b, 100, 0, 0)
+}
+
+// deltaE2000 returns the CIEDE2000 color difference between two Lab colors,
+// as Sharma, Wu and Dalal give it.
+func deltaE2000(l1, a1, b1, l2, a2, b2 float64) float64 {
+	rad := math.Pi / 180
+
+	// Stretch a to even out the chroma of near neutral colors
+	c := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2
+	g := 0.5 * (1 - math.Sqrt(math.Pow(c, 7)/(math.Pow(c, 7)+math.Pow(25, 7))))
+	a1, a2 = a1*(1+g), a2*(1+g)
+	c1, c2 := math.Hypot(a1, b1), math.Hypot(a2, b2)
+	hue := func(a, b float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) / rad
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1, h2 := hue(a1, b1), hue(a2, b2)
+
+	// Differences in lightness, chroma and hue
+	dl, dc := l2-l1, c2-c1
+	var dh float64
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(dh/2*rad)
+
+	// Means, with the mean hue taken the short way around
+	lm, cm := (l1+l2)/2, (c1+c2)/2
+	hm := h1 + h2
+	if c1*c2 != 0 {
+		switch {
+		case math.Abs(h1-h2) <= 180:
+			hm /= 2
+		case h1+h2 < 360:
+			hm = (hm + 360) / 2
+		default:
+			hm = (hm - 360) / 2
+		}
+	}
+
+	// Weight each difference by where the colors lie
+	t := 1 - 0.17*math.Cos((hm-30)*rad) + 0.24*math.Cos(2*hm*rad) + 0.32*math.Cos((3*hm+6)*rad) - 0.20*math.Cos((4*hm-63)*rad)
+	sl := 1 + 0.015*(lm-50)*(lm-50)/math.Sqrt(20+(lm-50)*(lm-50))
+	sc := 1 + 0.045*cm
+	sh := 1 + 0.015*cm*t
+	rt := -2 * math.Sqrt(math.Pow(cm, 7)/(math.Pow(cm, 7)+math.Pow(25, 7))) * math.Sin(60*math.Exp(-math.Pow((hm-275)/25, 2))*rad)
+	return math.Sqrt(math.Pow(dl/sl, 2) + math.Pow(dc/sc, 2) + math.Pow(dH/sh, 2) + rt*(dc/sc)*(dH/sh))
+}
@@ -0,0 +1,162 @@
+package press
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+)
+
+// TIFF tag types.
+const (
+	tiffASCII     = 2
+	tiffShort     = 3
+	tiffLong      = 4
+	tiffRational  = 5
+	tiffUndefined = 7
+)
+
+// tiffStripSize is the uncompressed size strips are cut at, as the TIFF
+// specification recommends.
+const tiffStripSize = 8 << 10
+
+// tiffEntry is an entry of a TIFF directory, with its values encoded.
+type tiffEntry struct {
+	tag, kind uint16
+	count     uint32
+	data      []byte
+}
+
+// EncodeTIFF writes img as a PackBits compressed CMYK TIFF whose resolution
+// makes it width by height points, embedding the profile when it is not
+// nil.
+func EncodeTIFF(w io.Writer, img *image.CMYK, width, height float64, profile *Profile) error {
+	b := img.Bounds()
+	pixWidth, pixHeight := b.Dx(), b.Dy()
+	rowsPerStrip := max(tiffStripSize/(pixWidth*4), 1)
+
+	// Compress the strips after the header, each row on its own
+	var data bytes.Buffer
+	data.Write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0})
+	var offsets, counts []uint32
+	for y := 0; y < pixHeight; y += rowsPerStrip {
+		start := data.Len()
+		for row := y; row < min(y+rowsPerStrip, pixHeight); row++ {
+			i := row * img.Stride
+			packBits(&data, img.Pix[i:i+pixWidth*4])
+		}
+		offsets = append(offsets, uint32(start))
+		counts = append(counts, uint32(data.Len()-start))
+	}
+	if data.Len()%2 != 0 {
+		data.WriteByte(0)
+	}
+
+	entries := []tiffEntry{
+		{tag: 256, kind: tiffLong, count: 1, data: longs(uint32(pixWidth))},
+		{tag: 257, kind: tiffLong, count: 1, data: longs(uint32(pixHeight))},
+		{tag: 258, kind: tiffShort, count: 4, data: shorts(8, 8, 8, 8)},
+		{tag: 259, kind: tiffShort, count: 1, data: shorts(32773)},
+		// Photometric interpretation 5 is separated inks
+		{tag: 262, kind: tiffShort, count: 1, data: shorts(5)},
+		{tag: 273, kind: tiffLong, count: uint32(len(offsets)), data: longs(offsets...)},
+		{tag: 277, kind: tiffShort, count: 1, data: shorts(4)},
+		{tag: 278, kind: tiffLong, count: 1, data: longs(uint32(rowsPerStrip))},
+		{tag: 279, kind: tiffLong, count: uint32(len(counts)), data: longs(counts...)},
+		{tag: 282, kind: tiffRational, count: 1, data: resolution(pixWidth, width)},
+		{tag: 283, kind: tiffRational, count: 1, data: resolution(pixHeight, height)},
+		{tag: 284, kind: tiffShort, count: 1, data: shorts(1)},
+		// Resolution unit 2 is inches
+		{tag: 296, kind: tiffShort, count: 1, data: shorts(2)},
+		{tag: 305, kind: tiffASCII, count: 15, data: []byte("logo-generator\x00")},
+		// Ink set 1 is CMYK
+		{tag: 332, kind: tiffShort, count: 1, data: shorts(1)},
+	}
+	if profile != nil {
+		entries = append(entries, tiffEntry{tag: 34675, kind: tiffUndefined, count: uint32(len(profile.Data)), data: profile.Data})
+	}
+
+	// The directory follows the strips, and values longer than four bytes
+	// follow the directory
+	ifd := data.Len()
+	binary.LittleEndian.PutUint32(data.Bytes()[4:], uint32(ifd))
+	extra := ifd + 2 + 12*len(entries) + 4
+	var values bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&data, binary.LittleEndian, struct {
+			Tag, Kind uint16
+			Count     uint32
+		}{e.tag, e.kind, e.count})
+		if len(e.data) <= 4 {
+			var inline [4]byte
+			copy(inline[:], e.data)
+			data.Write(inline[:])
+			continue
+		}
+		binary.Write(&data, binary.LittleEndian, uint32(extra+values.Len()))
+		values.Write(e.data)
+		if values.Len()%2 != 0 {
+			values.WriteByte(0)
+		}
+	}
+	data.Write([]byte{0, 0, 0, 0})
+	data.Write(values.Bytes())
+	_, err := w.Write(data.Bytes())
+	return err
+}
+
+// packBits appends row to b compressed with PackBits: runs of up to 128
+// repeated bytes, and literals of up to 128 bytes between them.
+func packBits(b *bytes.Buffer, row []byte) {
+	for i := 0; i < len(row); {
+		run := 1
+		for i+run < len(row) && run < 128 && row[i+run] == row[i] {
+			run++
+		}
+		if run > 1 {
+			b.WriteByte(byte(1 - run))
+			b.WriteByte(row[i])
+			i += run
+			continue
+		}
+		// A literal ends where a run of three starts, which saves a byte
+		end := i + 1
+		for end < len(row) && end-i < 128 && !(end+2 < len(row) && row[end] == row[end+1] && row[end] == row[end+2]) {
+			end++
+		}
+		b.WriteByte(byte(end - i - 1))
+		b.Write(row[i:end])
+		i = end
+	}
+}
+
+// shorts encodes TIFF SHORT values.
+func shorts(values ...uint16) []byte {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(data[2*i:], v)
+	}
+	return data
+}
+
+// longs encodes TIFF LONG values.
+func longs(values ...uint32) []byte {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], v)
+	}
+	return data
+}
+
+// resolution encodes the pixels per inch of pixels across points as a
+// TIFF RATIONAL, to a thousandth of a point.
+func resolution(pixels int, points float64) []byte {
+	num, den := uint64(pixels)*72*1000, uint64(math.Round(points*1000))
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return longs(uint32(num/a), uint32(den/a))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/press"
+)
+
+// maxPrintPixels caps the side of a print render, keeping its pixels under
+// a gigabyte.
+const maxPrintPixels = 16384
+
+// Spot color report thresholds, as CIEDE2000 differences.
+const (
+	// paperDeltaE is how close to white a color must be to print as bare
+	// paper rather than need an ink.
+	paperDeltaE = 2.0
+	// spotFarDeltaE flags matches far enough off that the color is better
+	// printed in CMYK than swapped for the spot color.
+	spotFarDeltaE = 5.0
+)
+
+// runPrint renders the logo at a physical size, converts it to CMYK and
+// writes it as a TIFF or single-page PDF, for business cards, letterheads
+// and other print deliverables.
+func runPrint(args []string) {
+	fs := flag.NewFlagSet("print", flag.ExitOnError)
+	input := fs.String("input", "", "path to the logo")
+	out := fs.String("o", "", "write the print to this .pdf, .tif or .tiff file")
+	size := fs.String("size", "", "physical size of the print, e.g. 85x55mm, 3.5x2in or 200x200pt; the logo is centered on white paper of that shape")
+	dpi := fs.Float64("dpi", 300, "resolution of the print in dots per inch")
+	icc := fs.String("icc", "", "ICC profile of the press, such as the printer's FOGRA or GRACoL profile; without one, colors are converted naively, which is only fit for proofs")
+	intent := fs.String("intent", "relative", "rendering intent of the ICC conversion: "+strings.Join(press.Intents, ", "))
+	spot := fs.String("spot", "", "spot color library, as an .ase swatch file or a .csv of names and colors; reports the nearest spot color to each dominant color of the logo")
+	fs.Parse(args)
+	if *input == "" || *out == "" || *size == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator print -input <path_to_image> -size 85x55mm -o logo.pdf [-dpi 300] [-icc press.icc] [-spot library.ase]")
+	}
+
+	ext := strings.ToLower(filepath.Ext(*out))
+	if ext != ".pdf" && ext != ".tif" && ext != ".tiff" {
+		log.Fatalf("Error: -o: %s: prints are written as .pdf, .tif or .tiff files\n", *out)
+	}
+	width, height, err := press.ParseSize(*size)
+	if err != nil {
+		log.Fatalf("Error: -size: %v\n", err)
+	}
+	if *dpi <= 0 {
+		log.Fatalf("Error: -dpi must be positive, got %g\n", *dpi)
+	}
+	pixWidth, pixHeight := press.Pixels(width, height, *dpi)
+	if pixWidth > maxPrintPixels || pixHeight > maxPrintPixels {
+		log.Fatalf("Error: a %s print at %g dpi is %dx%d pixels, over the limit of %d; lower -dpi\n", *size, *dpi, pixWidth, pixHeight, maxPrintPixels)
+	}
+
+	if side := min(pixWidth, pixHeight); side > 1080 {
+		fmt.Fprintf(os.Stderr, "Warning: the 1080x1080 source is enlarged to %dx%d pixels and may print soft; lower -dpi or -size\n", side, side)
+	}
+
+	var profile *press.Profile
+	if *icc != "" {
+		data, err := os.ReadFile(*icc)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if profile, err = press.LoadProfile(data, *intent); err != nil {
+			log.Fatalf("Error: -icc: %s: %v\n", *icc, err)
+		}
+	}
+
+	var swatches []press.Swatch
+	if *spot != "" {
+		data, err := os.ReadFile(*spot)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if swatches, err = press.LoadSwatches(*spot, data); err != nil {
+			log.Fatalf("Error: -spot: %s: %v\n", *spot, err)
+		}
+	}
+
+	// Render the logo padded to the shape of the paper, then convert it
+	dim := imageprocessor.Dimension{Name: "print.png", Width: uint(pixWidth), Height: uint(pixHeight), Fit: "pad"}
+	img, err := imageprocessor.RenderImage(context.Background(), *input, dim, imageprocessor.Options{Workers: 1})
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	cmyk := press.ToCMYK(img, profile)
+
+	var data bytes.Buffer
+	if ext == ".pdf" {
+		err = press.EncodePDF(&data, cmyk, width, height, profile)
+	} else {
+		err = press.EncodeTIFF(&data, cmyk, width, height, profile)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := os.WriteFile(*out, data.Bytes(), 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	colors := "naive CMYK"
+	if profile != nil {
+		colors = fmt.Sprintf("CMYK for %s, %s intent", profile.Description, *intent)
+	}
+	fmt.Printf("Wrote %s: %dx%d pixels, %s\n", *out, pixWidth, pixHeight, colors)
+	if swatches != nil {
+		printSpotColors(img, swatches, filepath.Base(*spot))
+	}
+}
+
+// printSpotColors reports the nearest spot color of the library to each
+// dominant color of img, so simple jobs can be sent as spot colors without
+// matching them in a prepress tool first.
+func printSpotColors(img *image.RGBA, swatches []press.Swatch, library string) {
+	fmt.Printf("Nearest spot colors in %s:\n", library)
+	for _, c := range imageprocessor.ExtractPalette(img, imageprocessor.DefaultPaletteSize) {
+		nrgba, _ := imageprocessor.ParseHexColor(c.Hex)
+		rgb := [3]uint8{nrgba.R, nrgba.G, nrgba.B}
+		if press.PaperDeltaE(rgb) < paperDeltaE {
+			fmt.Printf("  %s %5.1f%%  paper white, no ink\n", c.Hex, c.Coverage)
+			continue
+		}
+		match := press.NearestSwatch(rgb, swatches)
+		far := ""
+		if match.DeltaE > spotFarDeltaE {
+			far = "; no close match, keep it in CMYK"
+		}
+		fmt.Printf("  %s %5.1f%%  %s (ΔE %.1f%s)\n", c.Hex, c.Coverage, match.Swatch.Name, match.DeltaE, far)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// previewMarker tags the pull request comment pr-preview maintains, so
+// later runs update it instead of adding another.
+const previewMarker = "<!-- logo-generator-preview -->"
+
+// runPRPreview compares the icons generated from the master logo of a pull
+// request with those from its base branch, and posts or updates a comment
+// on the pull request showing both contact sheets. It does nothing when the
+// master logo did not change.
+func runPRPreview(args []string) {
+	fs := flag.NewFlagSet("pr-preview", flag.ExitOnError)
+	input := fs.String("input", "", "path to the master logo in the checked out pull request")
+	base := fs.String("base", "", "git revision holding the previous master logo (default: origin/$GITHUB_BASE_REF)")
+	pr := fs.Int("pr", 0, "pull request number (default: from the GitHub Actions event)")
+	upload := fs.String("upload", "", "storage URL the contact sheets are uploaded to, e.g. s3://bucket/previews")
+	publicURL := fs.String("public-url", "", "base URL the uploaded contact sheets are served from (default: the -upload URL, when it is http(s))")
+	cellSize := fs.Int("cell", 128, "size of each icon's cell on the contact sheets, in pixels")
+	dryRun := fs.Bool("dry-run", false, "print the comment instead of posting it")
+	options := processorFlags(fs)
+	dimensions, _ := dimensionsFlag(fs)
+	fs.Parse(args)
+
+	if *input == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator pr-preview -input <path_to_image> [-base <revision>] [-pr <number>] [-upload <url> -public-url <url>]")
+	}
+	if *base == "" {
+		ref := os.Getenv("GITHUB_BASE_REF")
+		if ref == "" {
+			log.Fatal("Error: -base is required outside of pull request workflows")
+		}
+		*base = "origin/" + ref
+	}
+	if *pr == 0 && !*dryRun {
+		number, err := eventPullRequest()
+		if err != nil {
+			log.Fatalf("Error: -pr is required: %v\n", err)
+		}
+		*pr = number
+	}
+	baseURL := *publicURL
+	if baseURL == "" && (strings.HasPrefix(*upload, "http://") || strings.HasPrefix(*upload, "https://")) {
+		baseURL = *upload
+	}
+	if *upload != "" && baseURL == "" {
+		log.Fatal("Error: -upload needs -public-url to link the contact sheets")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	dims, profile := dimensions()
+	opts := options()
+	opts.Watermark = profile.Watermark
+
+	// Find the master logo as of the base revision
+	repo, err := openGitRepo(ctx, filepath.Dir(*input))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	current, err := os.ReadFile(*input)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	previous, err := repo.fileAt(ctx, *base, *input)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if previous != nil && string(previous) == string(current) {
+		fmt.Println("The master logo is unchanged; no preview to post")
+		return
+	}
+
+	scratch, err := os.MkdirTemp("", "logo-generator-preview-")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	defer os.RemoveAll(scratch)
+	before, after, err := renderComparison(ctx, scratch, previous, *input, dims, opts, *cellSize)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Sheets are stored under the checksum of the new master, so every
+	// revision of the pull request links its own images
+	var sheetURLs [2]string
+	if *upload != "" {
+		store, err := storage.Open(ctx, *upload)
+		if err != nil {
+			log.Fatalf("Error: -upload: %v\n", err)
+		}
+		defer store.Close()
+		dir := fmt.Sprintf("pr-%d/%s", *pr, after.result.SourceSHA256[:12])
+		for i, side := range []*comparisonSide{before, after} {
+			if side == nil {
+				continue
+			}
+			name := dir + "/" + side.name + ".png"
+			if err := store.Put(ctx, name, side.sheet); err != nil {
+				log.Fatalf("Error: %v\n", err)
+			}
+			sheetURLs[i] = strings.TrimSuffix(baseURL, "/") + "/" + name
+		}
+	}
+
+	body := previewComment(*input, before, after, sheetURLs)
+	if *dryRun {
+		fmt.Print(body)
+		return
+	}
+	gh, err := repo.github(ctx)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	commentURL, err := gh.upsertComment(ctx, *pr, previewMarker, body)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Println("Posted the icon preview:", commentURL)
+}
+
+// comparisonSide holds the outputs and contact sheet of one master logo.
+type comparisonSide struct {
+	name   string
+	result *imageprocessor.Result
+	sheet  []byte
+}
+
+// renderComparison generates the outputs and contact sheets of the previous
+// master, which is nil for a new logo, and of the one at currentPath.
+func renderComparison(ctx context.Context, scratch string, previous []byte, currentPath string, dims []imageprocessor.Dimension, opts imageprocessor.Options, cellSize int) (before, after *comparisonSide, err error) {
+	render := func(name, source string) (*comparisonSide, error) {
+		result, err := imageprocessor.ProcessImage(ctx, source, filepath.Join(scratch, name), dims, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		sheet, err := imageprocessor.ContactSheet(ctx, source, dims, opts, cellSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &comparisonSide{name: name, result: result, sheet: sheet}, nil
+	}
+
+	if previous != nil {
+		// Keep the extension, which the decoder is picked by
+		source := filepath.Join(scratch, "previous"+filepath.Ext(currentPath))
+		if err := os.WriteFile(source, previous, 0644); err != nil {
+			return nil, nil, err
+		}
+		if before, err = render("before", source); err != nil {
+			return nil, nil, err
+		}
+	}
+	if after, err = render("after", currentPath); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+// previewComment writes the Markdown of the preview comment: the contact
+// sheets side by side, when uploaded, and a table of the outputs.
+func previewComment(input string, before, after *comparisonSide, sheetURLs [2]string) string {
+	var b strings.Builder
+	b.WriteString(previewMarker + "\n### Icon preview\n\n")
+
+	current := after.result.Manifest()
+	var changed map[string]bool
+	if before == nil {
+		fmt.Fprintf(&b, "`%s` is a new master logo generating %d icons.\n\n", input, len(current.Outputs))
+	} else {
+		changed = map[string]bool{}
+		for _, entry := range imageprocessor.ChangedOutputs(before.result.Manifest(), current) {
+			changed[entry.Name] = true
+		}
+		fmt.Fprintf(&b, "The master logo `%s` changed: %d of %d icons differ.\n\n", input, len(changed), len(current.Outputs))
+	}
+
+	switch {
+	case sheetURLs[1] == "":
+	case before == nil:
+		fmt.Fprintf(&b, "![after](%s)\n\n", sheetURLs[1])
+	default:
+		fmt.Fprintf(&b, "| Before | After |\n| --- | --- |\n| ![before](%s) | ![after](%s) |\n\n", sheetURLs[0], sheetURLs[1])
+	}
+
+	previous := map[string]imageprocessor.ManifestEntry{}
+	if before != nil {
+		for _, entry := range before.result.Manifest().Outputs {
+			previous[entry.Name] = entry
+		}
+	}
+	b.WriteString("<details><summary>Outputs</summary>\n\n| Output | Size | Before | After | |\n| --- | --- | ---: | ---: | --- |\n")
+	for _, entry := range current.Outputs {
+		old, ok := previous[entry.Name]
+		oldSize, status := "–", "new"
+		if ok {
+			oldSize, status = imageprocessor.FormatBytes(old.Bytes), "unchanged"
+			if changed[entry.Name] {
+				status = "changed"
+			}
+		}
+		fmt.Fprintf(&b, "| `%s` | %dx%d | %s | %s | %s |\n", entry.Name, entry.Width, entry.Height, oldSize, imageprocessor.FormatBytes(entry.Bytes), status)
+	}
+	b.WriteString("\n</details>\n")
+	return b.String()
+}
+
+// eventPullRequest returns the number of the pull request that triggered a
+// GitHub Actions workflow, from its event payload.
+func eventPullRequest() (int, error) {
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return 0, errors.New("GITHUB_EVENT_PATH is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var event struct {
+		Number      int `json:"number"`
+		PullRequest struct {
+			Number int `json:"number"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return 0, fmt.Errorf("invalid event payload: %w", err)
+	}
+	if n := max(event.PullRequest.Number, event.Number); n > 0 {
+		return n, nil
+	}
+	return 0, errors.New("the workflow was not triggered by a pull request")
+}
+
+// fileAt returns the contents of the file at path as of revision, or nil
+// when it did not exist then.
+func (g *gitRepo) fileAt(ctx context.Context, revision, path string) ([]byte, error) {
+	if _, err := g.run(ctx, "rev-parse", "--verify", "--quiet", revision+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("unknown revision %q", revision)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(g.dir, abs)
+	if err != nil {
+		return nil, err
+	}
+	object := revision + ":" + filepath.ToSlash(rel)
+	if _, err := g.run(ctx, "cat-file", "-e", object); err != nil {
+		return nil, nil
+	}
+	// run trims its output, which would corrupt binary files
+	data, err := exec.CommandContext(ctx, "git", "-C", g.dir, "cat-file", "blob", object).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: %w", err)
+	}
+	return data, nil
+}
+
+// upsertComment updates the comment of issue or pull request number that
+// contains marker, or adds one, and returns its URL.
+func (gh *githubClient) upsertComment(ctx context.Context, number int, marker, body string) (string, error) {
+	type comment struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+		URL  string `json:"html_url"`
+	}
+	issue := "/repos/" + gh.repo + "/issues/" + strconv.Itoa(number)
+	for page := 1; ; page++ {
+		var comments []comment
+		if err := gh.do(ctx, http.MethodGet, issue+"/comments?per_page=100&page="+strconv.Itoa(page), nil, &comments); err != nil {
+			return "", err
+		}
+		for _, c := range comments {
+			if strings.Contains(c.Body, marker) {
+				var updated comment
+				path := "/repos/" + gh.repo + "/issues/comments/" + strconv.FormatInt(c.ID, 10)
+				err := gh.do(ctx, http.MethodPatch, path, map[string]string{"body": body}, &updated)
+				return updated.URL, err
+			}
+		}
+		if len(comments) < 100 {
+			break
+		}
+	}
+	var created comment
+	err := gh.do(ctx, http.MethodPost, issue+"/comments", map[string]string{"body": body}, &created)
+	return created.URL, err
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"net/url"
+
+	"github.com/drewalth/logo-generator/cdn"
+)
+
+// purgerFlags validates the -purge flags and returns the configured purger.
+// Changes are detected with the manifest, so it must be enabled.
+func purgerFlags(spec, baseURL, manifestName string) cdn.Purger {
+	if manifestName == "" {
+		log.Fatal("Error: -purge finds changed files with the manifest, but -manifest is empty")
+	}
+	if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatal("Error: -purge needs -purge-url, the absolute http(s) URL the output directory is served from")
+	}
+	purger, err := cdn.New(spec)
+	if err != nil {
+		log.Fatalf("Error: -purge: %v\n", err)
+	}
+	return purger
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// remoteConfig is the server the remote command talks to, saved by
+// "remote login".
+type remoteConfig struct {
+	Server string `json:"server"`
+	APIKey string `json:"apiKey,omitempty"`
+	// CA, Cert and Key are PEM files: the CA the server's certificate must
+	// be signed by, and the client certificate of servers requiring one.
+	CA   string `json:"ca,omitempty"`
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// remoteConfigPath returns the file holding the saved remote config.
+func remoteConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logo-generator", "remote.json"), nil
+}
+
+// loadRemoteConfig reads the saved remote config, letting the
+// LOGO_GENERATOR_SERVER and LOGO_GENERATOR_API_KEY environment variables
+// override it.
+func loadRemoteConfig() (remoteConfig, error) {
+	var cfg remoteConfig
+	path, err := remoteConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if v := os.Getenv("LOGO_GENERATOR_SERVER"); v != "" {
+		cfg.Server = v
+	}
+	if v := os.Getenv("LOGO_GENERATOR_API_KEY"); v != "" {
+		cfg.APIKey = v
+	}
+	return cfg, nil
+}
+
+// runRemote generates images on a logo-generator server, or saves and
+// forgets the server to use with the login and logout subcommands.
+func runRemote(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "login":
+			runRemoteLogin(args[1:])
+			return
+		case "logout":
+			runRemoteLogout()
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("remote", flag.ExitOnError)
+	input := fs.String("input", "", "path to the source image")
+	outputDir := fs.String("output", "output", "directory the generated images are written to")
+	preset := fs.String("preset", "", "preset to generate; defaults to the server's")
+	manifestName := fs.String("manifest", "manifest.json", "name of the manifest written to the output directory; empty disables it")
+	timeout := fs.Duration("timeout", 10*time.Minute, "how long to wait for the server to finish")
+	fs.Parse(args)
+
+	if *input == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator remote -input <path_to_image> [-output <dir>] [-preset <name>]")
+	}
+	cfg, err := loadRemoteConfig()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if cfg.Server == "" {
+		log.Fatal("Error: no server configured; run logo-generator remote login -server <url>")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	client, err := newRemoteClient(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	manifest, err := client.generate(ctx, *input, *preset, *outputDir)
+	if manifest == nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	// A partial job still writes the outputs that were generated
+	if *manifestName != "" {
+		if err := manifest.Write(filepath.Join(*outputDir, *manifestName)); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+	fmt.Printf("Generated %d images on %s into %s\n", len(manifest.Outputs), cfg.Server, *outputDir)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
+
+// runRemoteLogin checks a server and API key and saves them for later runs.
+func runRemoteLogin(args []string) {
+	fs := flag.NewFlagSet("remote login", flag.ExitOnError)
+	server := fs.String("server", "", "base URL of the logo-generator server")
+	key := fs.String("key", "", "API key, when the server requires one (read from stdin if -)")
+	ca := fs.String("tls-ca", "", "PEM file of the CA the server's certificate is signed by, if not a system one")
+	cert := fs.String("tls-cert", "", "PEM client certificate, for servers requiring mutual TLS")
+	certKey := fs.String("tls-key", "", "PEM private key of -tls-cert")
+	fs.Parse(args)
+
+	if *server == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator remote login -server <url> [-key <api key>|-]")
+	}
+	cfg := remoteConfig{Server: strings.TrimSuffix(*server, "/"), APIKey: *key}
+	cfg.CA, cfg.Cert, cfg.Key = absPath(*ca), absPath(*cert), absPath(*certKey)
+	if cfg.APIKey == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		cfg.APIKey = strings.TrimSpace(string(data))
+	}
+
+	// Make sure the server answers and accepts the key before saving it
+	client, err := newRemoteClient(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	resp, err := client.do(context.Background(), http.MethodGet, "/presets", nil, "")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	resp.Body.Close()
+
+	path, err := remoteConfigPath()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	// The file holds the API key, so only the user may read it
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Logged in to %s; the settings are saved in %s\n", cfg.Server, path)
+}
+
+// absPath makes a non-empty path absolute, so the saved settings work from
+// any directory.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	return abs
+}
+
+// runRemoteLogout removes the saved remote config.
+func runRemoteLogout() {
+	path, err := remoteConfigPath()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Println("Logged out")
+}
+
+// remoteClient talks to the job API of a logo-generator server.
+type remoteClient struct {
+	cfg  remoteConfig
+	http *http.Client
+}
+
+// newRemoteClient returns a client for cfg, set up with its certificates.
+func newRemoteClient(cfg remoteConfig) (*remoteClient, error) {
+	if cfg.CA == "" && cfg.Cert == "" && cfg.Key == "" {
+		return &remoteClient{cfg: cfg, http: http.DefaultClient}, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CA != "" {
+		data, err := os.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s holds no PEM certificates", cfg.CA)
+		}
+	}
+	if cfg.Cert != "" || cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &remoteClient{cfg: cfg, http: &http.Client{Transport: transport}}, nil
+}
+
+// remoteJob is the part of a server job the client reads.
+type remoteJob struct {
+	ID       string                   `json:"id"`
+	State    string                   `json:"state"`
+	Error    string                   `json:"error"`
+	Manifest *imageprocessor.Manifest `json:"manifest"`
+	Outputs  []struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	} `json:"outputs"`
+}
+
+// remoteError is the JSON body of the server's error responses.
+type remoteError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// generate submits the source as a job, waits for it and extracts its outputs
+// into outputDir, returning the job's manifest.
+func (c *remoteClient) generate(ctx context.Context, input, preset, outputDir string) (*imageprocessor.Manifest, error) {
+	source, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", filepath.Base(input))
+	if err != nil {
+		return nil, err
+	}
+	part.Write(source)
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	path := "/jobs"
+	if preset != "" {
+		path += "?preset=" + url.QueryEscape(preset)
+	}
+	var job remoteJob
+	if err := c.doJSON(ctx, http.MethodPost, path, &body, form.FormDataContentType(), &job); err != nil {
+		return nil, fmt.Errorf("failed to submit job: %w", err)
+	}
+
+	// Poll with a growing delay until the job finishes
+	delay := 250 * time.Millisecond
+	for job.State == "queued" || job.State == "running" {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("job %s did not finish: %w", job.ID, ctx.Err())
+		}
+		delay = min(delay*2, 5*time.Second)
+		if err := c.doJSON(ctx, http.MethodGet, "/jobs/"+job.ID, nil, "", &job); err != nil {
+			return nil, fmt.Errorf("failed to check job %s: %w", job.ID, err)
+		}
+	}
+	if job.State != "succeeded" && job.State != "partial" {
+		return nil, fmt.Errorf("job %s failed: %s", job.ID, job.Error)
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/jobs/"+job.ID+"/download", nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download job %s: %w", job.ID, err)
+	}
+	defer resp.Body.Close()
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download job %s: %w", job.ID, err)
+	}
+	if err := extractZip(archive, outputDir); err != nil {
+		return nil, err
+	}
+
+	// The outputs that were generated are in place; report the others
+	if job.State == "partial" {
+		var errs []error
+		for _, out := range job.Outputs {
+			if out.Message != "" {
+				errs = append(errs, fmt.Errorf("%s: %s", out.Name, out.Message))
+			}
+		}
+		return job.Manifest, fmt.Errorf("job %s failed in part: %w", job.ID, errors.Join(errs...))
+	}
+	return job.Manifest, nil
+}
+
+// doJSON sends a request and decodes the JSON response into v.
+func (c *remoteClient) doJSON(ctx context.Context, method, path string, body io.Reader, contentType string, v any) error {
+	resp, err := c.do(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// do sends an authenticated request, turning error responses into errors.
+func (c *remoteClient) do(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.Server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr remoteError
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("%s: %s (%s)", resp.Status, apiErr.Message, apiErr.Code)
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// extractZip writes the files of a zip archive into dir, refusing entries
+// that would land outside it.
+func extractZip(archive []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !filepath.IsLocal(f.Name) || strings.ContainsAny(f.Name, `/\`) {
+			return fmt.Errorf("archive contains an unexpected file %q", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.Name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runSchema prints the JSON Schema of the config file format, or writes it
+// to -o, so editors can validate and autocomplete configs.
+func runSchema(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	out := fs.String("o", "", "write the schema to this file instead of stdout")
+	fs.Parse(args)
+
+	schema, err := imageprocessor.ConfigSchema()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	if *out == "" {
+		fmt.Println(string(schema))
+		return
+	}
+	if err := os.WriteFile(*out, append(schema, '\n'), 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runSelftest renders outputs from the built-in reference sources and
+// compares their perceptual hashes with golden hashes, so a new build or a
+// custom config can be checked for the expected pixels. With -write it
+// records the hashes instead.
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	configPath := fs.String("config", "", "JSON file listing the dimensions to render; defaults to the built-in reference outputs")
+	goldenPath := fs.String("golden", "", "golden hashes file; defaults to the built-in one, which only covers the reference outputs")
+	write := fs.Bool("write", false, "write the hashes of the rendered outputs to -golden, or print them, instead of comparing")
+	distance := fs.Int("distance", imageprocessor.DefaultMaxHashDistance, "number of perceptual hash bits an output may differ from its golden hash by")
+	outputDir := fs.String("output", "", "also write the rendered outputs to this directory, one subdirectory per reference source")
+	var opts imageprocessor.Options
+	fs.BoolVar(&opts.Tiled, "experimental-tiled", false, "resize the largest outputs with the experimental parallel tiled resampler")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator selftest [-config <file> -golden <file>] [-write]")
+	}
+	if *configPath != "" && *goldenPath == "" && !*write {
+		log.Fatal("Error: the built-in golden hashes only cover the reference outputs; pass -golden with -config")
+	}
+
+	dims := imageprocessor.ReferenceDimensions()
+	if *configPath != "" {
+		// A missing file must fail rather than check the built-in preset
+		// against the config's golden hashes
+		cfg, err := imageprocessor.LoadConfig(*configPath, nil)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		dims = cfg.Dimensions
+	}
+	golden := imageprocessor.ReferenceGolden()
+	if *goldenPath != "" && !*write {
+		var err error
+		if golden, err = imageprocessor.LoadGolden(*goldenPath); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	checks, err := imageprocessor.SelfTest(ctx, dims, golden, *outputDir, opts)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	if *write {
+		hashes := imageprocessor.Golden{}
+		for _, check := range checks {
+			hashes[check.Name] = check.Hash
+		}
+		writeGolden(hashes, *goldenPath)
+		return
+	}
+
+	failed := 0
+	for _, check := range checks {
+		switch {
+		case check.Missing:
+			fmt.Printf("  %-9s %-32s %s has no golden hash\n", "missing", check.Name, check.Hash)
+		case check.Passed(*distance):
+			fmt.Printf("  %-9s %-32s %s\n", "ok", check.Name, check.Hash)
+		default:
+			fmt.Printf("  %-9s %-32s %s is %d bits from %s\n", "FAIL", check.Name, check.Hash, check.Distance, check.Want)
+		}
+		if !check.Passed(*distance) {
+			failed++
+		}
+	}
+	fmt.Printf("%d of %d outputs match their golden hashes within %d bits\n", len(checks)-failed, len(checks), *distance)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// writeGolden writes golden hashes to path, or to stdout if path is empty.
+func writeGolden(golden imageprocessor.Golden, path string) {
+	if path == "" {
+		if err := golden.Write(os.Stdout); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := golden.Write(f); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Wrote %d golden hashes to %s\n", len(golden), path)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/server"
+)
+
+// runServe starts the HTTP server that generates logos from uploaded images.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	options := processorFlags(fs)
+	dimensions, _ := dimensionsFlag(fs)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	tenantsPath := fs.String("tenants", "", "JSON file mapping API keys to tenants with their allowed presets, destinations and quotas")
+	workDir := fs.String("work-dir", "", "directory holding uploads and job outputs (defaults to the system temp directory)")
+	jobWorkers := fs.Int("job-workers", 1, "number of asynchronous jobs processed at once")
+	slots := fs.Int("slots", runtime.NumCPU(), "number of outputs rendered at once across all requests and jobs, shared fairly between tenants")
+	publicURL := fs.String("public-url", "", "externally reachable base URL of the server, used for signed download links in job callbacks")
+	linkTTL := fs.Duration("link-ttl", 24*time.Hour, "how long signed download links stay valid")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long shutdown waits for in-flight requests and jobs before canceling them")
+	drainDelay := fs.Duration("drain-delay", 0, "how long to keep serving with /readyz failing after SIGTERM before closing the listener")
+	sessionTTL := fs.Duration("session-ttl", time.Hour, "how long preview sessions and finished jobs are kept after their last use")
+	maxDisk := fs.String("max-disk", "", "maximum disk space for sessions and finished jobs, e.g. 2GiB; the least recently used are removed first")
+	historyDir := fs.String("history", "", "directory keeping the outputs of every successful run so they can be listed and downloaded again")
+	maxUpload := fs.String("max-upload", "32MiB", "maximum size of an uploaded source, e.g. 10MiB; 0 means no limit")
+	rateLimit := fs.Float64("rate-limit", 0, "requests per second allowed from every client IP address; 0 means no limit")
+	rateBurst := fs.Int("rate-burst", 0, "requests a client may send at once before -rate-limit applies (defaults to the rate)")
+	allowPrivateCallbacks := fs.Bool("allow-private-callbacks", false, "let job callbacks reach loopback, private and link-local addresses, which are refused by default")
+	trustForwardedFor := fs.Bool("trust-forwarded-for", false, "take client addresses from X-Forwarded-For, set by a reverse proxy in front of the server")
+	tlsCert := fs.String("tls-cert", "", "PEM certificate to serve HTTPS with, reloaded when it changes")
+	tlsKey := fs.String("tls-key", "", "PEM private key of -tls-cert")
+	clientCA := fs.String("client-ca", "", "PEM file of the CAs client certificates must be signed by (mutual TLS)")
+	apiKeysPath := fs.String("api-keys", "", "file of hex SHA-256 hashes of the API keys accepted without tenants, one per line, reloaded when it changes")
+	auditPath := fs.String("audit-log", "", "file that every generation request and job is appended to as a line of JSON, or - for standard output")
+	cacheSpec := fs.String("cache", "", "directory or http(s) URL prefix caching generated sets by source and dimensions, shared between replicas")
+	ui := fs.Bool("ui", true, "serve the web UI at /")
+	logs := loggingFlags(fs)
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger, closeLog := logs.logger(slog.LevelInfo)
+	defer closeLog()
+
+	dims, profile := dimensions()
+	opts := options()
+	opts.Watermark = profile.Watermark
+	var maxDiskUsage int64
+	if *maxDisk != "" {
+		var err error
+		if maxDiskUsage, err = imageprocessor.ParseByteSize(*maxDisk); err != nil {
+			log.Fatalf("Error: -max-disk: %v\n", err)
+		}
+	}
+	maxUploadBytes, err := imageprocessor.ParseByteSize(*maxUpload)
+	if err != nil {
+		log.Fatalf("Error: -max-upload: %v\n", err)
+	}
+	var history *server.RunHistory
+	if *historyDir != "" {
+		var err error
+		if history, err = server.OpenRunHistory(*historyDir); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+	var audit *server.AuditLog
+	if *auditPath != "" {
+		var err error
+		if audit, err = server.OpenAuditLog(*auditPath); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		defer audit.Close()
+	}
+	var cache server.Cache
+	if *cacheSpec != "" {
+		var err error
+		if cache, err = server.OpenCache(*cacheSpec); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+	var tenants []server.Tenant
+	if *tenantsPath != "" {
+		var err error
+		if tenants, err = server.LoadTenants(*tenantsPath); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+	// Plain keys from the environment suit secrets mounted by orchestrators
+	var apiKeys *server.KeySet
+	envKeys := strings.Split(os.Getenv("LOGO_GENERATOR_API_KEYS"), ",")
+	switch {
+	case *apiKeysPath != "":
+		var err error
+		if apiKeys, err = server.LoadKeySet(*apiKeysPath, envKeys); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	case os.Getenv("LOGO_GENERATOR_API_KEYS") != "":
+		apiKeys = server.NewKeySet(envKeys)
+	}
+	if apiKeys != nil && tenants != nil {
+		log.Fatalf("Error: API keys and -tenants are exclusive; give each tenant its keys instead\n")
+	}
+
+	srv := server.New(server.Config{
+		Addr:         *addr,
+		Dimensions:   dims,
+		Options:      opts,
+		Logger:       logger,
+		WorkDir:      *workDir,
+		SessionTTL:   *sessionTTL,
+		MaxDiskUsage: maxDiskUsage,
+		JobWorkers:   *jobWorkers,
+		Slots:        *slots,
+		PublicURL:    *publicURL,
+		LinkTTL:      *linkTTL,
+		LinkSecret:   []byte(os.Getenv("LOGO_GENERATOR_LINK_SECRET")),
+		DrainTimeout: *drainTimeout,
+		DrainDelay:   *drainDelay,
+		DisableUI:    !*ui,
+		History:      history,
+		Tenants:      tenants,
+		Cache:        cache,
+		Audit:        audit,
+
+		MaxUploadBytes:        maxUploadBytes,
+		RateLimit:             *rateLimit,
+		RateBurst:             *rateBurst,
+		TrustForwardedFor:     *trustForwardedFor,
+		AllowPrivateCallbacks: *allowPrivateCallbacks,
+		TLSCert:               *tlsCert,
+		TLSKey:                *tlsKey,
+		ClientCA:              *clientCA,
+		APIKeys:               apiKeys,
+	})
+	if err := srv.ListenAndServe(ctx); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// AuditEntry records who generated what, and where it went.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Event is "generate" for synchronous requests, and "job.submitted"
+	// and "job.finished" for the two ends of a job.
+	Event     string `json:"event"`
+	RequestID string `json:"requestId"`
+	JobID     string `json:"jobId,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	// KeyID identifies the API key of the request without revealing it:
+	// the first 12 hex digits of its SHA-256 hash.
+	KeyID string `json:"keyId,omitempty"`
+	// Client is the client's IP address, and ClientCert the subject of its
+	// verified TLS certificate.
+	Client       string   `json:"client"`
+	ClientCert   string   `json:"clientCert,omitempty"`
+	Preset       string   `json:"preset"`
+	SourceSHA256 string   `json:"sourceSha256,omitempty"`
+	Outputs      int      `json:"outputs"`
+	Destinations []string `json:"destinations,omitempty"`
+	Cached       bool     `json:"cached,omitempty"`
+	Status       int      `json:"status"`
+	Code         string   `json:"code,omitempty"`
+}
+
+// AuditLog appends an AuditEntry per generation request as a line of JSON.
+// It is safe for concurrent use.
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// OpenAuditLog opens the file at path for appending, creating it readable
+// only by its owner; "-" writes to standard output instead.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if path == "-" {
+		return NewAuditLog(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return NewAuditLog(f), nil
+}
+
+// NewAuditLog returns an audit log writing to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// Write appends entry. Each entry is written with a single call, so lines
+// of concurrent writers to the same file never interleave.
+func (a *AuditLog) Write(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the underlying file, if any.
+func (a *AuditLog) Close() error {
+	if c, ok := a.w.(io.Closer); ok && a.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// auditKey is the context key of the audit entry of a request.
+type auditKey struct{}
+
+// auditFrom returns the audit entry of a request for handlers to complete,
+// or a throwaway one when the server keeps no audit log.
+func auditFrom(ctx context.Context) *AuditEntry {
+	if entry, ok := ctx.Value(auditKey{}).(*AuditEntry); ok {
+		return entry
+	}
+	return &AuditEntry{}
+}
+
+// audited records the request in the audit log once next has answered it,
+// with the details next filled in through auditFrom.
+func (s *Server) audited(event string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Audit == nil {
+			next(w, r)
+			return
+		}
+		entry := &AuditEntry{
+			Time:       time.Now().UTC(),
+			Event:      event,
+			RequestID:  w.Header().Get("X-Request-ID"),
+			Tenant:     tenantName(r),
+			KeyID:      keyID(requestKey(r)),
+			Client:     s.clientIP(r),
+			ClientCert: clientCertSubject(r),
+			Preset:     presetName(r),
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+		entry.Status = rec.status
+		s.writeAudit(r.Context(), *entry)
+	}
+}
+
+// writeAudit appends entry to the audit log, if any, logging failures.
+func (s *Server) writeAudit(ctx context.Context, entry AuditEntry) {
+	if s.cfg.Audit == nil {
+		return
+	}
+	if err := s.cfg.Audit.Write(entry); err != nil {
+		imageprocessor.Logger(ctx).Error("failed to write audit log", "error", err)
+	}
+}
+
+// auditResult fills in the outcome of a run that produced result.
+func auditResult(entry *AuditEntry, result *imageprocessor.Result, cached bool) {
+	entry.SourceSHA256, entry.Cached = result.SourceSHA256, cached
+	entry.Outputs = result.Count(imageprocessor.StatusGenerated) + result.Count(imageprocessor.StatusUnchanged)
+}
+
+// keyID returns the first 12 hex digits of the SHA-256 hash of an API key,
+// or an empty string for requests without one.
+func keyID(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// clientCertSubject returns the subject of the verified client certificate
+// of r, if any.
+func clientCertSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
+
+// presetName names the preset a request generates: the one it asks for,
+// its tenant's default or "default" for the server's dimensions.
+func presetName(r *http.Request) string {
+	if name := r.URL.Query().Get("preset"); name != "" {
+		return name
+	}
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		return tenant.Presets[0]
+	}
+	return "default"
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyReloadInterval is how often a KeySet file and TLS certificates are
+// checked for changes.
+const keyReloadInterval = 10 * time.Second
+
+// KeySet holds the API keys accepted by a server without tenants, as
+// SHA-256 hashes. Keys listed in a file are reloaded when it changes, so a
+// key can be rotated by adding the new one, moving clients over and then
+// removing the old one, without a restart.
+type KeySet struct {
+	static [][]byte
+	path   string
+
+	mu      sync.RWMutex
+	hashes  [][]byte
+	modTime time.Time
+}
+
+// NewKeySet returns a fixed set of the given plain keys, e.g. from an
+// environment variable.
+func NewKeySet(keys []string) *KeySet {
+	k := &KeySet{}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			sum := sha256.Sum256([]byte(key))
+			k.static = append(k.static, sum[:])
+		}
+	}
+	return k
+}
+
+// LoadKeySet returns the plain keys extended with the keys listed in the
+// file at path: one hex encoded SHA-256 hash per line, like the API keys of
+// tenants, with blank lines and lines starting with # ignored.
+func LoadKeySet(path string, keys []string) (*KeySet, error) {
+	k := NewKeySet(keys)
+	k.path = path
+	if _, err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Len returns the number of keys in the set.
+func (k *KeySet) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.static) + len(k.hashes)
+}
+
+// Contains reports whether key is in the set, comparing hashes in constant
+// time.
+func (k *KeySet) Contains(key string) bool {
+	if key == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(key))
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	found := false
+	for _, hashes := range [][][]byte{k.static, k.hashes} {
+		for _, h := range hashes {
+			if subtle.ConstantTimeCompare(sum[:], h) == 1 {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// reload rereads the key file if it changed since it was last read,
+// reporting whether it did.
+func (k *KeySet) reload() (bool, error) {
+	if k.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	var hashes [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		h, err := hex.DecodeString(line)
+		if err != nil || len(h) != sha256.Size {
+			return false, fmt.Errorf("%s:%d: API keys must be listed as hex SHA-256 hashes", k.path, n)
+		}
+		hashes = append(hashes, h)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.hashes, k.modTime = hashes, info.ModTime()
+	return true, nil
+}
+
+// watchAPIKeys reloads the server's key file until ctx is done. A file that
+// fails to load keeps the previous keys in use.
+func (s *Server) watchAPIKeys(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if changed, err := s.cfg.APIKeys.reload(); err != nil {
+				s.cfg.Logger.Error("failed to reload API keys", "error", err)
+			} else if changed {
+				s.cfg.Logger.Info("reloaded API keys", "keys", s.cfg.APIKeys.Len())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// requestKey returns the API key of r, given as a bearer token or in the
+// X-API-Key header.
+func requestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// writeUnauthorized answers 401 with a bearer challenge.
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="logo-generator"`)
+	writeError(w, http.StatusUnauthorized, CodeUnauthorized, "missing or unknown API key")
+}
+
+// certReloader serves a certificate from PEM files, rereading them when
+// their modification times change so renewed certificates are picked up.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTimes  [2]time.Time
+	lastCheck time.Time
+}
+
+// newCertReloader loads the certificate in certFile and keyFile.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload rereads the files if either changed.
+func (c *certReloader) reload() error {
+	var modTimes [2]time.Time
+	for i, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if c.cert != nil && modTimes == c.modTimes {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	c.cert, c.modTimes = &cert, modTimes
+	return nil
+}
+
+// getCertificate is the tls.Config hook returning the current certificate.
+// Failed reloads, e.g. while the files are being replaced, keep serving the
+// previous one.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastCheck) > keyReloadInterval {
+		c.lastCheck = time.Now()
+		c.reload()
+	}
+	return c.cert, nil
+}
+
+// tlsConfig returns the TLS configuration of the server, or nil when it
+// serves plain HTTP. With a client CA, client certificates are verified
+// when given and requireClientCert refuses requests without one, so health
+// probes, which carry none, still get through.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.cfg.TLSCert == "" && s.cfg.TLSKey == "" {
+		if s.cfg.ClientCA != "" {
+			return nil, errors.New("a client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+	if s.cfg.TLSCert == "" || s.cfg.TLSKey == "" {
+		return nil, errors.New("TLS needs both a certificate and a key")
+	}
+	certs, err := newCertReloader(s.cfg.TLSCert, s.cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}
+	if s.cfg.ClientCA != "" {
+		data, err := os.ReadFile(s.cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s holds no PEM certificates", s.cfg.ClientCA)
+		}
+		cfg.ClientCAs, cfg.ClientAuth = pool, tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// requireClientCert refuses requests without a verified client certificate
+// when the server has a client CA. Health probes are let through.
+func (s *Server) requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.ClientCA == "" || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "a client certificate is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
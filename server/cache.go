@@ -0,0 +1,387 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// ErrCacheMiss is returned by a Cache for keys it holds nothing for.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache keeps generated sets, keyed by a hash of the source and everything
+// that affects the outputs, so identical requests reuse them. A cache shared
+// between replicas, such as a directory on a network file system or an HTTP
+// object store, serves a set generated by any of them. Implementations must
+// be safe for concurrent use.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// OpenCache opens the cache at spec: an http or https URL prefix for an
+// HTTPCache, or otherwise a directory for a DirCache.
+func OpenCache(spec string) (Cache, error) {
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return NewHTTPCache(spec, os.Getenv("LOGO_GENERATOR_CACHE_TOKEN")), nil
+	}
+	return NewDirCache(spec)
+}
+
+// DirCache keeps entries as files in a directory. Entries are written to a
+// temporary file and renamed into place, so replicas sharing the directory
+// never read a partial entry. Nothing is evicted; remove old files, e.g. by
+// age, to bound its size.
+type DirCache struct {
+	dir string
+}
+
+// NewDirCache returns a cache in dir, creating it if needed.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DirCache{dir: dir}, nil
+}
+
+// Get returns the entry stored under key.
+func (c *DirCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, key+".zip"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	return data, err
+}
+
+// Put stores data under key.
+func (c *DirCache) Put(ctx context.Context, key string, data []byte) error {
+	f, err := os.CreateTemp(c.dir, ".tmp-"+key+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(c.dir, key+".zip"))
+}
+
+// HTTPCache keeps entries in an object store reached over HTTP, such as an
+// S3 bucket or a Redis REST proxy, reading them with GET and storing them
+// with PUT requests to <base>/<key>.zip.
+type HTTPCache struct {
+	base  string
+	token string
+}
+
+// NewHTTPCache returns a cache under the URL prefix base. A non-empty token
+// is sent as a bearer token with every request.
+func NewHTTPCache(base, token string) *HTTPCache {
+	return &HTTPCache{base: strings.TrimSuffix(base, "/"), token: token}
+}
+
+// Get returns the entry stored under key.
+func (c *HTTPCache) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound, http.StatusForbidden:
+		// S3 answers 403 for missing keys without list permission
+		return nil, ErrCacheMiss
+	default:
+		return nil, fmt.Errorf("failed to read cache entry: %s", resp.Status)
+	}
+}
+
+// Put stores data under key.
+func (c *HTTPCache) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to store cache entry: %s", resp.Status)
+	}
+	return nil
+}
+
+// do sends a request for the entry under key.
+func (c *HTTPCache) do(ctx context.Context, method, key string, data []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+"/"+key+".zip", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/zip")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// cacheKey identifies the outputs of dims generated from the source at
+// sourcePath with opts: it hashes the source, the dimensions, every option
+// that changes the pixels and the build, so a release that renders
+// differently starts from an empty cache.
+func cacheKey(sourcePath string, dims []imageprocessor.Dimension, opts imageprocessor.Options) (string, error) {
+	sum, err := fileSHA256(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	params := struct {
+		Build           string                     `json:"build"`
+		Source          string                     `json:"source"`
+		Dimensions      []imageprocessor.Dimension `json:"dimensions"`
+		Tiled           bool                       `json:"tiled"`
+		Watermark       *imageprocessor.Watermark  `json:"watermark,omitempty"`
+		WatermarkImage  string                     `json:"watermarkImage,omitempty"`
+		Approved        []string                   `json:"approved,omitempty"`
+		MaxHashDistance int                        `json:"maxHashDistance,omitempty"`
+		PNGEffort       int                        `json:"pngEffort,omitempty"`
+		PNGIndexed      bool                       `json:"pngIndexed,omitempty"`
+		Encoder         string                     `json:"encoder,omitempty"`
+		TargetSSIM      float64                    `json:"targetSSIM,omitempty"`
+	}{Build: buildID(), Source: sum, Dimensions: dims, Tiled: opts.Tiled, Watermark: opts.Watermark, MaxHashDistance: opts.MaxHashDistance, PNGEffort: opts.PNGEffort, PNGIndexed: opts.PNGIndexed, Encoder: opts.Encoder, TargetSSIM: opts.TargetSSIM}
+	// The watermark image may change behind its path
+	if opts.Watermark != nil && opts.Watermark.Image != "" {
+		if params.WatermarkImage, err = fileSHA256(opts.Watermark.Image); err != nil {
+			return "", err
+		}
+	}
+	for _, h := range opts.Approved {
+		params.Approved = append(params.Approved, h.String())
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	key := sha256.Sum256(data)
+	return hex.EncodeToString(key[:]), nil
+}
+
+// buildID identifies the running build by its module version and VCS
+// revision.
+func buildID() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	id := bi.Main.Version
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+			id += " " + s.Value
+		}
+	}
+	return id
+}
+
+// fileSHA256 returns the hex encoded checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedResult looks key up in the server's cache and, on a hit, extracts
+// the outputs into outputDir and returns a result describing them as
+// unchanged. Cache failures are logged and treated as misses.
+func (s *Server) cachedResult(ctx context.Context, key, sourcePath, outputDir string) (*imageprocessor.Result, bool) {
+	if s.cfg.Cache == nil || key == "" {
+		return nil, false
+	}
+	logger := imageprocessor.Logger(ctx)
+	data, err := s.cfg.Cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrCacheMiss) {
+			logger.Warn("failed to read cache", "key", key, "error", err)
+		}
+		return nil, false
+	}
+	result, err := extractCacheEntry(data, sourcePath, outputDir)
+	if err != nil {
+		logger.Warn("ignoring corrupt cache entry", "key", key, "error", err)
+		os.RemoveAll(outputDir)
+		return nil, false
+	}
+	logger.Info("cache hit", "key", key)
+	return result, true
+}
+
+// storeResult puts the outputs of a successful run into the server's cache,
+// logging failures.
+func (s *Server) storeResult(ctx context.Context, key string, result *imageprocessor.Result) {
+	if s.cfg.Cache == nil || key == "" {
+		return
+	}
+	var buf bytes.Buffer
+	err := writeCacheEntry(&buf, result)
+	if err == nil {
+		err = s.cfg.Cache.Put(ctx, key, buf.Bytes())
+	}
+	if err != nil {
+		imageprocessor.Logger(ctx).Warn("failed to store cache entry", "key", key, "error", err)
+	}
+}
+
+// cacheStatus is the X-Cache header value of a response.
+func cacheStatus(hit bool) string {
+	if hit {
+		return "hit"
+	}
+	return "miss"
+}
+
+// resultCacheKey returns the cache key of a run, or an empty key, which
+// skips the cache, when there is no cache or the key cannot be computed.
+func (s *Server) resultCacheKey(ctx context.Context, sourcePath string, dims []imageprocessor.Dimension) string {
+	if s.cfg.Cache == nil {
+		return ""
+	}
+	key, err := cacheKey(sourcePath, dims, s.cfg.Options)
+	if err != nil {
+		imageprocessor.Logger(ctx).Warn("failed to compute cache key", "error", err)
+		return ""
+	}
+	return key
+}
+
+// writeCacheEntry writes the outputs of result and their manifest as a zip
+// archive.
+func writeCacheEntry(w io.Writer, result *imageprocessor.Result) error {
+	zw := zip.NewWriter(w)
+	manifest := result.Manifest()
+	manifest.Source = filepath.Base(manifest.Source)
+	for _, out := range result.Outputs {
+		if !out.Status.Succeeded() {
+			continue
+		}
+		if err := addZipFile(zw, out.Dimension.Name, out.Path); err != nil {
+			return err
+		}
+	}
+	entry, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(entry).Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// extractCacheEntry writes the outputs of a cache entry into outputDir,
+// checking them against the entry's manifest, and describes them as the
+// result of a run from the source at sourcePath.
+func extractCacheEntry(data []byte, sourcePath, outputDir string) (*imageprocessor.Result, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	var manifest imageprocessor.Manifest
+	if err := readZipJSON(files["manifest.json"], &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+	result := &imageprocessor.Result{Source: sourcePath, SourceSHA256: manifest.SourceSHA256, OutputDir: outputDir, GeneratedAt: manifest.GeneratedAt}
+	if manifest.SourcePHash != "" {
+		if result.SourcePHash, err = imageprocessor.ParsePerceptualHash(manifest.SourcePHash); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range manifest.Outputs {
+		// Names come from a validated config, but the entry may be tampered with
+		if !filepath.IsLocal(entry.Name) || files[entry.Name] == nil {
+			return nil, fmt.Errorf("missing or invalid output %q", entry.Name)
+		}
+		path := filepath.Join(outputDir, entry.Name)
+		sum, err := extractZipFile(files[entry.Name], path)
+		if err != nil {
+			return nil, err
+		}
+		if sum != entry.SHA256 {
+			return nil, fmt.Errorf("output %q does not match its checksum", entry.Name)
+		}
+		result.Outputs = append(result.Outputs, imageprocessor.OutputResult{
+			Dimension: imageprocessor.Dimension{Name: entry.Name, Width: entry.Width, Height: entry.Height},
+			Path:      path,
+			Status:    imageprocessor.StatusUnchanged,
+			Bytes:     entry.Bytes,
+			SHA256:    entry.SHA256,
+		})
+	}
+	return result, nil
+}
+
+// readZipJSON decodes the JSON file f of an archive into v.
+func readZipJSON(f *zip.File, v any) error {
+	if f == nil {
+		return os.ErrNotExist
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+// extractZipFile writes the archived file f to path and returns its hex
+// encoded checksum.
+func extractZipFile(f *zip.File, path string) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, h), r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), out.Close()
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// callbackAttempts is how often a callback is delivered before giving up.
+const callbackAttempts = 3
+
+// callbackPayload is the JSON body posted to a job's callback URL.
+type callbackPayload struct {
+	Job
+	// DownloadURL is a signed link to the outputs, valid until DownloadExpires
+	// without an API key. It is only set when the server knows its public URL.
+	DownloadURL     string     `json:"downloadUrl,omitempty"`
+	DownloadExpires *time.Time `json:"downloadExpires,omitempty"`
+}
+
+// parseCallback validates the callback URL given with a job submission.
+func parseCallback(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("callback %q must be an absolute http or https URL", raw)
+	}
+	return u.String(), nil
+}
+
+// notifyCallback posts the finished job to its callback URL, retrying failed
+// deliveries with a growing delay.
+func (s *Server) notifyCallback(ctx context.Context, job Job) {
+	logger := imageprocessor.Logger(ctx).With("callback", job.Callback)
+
+	payload := callbackPayload{Job: job}
+	if job.Manifest != nil && s.cfg.PublicURL != "" {
+		expires := time.Now().Add(s.cfg.LinkTTL).UTC().Truncate(time.Second)
+		payload.DownloadURL = s.signedDownloadURL(job.ID, expires)
+		payload.DownloadExpires = &expires
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("failed to encode callback", "error", err)
+		return
+	}
+
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := postCallback(ctx, s.callbacks, job.Callback, body)
+		if err == nil {
+			logger.Info("callback delivered")
+			return
+		}
+		if attempt == callbackAttempts {
+			logger.Warn("callback failed", "attempts", attempt, "error", err)
+			return
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 4
+		case <-ctx.Done():
+			logger.Warn("callback canceled", "error", err)
+			return
+		}
+	}
+}
+
+// callbackClient returns the client callbacks are delivered with. Unless
+// allowPrivate is set, it refuses to connect to addresses that are not
+// public. The check runs on the resolved address of every connection,
+// redirects included, so names resolving to internal hosts are caught too.
+// Proxies from the environment are not used, as they would be dialed
+// instead of the callback's host.
+func callbackClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(ip) {
+				return fmt.Errorf("callback address %s is not public; see -allow-private-callbacks", ip)
+			}
+			return nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routed on
+// the internet either.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether ip is a global unicast address outside the
+// private, shared and loopback ranges.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// postCallback delivers body once with client, treating any non-2xx
+// response as a failure.
+func postCallback(ctx context.Context, client *http.Client, callback string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("callback answered %s", resp.Status)
+	}
+	return nil
+}
+
+// signedDownloadURL returns a public link to a job's download that is valid
+// until expires.
+func (s *Server) signedDownloadURL(id string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q := url.Values{"expires": {exp}, "signature": {s.downloadSignature(id, exp)}}
+	return s.cfg.PublicURL + "/jobs/" + url.PathEscape(id) + "/download?" + q.Encode()
+}
+
+// downloadSignature is the hex HMAC-SHA256 of a job ID and expiry.
+func (s *Server) downloadSignature(id, expires string) string {
+	mac := hmac.New(sha256.New, s.linkSecret)
+	mac.Write([]byte(id + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// errLinkInvalid is returned for download links with a bad or expired signature.
+var errLinkInvalid = errors.New("download link is invalid or expired")
+
+// checkSignedDownload verifies the signature of a download link.
+func (s *Server) checkSignedDownload(r *http.Request) error {
+	exp := r.URL.Query().Get("expires")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return errLinkInvalid
+	}
+	want := s.downloadSignature(r.PathValue("id"), exp)
+	if !hmac.Equal([]byte(want), []byte(r.URL.Query().Get("signature"))) {
+		return errLinkInvalid
+	}
+	return nil
+}
+
+// handleDownload serves signed download links without an API key and every
+// other download through the usual authentication.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("signature") {
+		s.authenticate(s.handleJobDownload)(w, r)
+		return
+	}
+	if err := s.checkSignedDownload(r); err != nil {
+		writeError(w, http.StatusForbidden, CodeForbidden, err.Error())
+		return
+	}
+	s.handleJobDownload(w, r)
+}
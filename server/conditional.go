@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// outputETag returns the strong entity tag of an output: its checksum.
+func outputETag(entry imageprocessor.ManifestEntry) string {
+	return `"` + entry.SHA256 + `"`
+}
+
+// manifestETag returns the strong entity tag of the zip of the outputs of m.
+// Archives carry no timestamps, so the same outputs always zip to the same
+// bytes and the tag only needs their names and checksums.
+func manifestETag(m *imageprocessor.Manifest) string {
+	h := sha256.New()
+	for _, entry := range m.Outputs {
+		h.Write([]byte(entry.Name + "\x00" + entry.SHA256 + "\n"))
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// notModified sets the ETag and Last-Modified headers of a response and, when
+// the request's If-None-Match or, without it, If-Modified-Since header shows
+// the client already holds it, answers 304 Not Modified and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	match := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		match = etagListMatches(inm, etag)
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		// HTTP dates have a resolution of a second
+		match = !modified.Truncate(time.Second).After(ims)
+	}
+	if !match {
+		return false
+	}
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Disposition")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches reports whether the If-None-Match list matches etag, using
+// the weak comparison RFC 9110 prescribes for it.
+func etagListMatches(list, etag string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
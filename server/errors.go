@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Error codes of API error responses. Clients branch on the code, which is
+// stable, rather than on the message, which is meant for people.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeTooLarge          = "too_large"
+	CodeRateLimited       = "rate_limited"
+	CodeUnavailable       = "unavailable"
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeBadDimensions     = "bad_dimensions"
+	CodeInvalidConfig     = "invalid_config"
+	CodeNotApproved       = "not_approved"
+	CodeSourceConverted   = "source_converted"
+	CodeCanceled          = "canceled"
+	CodePartialFailure    = "partial_failure"
+	CodeInternal          = "internal"
+)
+
+// APIError is the JSON body of every error response, and of the 207
+// Multi-Status response of a run in which only some outputs failed.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Outputs reports every output of a run that failed in part or whose
+	// outputs all failed.
+	Outputs []OutputStatus `json:"outputs,omitempty"`
+}
+
+// OutputStatus is the outcome of one output of a run.
+type OutputStatus struct {
+	Name string `json:"name"`
+	// State is the processor's status: generated, unchanged, failed or
+	// pending, for outputs a failure kept from starting.
+	State imageprocessor.Status `json:"state"`
+	// Status is the HTTP status the output would have had on its own.
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// writeError responds with an APIError.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIError{Code: code, Message: message})
+}
+
+// writeInternalError responds 500 without revealing the cause, which the
+// caller logs.
+func writeInternalError(w http.ResponseWriter) {
+	writeError(w, http.StatusInternalServerError, CodeInternal, "internal error")
+}
+
+// writeUploadError responds to a failure to store an upload.
+func writeUploadError(w http.ResponseWriter, err error) {
+	status, code := uploadError(err)
+	message := err.Error()
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		message = tooLargeMessage(maxErr.Limit)
+	}
+	writeError(w, status, code, message)
+}
+
+// processError maps a processor error to an HTTP status and error code.
+func processError(err error) (int, string) {
+	switch {
+	case errors.Is(err, imageprocessor.ErrUnsupportedFormat):
+		return http.StatusUnprocessableEntity, CodeUnsupportedFormat
+	case errors.Is(err, imageprocessor.ErrBadDimensions):
+		return http.StatusUnprocessableEntity, CodeBadDimensions
+	case errors.Is(err, imageprocessor.ErrNotApproved):
+		return http.StatusForbidden, CodeNotApproved
+	case errors.Is(err, imageprocessor.ErrSourceConverted):
+		return http.StatusUnprocessableEntity, CodeSourceConverted
+	case errors.Is(err, imageprocessor.ErrLimitExceeded):
+		return http.StatusRequestEntityTooLarge, CodeTooLarge
+	case errors.Is(err, imageprocessor.ErrConfigInvalid):
+		return http.StatusInternalServerError, CodeInvalidConfig
+	case errors.Is(err, imageprocessor.ErrCanceled):
+		return http.StatusServiceUnavailable, CodeCanceled
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+// uploadError maps a failure to store an upload to an HTTP status and error
+// code.
+func uploadError(err error) (int, string) {
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		return http.StatusRequestEntityTooLarge, CodeTooLarge
+	}
+	return http.StatusBadRequest, CodeBadRequest
+}
+
+// outputStatuses reports the outcome of every output of result.
+func outputStatuses(result *imageprocessor.Result) []OutputStatus {
+	statuses := make([]OutputStatus, len(result.Outputs))
+	for i, out := range result.Outputs {
+		s := OutputStatus{Name: out.Dimension.Name, State: out.Status, Status: http.StatusOK}
+		switch {
+		case out.Err != nil:
+			s.Status, s.Code = processError(out.Err)
+			s.Message = out.Err.Error()
+		case out.Status == imageprocessor.StatusPending:
+			s.Status, s.Code, s.Message = http.StatusServiceUnavailable, CodeCanceled, "not generated after another output failed"
+		}
+		statuses[i] = s
+	}
+	return statuses
+}
+
+// runError describes a failed run. Runs whose outputs failed, rather than
+// the source or the configuration, list every output; a run in which some
+// outputs are in place is a partial failure answered with 207 Multi-Status.
+func runError(result *imageprocessor.Result, err error) (int, APIError) {
+	status, code := processError(err)
+	apiErr := APIError{Code: code, Message: err.Error()}
+	if outErr := (*imageprocessor.OutputError)(nil); !errors.As(err, &outErr) {
+		return status, apiErr
+	}
+	apiErr.Outputs = outputStatuses(result)
+	if done := result.Count(imageprocessor.StatusGenerated) + result.Count(imageprocessor.StatusUnchanged); done > 0 {
+		status, apiErr.Code = http.StatusMultiStatus, CodePartialFailure
+		apiErr.Message = fmt.Sprintf("%d of %d outputs failed", result.Count(imageprocessor.StatusFailed), len(result.Outputs))
+	}
+	return status, apiErr
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// JobState is the lifecycle stage of an asynchronous job.
+type JobState string
+
+const (
+	// JobQueued means the job waits for a free job worker.
+	JobQueued JobState = "queued"
+	// JobRunning means the job is being processed.
+	JobRunning JobState = "running"
+	// JobSucceeded means the outputs are ready for download.
+	JobSucceeded JobState = "succeeded"
+	// JobPartial means some outputs failed; the others are ready for
+	// download.
+	JobPartial JobState = "partial"
+	// JobFailed means processing returned an error.
+	JobFailed JobState = "failed"
+)
+
+// Job is an asynchronous generation request.
+type Job struct {
+	ID         string     `json:"id"`
+	State      JobState   `json:"state"`
+	Tenant     string     `json:"tenant,omitempty"`
+	Preset     string     `json:"preset,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// Code is the error code of a failed or partial job.
+	Code     string                   `json:"code,omitempty"`
+	Manifest *imageprocessor.Manifest `json:"manifest,omitempty"`
+	// Outputs reports every output of a partial job, or of a failed job
+	// whose outputs failed.
+	Outputs []OutputStatus `json:"outputs,omitempty"`
+	// Callback receives the finished job as JSON.
+	Callback string `json:"callback,omitempty"`
+	// Dir holds the job's source and outputs on the server's disk.
+	Dir string `json:"-"`
+}
+
+// ErrJobNotFound is returned by a JobStore for unknown job IDs.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStore keeps the state of asynchronous jobs. Implementations must be safe
+// for concurrent use; a shared store such as Redis lets several replicas
+// answer status polls.
+type JobStore interface {
+	Put(job Job) error
+	Get(id string) (Job, error)
+	Delete(id string) error
+}
+
+// MemoryJobStore keeps jobs in memory until the process exits.
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryJobStore returns an empty in-memory job store.
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: map[string]Job{}}
+}
+
+// Put stores a copy of job.
+func (m *MemoryJobStore) Put(job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = job
+	return nil
+}
+
+// Get returns a copy of the job with the given ID.
+func (m *MemoryJobStore) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Delete forgets the job with the given ID.
+func (m *MemoryJobStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+	return nil
+}
+
+// handleSubmitJob stores the upload like handleGenerate, queues it and
+// answers 202 Accepted with the job, whose URL is in the Location header. An
+// optional callback form field or query parameter names a URL notified when
+// the job finishes.
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	logger := imageprocessor.Logger(r.Context())
+
+	dims, ok := s.dimensionsFor(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	job := Job{ID: newRequestID(), State: JobQueued, Preset: r.URL.Query().Get("preset"), CreatedAt: time.Now().UTC()}
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		job.Tenant = tenant.Name
+	}
+	if job.Dir, err = os.MkdirTemp(s.cfg.WorkDir, "logo-generator-job-"); err != nil {
+		logger.Error("failed to create job directory", "error", err)
+		writeInternalError(w)
+		return
+	}
+	if err := saveUpload(r, filepath.Join(job.Dir, "source")); err != nil {
+		os.RemoveAll(job.Dir)
+		logger.Warn("failed to read upload", "error", err)
+		writeUploadError(w, err)
+		return
+	}
+	if callback := r.FormValue("callback"); callback != "" {
+		if job.Callback, err = parseCallback(callback); err != nil {
+			os.RemoveAll(job.Dir)
+			writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return
+		}
+	}
+	if err := s.cfg.Jobs.Put(job); err != nil {
+		os.RemoveAll(job.Dir)
+		logger.Error("failed to store job", "error", err)
+		writeInternalError(w)
+		return
+	}
+
+	audit := auditFrom(r.Context())
+	audit.JobID = job.ID
+	s.jobsGroup.Add(1)
+	go s.runJob(job, dims, *audit)
+
+	logger.Info("job queued", "job", job.ID)
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// runJob waits for a job slot, processes the job, records the outcome and
+// notifies the job's callback. audit is the entry of the submission, which
+// the job's own entry takes who submitted it from.
+func (s *Server) runJob(job Job, dims []imageprocessor.Dimension, audit AuditEntry) {
+	defer s.jobsGroup.Done()
+	logger := s.cfg.Logger.With("job", job.ID)
+	ctx := imageprocessor.WithLogger(s.jobCtx, logger)
+	audit.Event, audit.Status, audit.Code, audit.Destinations = "job.finished", http.StatusOK, "", nil
+	ctx = context.WithValue(ctx, auditKey{}, &audit)
+
+	// Larger jobs cost their tenant more of its share. A canceled job still
+	// runs through ProcessImage, which fails it at once.
+	if release, err := s.jobQueue.acquire(ctx, job.Tenant, s.tenantWeight(job.Tenant), float64(len(dims))); err == nil {
+		defer release()
+	}
+
+	job.State = JobRunning
+	s.putJob(job)
+
+	sourcePath, outputDir := filepath.Join(job.Dir, "source"), filepath.Join(job.Dir, "output")
+	key := s.resultCacheKey(ctx, sourcePath, dims)
+	result, hit := s.cachedResult(ctx, key, sourcePath, outputDir)
+	var err error
+	if !hit {
+		result, err = imageprocessor.ProcessImage(ctx, sourcePath, outputDir, dims, s.runOptions(job.Tenant, false))
+		if err == nil {
+			s.storeResult(ctx, key, result)
+		}
+	}
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	job.State = JobSucceeded
+	auditResult(&audit, result, hit)
+	if err != nil {
+		status, apiErr := runError(result, err)
+		audit.Status = status
+		job.State, job.Error, job.Code, job.Outputs = JobFailed, apiErr.Message, apiErr.Code, apiErr.Outputs
+		// The outputs that are in place stay available after a partial failure
+		if status == http.StatusMultiStatus {
+			job.State = JobPartial
+		}
+		logger.Warn("job failed", "error", err, "state", job.State)
+	}
+	if job.State != JobFailed {
+		// Keep a copy in the tenant's destination, like synchronous requests
+		if tenant := s.tenantNamed(job.Tenant); tenant != nil && tenant.Destination != "" {
+			dest := filepath.Join(tenant.Destination, job.ID)
+			if err := copyOutputs(result, dest); err != nil {
+				logger.Error("failed to store outputs", "destination", dest, "error", err)
+				audit.Status = http.StatusInternalServerError
+				job.State, job.Error, job.Code, job.Outputs = JobFailed, "failed to store outputs", CodeInternal, nil
+			} else {
+				audit.Destinations = append(audit.Destinations, dest)
+			}
+		}
+	}
+	switch job.State {
+	case JobFailed:
+		os.RemoveAll(job.Dir)
+	case JobSucceeded, JobPartial:
+		manifest := result.Manifest()
+		// The source is a file in the job directory; don't expose its path
+		manifest.Source = filepath.Base(manifest.Source)
+		job.Manifest = &manifest
+		if job.State == JobSucceeded {
+			logger.Info("job succeeded", "duration", result.Duration)
+			s.recordRun(ctx, Run{ID: job.ID, Tenant: job.Tenant, Preset: job.Preset}, result)
+		}
+	}
+	s.putJob(job)
+	audit.Time, audit.Code = finished, job.Code
+	s.writeAudit(ctx, audit)
+
+	// Keep the outputs and the job's state until it expires
+	s.workDirs.track(job.Dir, func() {
+		if err := s.cfg.Jobs.Delete(job.ID); err != nil {
+			s.cfg.Logger.Error("failed to delete job", "job", job.ID, "error", err)
+		}
+	})
+	s.expireWorkDirs()
+
+	// Deliver the callback without holding on to the job slot
+	if job.Callback != "" {
+		s.jobsGroup.Add(1)
+		go func() {
+			defer s.jobsGroup.Done()
+			s.notifyCallback(ctx, job)
+		}()
+	}
+}
+
+// tenantNamed returns the configured tenant with the given name, if any.
+func (s *Server) tenantNamed(name string) *Tenant {
+	for i := range s.cfg.Tenants {
+		if s.cfg.Tenants[i].Name == name {
+			return &s.cfg.Tenants[i]
+		}
+	}
+	return nil
+}
+
+// putJob stores a job update, logging stores that fail.
+func (s *Server) putJob(job Job) {
+	if err := s.cfg.Jobs.Put(job); err != nil {
+		s.cfg.Logger.Error("failed to store job", "job", job.ID, "error", err)
+	}
+}
+
+// handleJobStatus reports the state of a job, and its manifest once it succeeded.
+func (s *Server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleJobDownload responds with a zip of the outputs of a succeeded or
+// partial job.
+func (s *Server) handleJobDownload(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if job.State != JobSucceeded && job.State != JobPartial {
+		writeError(w, http.StatusConflict, CodeConflict, "job is "+string(job.State))
+		return
+	}
+	s.workDirs.touch(job.Dir)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="logos.zip"`)
+	if notModified(w, r, manifestETag(job.Manifest), job.Manifest.GeneratedAt) {
+		return
+	}
+	if err := writeManifestZip(w, filepath.Join(job.Dir, "output"), job.Manifest); err != nil {
+		imageprocessor.Logger(r.Context()).Error("failed to write zip", "error", err)
+	}
+}
+
+// lookupJob loads the job named in the path, answering 404 for unknown jobs
+// and for jobs of other tenants.
+func (s *Server) lookupJob(w http.ResponseWriter, r *http.Request) (Job, bool) {
+	job, err := s.cfg.Jobs.Get(r.PathValue("id"))
+	if err == nil {
+		if tenant := tenantFrom(r.Context()); tenant != nil && tenant.Name != job.Tenant {
+			err = ErrJobNotFound
+		}
+	}
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeError(w, http.StatusNotFound, CodeNotFound, err.Error())
+		return Job{}, false
+	case err != nil:
+		imageprocessor.Logger(r.Context()).Error("failed to load job", "error", err)
+		writeInternalError(w)
+		return Job{}, false
+	}
+	return job, true
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// rateLimiter keeps a token bucket per client: each request takes a token,
+// and tokens come back at a steady rate up to a burst.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket holds the tokens of one client as of last.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token from the bucket of key, refilled at rate tokens per
+// second up to burst. When the bucket is empty it returns how long until
+// the next token.
+func (l *rateLimiter) take(key string, rate float64, burst int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	// Forget clients whose buckets have filled up again, so addresses
+	// seen once don't accumulate
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// limitClients answers 429 Too Many Requests to clients exceeding the
+// configured request rate. Health probes are never limited.
+func (s *Server) limitClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.RateLimit <= 0 || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := s.clientIP(r)
+		if ok, wait := s.limiter.take("ip/"+ip, s.cfg.RateLimit, s.cfg.RateBurst); !ok {
+			imageprocessor.Logger(r.Context()).Warn("request rate limited", "client", ip)
+			writeRateLimited(w, wait, "too many requests from "+ip)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client of r: the last X-Forwarded-For
+// entry, added by a trusted reverse proxy, or the peer address.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.cfg.TrustForwardedFor {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			entries := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// takeTenantRate charges a work-starting request to the per-minute rate of
+// its tenant, answering 429 and returning false once it is exceeded.
+func (s *Server) takeTenantRate(w http.ResponseWriter, t *Tenant) bool {
+	perMinute := t.Quota.RequestsPerMinute
+	if perMinute <= 0 {
+		return true
+	}
+	if ok, wait := s.limiter.take("tenant/"+t.Name, float64(perMinute)/60, perMinute); !ok {
+		writeRateLimited(w, wait, fmt.Sprintf("rate limit of %d requests per minute exceeded", perMinute))
+		return false
+	}
+	return true
+}
+
+// writeRateLimited answers 429 with a Retry-After header of wait, in whole
+// seconds.
+func writeRateLimited(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	writeError(w, http.StatusTooManyRequests, CodeRateLimited, message)
+}
+
+// limitBody caps the body of an upload at maxBytes, answering 413 right
+// away and returning false when the announced length already exceeds it.
+// Bodies without a length fail with an *http.MaxBytesError once read past
+// the limit.
+func limitBody(w http.ResponseWriter, r *http.Request, maxBytes int64) bool {
+	if maxBytes <= 0 {
+		return true
+	}
+	if r.ContentLength > maxBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, tooLargeMessage(maxBytes))
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	return true
+}
+
+// tooLargeMessage describes an upload over maxBytes.
+func tooLargeMessage(maxBytes int64) string {
+	return "upload is larger than the limit of " + imageprocessor.FormatBytes(maxBytes)
+}
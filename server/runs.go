@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+const (
+	// defaultRunsPage and maxRunsPage bound the runs listed per page.
+	defaultRunsPage = 20
+	maxRunsPage     = 100
+)
+
+// Run is a past generation kept in the run history.
+type Run struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Preset    string    `json:"preset,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Outputs is the number of generated files.
+	Outputs  int                      `json:"outputs"`
+	Manifest *imageprocessor.Manifest `json:"manifest,omitempty"`
+}
+
+// RunHistory keeps the outputs of every successful run in a directory, one
+// subdirectory per run holding the outputs, their manifest and a run.json.
+// An index of the runs is kept in memory, newest first.
+type RunHistory struct {
+	dir  string
+	mu   sync.RWMutex
+	runs []Run
+}
+
+// OpenRunHistory opens the run history in dir, creating it if needed and
+// indexing the runs recorded earlier.
+func OpenRunHistory(dir string) (*RunHistory, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run history: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run history: %w", err)
+	}
+
+	h := &RunHistory{dir: dir}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), "run.json"))
+		if errors.Is(err, os.ErrNotExist) {
+			// A run that was interrupted while being recorded
+			continue
+		}
+		var run Run
+		if err == nil {
+			err = json.Unmarshal(data, &run)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run %s: %w", e.Name(), err)
+		}
+		h.runs = append(h.runs, run)
+	}
+	slices.SortFunc(h.runs, func(a, b Run) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return h, nil
+}
+
+// record copies the outputs of result into the history as run. The run's
+// metadata is written last, so a run interrupted midway is ignored.
+func (h *RunHistory) record(run Run, result *imageprocessor.Result) error {
+	manifest := result.Manifest()
+	manifest.Source = filepath.Base(manifest.Source)
+	run.Manifest = &manifest
+	run.Outputs = len(manifest.Outputs)
+
+	dir := filepath.Join(h.dir, run.ID)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	if err := copyOutputs(result, dir); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "run.json"), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = slices.Insert(h.runs, 0, run)
+	return nil
+}
+
+// list returns up to limit runs of tenant, newest first, starting after the
+// run named by cursor. The returned cursor is empty on the last page.
+func (h *RunHistory) list(tenant, cursor string, limit int) ([]Run, string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	start := 0
+	if cursor != "" {
+		i := slices.IndexFunc(h.runs, func(r Run) bool { return r.ID == cursor && r.Tenant == tenant })
+		if i < 0 {
+			return nil, "", fmt.Errorf("unknown cursor %q", cursor)
+		}
+		start = i + 1
+	}
+
+	runs := []Run{}
+	for _, run := range h.runs[start:] {
+		if run.Tenant != tenant {
+			continue
+		}
+		if len(runs) == limit {
+			return runs, runs[len(runs)-1].ID, nil
+		}
+		run.Manifest = nil
+		runs = append(runs, run)
+	}
+	return runs, "", nil
+}
+
+// get returns the run with the given ID if it belongs to tenant.
+func (h *RunHistory) get(tenant, id string) (Run, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	i := slices.IndexFunc(h.runs, func(r Run) bool { return r.ID == id && r.Tenant == tenant })
+	if i < 0 {
+		return Run{}, false
+	}
+	return h.runs[i], true
+}
+
+// recordRun adds a successful run to the history, if the server keeps one.
+func (s *Server) recordRun(ctx context.Context, run Run, result *imageprocessor.Result) {
+	if s.cfg.History == nil {
+		return
+	}
+	run.CreatedAt = time.Now().UTC()
+	if err := s.cfg.History.record(run, result); err != nil {
+		imageprocessor.Logger(ctx).Error("failed to record run", "run", run.ID, "error", err)
+		return
+	}
+	audit := auditFrom(ctx)
+	audit.Destinations = append(audit.Destinations, filepath.Join(s.cfg.History.dir, run.ID))
+}
+
+// handleListRuns lists the requester's past runs, newest first. The limit
+// query parameter sets the page size, and the next field of a page is the
+// cursor query parameter of the following one.
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRunsPage
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRunsPage {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, "limit must be between 1 and "+strconv.Itoa(maxRunsPage))
+			return
+		}
+		limit = n
+	}
+
+	runs, next, err := s.cfg.History.list(tenantName(r), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Runs []Run  `json:"runs"`
+		Next string `json:"next,omitempty"`
+	}{runs, next})
+}
+
+// handleGetRun reports a past run with its manifest.
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.cfg.History.get(tenantName(r), r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleRunDownload responds with a zip of a past run's outputs.
+func (s *Server) handleRunDownload(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.cfg.History.get(tenantName(r), r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "run not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="logos-`+run.ID+`.zip"`)
+	if notModified(w, r, manifestETag(run.Manifest), run.Manifest.GeneratedAt) {
+		return
+	}
+	if err := writeManifestZip(w, filepath.Join(s.cfg.History.dir, run.ID), run.Manifest); err != nil {
+		imageprocessor.Logger(r.Context()).Error("failed to write zip", "error", err)
+	}
+}
+
+// tenantName returns the name of the request's tenant, empty without tenants.
+func tenantName(r *http.Request) string {
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		return tenant.Name
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// interactiveWeight is how many times the share of a tenant's batch jobs
+// its interactive requests, previews and synchronous generation, get.
+const interactiveWeight = 8
+
+// scheduler hands out a fixed number of slots to flows in proportion to
+// their weights, using start-time fair queuing: every request is tagged
+// with the virtual time its flow would start it at, and free slots go to
+// the lowest tag. A flow that submits a lot therefore waits behind flows
+// that submit little instead of starving them.
+type scheduler struct {
+	mu      sync.Mutex
+	free    int
+	vtime   float64
+	seq     uint64
+	finish  map[string]float64
+	waiting []*waiter
+}
+
+// waiter is a request queued for a slot.
+type waiter struct {
+	start float64
+	seq   uint64
+	ready chan struct{}
+}
+
+// newScheduler returns a scheduler with the given number of slots.
+func newScheduler(slots int) *scheduler {
+	return &scheduler{free: max(1, slots), finish: map[string]float64{}}
+}
+
+// acquire waits for a slot for a request of flow costing cost, returning
+// the function that gives it back. It fails only when ctx is done first.
+func (s *scheduler) acquire(ctx context.Context, flow string, weight, cost float64) (func(), error) {
+	s.mu.Lock()
+	start := max(s.vtime, s.finish[flow])
+	s.finish[flow] = start + cost/weight
+	if s.free > 0 && len(s.waiting) == 0 {
+		s.free--
+		s.vtime = start
+		s.mu.Unlock()
+		return s.release, nil
+	}
+	w := &waiter{start: start, seq: s.seq, ready: make(chan struct{})}
+	s.seq++
+	s.waiting = append(s.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if i := slices.Index(s.waiting, w); i >= 0 {
+			s.waiting = slices.Delete(s.waiting, i, i+1)
+			s.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		s.mu.Unlock()
+		// The slot was handed over while the request gave up
+		s.release()
+		return nil, ctx.Err()
+	}
+}
+
+// release gives a slot back, handing it to the waiting request with the
+// lowest start tag, in arrival order among equal tags.
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiting) == 0 {
+		s.free++
+		return
+	}
+	next := 0
+	for i, w := range s.waiting {
+		if w.start < s.waiting[next].start || (w.start == s.waiting[next].start && w.seq < s.waiting[next].seq) {
+			next = i
+		}
+	}
+	w := s.waiting[next]
+	s.waiting = slices.Delete(s.waiting, next, next+1)
+	s.vtime = w.start
+	close(w.ready)
+}
+
+// runOptions returns the processor options of a run for tenant. Each output
+// of the run waits for one of the server's processing slots, shared fairly
+// between tenants, with interactive runs weighted above batch jobs.
+func (s *Server) runOptions(tenant string, interactive bool) imageprocessor.Options {
+	opts := s.cfg.Options
+	flow, weight := "batch/"+tenant, s.tenantWeight(tenant)
+	if interactive {
+		flow, weight = "interactive/"+tenant, weight*interactiveWeight
+	}
+	opts.Acquire = func(ctx context.Context) (func(), error) {
+		return s.slots.acquire(ctx, flow, weight, 1)
+	}
+	return opts
+}
+
+// tenantWeight returns the scheduling weight of the named tenant.
+func (s *Server) tenantWeight(name string) float64 {
+	if tenant := s.tenantNamed(name); tenant != nil && tenant.Weight > 0 {
+		return tenant.Weight
+	}
+	return 1
+}
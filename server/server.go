@@ -0,0 +1,532 @@
+// Package server exposes the image processor over HTTP.
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Config controls the HTTP server.
+type Config struct {
+	// Addr is the TCP address to listen on, e.g. ":8080".
+	Addr string
+	// Dimensions are generated for every upload.
+	Dimensions []imageprocessor.Dimension
+	// Options are passed to the processor for every upload.
+	Options imageprocessor.Options
+	// Logger is the base logger; each request logs through a child carrying its request ID.
+	Logger *slog.Logger
+	// WorkDir holds uploads and job outputs; empty means the system temp directory.
+	WorkDir string
+	// SessionTTL is how long preview sessions and finished jobs are kept
+	// after their last use; zero means an hour.
+	SessionTTL time.Duration
+	// MaxDiskUsage caps the bytes kept for sessions and finished jobs, removing
+	// the least recently used first; zero means no limit.
+	MaxDiskUsage int64
+	// JobWorkers is the number of asynchronous jobs processed at once; zero means one.
+	JobWorkers int
+	// Slots is the number of outputs rendered at once across all runs;
+	// zero means the number of CPUs. Waiting outputs are served fairly
+	// between tenants, and previews and synchronous requests go ahead of
+	// batch jobs, so a large job cannot starve them.
+	Slots int
+	// Jobs stores the state of asynchronous jobs; nil means in memory.
+	Jobs JobStore
+	// PublicURL is the externally reachable base URL of the server, e.g.
+	// "https://logos.example.com". When set, job callbacks include a signed
+	// download link.
+	PublicURL string
+	// AllowPrivateCallbacks lets job callbacks reach loopback, private and
+	// link-local addresses, such as a receiver on the same host. They are
+	// refused by default, so tenants cannot make the server call internal
+	// services or the cloud metadata endpoint.
+	AllowPrivateCallbacks bool
+	// LinkTTL is how long signed download links stay valid; zero means a day.
+	LinkTTL time.Duration
+	// LinkSecret signs download links; empty means a random secret, so links
+	// only work on the server that issued them.
+	LinkSecret []byte
+	// DrainTimeout bounds how long shutdown waits for in-flight requests and
+	// jobs before canceling them; zero means 30 seconds.
+	DrainTimeout time.Duration
+	// DrainDelay keeps the listener open with /readyz failing for this long
+	// after shutdown starts, so load balancers stop routing to the server
+	// before it stops accepting connections. It counts toward DrainTimeout.
+	DrainDelay time.Duration
+	// DisableUI stops serving the web UI at /.
+	DisableUI bool
+	// History, when set, keeps the outputs of every successful run so they
+	// can be listed and downloaded again.
+	History *RunHistory
+	// Tenants, when set, require every generate request to carry one of
+	// their API keys and replace Dimensions with the tenant's presets.
+	Tenants []Tenant
+	// MaxUploadBytes caps the body of requests that upload a source; zero
+	// means no limit. A tenant's quota may set a lower one.
+	MaxUploadBytes int64
+	// RateLimit caps the requests per second of every client IP address,
+	// allowing bursts of RateBurst requests; zero means no limit and zero
+	// RateBurst means the rate rounded up.
+	RateLimit float64
+	RateBurst int
+	// TrustForwardedFor takes client addresses from the last entry of the
+	// X-Forwarded-For header, for servers behind a reverse proxy.
+	TrustForwardedFor bool
+	// TLSCert and TLSKey are PEM files of the certificate to serve HTTPS
+	// with. They are reread when they change, so renewed certificates are
+	// picked up without a restart.
+	TLSCert, TLSKey string
+	// ClientCA, with TLS, is a PEM file of the CAs that must sign client
+	// certificates. Requests without one are refused, except health probes.
+	ClientCA string
+	// APIKeys, when set on a server without tenants, requires the requests
+	// that tenants would authenticate to carry one of its keys.
+	APIKeys *KeySet
+	// Audit, when set, records every generation request and job.
+	Audit *AuditLog
+	// Cache, when set, keeps the outputs of successful runs so requests
+	// for the same source and dimensions, on any replica sharing the
+	// cache, are answered without processing.
+	Cache Cache
+}
+
+// Server handles logo generation requests.
+type Server struct {
+	cfg        Config
+	mux        *http.ServeMux
+	usage      usage
+	limiter    rateLimiter
+	sessions   sessions
+	workDirs   workDirs
+	linkSecret []byte
+	// callbacks delivers job callbacks.
+	callbacks *http.Client
+	// draining is set once shutdown starts; new work is refused from then on.
+	draining atomic.Bool
+
+	// slots schedules the outputs of every run.
+	slots *scheduler
+	// Asynchronous jobs run on jobCtx, which outlives their requests, and
+	// are admitted by jobQueue, fairly between tenants.
+	jobCtx    context.Context
+	stopJobs  context.CancelFunc
+	jobQueue  *scheduler
+	jobsGroup sync.WaitGroup
+}
+
+// New returns a server for cfg.
+func New(cfg Config) *Server {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	if cfg.Jobs == nil {
+		cfg.Jobs = NewMemoryJobStore()
+	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = time.Hour
+	}
+	if cfg.LinkTTL == 0 {
+		cfg.LinkTTL = 24 * time.Hour
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	if cfg.RateBurst == 0 {
+		cfg.RateBurst = max(1, int(math.Ceil(cfg.RateLimit)))
+	}
+	if cfg.Slots == 0 {
+		cfg.Slots = runtime.NumCPU()
+	}
+	s := &Server{cfg: cfg, mux: http.NewServeMux(), slots: newScheduler(cfg.Slots), jobQueue: newScheduler(cfg.JobWorkers), callbacks: callbackClient(cfg.AllowPrivateCallbacks)}
+	s.linkSecret = cfg.LinkSecret
+	if len(s.linkSecret) == 0 {
+		s.linkSecret = make([]byte, 32)
+		rand.Read(s.linkSecret)
+	}
+	s.jobCtx, s.stopJobs = context.WithCancel(imageprocessor.WithLogger(context.Background(), cfg.Logger))
+	s.mux.HandleFunc("POST /generate", s.acceptingWork(s.requireTenant(s.audited("generate", s.handleGenerate))))
+	s.mux.HandleFunc("POST /jobs", s.acceptingWork(s.requireTenant(s.audited("job.submitted", s.handleSubmitJob))))
+	s.mux.HandleFunc("GET /jobs/{id}", s.authenticate(s.handleJobStatus))
+	s.mux.HandleFunc("GET /jobs/{id}/download", s.handleDownload)
+	s.mux.HandleFunc("GET /jobs/{id}/files/{name}", s.authenticate(s.handleJobFile))
+	if cfg.History != nil {
+		s.mux.HandleFunc("GET /runs", s.authenticate(s.handleListRuns))
+		s.mux.HandleFunc("GET /runs/{id}", s.authenticate(s.handleGetRun))
+		s.mux.HandleFunc("GET /runs/{id}/download", s.authenticate(s.handleRunDownload))
+	}
+	s.mux.HandleFunc("GET /presets", s.authenticate(s.handlePresets))
+	s.mux.HandleFunc("POST /sessions", s.acceptingWork(s.requireTenant(s.handleCreateSession)))
+	s.mux.HandleFunc("GET /preview", s.authenticate(s.handlePreview))
+	s.mux.HandleFunc("GET /schema.json", s.handleSchema)
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	if !cfg.DisableUI {
+		s.mux.HandleFunc("GET /{$}", s.handleUI)
+	}
+	return s
+}
+
+// Handler returns the HTTP handler with request logging, client
+// certificate checks and rate limiting applied.
+func (s *Server) Handler() http.Handler {
+	return s.withRequestLogger(s.requireClientCert(s.limitClients(s.mux)))
+}
+
+// ListenAndServe serves until ctx is canceled, then drains: new work is
+// refused while in-flight requests and asynchronous jobs get up to
+// DrainTimeout to finish before they are canceled.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Addr:              s.cfg.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+
+	cleanupCtx, stopCleanup := context.WithCancel(ctx)
+	defer stopCleanup()
+	go s.cleanupWorkDirs(cleanupCtx)
+	if s.cfg.APIKeys != nil {
+		go s.watchAPIKeys(cleanupCtx)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		s.cfg.Logger.Info("server listening", "addr", s.cfg.Addr, "tls", tlsConfig != nil, "client_certs", s.cfg.ClientCA != "")
+		if tlsConfig != nil {
+			errc <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		s.draining.Store(true)
+		s.cfg.Logger.Info("draining", "delay", s.cfg.DrainDelay, "timeout", s.cfg.DrainTimeout)
+		drainCtx, cancel := context.WithTimeout(context.Background(), s.cfg.DrainTimeout)
+		defer cancel()
+
+		select {
+		case <-time.After(s.cfg.DrainDelay):
+		case <-drainCtx.Done():
+		}
+		err := srv.Shutdown(drainCtx)
+		if err != nil {
+			srv.Close()
+		}
+
+		jobsDone := make(chan struct{})
+		go func() {
+			s.jobsGroup.Wait()
+			close(jobsDone)
+		}()
+		select {
+		case <-jobsDone:
+		case <-drainCtx.Done():
+			s.cfg.Logger.Warn("drain timed out, canceling jobs")
+			s.stopJobs()
+			<-jobsDone
+		}
+		s.stopJobs()
+
+		// Sessions and jobs live in memory, so their files are useless after exit
+		s.workDirs.expire(-1, 0)
+		return err
+	}
+}
+
+// withRequestLogger assigns every request an ID, taken from the X-Request-ID
+// header when present, and stores a logger carrying it in the request context.
+func (s *Server) withRequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Request IDs name directories, so only simple ones are accepted
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		logger := s.cfg.Logger.With("request_id", id)
+		start := time.Now()
+		// Probes arrive every few seconds and would drown out real requests
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		logger.Log(r.Context(), level, "request started", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(imageprocessor.WithLogger(r.Context(), logger)))
+
+		logger.Log(r.Context(), level, "request finished", "status", rec.status, "duration", time.Since(start))
+	})
+}
+
+// handleGenerate accepts a source image as the "image" form file or as the raw
+// request body and responds with a zip of the generated outputs. Tenants pick
+// one of their presets with the preset query parameter.
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	logger := imageprocessor.Logger(r.Context())
+	tenant := tenantFrom(r.Context())
+
+	dims, ok := s.dimensionsFor(w, r)
+	if !ok {
+		return
+	}
+
+	workDir, err := os.MkdirTemp(s.cfg.WorkDir, "logo-generator-")
+	if err != nil {
+		logger.Error("failed to create work directory", "error", err)
+		writeInternalError(w)
+		return
+	}
+	defer os.RemoveAll(workDir)
+
+	// Store the upload so the processor can read it like any other source
+	sourcePath := filepath.Join(workDir, "source")
+	if err := saveUpload(r, sourcePath); err != nil {
+		logger.Warn("failed to read upload", "error", err)
+		writeUploadError(w, err)
+		return
+	}
+
+	outputDir := filepath.Join(workDir, "output")
+	key := s.resultCacheKey(r.Context(), sourcePath, dims)
+	result, hit := s.cachedResult(r.Context(), key, sourcePath, outputDir)
+	if !hit {
+		result, err = imageprocessor.ProcessImage(r.Context(), sourcePath, outputDir, dims, s.runOptions(tenantName(r), true))
+		auditResult(auditFrom(r.Context()), result, false)
+		if err != nil {
+			status, apiErr := runError(result, err)
+			auditFrom(r.Context()).Code = apiErr.Code
+			writeJSON(w, status, apiErr)
+			return
+		}
+		s.storeResult(r.Context(), key, result)
+	} else {
+		auditResult(auditFrom(r.Context()), result, true)
+	}
+
+	// Keep a copy in the tenant's destination before responding
+	if tenant != nil && tenant.Destination != "" {
+		dest := filepath.Join(tenant.Destination, w.Header().Get("X-Request-ID"))
+		if err := copyOutputs(result, dest); err != nil {
+			logger.Error("failed to store outputs", "destination", dest, "error", err)
+			writeInternalError(w)
+			return
+		}
+		audit := auditFrom(r.Context())
+		audit.Destinations = append(audit.Destinations, dest)
+	}
+
+	id := w.Header().Get("X-Request-ID")
+	s.recordRun(r.Context(), Run{ID: id, Tenant: tenantName(r), Preset: r.URL.Query().Get("preset")}, result)
+
+	if s.cfg.Cache != nil {
+		w.Header().Set("X-Cache", cacheStatus(hit))
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="logos.zip"`)
+	if err := writeZip(w, result); err != nil {
+		logger.Error("failed to write zip", "error", err)
+	}
+}
+
+// acceptingWork answers 503 instead of starting new work while the server drains.
+func (s *Server) acceptingWork(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "server is shutting down")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleHealthz reports that the process is alive.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the server accepts new work, failing once it
+// drains so load balancers stop routing to it.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "draining")
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// handleSchema serves the JSON Schema of the config file format.
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := imageprocessor.ConfigSchema()
+	if err != nil {
+		imageprocessor.Logger(r.Context()).Error("failed to generate schema", "error", err)
+		writeInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
+}
+
+// dimensionsFor returns the dimensions a request generates: the tenant's
+// requested preset, or without tenants any built-in preset named by the
+// preset query parameter, defaulting to the server's dimensions. It answers
+// the request itself when the preset cannot be used.
+func (s *Server) dimensionsFor(w http.ResponseWriter, r *http.Request) ([]imageprocessor.Dimension, bool) {
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		dims, err := tenantDimensions(tenant, r)
+		if err != nil {
+			writeError(w, http.StatusForbidden, CodeForbidden, err.Error())
+			return nil, false
+		}
+		return dims, true
+	}
+	if name := r.URL.Query().Get("preset"); name != "" {
+		dims, err := imageprocessor.LoadPreset(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeBadRequest, err.Error())
+			return nil, false
+		}
+		return dims, true
+	}
+	return s.cfg.Dimensions, true
+}
+
+// saveUpload writes the uploaded image to path.
+func saveUpload(r *http.Request, path string) error {
+	body := io.Reader(r.Body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			return fmt.Errorf("failed to read form file: %w", err)
+		}
+		defer file.Close()
+		body = file
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, body); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	return out.Close()
+}
+
+// writeZip streams the generated outputs of result as a zip archive.
+func writeZip(w io.Writer, result *imageprocessor.Result) error {
+	zw := zip.NewWriter(w)
+	for _, out := range result.Outputs {
+		if !out.Status.Succeeded() {
+			continue
+		}
+		if err := addZipFile(zw, out.Dimension.Name, out.Path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeManifestZip streams the outputs listed in m, stored in dir, as a zip
+// archive.
+func writeManifestZip(w io.Writer, dir string, m *imageprocessor.Manifest) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range m.Outputs {
+		if err := addZipFile(zw, entry.Name, filepath.Join(dir, entry.Name)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyOutputs copies the generated outputs of result and their manifest into dir.
+func copyOutputs(result *imageprocessor.Result, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, out := range result.Outputs {
+		if !out.Status.Succeeded() {
+			continue
+		}
+		data, err := os.ReadFile(out.Path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, out.Dimension.Name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return result.WriteManifest(filepath.Join(dir, "manifest.json"))
+}
+
+// addZipFile copies the file at path into the archive under name.
+func addZipFile(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, f)
+	return err
+}
+
+// validRequestID matches the X-Request-ID values taken over from clients.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// newRequestID returns a random 16 character hex identifier.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// maxPreviewSize bounds the size of previews rendered on demand.
+const maxPreviewSize = 1024
+
+// session holds a source uploaded for previews until it expires.
+type session struct {
+	ID      string
+	Tenant  string
+	Dir     string
+	Created time.Time
+}
+
+// sessions keeps the sources uploaded for previews.
+type sessions struct {
+	mu   sync.Mutex
+	byID map[string]*session
+}
+
+// add registers sess.
+func (ss *sessions) add(sess *session) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.byID == nil {
+		ss.byID = map[string]*session{}
+	}
+	ss.byID[sess.ID] = sess
+}
+
+// remove forgets the session with the given ID.
+func (ss *sessions) remove(id string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.byID, id)
+}
+
+// get returns the session with the given ID, or nil.
+func (ss *sessions) get(id string) *session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.byID[id]
+}
+
+// handleCreateSession stores an uploaded source for previews and answers
+// 201 Created with the session ID.
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	logger := imageprocessor.Logger(r.Context())
+
+	sess := &session{ID: newRequestID(), Created: time.Now().UTC()}
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		sess.Tenant = tenant.Name
+	}
+	var err error
+	if sess.Dir, err = os.MkdirTemp(s.cfg.WorkDir, "logo-generator-session-"); err != nil {
+		logger.Error("failed to create session directory", "error", err)
+		writeInternalError(w)
+		return
+	}
+	if err := saveUpload(r, filepath.Join(sess.Dir, "source")); err != nil {
+		os.RemoveAll(sess.Dir)
+		logger.Warn("failed to read upload", "error", err)
+		writeUploadError(w, err)
+		return
+	}
+	s.sessions.add(sess)
+	s.workDirs.track(sess.Dir, func() { s.sessions.remove(sess.ID) })
+	s.expireWorkDirs()
+
+	logger.Info("session created", "session", sess.ID)
+	writeJSON(w, http.StatusCreated, map[string]string{"id": sess.ID})
+}
+
+// handlePreview renders one square size of a session's source as PNG. The
+// size, mask and bg query parameters pick its size, an optional circle or
+// rounded mask and an optional background color.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sess := s.sessions.get(q.Get("session"))
+	if tenant := tenantFrom(r.Context()); sess == nil || (tenant != nil && tenant.Name != sess.Tenant) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "session not found")
+		return
+	}
+
+	s.workDirs.touch(sess.Dir)
+
+	size, err := strconv.Atoi(q.Get("size"))
+	if err != nil || size < 1 || size > maxPreviewSize {
+		writeError(w, http.StatusBadRequest, CodeBadRequest, "size must be between 1 and "+strconv.Itoa(maxPreviewSize))
+		return
+	}
+	dim := imageprocessor.Dimension{Width: uint(size), Height: uint(size), Name: "preview.png"}
+	if bg := q.Get("bg"); bg != "" {
+		dim.Filters = append(dim.Filters, imageprocessor.FilterSpec{Type: "background", Color: bg})
+	}
+	if mask := q.Get("mask"); mask != "" && mask != "none" {
+		dim.Filters = append(dim.Filters, imageprocessor.FilterSpec{Type: "mask", Shape: mask})
+	}
+
+	data, err := imageprocessor.RenderPreview(r.Context(), filepath.Join(sess.Dir, "source"), dim, s.runOptions(sess.Tenant, true))
+	if err != nil {
+		status, code := processError(err)
+		if errors.Is(err, imageprocessor.ErrConfigInvalid) {
+			// The preview's filters come from the query
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, code, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(data)
+}
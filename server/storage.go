@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// workDirs tracks the directories holding preview sessions and finished job
+// outputs, removing them once unused for the TTL or, least recently used
+// first, while they take more disk space than allowed.
+type workDirs struct {
+	mu      sync.Mutex
+	entries map[string]*workDir
+	total   int64
+}
+
+// workDir is a tracked directory; remove forgets whatever refers to it.
+type workDir struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+	remove   func()
+}
+
+// track starts tracking dir, measuring its size. remove is called when the
+// directory is deleted.
+func (d *workDirs) track(dir string, remove func()) {
+	size := dirSize(dir)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		d.entries = map[string]*workDir{}
+	}
+	d.entries[dir] = &workDir{path: dir, size: size, lastUsed: time.Now(), remove: remove}
+	d.total += size
+}
+
+// touch marks dir as used now.
+func (d *workDirs) touch(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.entries[dir]; ok {
+		e.lastUsed = time.Now()
+	}
+}
+
+// expire deletes the directories unused for longer than ttl, and then the
+// least recently used ones while the total exceeds maxBytes (zero means no
+// limit). It returns the number of directories deleted.
+func (d *workDirs) expire(ttl time.Duration, maxBytes int64) int {
+	d.mu.Lock()
+	entries := make([]*workDir, 0, len(d.entries))
+	for _, e := range d.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b *workDir) int { return a.lastUsed.Compare(b.lastUsed) })
+
+	var victims []*workDir
+	cutoff := time.Now().Add(-ttl)
+	for _, e := range entries {
+		if e.lastUsed.After(cutoff) && (maxBytes == 0 || d.total <= maxBytes) {
+			break
+		}
+		victims = append(victims, e)
+		delete(d.entries, e.path)
+		d.total -= e.size
+	}
+	d.mu.Unlock()
+
+	// Forget the owners first so nothing new reads a directory being deleted
+	for _, e := range victims {
+		e.remove()
+		os.RemoveAll(e.path)
+	}
+	return len(victims)
+}
+
+// usage returns the number of tracked directories and their total size.
+func (d *workDirs) usage() (int, int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries), d.total
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// cleanupWorkDirs expires work directories periodically until ctx is canceled.
+func (s *Server) cleanupWorkDirs(ctx context.Context) {
+	ticker := time.NewTicker(min(max(s.cfg.SessionTTL/2, time.Second), time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expireWorkDirs()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expireWorkDirs removes expired and evicted work directories, logging what
+// was removed.
+func (s *Server) expireWorkDirs() {
+	if n := s.workDirs.expire(s.cfg.SessionTTL, s.cfg.MaxDiskUsage); n > 0 {
+		count, total := s.workDirs.usage()
+		s.cfg.Logger.Info("removed work directories", "removed", n, "remaining", count, "bytes", total)
+	}
+}
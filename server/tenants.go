@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Tenant is a team sharing the server, identified by its API keys.
+type Tenant struct {
+	Name string `json:"name"`
+	// APIKeys are the hex encoded SHA-256 hashes of the tenant's keys, so
+	// the tenants file holds no secrets.
+	APIKeys []string `json:"apiKeys"`
+	// Presets lists the built-in presets the tenant may request; the first
+	// one is used when a request names none.
+	Presets []string `json:"presets"`
+	// Destination, when set, receives a copy of every generated set under
+	// <destination>/<request id>.
+	Destination string `json:"destination,omitempty"`
+	Quota       Quota  `json:"quota"`
+	// Weight is the tenant's share of the processing slots relative to
+	// other tenants; zero means 1.
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// Quota limits a tenant's use of the server. Zero values are unlimited.
+type Quota struct {
+	RequestsPerDay int `json:"requestsPerDay,omitempty"`
+	// RequestsPerMinute caps the rate of requests starting work, allowing
+	// a minute's worth at once.
+	RequestsPerMinute int   `json:"requestsPerMinute,omitempty"`
+	MaxUploadBytes    int64 `json:"maxUploadBytes,omitempty"`
+}
+
+// LoadTenants reads a JSON array of tenants and validates it.
+func LoadTenants(path string) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+	var tenants []Tenant
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	keys := map[string]string{}
+	for _, t := range tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("%s: tenant without a name", path)
+		}
+		if len(t.Presets) == 0 {
+			return nil, fmt.Errorf("%s: tenant %s allows no presets", path, t.Name)
+		}
+		for _, p := range t.Presets {
+			if _, err := imageprocessor.LoadPreset(p); err != nil {
+				return nil, fmt.Errorf("%s: tenant %s: %w", path, t.Name, err)
+			}
+		}
+		if len(t.APIKeys) == 0 {
+			return nil, fmt.Errorf("%s: tenant %s has no API keys", path, t.Name)
+		}
+		if t.Quota.RequestsPerDay < 0 || t.Quota.RequestsPerMinute < 0 || t.Quota.MaxUploadBytes < 0 {
+			return nil, fmt.Errorf("%s: tenant %s has a negative quota", path, t.Name)
+		}
+		if t.Weight < 0 {
+			return nil, fmt.Errorf("%s: tenant %s has a negative weight", path, t.Name)
+		}
+		for _, k := range t.APIKeys {
+			if b, err := hex.DecodeString(k); err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("%s: tenant %s: API keys must be listed as hex SHA-256 hashes", path, t.Name)
+			}
+			if other, ok := keys[strings.ToLower(k)]; ok {
+				return nil, fmt.Errorf("%s: tenants %s and %s share an API key", path, other, t.Name)
+			}
+			keys[strings.ToLower(k)] = t.Name
+		}
+	}
+	return tenants, nil
+}
+
+// tenantKey is the context key of the authenticated tenant.
+type tenantKey struct{}
+
+// tenantFrom returns the tenant of an authenticated request, or nil when the
+// server runs without tenants.
+func tenantFrom(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// errQuotaExceeded is returned by usage.take once a tenant's daily requests
+// are used up.
+var errQuotaExceeded = errors.New("daily request quota exceeded")
+
+// usage counts the requests of every tenant during the current UTC day.
+type usage struct {
+	mu    sync.Mutex
+	day   string
+	count map[string]int
+}
+
+// take records a request by t, failing once its daily quota is used up.
+func (u *usage) take(t *Tenant) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if day := time.Now().UTC().Format(time.DateOnly); day != u.day {
+		u.day, u.count = day, map[string]int{}
+	}
+	if t.Quota.RequestsPerDay > 0 && u.count[t.Name] >= t.Quota.RequestsPerDay {
+		return errQuotaExceeded
+	}
+	u.count[t.Name]++
+	return nil
+}
+
+// requireTenant authenticates requests by their API key, given as a bearer
+// token or in the X-API-Key header, and enforces the tenant's quotas. Without
+// configured tenants, requests need one of the server's API keys, if any.
+func (s *Server) requireTenant(next http.HandlerFunc) http.HandlerFunc {
+	return s.withTenant(next, true)
+}
+
+// authenticate is requireTenant for requests that do not start work, such as
+// status polls, which count against no quota.
+func (s *Server) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return s.withTenant(next, false)
+}
+
+// withTenant resolves the tenant of a request, charging its quotas when the
+// request starts work.
+func (s *Server) withTenant(next http.HandlerFunc, charge bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if charge && !limitBody(w, r, s.cfg.MaxUploadBytes) {
+			return
+		}
+		if len(s.cfg.Tenants) == 0 {
+			if s.cfg.APIKeys != nil && !s.cfg.APIKeys.Contains(requestKey(r)) {
+				writeUnauthorized(w)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		tenant := s.lookupTenant(requestKey(r))
+		if tenant == nil {
+			writeUnauthorized(w)
+			return
+		}
+
+		logger := imageprocessor.Logger(r.Context()).With("tenant", tenant.Name)
+		if charge {
+			if !s.takeTenantRate(w, tenant) {
+				logger.Warn("request rate limited")
+				return
+			}
+			if err := s.usage.take(tenant); err != nil {
+				logger.Warn("request rejected", "error", err)
+				writeError(w, http.StatusTooManyRequests, CodeRateLimited, err.Error())
+				return
+			}
+			if !limitBody(w, r, tenant.Quota.MaxUploadBytes) {
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), tenantKey{}, tenant)
+		next(w, r.WithContext(imageprocessor.WithLogger(ctx, logger)))
+	}
+}
+
+// lookupTenant returns the tenant owning key, comparing hashes in constant time.
+func (s *Server) lookupTenant(key string) *Tenant {
+	if key == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	for i := range s.cfg.Tenants {
+		t := &s.cfg.Tenants[i]
+		for _, k := range t.APIKeys {
+			want, _ := hex.DecodeString(k)
+			if subtle.ConstantTimeCompare(sum[:], want) == 1 {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// tenantDimensions returns the dimensions of the preset requested with the
+// preset query parameter, which must be one the tenant may use.
+func tenantDimensions(t *Tenant, r *http.Request) ([]imageprocessor.Dimension, error) {
+	name := r.URL.Query().Get("preset")
+	if name == "" {
+		name = t.Presets[0]
+	}
+	if !slices.Contains(t.Presets, name) {
+		return nil, fmt.Errorf("preset %q is not allowed for tenant %s", name, t.Name)
+	}
+	return imageprocessor.LoadPreset(name)
+}
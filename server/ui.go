@@ -0,0 +1,84 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// uiPage is the self-contained web UI served at /.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// presetInfo describes a preset offered to a client.
+type presetInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// handleUI serves the web UI.
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' blob:; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+	w.Write(uiPage)
+}
+
+// handlePresets lists the presets a request may pick with the preset query
+// parameter: the tenant's, or "default" for the server's dimensions followed
+// by every built-in preset.
+func (s *Server) handlePresets(w http.ResponseWriter, r *http.Request) {
+	presets := []presetInfo{}
+	tenant := tenantFrom(r.Context())
+	if tenant == nil {
+		presets = append(presets, presetInfo{Name: "default", Description: "The server's configured dimensions"})
+	}
+	for _, p := range imageprocessor.Presets() {
+		if tenant == nil || slices.Contains(tenant.Presets, p.Name) {
+			presets = append(presets, presetInfo{Name: p.Name, Description: p.Description})
+		}
+	}
+	// Tenants list their default preset first
+	if tenant != nil {
+		slices.SortStableFunc(presets, func(a, b presetInfo) int {
+			return slices.Index(tenant.Presets, a.Name) - slices.Index(tenant.Presets, b.Name)
+		})
+	}
+	writeJSON(w, http.StatusOK, presets)
+}
+
+// handleJobFile serves one output of a succeeded or partial job, for
+// previews, tagged with its checksum.
+func (s *Server) handleJobFile(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	i := -1
+	if job.Manifest != nil {
+		i = slices.IndexFunc(job.Manifest.Outputs, func(e imageprocessor.ManifestEntry) bool { return e.Name == name })
+	}
+	if i < 0 {
+		writeError(w, http.StatusNotFound, CodeNotFound, "no such output")
+		return
+	}
+
+	s.workDirs.touch(job.Dir)
+
+	f, err := os.Open(filepath.Join(job.Dir, "output", name))
+	if err != nil {
+		imageprocessor.Logger(r.Context()).Error("failed to open output", "name", name, "error", err)
+		writeInternalError(w)
+		return
+	}
+	defer f.Close()
+	// The manifest dates the output even when a cache hit wrote the file
+	// later, and ServeContent answers conditional and range requests
+	w.Header().Set("ETag", outputETag(job.Manifest.Outputs[i]))
+	http.ServeContent(w, r, name, job.Manifest.GeneratedAt, f)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/drewalth/logo-generator/desktop"
+)
+
+// runInstallService installs a Finder Quick Action that runs the generator
+// with the given dimension flags on the images right-clicked in Finder.
+// Flags after the command's own are passed on to every run.
+func runInstallService(args []string) {
+	fs := flag.NewFlagSet("install-service", flag.ExitOnError)
+	name := fs.String("name", "Generate Logos", "title of the Quick Action in Finder")
+	suffix := fs.String("suffix", "-icons", "appended to an image's name to name the directory its icons are written to")
+	dir := fs.String("dir", "", "directory the workflow is installed into; defaults to ~/Library/Services")
+	uninstall := fs.Bool("uninstall", false, "remove the Quick Action instead of installing it")
+	loadDimensions := dimensionsLoader(fs)
+	forwarded := forwardFlags(fs, "name", "suffix", "dir", "uninstall")
+	fs.Parse(args)
+
+	if *dir == "" {
+		if runtime.GOOS != "darwin" {
+			log.Fatal("Error: Quick Actions are only supported on macOS; pass -dir to write the workflow elsewhere")
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		*dir = filepath.Join(home, "Library", "Services")
+	}
+	action := desktop.QuickAction{Name: *name, OutputSuffix: *suffix}
+	bundleName, err := action.BundleName()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	bundle := filepath.Join(*dir, bundleName)
+
+	if *uninstall {
+		if err := os.RemoveAll(bundle); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		refreshServices()
+		fmt.Println("Removed", bundle)
+		return
+	}
+
+	// Catch a broken config or unknown profile now rather than on every click
+	if _, _, err := loadDimensions(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	command, err := serviceCommand(*forwarded, fs.Args())
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	action.Command = command
+
+	files, err := action.Files()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	// Replace an earlier install so no stale files are left in the bundle
+	if err := os.RemoveAll(bundle); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	for path, data := range files {
+		target := filepath.Join(bundle, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+	refreshServices()
+	fmt.Printf("Installed %q in %s; right-click an image in Finder and choose Quick Actions > %s\n", *name, bundle, *name)
+}
+
+// forwardedFlag records every value a generator flag is set to, so
+// repeatable flags such as -var reach the Quick Action's command intact.
+type forwardedFlag struct {
+	flag.Value
+	name string
+	args *[]string
+}
+
+func (f forwardedFlag) Set(s string) error {
+	if err := f.Value.Set(s); err != nil {
+		return err
+	}
+	*f.args = append(*f.args, "-"+f.name+"="+s)
+	return nil
+}
+
+func (f forwardedFlag) IsBoolFlag() bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// forwardFlags wraps the flags registered on fs, except the command's own,
+// and returns the arguments they were set with once parsed.
+func forwardFlags(fs *flag.FlagSet, own ...string) *[]string {
+	args := &[]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if !slices.Contains(own, f.Name) {
+			f.Value = forwardedFlag{Value: f.Value, name: f.Name, args: args}
+		}
+	})
+	return args
+}
+
+// serviceCommand returns the command line the Quick Action runs: this
+// executable, the forwarded flags and the remaining arguments. The config
+// path is made absolute, as Finder runs the workflow from an unrelated
+// directory.
+func serviceCommand(forwarded, rest []string) ([]string, error) {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the generator executable: %w", err)
+	}
+	command := []string{exe}
+	for _, arg := range forwarded {
+		if path, ok := strings.CutPrefix(arg, "-config="); ok && path != "" {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve -config: %w", err)
+			}
+			arg = "-config=" + abs
+		}
+		command = append(command, arg)
+	}
+	return append(command, rest...), nil
+}
+
+// refreshServices asks macOS to pick up changed services right away instead
+// of at the next login. Failing to do so only delays the change.
+func refreshServices() {
+	if runtime.GOOS == "darwin" {
+		exec.Command("/System/Library/CoreServices/pbs", "-update").Run()
+	}
+}
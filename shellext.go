@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/drewalth/logo-generator/desktop"
+)
+
+// runInstallShellExt registers a Windows Explorer context menu entry that
+// runs the generator with the given dimension flags on the image
+// right-clicked. Flags after the command's own are passed on to every run.
+func runInstallShellExt(args []string) {
+	fs := flag.NewFlagSet("install-shell-ext", flag.ExitOnError)
+	name := fs.String("name", "Generate logos…", "text of the context menu entry")
+	suffix := fs.String("suffix", "-icons", "appended to an image's name to name the directory its icons are written to")
+	dir := fs.String("dir", "", `directory the entry's script is installed into; defaults to %LOCALAPPDATA%\logo-generator`)
+	regFile := fs.String("reg-file", "", "write the registry changes to this file instead of importing them, for review or a later `reg import`")
+	uninstall := fs.Bool("uninstall", false, "remove the entry instead of installing it")
+	loadDimensions := dimensionsLoader(fs)
+	forwarded := forwardFlags(fs, "name", "suffix", "dir", "reg-file", "uninstall")
+	fs.Parse(args)
+
+	if runtime.GOOS != "windows" && (*dir == "" || *regFile == "") {
+		log.Fatal("Error: context menu entries are only supported on Windows; pass -dir and -reg-file to write the files elsewhere")
+	}
+	if *dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		*dir = filepath.Join(cache, "logo-generator")
+	}
+	ext := desktop.ShellExtension{Name: *name, OutputSuffix: *suffix}
+	ext.ScriptPath = filepath.Join(*dir, ext.Key()+".cmd")
+
+	if *uninstall {
+		if err := applyRegFile(ext.UninstallRegFile(), *regFile); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if err := os.Remove(ext.ScriptPath); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Error: %v\n", err)
+		}
+		fmt.Printf("Removed %q\n", *name)
+		return
+	}
+
+	// Catch a broken config or unknown profile now rather than on every click
+	if _, _, err := loadDimensions(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	command, err := serviceCommand(*forwarded, fs.Args())
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	ext.Command = command
+
+	script, err := ext.Script()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	reg, err := ext.RegFile()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := os.WriteFile(ext.ScriptPath, script, 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := applyRegFile(reg, *regFile); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Installed %q; right-click a PNG or JPEG in Explorer to use it\n", *name)
+}
+
+// applyRegFile writes the registry file to path when one is given, and
+// imports it into the registry otherwise.
+func applyRegFile(data []byte, path string) error {
+	if path != "" {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "logo-generator-*.reg")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if out, err := exec.Command("reg", "import", tmp.Name()).CombinedOutput(); err != nil {
+		return fmt.Errorf("reg import failed: %w: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// runKeygen writes a new Ed25519 key pair for signing manifests.
+func runKeygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	name := fs.String("o", "logo-generator", "write the keys to <name>.key and <name>.pub")
+	fs.Parse(args)
+
+	priv, pub, err := imageprocessor.GenerateSigningKey()
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Never overwrite an existing private key
+	keyFile, err := os.OpenFile(*name+".key", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := keyFile.Write(priv); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := keyFile.Close(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := os.WriteFile(*name+".pub", pub, 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Wrote the signing key to %s.key and the verification key to %s.pub\n", *name, *name)
+}
+
+// runVerify checks the signature of an output directory's manifest and the
+// checksum of every file it lists.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyPath := fs.String("key", "", "PEM encoded Ed25519 public key the manifest must be signed with")
+	outputDir := fs.String("output", "output", "directory holding the generated images and manifest")
+	manifestName := fs.String("manifest", "manifest.json", "name of the manifest in the output directory")
+	fs.Parse(args)
+
+	if *keyPath == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator verify -key <key.pub> [-output <dir>]")
+	}
+	keyData, err := os.ReadFile(*keyPath)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	key, err := imageprocessor.ParseVerifyKey(keyData)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Trust the manifest only after its signature checks out
+	manifestPath := filepath.Join(*outputDir, *manifestName)
+	data, err := imageprocessor.VerifyFile(manifestPath, key)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	manifest, err := imageprocessor.ParseManifest(data)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if err := imageprocessor.VerifyOutputs(*outputDir, manifest); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Verified %d files generated from source %s\n", len(manifest.Outputs), manifest.SourceSHA256)
+}
+
+// signingKeyFlag registers -sign-key on fs and returns a function that loads
+// the key once parsed, or returns nil when signing is disabled.
+func signingKeyFlag(fs *flag.FlagSet) func() ed25519.PrivateKey {
+	path := fs.String("sign-key", "", "PEM encoded Ed25519 private key; signs the manifest as <manifest>.sig")
+	return func() ed25519.PrivateKey {
+		if *path == "" {
+			return nil
+		}
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		key, err := imageprocessor.ParseSigningKey(data)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		return key
+	}
+}
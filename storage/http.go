@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// HTTP stores files with PUT requests to <prefix>/<name>, which suits
+// WebDAV servers and buckets accepting presigned or anonymous uploads.
+type HTTP struct {
+	Prefix string
+	// Token, when set, is sent as a bearer token.
+	Token string
+}
+
+// openHTTP opens an http(s) URL prefix, with LOGO_GENERATOR_STORAGE_TOKEN as
+// the optional bearer token.
+func openHTTP(ctx context.Context, u *url.URL) (Storage, error) {
+	return &HTTP{Prefix: strings.TrimSuffix(u.String(), "/"), Token: os.Getenv("LOGO_GENERATOR_STORAGE_TOKEN")}, nil
+}
+
+// Put stores data under name.
+func (h *HTTP) Put(ctx context.Context, name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.Prefix+"/"+escapePath(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType(name))
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	return do(req, name)
+}
+
+// Close does nothing.
+func (h *HTTP) Close() error { return nil }
+
+// escapePath escapes every segment of a slash separated name.
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends an upload request, turning unsuccessful responses into errors.
+func do(req *http.Request, name string) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("failed to upload %s: %s: %s", name, resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Dir stores files in a local directory. Files are written to a temporary
+// file and renamed into place, so readers never see a partial file.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a storage writing under root, which is created on the
+// first Put.
+func NewDir(root string) (*Dir, error) {
+	if root == "" {
+		return nil, fmt.Errorf("empty storage directory")
+	}
+	return &Dir{root: root}, nil
+}
+
+// Put stores data under name.
+func (d *Dir) Put(ctx context.Context, name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	target := filepath.Join(d.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(target), ".tmp-"+filepath.Base(target)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes files private; outputs are meant to be served
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), target)
+}
+
+// Close does nothing.
+func (d *Dir) Close() error { return nil }
+
+// Memory keeps files in memory, for tests and embedders that handle the
+// outputs themselves. The zero value is ready to use.
+type Memory struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemory returns an empty in-memory storage.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+var (
+	memoriesMu sync.Mutex
+	memories   = map[string]*Memory{}
+)
+
+// NamedMemory returns the process-wide in-memory storage that mem://<name>
+// URLs open, creating it on first use.
+func NamedMemory(name string) *Memory {
+	memoriesMu.Lock()
+	defer memoriesMu.Unlock()
+	m, ok := memories[name]
+	if !ok {
+		m = NewMemory()
+		memories[name] = m
+	}
+	return m
+}
+
+// Put stores a copy of data under name.
+func (m *Memory) Put(ctx context.Context, name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = map[string][]byte{}
+	}
+	m.files[name] = slices.Clone(data)
+	return nil
+}
+
+// Get returns a copy of the file stored under name.
+func (m *Memory) Get(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	return slices.Clone(data), ok
+}
+
+// Names returns the names of the stored files, sorted.
+func (m *Memory) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Close does nothing; the files stay available.
+func (m *Memory) Close() error { return nil }
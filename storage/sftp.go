@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SFTP stores files on an SSH server through the OpenSSH sftp client, so
+// hosts, keys and agents are configured as for ssh. Authentication must not
+// prompt: the host has to be in known_hosts and the key unlocked or held by
+// an agent. Puts share one connection through an SSH control socket.
+type SFTP struct {
+	// Host is the destination as ssh takes it, e.g. deploy@example.com.
+	Host string
+	Port string
+	// Root is the remote directory; relative paths start at the home
+	// directory.
+	Root string
+	// Key is the private key file; ssh's defaults and agent are used when
+	// it is empty.
+	Key string
+
+	controlDir string
+}
+
+// openSFTP opens sftp://user@host[:port]/path, where the path is absolute
+// unless it starts with /~/. The key is taken from LOGO_GENERATOR_SFTP_KEY.
+func openSFTP(ctx context.Context, u *url.URL) (Storage, error) {
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("sftp URL %q has no host", u.Redacted())
+	}
+	// ssh would read a host or user starting with - as an option
+	if strings.HasPrefix(u.Hostname(), "-") || strings.HasPrefix(u.User.Username(), "-") {
+		return nil, fmt.Errorf("sftp URL %q has a host or user starting with -", u.Redacted())
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, errors.New("sftp URLs must not hold a password; use a key")
+	}
+	if _, err := exec.LookPath("sftp"); err != nil {
+		return nil, fmt.Errorf("sftp storage needs the OpenSSH sftp client: %w", err)
+	}
+	s := &SFTP{Host: u.Hostname(), Port: u.Port(), Root: u.Path, Key: os.Getenv("LOGO_GENERATOR_SFTP_KEY")}
+	if user := u.User.Username(); user != "" {
+		s.Host = user + "@" + s.Host
+	}
+	if rest, ok := strings.CutPrefix(s.Root, "/~"); ok {
+		s.Root = strings.TrimPrefix(rest, "/")
+	}
+	if s.Root == "" {
+		s.Root = "."
+	}
+	dir, err := os.MkdirTemp("", "logo-generator-ssh-")
+	if err != nil {
+		return nil, err
+	}
+	s.controlDir = dir
+	return s, nil
+}
+
+// Put uploads data to a temporary file next to name and renames it into
+// place, creating the directories on the way.
+func (s *SFTP) Put(ctx context.Context, name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.controlDir, "put-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	target := path.Join(s.Root, name)
+	tmp := path.Join(path.Dir(target), ".tmp-"+path.Base(target)+"-"+filepath.Base(f.Name()))
+	var batch strings.Builder
+	// A leading - makes sftp ignore the error of directories that exist
+	for _, dir := range parentDirs(path.Dir(target)) {
+		fmt.Fprintf(&batch, "-mkdir %s\n", sftpQuote(dir))
+	}
+	fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(f.Name()), sftpQuote(tmp))
+	fmt.Fprintf(&batch, "chmod 644 %s\n", sftpQuote(tmp))
+	// OpenSSH servers replace the target atomically with posix-rename
+	fmt.Fprintf(&batch, "rename %s %s\n", sftpQuote(tmp), sftpQuote(target))
+
+	args := append([]string{"-q", "-b", "-"}, s.sshOptions("-P")...)
+	cmd := exec.CommandContext(ctx, "sftp", append(args, "--", s.Host)...)
+	cmd.Stdin = strings.NewReader(batch.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("failed to upload %s: %s", name, msg)
+		}
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close shuts the shared connection down and removes the control socket.
+func (s *SFTP) Close() error {
+	args := append([]string{"-O", "exit"}, s.sshOptions("-p")...)
+	// Fails harmlessly when no connection was made
+	exec.Command("ssh", append(args, "--", s.Host)...).Run()
+	return os.RemoveAll(s.controlDir)
+}
+
+// sshOptions returns the options shared by sftp and ssh, which name the
+// port option differently. The master connection outlives a crashed
+// process by a minute at most.
+func (s *SFTP) sshOptions(portFlag string) []string {
+	opts := []string{
+		"-o", "BatchMode=yes",
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(s.controlDir, "control"),
+		"-o", "ControlPersist=60",
+	}
+	if s.Port != "" {
+		opts = append(opts, portFlag, s.Port)
+	}
+	if s.Key != "" {
+		opts = append(opts, "-i", s.Key, "-o", "IdentitiesOnly=yes")
+	}
+	return opts
+}
+
+// parentDirs returns dir and its ancestors, outermost first, leaving out
+// the root and the home directory.
+func parentDirs(dir string) []string {
+	var dirs []string
+	for ; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+// sftpQuote quotes a path for an sftp batch file.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
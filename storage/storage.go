@@ -0,0 +1,121 @@
+// Package storage writes generated files to their destination: a local
+// directory, memory, an HTTP endpoint, an SSH server or a cloud bucket.
+// Destinations are named by URLs whose scheme selects the backend, and new
+// backends are added by registering an Opener for their scheme.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Storage receives files under names relative to its root, using forward
+// slashes. Implementations must be safe for concurrent use.
+type Storage interface {
+	// Put stores data under name, replacing any previous file.
+	Put(ctx context.Context, name string, data []byte) error
+	// Close releases connections held by the storage.
+	Close() error
+}
+
+// Opener opens the storage a URL names.
+type Opener func(ctx context.Context, u *url.URL) (Storage, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = map[string]Opener{}
+)
+
+// Register makes a backend available under the URL scheme. It panics when
+// the scheme is already registered.
+func Register(scheme string, open Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	if _, ok := openers[scheme]; ok {
+		panic("storage: scheme " + scheme + " registered twice")
+	}
+	openers[scheme] = open
+}
+
+// Schemes returns the registered URL schemes, sorted.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	slices.Sort(schemes)
+	return schemes
+}
+
+// IsLocal reports whether target is a directory path rather than a URL.
+func IsLocal(target string) bool {
+	return !strings.Contains(target, "://")
+}
+
+// Open opens the storage target names: a directory path, or a URL whose
+// scheme has been registered, such as s3://bucket/prefix.
+func Open(ctx context.Context, target string) (Storage, error) {
+	if IsLocal(target) {
+		return NewDir(target)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL: %w", err)
+	}
+	openersMu.RLock()
+	open, ok := openers[u.Scheme]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage scheme %q, want a directory or one of %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	return open(ctx, u)
+}
+
+// checkName rejects names that would escape the storage's root.
+func checkName(name string) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, `\`) {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	return nil
+}
+
+// contentType returns the media type of a file by its extension.
+func contentType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// joinKey joins a key prefix, which may be empty, and a name.
+func joinKey(prefix, name string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+func init() {
+	Register("file", func(ctx context.Context, u *url.URL) (Storage, error) {
+		return NewDir(filepath.FromSlash(u.Path))
+	})
+	Register("mem", func(ctx context.Context, u *url.URL) (Storage, error) {
+		return NamedMemory(u.Host), nil
+	})
+	Register("http", openHTTP)
+	Register("https", openHTTP)
+	Register("s3", openS3)
+	Register("gs", openGCS)
+	Register("azblob", openAzure)
+	Register("sftp", openSFTP)
+}
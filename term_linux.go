@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// The ioctl requests reading and writing terminal attributes.
+const (
+	ioctlReadTermios  = syscall.TCGETS
+	ioctlWriteTermios = syscall.TCSETS
+)
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw reports that raw terminal mode is not available on this platform.
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
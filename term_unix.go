@@ -0,0 +1,35 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw switches the terminal on f to raw mode, so keys are read as they
+// are pressed without being echoed, and returns a function restoring it.
+// Output processing stays on, so "\n" still starts a new line.
+func makeRaw(f *os.File) (restore func(), err error) {
+	var saved syscall.Termios
+	if err := termios(f, ioctlReadTermios, &saved); err != nil {
+		return nil, err
+	}
+	raw := saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+	if err := termios(f, ioctlWriteTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { termios(f, ioctlWriteTermios, &saved) }, nil
+}
+
+// termios reads or writes the terminal attributes of f.
+func termios(f *os.File, request uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Console modes, from the Windows console API.
+const (
+	enableProcessedInput            = 0x0001
+	enableLineInput                 = 0x0002
+	enableEchoInput                 = 0x0004
+	enableVirtualTerminalInput      = 0x0200
+	enableVirtualTerminalProcessing = 0x0004
+)
+
+var setConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// makeRaw switches the console on f to raw mode, so keys are read as they
+// are pressed without being echoed, and returns a function restoring it.
+// Keys arrive as the same escape sequences as on Unix terminals, and
+// standard output is switched to interpret them too.
+func makeRaw(f *os.File) (restore func(), err error) {
+	in := syscall.Handle(f.Fd())
+	out := syscall.Handle(os.Stdout.Fd())
+	var inMode, outMode uint32
+	if err := syscall.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	if err := syscall.GetConsoleMode(out, &outMode); err != nil {
+		return nil, err
+	}
+	if err := consoleMode(in, inMode&^(enableProcessedInput|enableLineInput|enableEchoInput)|enableVirtualTerminalInput); err != nil {
+		return nil, err
+	}
+	if err := consoleMode(out, outMode|enableVirtualTerminalProcessing); err != nil {
+		consoleMode(in, inMode)
+		return nil, err
+	}
+	return func() {
+		consoleMode(in, inMode)
+		consoleMode(out, outMode)
+	}, nil
+}
+
+// consoleMode sets the mode of a console handle.
+func consoleMode(h syscall.Handle, mode uint32) error {
+	if ok, _, err := setConsoleMode.Call(uintptr(h), uintptr(mode)); ok == 0 {
+		return err
+	}
+	return nil
+}
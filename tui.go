@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// ANSI escape sequences used by the interactive mode.
+const (
+	ansiClearLine = "\r\x1b[K"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiReset     = "\x1b[0m"
+	ansiHide      = "\x1b[?25l"
+	ansiShow      = "\x1b[?25h"
+)
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runInteractive walks through a run in the terminal: it asks for the
+// source, which may be dragged onto the window, and the output directory,
+// offers the presets as checkboxes, shows the outputs as they are written
+// and ends with a summary. It is started when the CLI runs without
+// arguments in a terminal.
+func runInteractive() {
+	in := bufio.NewReader(os.Stdin)
+	fmt.Println(ansiBold + "logo-generator" + ansiReset + " " + ansiDim + "interactive mode; run with -h for the flags" + ansiReset)
+	fmt.Println()
+
+	source := promptSource(in)
+	outputDir := prompt(in, "Output directory", "output")
+
+	presets := imageprocessor.Presets()
+	selected, err := choosePresets(in, presets)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	presets = slices.DeleteFunc(presets, func(p imageprocessor.Preset) bool { return !selected[p.Name] })
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := imageprocessor.Options{Workers: runtime.NumCPU()}
+	if source == clipboardInput {
+		if opts.FS, err = clipboardFS(); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
+	// Presets share output names such as icon.png, so each one gets its
+	// own directory when several are selected
+	fmt.Println()
+	var summaries []func()
+	failed := false
+	for _, preset := range presets {
+		dir := outputDir
+		if len(presets) > 1 {
+			dir = filepath.Join(outputDir, preset.Name)
+		}
+		result, err := runWithProgress(ctx, preset.Name, source, dir, preset.Dimensions, opts)
+		if err == nil {
+			err = result.WriteManifest(filepath.Join(dir, "manifest.json"))
+		}
+		failed = failed || err != nil
+		summaries = append(summaries, func() { printInteractiveSummary(preset.Name, result, err) })
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	fmt.Println()
+	for _, summary := range summaries {
+		summary()
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// prompt asks for a line of input, returning def when it is left empty.
+func prompt(in *bufio.Reader, question, def string) string {
+	fmt.Printf("%s %s[%s]%s: ", question, ansiDim, def, ansiReset)
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+// promptSource asks for the source image until an existing file, or the
+// clipboard, is given.
+func promptSource(in *bufio.Reader) string {
+	fmt.Println("Drag the source image onto this window, type its path, or type clipboard.")
+	for {
+		fmt.Print("Source image: ")
+		line, err := in.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			os.Exit(1)
+		} else if err != nil && err != io.EOF {
+			log.Fatalf("Error: %v\n", err)
+		}
+		path := droppedPath(line)
+		if path == clipboardInput {
+			return path
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		fmt.Printf("  %q is not a file\n", path)
+	}
+}
+
+// droppedPath turns a path dropped onto a terminal into a plain path.
+// Terminals quote it, or escape its spaces with backslashes, and some
+// insert it as a file:// URL.
+func droppedPath(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	if rest, ok := strings.CutPrefix(s, "file://"); ok {
+		return strings.ReplaceAll(rest, "%20", " ")
+	}
+	// Backslashes separate Windows paths rather than escape characters
+	if runtime.GOOS == "windows" {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// choosePresets shows the presets as checkboxes, the default one checked,
+// until enter confirms a non-empty selection.
+func choosePresets(in *bufio.Reader, presets []imageprocessor.Preset) (map[string]bool, error) {
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys from the terminal: %w", err)
+	}
+	defer restore()
+	fmt.Print(ansiHide)
+	defer fmt.Print(ansiShow)
+
+	selected := map[string]bool{imageprocessor.DefaultPreset: true}
+	cursor := slices.IndexFunc(presets, func(p imageprocessor.Preset) bool { return p.Name == imageprocessor.DefaultPreset })
+	fmt.Println()
+	fmt.Println("Presets " + ansiDim + "(↑/↓ to move, space to toggle, enter to generate, q to quit)" + ansiReset)
+	for drawn := false; ; drawn = true {
+		// Redraw the list in place
+		if drawn {
+			fmt.Printf("\x1b[%dA", len(presets))
+		}
+		for i, preset := range presets {
+			pointer, box := "  ", "[ ]"
+			if i == cursor {
+				pointer = ansiBold + "> " + ansiReset
+			}
+			if selected[preset.Name] {
+				box = "[x]"
+			}
+			// Wrapped lines would break the redraw, so long descriptions are cut
+			description := []rune(preset.Description)
+			if len(description) > 48 {
+				description = append(description[:47], '…')
+			}
+			fmt.Printf("%s%s%s %-8s %3d outputs  %s%s%s\n", ansiClearLine, pointer, box, preset.Name, len(preset.Dimensions), ansiDim, string(description), ansiReset)
+		}
+
+		key, err := readKey(in)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "up", "k":
+			cursor = (cursor + len(presets) - 1) % len(presets)
+		case "down", "j":
+			cursor = (cursor + 1) % len(presets)
+		case " ":
+			name := presets[cursor].Name
+			selected[name] = !selected[name]
+		case "enter":
+			if slices.ContainsFunc(presets, func(p imageprocessor.Preset) bool { return selected[p.Name] }) {
+				return selected, nil
+			}
+		case "q", "ctrl+c", "esc":
+			restore()
+			fmt.Print(ansiShow)
+			os.Exit(130)
+		}
+	}
+}
+
+// readKey reads one key press in raw mode, naming the keys choosePresets
+// handles that are not printable.
+func readKey(in *bufio.Reader) (string, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x03:
+		return "ctrl+c", nil
+	case 0x1b:
+		// Arrow keys arrive as ESC [ A and ESC [ B; a lone ESC has nothing
+		// buffered after it
+		if in.Buffered() == 0 {
+			return "esc", nil
+		}
+		seq := make([]byte, min(in.Buffered(), 2))
+		io.ReadFull(in, seq)
+		switch string(seq) {
+		case "[A", "OA":
+			return "up", nil
+		case "[B", "OB":
+			return "down", nil
+		}
+		return "", nil
+	}
+	return string(b), nil
+}
+
+// runWithProgress generates the outputs while drawing a progress bar, the
+// elapsed time and the latest finished output on one line.
+func runWithProgress(ctx context.Context, label, source, outputDir string, dims []imageprocessor.Dimension, opts imageprocessor.Options) (*imageprocessor.Result, error) {
+	progress := make(chan imageprocessor.OutputResult, len(dims))
+	opts.Progress = func(out imageprocessor.OutputResult) { progress <- out }
+
+	type outcome struct {
+		result *imageprocessor.Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := imageprocessor.ProcessImage(ctx, source, outputDir, dims, opts)
+		done <- outcome{result, err}
+	}()
+
+	finished := 0
+	start := time.Now()
+	draw := func(last string) {
+		const width = 30
+		filled := 0
+		if len(dims) > 0 {
+			filled = width * finished / len(dims)
+		}
+		bar := strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+		fmt.Printf("%s%-8s %s %3d/%-3d %s%6s %s%s", ansiClearLine, label, bar, finished, len(dims), ansiDim, time.Since(start).Round(100*time.Millisecond), last, ansiReset)
+	}
+	draw("")
+	for {
+		select {
+		case out := <-progress:
+			finished++
+			draw(out.Dimension.Name)
+		case o := <-done:
+			// Outputs finished just before the run ended are still queued
+			for len(progress) > 0 {
+				<-progress
+				finished++
+			}
+			draw("")
+			fmt.Println()
+			return o.result, o.err
+		}
+	}
+}
+
+// printInteractiveSummary reports the outcome of a preset's run, listing
+// the outputs that failed.
+func printInteractiveSummary(label string, result *imageprocessor.Result, err error) {
+	if err != nil {
+		fmt.Printf("%s%-8s failed:%s %v\n", ansiBold, label, ansiReset, err)
+	} else {
+		fmt.Printf("%s%-8s%s %d generated, %d unchanged, %s in %s\n", ansiBold, label, ansiReset,
+			result.Count(imageprocessor.StatusGenerated), result.Count(imageprocessor.StatusUnchanged),
+			imageprocessor.FormatBytes(result.BytesWritten()), result.OutputDir)
+	}
+	for _, out := range result.Outputs {
+		if out.Status == imageprocessor.StatusFailed {
+			fmt.Printf("  %s: %v\n", out.Dimension.Name, out.Err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// latestReleaseURL is the GitHub API endpoint describing the latest release.
+const latestReleaseURL = "https://api.github.com/repos/drewalth/logo-generator/releases/latest"
+
+// updatePublicKey is the base64 encoded Ed25519 key that signs SHA256SUMS,
+// set at release time with -ldflags "-X main.updatePublicKey=...". Builds
+// without it verify checksums only.
+var updatePublicKey = ""
+
+// release is the part of the GitHub release API response used by update.
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// asset returns the download URL of the named asset.
+func (r *release) asset(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// runUpdate replaces the running binary with the latest GitHub release after
+// verifying it against the release's SHA256SUMS and, when the build carries a
+// public key, the signature of SHA256SUMS.
+func runUpdate(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether an update is available")
+	force := fs.Bool("force", false, "install the latest release even if it is not newer")
+	url := fs.String("url", latestReleaseURL, "release API endpoint, for mirrors")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	// Find the latest release and the binary built for this platform
+	var rel release
+	if err := getJSON(ctx, client, *url, &rel); err != nil {
+		log.Fatalf("Error: failed to check for updates: %v\n", err)
+	}
+	current := currentBuild().Version
+	newer := compareVersions(rel.TagName, current) > 0
+	switch {
+	case *check && newer:
+		fmt.Printf("Update available: %s (running %s)\n", rel.TagName, current)
+		return
+	case !newer && !*force:
+		fmt.Printf("Already up to date (%s)\n", current)
+		return
+	case *check:
+		fmt.Printf("No newer release than %s\n", current)
+		return
+	}
+
+	name := assetName(runtime.GOOS, runtime.GOARCH)
+	binURL, ok := rel.asset(name)
+	if !ok {
+		log.Fatalf("Error: release %s has no binary for %s/%s\n", rel.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	sumsURL, ok := rel.asset("SHA256SUMS")
+	if !ok {
+		log.Fatalf("Error: release %s has no SHA256SUMS\n", rel.TagName)
+	}
+
+	// Verify the checksum list before trusting any entry in it
+	sums, err := download(ctx, client, sumsURL)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if updatePublicKey != "" {
+		sigURL, ok := rel.asset("SHA256SUMS.sig")
+		if !ok {
+			log.Fatalf("Error: release %s has no SHA256SUMS.sig\n", rel.TagName)
+		}
+		sig, err := download(ctx, client, sigURL)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if err := verifySignature(sums, sig, updatePublicKey); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "Warning: this build has no update signing key; verifying the checksum only")
+	}
+	want, err := lookupChecksum(sums, name)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Download the new binary and check it against SHA256SUMS
+	bin, err := download(ctx, client, binURL)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if got := sha256.Sum256(bin); hex.EncodeToString(got[:]) != want {
+		log.Fatalf("Error: checksum mismatch for %s\n", name)
+	}
+
+	if err := replaceExecutable(bin); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fmt.Printf("Updated %s to %s\n", current, rel.TagName)
+}
+
+// assetName returns the release asset name of the binary for a platform.
+func assetName(goos, goarch string) string {
+	name := fmt.Sprintf("logo-generator_%s_%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// getJSON decodes the JSON response of a GET request into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	data, err := download(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// download returns the body of a successful GET request.
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifySignature checks an Ed25519 signature of data, given raw or base64
+// encoded, against a base64 encoded public key.
+func verifySignature(data, sig []byte, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid update signing key in this build")
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = decoded
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return errors.New("SHA256SUMS signature does not match")
+	}
+	return nil
+}
+
+// lookupChecksum finds the hex SHA-256 of name in a sha256sum style list.
+func lookupChecksum(sums []byte, name string) (string, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("SHA256SUMS has no entry for %s", name)
+}
+
+// replaceExecutable swaps the running binary for bin. The new file is
+// written next to the old one and renamed over it, so an interrupted update
+// never leaves a partial binary behind. Windows cannot overwrite a running
+// executable, so there the old one is moved aside first.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".logo-generator-update-")
+	if err != nil {
+		return fmt.Errorf("failed to write the new binary: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write the new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the new binary: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to write the new binary: %w", err)
+	}
+
+	var old string
+	if runtime.GOOS == "windows" {
+		old = exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("failed to move the old binary aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		// Put the running binary back so an executable is left in place
+		if old != "" {
+			if restoreErr := os.Rename(old, exe); restoreErr != nil {
+				return fmt.Errorf("failed to replace the binary: %w; the previous one is left at %s: %w", err, old, restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to replace the binary: %w", err)
+	}
+	return nil
+}
+
+// compareVersions compares two vMAJOR.MINOR.PATCH versions. Unparsable
+// versions, such as development builds, sort before every release.
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses vMAJOR.MINOR.PATCH, ignoring pre-release and build
+// suffixes.
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/drewalth/logo-generator/cdn"
+)
+
+// transformedOutput is an output served by an image CDN rather than written.
+type transformedOutput struct {
+	Name   string `json:"name"`
+	Width  uint   `json:"width"`
+	Height uint   `json:"height"`
+	Format string `json:"format"`
+	URL    string `json:"url"`
+}
+
+// runURLs prints the image CDN URLs equivalent to the configured outputs,
+// for teams that serve icons through imgproxy, Cloudinary or Thumbor but
+// keep one spec as the source of truth.
+func runURLs(args []string) {
+	fs := flag.NewFlagSet("urls", flag.ExitOnError)
+	provider := fs.String("provider", "", "image CDN: imgproxy, cloudinary or thumbor")
+	endpoint := fs.String("endpoint", "", "base URL the image CDN is served from")
+	source := fs.String("source", "", "URL of the source image, or its public ID on Cloudinary")
+	output := fs.String("o", "", "file to write the JSON to; defaults to stdout")
+	dimensions, _ := dimensionsFlag(fs)
+	fs.Parse(args)
+
+	if *provider == "" || *source == "" || fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator urls -provider <imgproxy|cloudinary|thumbor> -endpoint <url> -source <url> [-config <file>|-preset <name>]")
+	}
+	transformer, err := cdn.NewTransformer(*provider, *endpoint)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	dims, profile := dimensions()
+	if profile.Watermark != nil {
+		log.Fatal("Error: watermarks cannot be expressed as image CDN URLs")
+	}
+
+	outputs := make([]transformedOutput, 0, len(dims))
+	for _, dim := range dims {
+		u, err := transformer.URL(*source, dim)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		format := dim.Format
+		if format == "" {
+			format = "png"
+		}
+		outputs = append(outputs, transformedOutput{Name: dim.Name, Width: dim.Width, Height: dim.Height, Format: format, URL: u})
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Provider string              `json:"provider"`
+		Source   string              `json:"source"`
+		Outputs  []transformedOutput `json:"outputs"`
+	}{*provider, *source, outputs}, "", "  ")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// Build information, set at release time with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// buildInfo describes the binary and the features compiled into it.
+type buildInfo struct {
+	Version       string          `json:"version"`
+	Commit        string          `json:"commit,omitempty"`
+	Modified      bool            `json:"modified,omitempty"`
+	Go            string          `json:"go"`
+	Platform      string          `json:"platform"`
+	ConfigVersion int             `json:"config_version"`
+	SourceFormats []string        `json:"source_formats"`
+	OutputFormats []string        `json:"output_formats"`
+	Backends      map[string]bool `json:"backends"`
+	SignedUpdates bool            `json:"signed_updates"`
+	Presets       []presetInfo    `json:"presets"`
+}
+
+type presetInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Outputs int    `json:"outputs"`
+}
+
+// optionalBackends lists codec backends that builds may add behind build
+// tags, reported as missing unless a source format registers them.
+var optionalBackends = []string{"webp", "avif", "libvips"}
+
+// currentBuild collects the build information of the running binary. Values
+// missing from -ldflags are taken from the module and VCS data Go embeds.
+func currentBuild() buildInfo {
+	info := buildInfo{
+		Version:       version,
+		Commit:        commit,
+		Go:            runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		ConfigVersion: imageprocessor.ConfigVersion,
+		SourceFormats: imageprocessor.SourceFormats,
+		OutputFormats: imageprocessor.OutputFormats,
+		Backends:      map[string]bool{},
+		SignedUpdates: updatePublicKey != "",
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	for _, name := range optionalBackends {
+		info.Backends[name] = slices.Contains(imageprocessor.SourceFormats, name)
+	}
+	for _, preset := range imageprocessor.Presets() {
+		info.Presets = append(info.Presets, presetInfo{Name: preset.Name, Version: preset.Version, Outputs: len(preset.Dimensions)})
+	}
+	return info
+}
+
+// runVersion prints the version, commit and compiled-in features.
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the build information as JSON")
+	fs.Parse(args)
+
+	info := currentBuild()
+	if *asJSON {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		os.Stdout.Write(append(data, '\n'))
+		return
+	}
+
+	commit := info.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if info.Modified {
+		commit += " (modified)"
+	}
+	var backends []string
+	for _, name := range optionalBackends {
+		state := "no"
+		if info.Backends[name] {
+			state = "yes"
+		}
+		backends = append(backends, name+" "+state)
+	}
+	var presets []string
+	for _, p := range info.Presets {
+		presets = append(presets, fmt.Sprintf("%s %s (%d outputs)", p.Name, p.Version, p.Outputs))
+	}
+
+	fmt.Printf("logo-generator %s\n", info.Version)
+	fmt.Printf("  commit:         %s\n", commit)
+	fmt.Printf("  go:             %s %s\n", info.Go, info.Platform)
+	fmt.Printf("  config format:  version %d\n", info.ConfigVersion)
+	fmt.Printf("  source formats: %s\n", strings.Join(info.SourceFormats, ", "))
+	fmt.Printf("  output formats: %s\n", strings.Join(info.OutputFormats, ", "))
+	fmt.Printf("  backends:       %s\n", strings.Join(backends, ", "))
+	fmt.Printf("  signed updates: %t\n", info.SignedUpdates)
+	fmt.Printf("  presets:        %s\n", strings.Join(presets, "\n                  "))
+}
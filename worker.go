@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/drewalth/logo-generator/worker"
+)
+
+// runWorker consumes generation jobs from a queue until interrupted.
+func runWorker(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	options := processorFlags(fs)
+	dimensions, _ := dimensionsFlag(fs)
+	queueDir := fs.String("queue", "", "queue directory holding one .json message per job, or the https URL of an Amazon SQS queue")
+	poll := fs.Duration("poll", time.Second, "how often an empty queue directory is checked for new messages")
+	destination := fs.String("destination", "", "directory or storage URL, such as s3://bucket/prefix or an http(s) prefix accepting PUT, receiving <id>/<outputs> for messages that name no destination")
+	publicURL := fs.String("public-url", "", "base URL -destination is publicly served from, for the urls.json of each job; defaults to -destination when it is a URL")
+	concurrency := fs.Int("concurrency", 1, "number of jobs processed at once")
+	logs := loggingFlags(fs)
+	fs.Parse(args)
+
+	if *queueDir == "" {
+		log.Fatalf("Error: -queue is required\n")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger, closeLog := logs.logger(slog.LevelInfo)
+	defer closeLog()
+
+	var queue worker.Queue
+	var err error
+	if strings.HasPrefix(*queueDir, "https://") || strings.HasPrefix(*queueDir, "http://") {
+		queue, err = worker.NewSQSQueue(*queueDir)
+	} else {
+		queue, err = worker.NewDirQueue(*queueDir, *poll)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	dims, profile := dimensions()
+	opts := options()
+	opts.Watermark = profile.Watermark
+
+	logger.Info("worker started", "queue", *queueDir, "concurrency", *concurrency)
+	err = worker.Run(ctx, worker.Config{
+		Queue:       queue,
+		Dimensions:  dims,
+		Options:     opts,
+		Destination: *destination,
+		PublicURL:   *publicURL,
+		Concurrency: *concurrency,
+		Logger:      logger,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Package worker consumes generation jobs from a queue and stores the
+// results, so any number of workers can share the load.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Message is a generation job taken from a queue.
+type Message struct {
+	// ID names the job; outputs are stored under <destination>/<id>/.
+	ID string `json:"id"`
+	// Source is a local path or an http(s) URL of the source image.
+	Source string `json:"source"`
+	// Preset selects a built-in preset instead of the worker's dimensions.
+	Preset string `json:"preset,omitempty"`
+	// Tags limits the dimensions to the entries with one of these tags.
+	Tags []string `json:"tags,omitempty"`
+	// Destination overrides the worker's destination.
+	Destination string `json:"destination,omitempty"`
+	// PublicURL is the base URL Destination is publicly served from.
+	PublicURL string `json:"publicUrl,omitempty"`
+}
+
+// Delivery is a message received from a queue. It must be acknowledged once
+// the job is done, with the error that failed it, if any.
+type Delivery interface {
+	Message() Message
+	Ack(jobErr error) error
+}
+
+// Queue hands out messages to workers. Receive blocks until a message is
+// available or ctx is canceled. Implementations must give every message to
+// a single worker, even across processes.
+type Queue interface {
+	Receive(ctx context.Context) (Delivery, error)
+}
+
+// ErrFatal marks queue errors that retrying cannot fix, such as a queue
+// that does not exist or refuses the worker's credentials. Workers retry
+// any other error, so a throttled request or a network failure does not
+// stop them.
+var ErrFatal = errors.New("queue failed permanently")
+
+// DirQueue is a queue kept in a directory, which may be shared by workers on
+// several machines over a network file system. Producers write each message as
+// a .json file, creating it under another name and renaming it into place so
+// workers never read a partial file. A worker claims a message by renaming it
+// into processing/; acknowledged messages are removed, and failed ones are
+// moved to failed/ next to a .error file explaining why.
+type DirQueue struct {
+	dir  string
+	poll time.Duration
+}
+
+// NewDirQueue returns the queue in dir, polling for messages every poll.
+func NewDirQueue(dir string, poll time.Duration) (*DirQueue, error) {
+	for _, sub := range []string{"processing", "failed"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create queue directory: %w", err)
+		}
+	}
+	return &DirQueue{dir: dir, poll: poll}, nil
+}
+
+// Receive claims the oldest message by name, waiting until one arrives.
+func (q *DirQueue) Receive(ctx context.Context) (Delivery, error) {
+	for {
+		d, err := q.claim()
+		if d != nil || err != nil {
+			return d, err
+		}
+		select {
+		case <-time.After(q.poll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// claim tries to take one pending message, returning nil when there is none.
+func (q *DirQueue) claim() (Delivery, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		claimed := filepath.Join(q.dir, "processing", name)
+		// Another worker may take the message first
+		if err := os.Rename(filepath.Join(q.dir, name), claimed); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to claim %s: %w", name, err)
+		}
+
+		d := &dirDelivery{queue: q, name: name}
+		data, err := os.ReadFile(claimed)
+		if err == nil {
+			err = json.Unmarshal(data, &d.msg)
+		}
+		if err == nil && d.msg.Source == "" {
+			err = errors.New("message has no source")
+		}
+		if err != nil {
+			d.Ack(fmt.Errorf("invalid message: %w", err))
+			continue
+		}
+		if d.msg.ID == "" {
+			d.msg.ID = strings.TrimSuffix(name, ".json")
+		}
+		return d, nil
+	}
+	return nil, nil
+}
+
+// dirDelivery is a message claimed from a DirQueue.
+type dirDelivery struct {
+	queue *DirQueue
+	name  string
+	msg   Message
+}
+
+func (d *dirDelivery) Message() Message { return d.msg }
+
+// Ack removes a completed message, or moves a failed one to failed/.
+func (d *dirDelivery) Ack(jobErr error) error {
+	claimed := filepath.Join(d.queue.dir, "processing", d.name)
+	if jobErr == nil {
+		return os.Remove(claimed)
+	}
+	failed := filepath.Join(d.queue.dir, "failed", d.name)
+	if err := os.WriteFile(failed+".error", []byte(jobErr.Error()+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(claimed, failed)
+}
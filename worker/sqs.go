@@ -0,0 +1,204 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// sqsVisibility is how long a received message stays hidden from other
+// workers. It is extended while the job runs, so a worker that dies only
+// delays its job by this long.
+const sqsVisibility = 60 * time.Second
+
+// SQSQueue is an Amazon SQS queue, or a queue of a compatible service,
+// used through the SQS JSON API with requests signed by AWS Signature
+// Version 4. Acknowledged messages are deleted. Failed ones are made
+// visible again at once, so they are retried until the queue's redrive
+// policy moves them to a dead-letter queue.
+type SQSQueue struct {
+	url    string
+	region string
+	creds  storage.AWSCredentials
+	client *http.Client
+}
+
+// NewSQSQueue returns the queue at queueURL, such as
+// https://sqs.us-east-1.amazonaws.com/123456789012/logos, with the
+// credentials of the standard AWS environment variables. The region is
+// taken from the URL, or from the environment for other endpoints.
+func NewSQSQueue(queueURL string) (*SQSQueue, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("SQS queue %q must be an absolute http or https URL", queueURL)
+	}
+	creds, err := storage.AWSCredentialsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("sqs: %w", err)
+	}
+	region := storage.AWSRegion()
+	if parts := strings.Split(u.Hostname(), "."); len(parts) >= 4 && parts[0] == "sqs" && parts[len(parts)-2] == "amazonaws" {
+		region = parts[1]
+	}
+	// The timeout leaves room for receives, which wait up to 20 seconds
+	return &SQSQueue{url: queueURL, region: region, creds: creds, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// sqsMessage is a message as returned by ReceiveMessage.
+type sqsMessage struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+}
+
+// Receive long polls the queue until a message arrives.
+func (q *SQSQueue) Receive(ctx context.Context) (Delivery, error) {
+	for {
+		var out struct {
+			Messages []sqsMessage `json:"Messages"`
+		}
+		err := q.call(ctx, "ReceiveMessage", map[string]any{
+			"QueueUrl":            q.url,
+			"MaxNumberOfMessages": 1,
+			"WaitTimeSeconds":     20,
+			"VisibilityTimeout":   int(sqsVisibility / time.Second),
+		}, &out)
+		if err != nil {
+			return nil, err
+		}
+		if len(out.Messages) == 0 {
+			continue
+		}
+
+		m := out.Messages[0]
+		d := &sqsDelivery{queue: q, handle: m.ReceiptHandle}
+		err = json.Unmarshal([]byte(m.Body), &d.msg)
+		if err == nil && d.msg.Source == "" {
+			err = errors.New("message has no source")
+		}
+		if err != nil {
+			if err := d.Ack(fmt.Errorf("invalid message: %w", err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if d.msg.ID == "" {
+			d.msg.ID = m.MessageID
+		}
+		// The message stays hidden for as long as the job runs
+		heartbeat, stop := context.WithCancel(ctx)
+		d.stop = stop
+		go d.extend(heartbeat)
+		return d, nil
+	}
+}
+
+// call invokes action with the JSON request in, decoding the response into
+// out unless it is nil.
+func (q *SQSQueue) call(ctx context.Context, action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u, _ := url.Parse(q.url)
+	endpoint := u.Scheme + "://" + u.Host + "/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	storage.SignAWS(req, "/", body, q.creds, q.region, "sqs", time.Now().UTC())
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sqs %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("sqs %s: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		err := fmt.Errorf("sqs %s: %s", action, resp.Status)
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Type != "" {
+			err = fmt.Errorf("sqs %s: %s: %s", action, apiErr.Type, apiErr.Message)
+		}
+		// Missing queues and rejected credentials stay that way
+		if resp.StatusCode == http.StatusForbidden || strings.Contains(apiErr.Type, "NonExistentQueue") || strings.Contains(apiErr.Type, "QueueDoesNotExist") {
+			err = fmt.Errorf("%w: %w", ErrFatal, err)
+		}
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("sqs %s: invalid response: %w", action, err)
+	}
+	return nil
+}
+
+// setVisibility hides the message with handle for timeout from now; zero
+// makes it visible again.
+func (q *SQSQueue) setVisibility(ctx context.Context, handle string, timeout time.Duration) error {
+	return q.call(ctx, "ChangeMessageVisibility", map[string]any{
+		"QueueUrl":          q.url,
+		"ReceiptHandle":     handle,
+		"VisibilityTimeout": int(timeout / time.Second),
+	}, nil)
+}
+
+// sqsDelivery is a message received from an SQSQueue.
+type sqsDelivery struct {
+	queue  *SQSQueue
+	handle string
+	msg    Message
+	stop   context.CancelFunc
+}
+
+func (d *sqsDelivery) Message() Message { return d.msg }
+
+// extend keeps the message hidden until ctx is canceled. When the worker
+// stops, the message becomes visible again once the last extension runs out.
+func (d *sqsDelivery) extend(ctx context.Context) {
+	ticker := time.NewTicker(sqsVisibility / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// A failed extension is retried on the next tick
+			d.queue.setVisibility(ctx, d.handle, sqsVisibility)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Ack deletes a completed message, or makes a failed one visible again.
+func (d *sqsDelivery) Ack(jobErr error) error {
+	if d.stop != nil {
+		d.stop()
+	}
+	ctx := context.Background()
+	if jobErr != nil {
+		return d.queue.setVisibility(ctx, d.handle, 0)
+	}
+	return d.queue.call(ctx, "DeleteMessage", map[string]any{
+		"QueueUrl":      d.queue.url,
+		"ReceiptHandle": d.handle,
+	}, nil)
+}
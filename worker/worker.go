@@ -0,0 +1,263 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+	"github.com/drewalth/logo-generator/storage"
+)
+
+// Config controls a worker.
+type Config struct {
+	Queue Queue
+	// Dimensions are generated for messages that name no preset.
+	Dimensions []imageprocessor.Dimension
+	// Options are passed to the processor for every job.
+	Options imageprocessor.Options
+	// Destination receives the outputs of messages that name none: a
+	// directory, or a URL of a storage backend such as s3://bucket/prefix
+	// or an http(s) prefix accepting PUT requests.
+	Destination string
+	// PublicURL is the base URL Destination is publicly served from, when it
+	// differs from the upload URL, e.g. a CDN in front of a bucket.
+	PublicURL string
+	// Concurrency is the number of jobs processed at once; zero means one.
+	Concurrency int
+	Logger      *slog.Logger
+}
+
+// Run consumes jobs until ctx is canceled. Jobs that are being processed
+// when ctx is canceled are abandoned in the queue's processing state.
+func Run(ctx context.Context, cfg Config) error {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, max(1, cfg.Concurrency))
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = consume(ctx, cfg)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Delays between attempts to reach a failing queue.
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// consume processes messages one at a time until ctx is canceled or the
+// queue fails with ErrFatal. Other queue errors are logged and retried with
+// a growing delay.
+func consume(ctx context.Context, cfg Config) error {
+	delay := minRetryDelay
+	for {
+		d, err := cfg.Queue.Receive(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrFatal) {
+			return err
+		}
+		if err != nil {
+			cfg.Logger.Warn("failed to receive job", "error", err, "retry", delay)
+			select {
+			case <-time.After(delay):
+				delay = min(delay*2, maxRetryDelay)
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+		delay = minRetryDelay
+
+		msg := d.Message()
+		logger := cfg.Logger.With("job", msg.ID)
+		start := time.Now()
+		jobErr := process(imageprocessor.WithLogger(ctx, logger), cfg, msg)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if jobErr != nil {
+			logger.Warn("job failed", "error", jobErr)
+		} else {
+			logger.Info("job done", "duration", time.Since(start))
+		}
+		// An unacknowledged job is handed out again, so only a fatal error
+		// stops the worker
+		if err := d.Ack(jobErr); errors.Is(err, ErrFatal) {
+			return fmt.Errorf("failed to acknowledge job %s: %w", msg.ID, err)
+		} else if err != nil {
+			logger.Warn("failed to acknowledge job", "error", err)
+		}
+	}
+}
+
+// process generates the outputs of one message and stores them with their
+// manifest under <destination>/<id>/. When the outputs are public, a
+// urls.json mapping each name to its public URL is stored last.
+func process(ctx context.Context, cfg Config, msg Message) error {
+	if msg.ID == "." || msg.ID == ".." || strings.ContainsAny(msg.ID, `/\`) {
+		return fmt.Errorf("job ID %q is not a valid directory name", msg.ID)
+	}
+	dims := cfg.Dimensions
+	if msg.Preset != "" {
+		var err error
+		if dims, err = imageprocessor.LoadPreset(msg.Preset); err != nil {
+			return err
+		}
+	}
+	if len(msg.Tags) > 0 {
+		dims = imageprocessor.SelectTags(dims, msg.Tags)
+	}
+	dest := msg.Destination
+	if dest == "" {
+		dest = cfg.Destination
+	}
+	if dest == "" {
+		return errors.New("no destination for the outputs")
+	}
+	// The worker's public URL only applies to the worker's destination
+	publicURL := msg.PublicURL
+	if publicURL == "" && msg.Destination == "" {
+		publicURL = cfg.PublicURL
+	}
+	if publicURL == "" && isURL(dest) {
+		publicURL = dest
+	}
+
+	workDir, err := os.MkdirTemp("", "logo-generator-worker-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	source := msg.Source
+	if isURL(source) {
+		source = filepath.Join(workDir, "source")
+		if err := download(ctx, msg.Source, source); err != nil {
+			return err
+		}
+	}
+
+	store, err := storage.Open(ctx, dest)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// Outputs are uploaded as they are written, and the files listing them
+	// once they are all in place
+	opts := cfg.Options
+	opts.Upload = func(ctx context.Context, out imageprocessor.OutputResult, data []byte) error {
+		return store.Put(ctx, msg.ID+"/"+out.Dimension.Name, data)
+	}
+	outputDir := filepath.Join(workDir, "output")
+	result, err := imageprocessor.ProcessImage(ctx, source, outputDir, dims, opts)
+	if err != nil {
+		return err
+	}
+	result.Source = msg.Source
+	if err := result.WriteManifest(filepath.Join(outputDir, "manifest.json")); err != nil {
+		return err
+	}
+
+	names := []string{"manifest.json"}
+	if publicURL != "" {
+		var outputs []string
+		for _, out := range result.Outputs {
+			if out.Status.Succeeded() {
+				outputs = append(outputs, out.Dimension.Name)
+			}
+		}
+		if err := writeURLs(filepath.Join(outputDir, "urls.json"), publicURL, msg.ID, outputs); err != nil {
+			return err
+		}
+		names = append(names, "urls.json")
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			return err
+		}
+		if err := store.Put(ctx, msg.ID+"/"+name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeURLs writes the JSON object mapping the output names to their public
+// URLs under base/id/. Keys are sorted, so the document only changes when
+// the outputs do, as infrastructure-as-code data sources expect.
+func writeURLs(path, base, id string, names []string) error {
+	urls := make(map[string]string, len(names))
+	for _, name := range names {
+		urls[name] = strings.TrimSuffix(base, "/") + "/" + url.PathEscape(id) + "/" + url.PathEscape(name)
+	}
+	data, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// isURL reports whether s is an http or https URL rather than a path.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// download fetches url into path, up to the size sources may have.
+func download(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download source: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download source: %s", resp.Status)
+	}
+
+	// Larger sources would be refused when they are read, so stop there
+	limit := imageprocessor.DefaultDecodeLimits.MaxBytes
+	tooLarge := fmt.Errorf("failed to download source: %w: image is larger than %s", imageprocessor.ErrLimitExceeded, imageprocessor.FormatBytes(limit))
+	if resp.ContentLength > limit {
+		return tooLarge
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("failed to download source: %w", err)
+	}
+	if n > limit {
+		return tooLarge
+	}
+	return f.Close()
+}
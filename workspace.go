@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/drewalth/logo-generator/imageprocessor"
+)
+
+// workspace lists the projects generated together by the workspace command.
+type workspace struct {
+	Comment  string             `json:"$comment,omitempty"`
+	Projects []workspaceProject `json:"projects"`
+}
+
+// workspaceProject is one project of a workspace. Paths are relative to the
+// workspace file.
+type workspaceProject struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Output string `json:"output"`
+	// Config and Preset select the dimensions like -config and -preset;
+	// without either the default preset is generated.
+	Config  string            `json:"config,omitempty"`
+	Preset  string            `json:"preset,omitempty"`
+	Profile string            `json:"profile,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Vars    map[string]string `json:"vars,omitempty"`
+}
+
+// loadWorkspace reads a workspace file, resolving the project paths.
+func loadWorkspace(path string) (*workspace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ws workspace
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ws); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(ws.Projects) == 0 {
+		return nil, fmt.Errorf("%s lists no projects", path)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	seen := map[string]bool{}
+	for i := range ws.Projects {
+		p := &ws.Projects[i]
+		switch {
+		case p.Name == "":
+			return nil, fmt.Errorf("%s: project %d has no name", path, i+1)
+		case seen[p.Name]:
+			return nil, fmt.Errorf("%s: project %s is listed twice", path, p.Name)
+		case p.Source == "" || p.Output == "":
+			return nil, fmt.Errorf("%s: project %s needs a source and an output", path, p.Name)
+		case p.Config != "" && p.Preset != "":
+			return nil, fmt.Errorf("%s: project %s sets both config and preset", path, p.Name)
+		case p.Profile != "" && p.Config == "":
+			return nil, fmt.Errorf("%s: project %s sets a profile without a config", path, p.Name)
+		}
+		seen[p.Name] = true
+		p.Source, p.Output, p.Config = resolve(p.Source), resolve(p.Output), resolve(p.Config)
+	}
+	return &ws, nil
+}
+
+// dimensions returns the project's dimensions and profile.
+func (p *workspaceProject) dimensions() ([]imageprocessor.Dimension, imageprocessor.Profile, error) {
+	dims := imageprocessor.DefaultDimensions
+	var profile imageprocessor.Profile
+	switch {
+	case p.Config != "":
+		cfg, err := imageprocessor.LoadConfig(p.Config, p.Vars)
+		if err != nil {
+			return nil, profile, err
+		}
+		if profile, err = cfg.Profile(p.Profile); err != nil {
+			return nil, profile, err
+		}
+		dims = cfg.Dimensions
+	case p.Preset != "":
+		dims = nil
+		for _, name := range strings.Split(p.Preset, ",") {
+			preset, err := imageprocessor.LoadPreset(name)
+			if err != nil {
+				return nil, profile, err
+			}
+			dims = append(dims, preset...)
+		}
+	}
+	dims = imageprocessor.SelectWhen(dims, imageprocessor.HostEnvironment(p.Profile))
+	return imageprocessor.SelectTags(dims, p.Tags), profile, nil
+}
+
+// runWorkspace generates every project of a workspace file in one run and
+// prints a combined summary. A failing project does not stop the others.
+func runWorkspace(args []string) {
+	fs := flag.NewFlagSet("workspace", flag.ExitOnError)
+	path := fs.String("workspace", "logo-generator.workspace.json", "workspace file listing the projects")
+	only := fs.String("projects", "", "comma separated projects to generate; defaults to all")
+	manifestName := fs.String("manifest", "manifest.json", "name of the manifest written to each output directory; empty disables it")
+	dedupe := fs.Bool("dedupe", false, "skip projects whose source duplicates the source of an earlier project generated the same way")
+	dedupeDistance := fs.Int("dedupe-distance", imageprocessor.DefaultMaxHashDistance, "perceptual hash bits up to which sources count as near-identical duplicates; -1 matches identical pixels only")
+	options := processorFlags(fs)
+	logs := loggingFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		log.Fatal("Usage: logo-generator workspace [-workspace <file>] [-projects <names>]")
+	}
+	ws, err := loadWorkspace(*path)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	projects := ws.Projects
+	if *only != "" {
+		names := strings.Split(*only, ",")
+		for _, name := range names {
+			if !slices.ContainsFunc(projects, func(p workspaceProject) bool { return p.Name == name }) {
+				log.Fatalf("Error: unknown project %q\n", name)
+			}
+		}
+		projects = slices.DeleteFunc(projects, func(p workspaceProject) bool { return !slices.Contains(names, p.Name) })
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logger, closeLog := logs.logger(slog.LevelWarn)
+	defer closeLog()
+	opts := options()
+
+	// Load every config first, so a broken one fails before anything is written
+	dims := make([][]imageprocessor.Dimension, len(projects))
+	profiles := make([]imageprocessor.Profile, len(projects))
+	for i := range projects {
+		if dims[i], profiles[i], err = projects[i].dimensions(); err != nil {
+			log.Fatalf("Error: project %s: %v\n", projects[i].Name, err)
+		}
+	}
+
+	// Report copies of the same artwork, which messy asset folders collect
+	dups := findDuplicates(projects, *dedupeDistance)
+	if len(dups) > 0 && !logs.quiet {
+		printDuplicates(projects, dups, *dedupe)
+	}
+
+	start := time.Now()
+	results := make([]*imageprocessor.Result, len(projects))
+	errs := make([]error, len(projects))
+	for i, p := range projects {
+		if ctx.Err() != nil {
+			errs[i] = imageprocessor.ErrCanceled
+			continue
+		}
+		if _, ok := dups[i]; ok && *dedupe {
+			continue
+		}
+		projectOpts := opts
+		projectOpts.Watermark = profiles[i].Watermark
+		projectCtx := imageprocessor.WithLogger(ctx, logger.With("project", p.Name))
+		results[i], errs[i] = imageprocessor.ProcessImage(projectCtx, p.Source, p.Output, dims[i], projectOpts)
+		if errs[i] == nil && *manifestName != "" {
+			errs[i] = results[i].WriteManifest(filepath.Join(p.Output, *manifestName))
+		}
+	}
+
+	if !logs.quiet {
+		printWorkspaceSummary(projects, results, errs, time.Since(start))
+	}
+	if err := errors.Join(errs...); err != nil {
+		failed := 0
+		for i, err := range errs {
+			if err != nil {
+				failed++
+				log.Printf("Error: project %s: %v\n", projects[i].Name, err)
+			}
+		}
+		log.Fatalf("Error: %d of %d projects failed\n", failed, len(projects))
+	}
+}
+
+// printWorkspaceSummary prints one line per project followed by the totals.
+func printWorkspaceSummary(projects []workspaceProject, results []*imageprocessor.Result, errs []error, elapsed time.Duration) {
+	var generated, unchanged, outputs int
+	var written int64
+	for i, p := range projects {
+		status := "ok"
+		if errs[i] != nil {
+			status = "failed"
+		}
+		r := results[i]
+		if r == nil {
+			if errs[i] == nil {
+				status = "skipped"
+			}
+			fmt.Printf("  %-7s %-24s\n", status, p.Name)
+			continue
+		}
+		fmt.Printf("  %-7s %-24s %4d generated %4d unchanged %10s %8s  %s\n", status, p.Name,
+			r.Count(imageprocessor.StatusGenerated), r.Count(imageprocessor.StatusUnchanged),
+			imageprocessor.FormatBytes(r.BytesWritten()), r.Duration.Round(time.Millisecond), p.Output)
+		generated += r.Count(imageprocessor.StatusGenerated)
+		unchanged += r.Count(imageprocessor.StatusUnchanged)
+		outputs += len(r.Outputs)
+		written += r.BytesWritten()
+	}
+	fmt.Printf("Generated %d of %d images (%s, %d unchanged) across %d projects in %s\n",
+		generated, outputs, imageprocessor.FormatBytes(written), unchanged, len(projects), elapsed.Round(time.Millisecond))
+}
+
+// printDuplicates lists the projects whose source duplicates an earlier
+// project's, and whether they are skipped.
+func printDuplicates(projects []workspaceProject, dups map[int]duplicate, skipped bool) {
+	fmt.Println("Duplicate sources:")
+	for i, p := range projects {
+		d, ok := dups[i]
+		if !ok {
+			continue
+		}
+		of := projects[d.Of]
+		fmt.Printf("  %s (%s) duplicates %s (%s): %s\n", p.Name, p.Source, of.Name, of.Source, d)
+	}
+	if skipped {
+		fmt.Println("Only the first project of each group is generated.")
+	} else {
+		fmt.Println("Run with -dedupe to generate only the first project of each group.")
+	}
+}